@@ -6,6 +6,7 @@ export interface Model {
     parentId: number;
     structName: string;
     queryTime: string;
+    audit: string;
     databaseName: string;
     nickname: string;
 }
@@ -29,6 +29,7 @@ export default {
   'modelDialogForm.structName.prompt': '请输入模块名称',
   'modelDialogForm.queryTime': '时间查询',
   'modelDialogForm.queryTime.prompt': '请选择时间',
+  'modelDialogForm.audit': '变更审计',
   'modelDialogForm.databaseName': '数据库',
   'modelDialogForm.databaseName.prompt': '请选择数据库',
   'modelDialogForm.nickname': '模块昵称',
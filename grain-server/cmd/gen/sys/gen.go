@@ -34,6 +34,18 @@ func Gen() {
 		sysModel.Models{},
 		sysModel.Fields{},
 		sysModel.Organize{},
+		sysModel.SysAudit{},
+		sysModel.SysSms{},
+		sysModel.SysMail{},
+		sysModel.UploadBlob{},
+		sysModel.UploadVariant{},
+		sysModel.UploadQuota{},
+		sysModel.UploadUserUsage{},
+		sysModel.SysMessage{},
+		sysModel.SysNotification{},
+		sysModel.SysAnnouncement{},
+		sysModel.SysJob{},
+		sysModel.SysJobLog{},
 	)
 }
 
@@ -18,8 +18,8 @@ import (
 	_ "embed"
 	"errors"
 	"flag"
-	"fmt"
 	"github.com/fsnotify/fsnotify"
+	"github.com/go-grain/grain/log"
 	"github.com/go-grain/grain/pkg/encoding/json"
 	"github.com/spf13/viper"
 	"go.uber.org/zap/zapcore"
@@ -49,21 +49,247 @@ type SysEmail struct {
 	EmailPort     int    `mapstructure:"email_port" json:"email_port" yaml:"email_port"`
 	EmailUsername string `mapstructure:"email_username" json:"email_username" yaml:"email_username"`
 	EmailPassword string `mapstructure:"email_password" json:"email_password" yaml:"email_password"`
+	// 邮件模板目录, 目录中的同名模板会覆盖内置模板
+	TemplateDir string `mapstructure:"template_dir" json:"template_dir" yaml:"template_dir"`
+	// 发信并发数, 即 mail 队列的并发数
+	Workers int `mapstructure:"workers" json:"workers" yaml:"workers"`
+	// 最大尝试次数, 超过后进入死信列表
+	MaxAttempts int `mapstructure:"max_attempts" json:"max_attempts" yaml:"max_attempts"`
+	// 重试基础间隔 单位秒, 按 2 的指数退避
+	RetryInterval int `mapstructure:"retry_interval" json:"retry_interval" yaml:"retry_interval"`
+}
+
+type Captcha struct {
+	// 是否在 Routes 配置的接口上强制校验图形/滑块验证码
+	Enable bool `mapstructure:"enable" json:"enable" yaml:"enable"`
+	// 需要校验的接口 格式为 "POST /api/v1/sysUser/login"
+	Routes []string `mapstructure:"routes" json:"routes" yaml:"routes"`
+	// 挑战有效期 单位秒
+	Expire int `mapstructure:"expire" json:"expire" yaml:"expire"`
+	// 数字验证码长度以及图片尺寸
+	Length int `mapstructure:"length" json:"length" yaml:"length"`
+	Width  int `mapstructure:"width" json:"width" yaml:"width"`
+	Height int `mapstructure:"height" json:"height" yaml:"height"`
+
+	Slider struct {
+		Width  int `mapstructure:"width" json:"width" yaml:"width"`
+		Height int `mapstructure:"height" json:"height" yaml:"height"`
+		// 拼图块边长
+		Size int `mapstructure:"size" json:"size" yaml:"size"`
+		// 允许的误差像素
+		Tolerance int `mapstructure:"tolerance" json:"tolerance" yaml:"tolerance"`
+	} `mapstructure:"slider" json:"slider" yaml:"slider"`
+}
+
+type SmsTemplate struct {
+	// 服务商侧的模板编号
+	Code string `mapstructure:"code" json:"code" yaml:"code"`
+	// 模板正文 text/template 语法
+	Content string `mapstructure:"content" json:"content" yaml:"content"`
+}
+
+type Sms struct {
+	// 短信渠道 console file http
+	Driver   string `mapstructure:"driver" json:"driver" yaml:"driver"`
+	SignName string `mapstructure:"sign_name" json:"sign_name" yaml:"sign_name"`
+	// 每个手机号每天最多发送条数 0表示不限制
+	DailyLimit int                    `mapstructure:"daily_limit" json:"daily_limit" yaml:"daily_limit"`
+	Templates  map[string]SmsTemplate `mapstructure:"templates" json:"templates" yaml:"templates"`
+
+	File struct {
+		Path string `mapstructure:"path" json:"path" yaml:"path"`
+	} `mapstructure:"file" json:"file" yaml:"file"`
+
+	Http struct {
+		URL     string        `mapstructure:"url" json:"url" yaml:"url"`
+		Token   string        `mapstructure:"token" json:"token" yaml:"token"`
+		Timeout time.Duration `mapstructure:"timeout" json:"timeout" yaml:"timeout"`
+	} `mapstructure:"http" json:"http" yaml:"http"`
 }
 
 type Log struct {
-	Level     zapcore.Level `mapstructure:"level" json:"level" yaml:"level"`
-	LogPath   string        `mapstructure:"log_path" json:"log_path" yaml:"log_path"`
-	SplitSize int           `mapstructure:"split_size" json:"split_size" yaml:"split_size"`
+	// 日志格式 text 为 key=value 文本, json 为每行一个 JSON 对象, zap 使用 zap 的 JSON 编码输出
+	Format  string        `mapstructure:"format" json:"format" yaml:"format"`
+	Level   zapcore.Level `mapstructure:"level" json:"level" yaml:"level"`
+	LogPath string        `mapstructure:"log_path" json:"log_path" yaml:"log_path"`
+	// 单个日志文件的最大体积, 单位 MB, 0 表示不按大小切割
+	SplitSize int `mapstructure:"split_size" json:"split_size" yaml:"split_size"`
+	// 按时间切割的周期, 例如 24h 表示每天零点切割, 0 表示不按时间切割
+	SplitTime time.Duration `mapstructure:"split_time" json:"split_time" yaml:"split_time"`
+	// 最多保留的归档文件数量, 0 表示不限制
+	MaxBackups int `mapstructure:"max_backups" json:"max_backups" yaml:"max_backups"`
+	// 归档文件最多保留的天数, 0 表示不限制
+	MaxAge int `mapstructure:"max_age" json:"max_age" yaml:"max_age"`
+	// 是否使用 gzip 压缩归档文件
+	Compress bool `mapstructure:"compress" json:"compress" yaml:"compress"`
+}
+
+type Telemetry struct {
+	// 链路追踪导出方式 otlp 通过 OTLP/HTTP 上报, stdout 打印到控制台, none 不导出
+	Exporter string `mapstructure:"exporter" json:"exporter" yaml:"exporter"`
+	// OTLP 接收地址, 例如 localhost:4318
+	Endpoint string `mapstructure:"endpoint" json:"endpoint" yaml:"endpoint"`
+	// 是否使用 http 而不是 https 上报
+	Insecure bool `mapstructure:"insecure" json:"insecure" yaml:"insecure"`
+	// 上报时附带的请求头, 例如鉴权 token
+	Headers map[string]string `mapstructure:"headers" json:"headers" yaml:"headers"`
+	// 采样率 0 到 1, 上游已经决定采样的请求沿用上游的结果
+	SampleRatio float64 `mapstructure:"sample_ratio" json:"sample_ratio" yaml:"sample_ratio"`
+	// 服务名称, 为空时使用 system.site_name
+	ServiceName string `mapstructure:"service_name" json:"service_name" yaml:"service_name"`
+}
+
+type Health struct {
+	// 单个依赖检查的超时时间
+	Timeout time.Duration `mapstructure:"timeout" json:"timeout" yaml:"timeout"`
+	// 是否检查 SMTP 连通性, 属于可选检查, 失败不影响就绪状态
+	Smtp bool `mapstructure:"smtp" json:"smtp" yaml:"smtp"`
+}
+
+type Monitor struct {
+	// 运行监控采样间隔
+	Interval time.Duration `mapstructure:"interval" json:"interval" yaml:"interval"`
+	// 内存中保留的采样条数, 默认 120 条, 按 5 秒间隔约 10 分钟
+	Size int `mapstructure:"size" json:"size" yaml:"size"`
+}
+
+type Metrics struct {
+	// 是否开启 Prometheus 指标接口
+	Enable bool `mapstructure:"enable" json:"enable" yaml:"enable"`
+	// 独立监听地址, 默认 127.0.0.1:9090, 为空时挂在 gin.host 上, 此时必须配置 token
+	Listen string `mapstructure:"listen" json:"listen" yaml:"listen"`
+	// 指标接口路径
+	Path string `mapstructure:"path" json:"path" yaml:"path"`
+	// 访问令牌, 不为空时需要携带请求头 Authorization: Bearer <token>
+	Token string `mapstructure:"token" json:"token" yaml:"token"`
+}
+
+type Websocket struct {
+	// 每个连接待发送消息的缓冲数, 写满后断开慢速连接
+	SendBuffer int `mapstructure:"send_buffer" json:"send_buffer" yaml:"send_buffer"`
+	// 客户端单条消息的最大字节数
+	MaxMessageSize int64 `mapstructure:"max_message_size" json:"max_message_size" yaml:"max_message_size"`
+	// 心跳间隔, 需要小于 pong_wait
+	PingInterval time.Duration `mapstructure:"ping_interval" json:"ping_interval" yaml:"ping_interval"`
+	// 超过该时间没有收到客户端心跳或消息则断开
+	PongWait time.Duration `mapstructure:"pong_wait" json:"pong_wait" yaml:"pong_wait"`
+	// 允许的来源, 为空时只允许同源, * 允许所有来源
+	AllowedOrigins []string `mapstructure:"allowed_origins" json:"allowed_origins" yaml:"allowed_origins"`
+}
+
+type CronJob struct {
+	// cron 表达式, 为空时使用代码注册时的默认值
+	Spec string `mapstructure:"spec" json:"spec" yaml:"spec"`
+	// 单次执行的超时时间, 为 0 时使用代码注册时的默认值
+	Timeout time.Duration `mapstructure:"timeout" json:"timeout" yaml:"timeout"`
+}
+
+type Cron struct {
+	// 是否开启定时任务, 关闭后不调度, 也不能手动执行
+	Enable bool `mapstructure:"enable" json:"enable" yaml:"enable"`
+	// 没有设置超时时间的任务的默认超时
+	Timeout time.Duration `mapstructure:"timeout" json:"timeout" yaml:"timeout"`
+	// 操作日志以及任务执行记录保留天数, 0 表示不清理
+	LogRetention int `mapstructure:"log_retention" json:"log_retention" yaml:"log_retention"`
+	// 软删除的数据在回收站中保留的天数, 超过后彻底删除, 0 表示不清理
+	RecycleRetention int `mapstructure:"recycle_retention" json:"recycle_retention" yaml:"recycle_retention"`
+	// 按任务名称覆盖表达式以及超时时间
+	Jobs map[string]CronJob `mapstructure:"jobs" json:"jobs" yaml:"jobs"`
+}
+
+type Queue struct {
+	// 是否在本实例处理后台任务, 关闭后仍然可以投递, 由其他开启的实例处理
+	Enable bool `mapstructure:"enable" json:"enable" yaml:"enable"`
+	// 每个队列的并发数, mail 队列使用 email.workers
+	Concurrency map[string]int `mapstructure:"concurrency" json:"concurrency" yaml:"concurrency"`
+	// 队列为空时的轮询间隔
+	PollInterval time.Duration `mapstructure:"poll_interval" json:"poll_interval" yaml:"poll_interval"`
+	// 任务租约, worker 异常退出后超过该时间任务重新入队
+	Lease time.Duration `mapstructure:"lease" json:"lease" yaml:"lease"`
+	// 没有设置超时时间的任务的默认超时
+	Timeout time.Duration `mapstructure:"timeout" json:"timeout" yaml:"timeout"`
+	// 死信保留天数
+	DeadRetention int `mapstructure:"dead_retention" json:"dead_retention" yaml:"dead_retention"`
 }
 
 type Server struct {
 	FileDomain string `mapstructure:"file_domain" json:"file_domain" yaml:"file_domain"`
 }
 
+type Storage struct {
+	// 存储驱动 local 本地磁盘 s3 S3 兼容的对象存储
+	Driver string `mapstructure:"driver" json:"driver" yaml:"driver"`
+	// 临时访问地址的有效期
+	PresignExpire time.Duration `mapstructure:"presign_expire" json:"presign_expire" yaml:"presign_expire"`
+	// 分片上传的分片大小 字节, 以及未完成的上传会话保留多久
+	ChunkSize   int64         `mapstructure:"chunk_size" json:"chunk_size" yaml:"chunk_size"`
+	ChunkExpire time.Duration `mapstructure:"chunk_expire" json:"chunk_expire" yaml:"chunk_expire"`
+
+	Local struct {
+		// 存储根目录
+		Root string `mapstructure:"root" json:"root" yaml:"root"`
+		// 根目录对外的访问地址, 为空时使用 server.file_domain + /uploads
+		BaseURL string `mapstructure:"base_url" json:"base_url" yaml:"base_url"`
+		// 临时访问地址以及签名下载地址的密钥, 为空时使用 jwt.secret_key
+		Secret string `mapstructure:"secret" json:"secret" yaml:"secret"`
+	} `mapstructure:"local" json:"local" yaml:"local"`
+
+	S3 struct {
+		Endpoint  string `mapstructure:"endpoint" json:"endpoint" yaml:"endpoint"`
+		Region    string `mapstructure:"region" json:"region" yaml:"region"`
+		Bucket    string `mapstructure:"bucket" json:"bucket" yaml:"bucket"`
+		AccessKey string `mapstructure:"access_key" json:"access_key" yaml:"access_key"`
+		SecretKey string `mapstructure:"secret_key" json:"secret_key" yaml:"secret_key"`
+		// MinIO 等自建服务使用路径风格
+		PathStyle bool `mapstructure:"path_style" json:"path_style" yaml:"path_style"`
+		// 公开访问地址 例如 CDN 域名, 为空时使用 endpoint
+		BaseURL string        `mapstructure:"base_url" json:"base_url" yaml:"base_url"`
+		Timeout time.Duration `mapstructure:"timeout" json:"timeout" yaml:"timeout"`
+	} `mapstructure:"s3" json:"s3" yaml:"s3"`
+}
+
+type UploadPolicy struct {
+	// 文件大小上限 字节, 0 表示不限制
+	MaxSize int64 `mapstructure:"max_size" json:"max_size" yaml:"max_size"`
+	// 允许的 MIME 类型 按文件内容识别, 支持 image/* 这种写法, 为空表示不限制
+	AllowedMimes []string `mapstructure:"allowed_mimes" json:"allowed_mimes" yaml:"allowed_mimes"`
+	// 禁止的扩展名 不带点
+	ForbiddenExts []string `mapstructure:"forbidden_exts" json:"forbidden_exts" yaml:"forbidden_exts"`
+	// 是否重新编码图片去掉 EXIF 等元数据, 支持 jpeg png gif
+	Reencode bool `mapstructure:"reencode" json:"reencode" yaml:"reencode"`
+	// 上传后立即生成的图片规格, 配置之后上传的文件必须是可以解码的图片, 头像使用第一个规格
+	Variants []string `mapstructure:"variants" json:"variants" yaml:"variants"`
+}
+
+// ImagePreset 图片规格, 只会缩小不会放大
+type ImagePreset struct {
+	Width  int `mapstructure:"width" json:"width" yaml:"width"`
+	Height int `mapstructure:"height" json:"height" yaml:"height"`
+	// cover 等比缩放后居中裁剪铺满 contain 等比缩放到宽高以内
+	Fit string `mapstructure:"fit" json:"fit" yaml:"fit"`
+	// 输出格式 jpeg png, 为空时保持原格式 gif 输出为 png
+	Format string `mapstructure:"format" json:"format" yaml:"format"`
+	// jpeg 质量 1-100
+	Quality int `mapstructure:"quality" json:"quality" yaml:"quality"`
+}
+
+type Upload struct {
+	// 按 classify 配置的上传策略, 例如 avatar file, 没有单独配置的使用 default
+	Policies map[string]UploadPolicy `mapstructure:"policies" json:"policies" yaml:"policies"`
+	// 图片规格, 访问图片时通过 preset 参数获取, 生成后缓存在存储中
+	Presets map[string]ImagePreset `mapstructure:"presets" json:"presets" yaml:"presets"`
+
+	Quota struct {
+		// 没有配置角色以及用户配额时的默认配额 字节, 0 表示不限制
+		Default int64 `mapstructure:"default" json:"default" yaml:"default"`
+	} `mapstructure:"quota" json:"quota" yaml:"quota"`
+}
+
 type Gin struct {
 	Host  string `mapstructure:"host" json:"host" yaml:"host"`
 	Model string `mapstructure:"model" json:"model" yaml:"model"`
+	// 收到退出信号后等待进行中的请求以及定时任务结束的最长时间
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout" json:"shutdown_timeout" yaml:"shutdown_timeout"`
 }
 
 type DataBase struct {
@@ -86,12 +312,40 @@ type DataBase struct {
 	} `mapstructure:"sqlite" json:"sqlite" yaml:"sqlite"`
 
 	Redis struct {
-		UserName     string        `mapstructure:"user_name" json:"user_name" yaml:"user_name"`
-		Password     string        `mapstructure:"password" json:"password" yaml:"password"`
-		Addr         string        `mapstructure:"addr" json:"addr" yaml:"addr"`
-		DB           int           `mapstructure:"db" json:"db" yaml:"db"`
+		// 部署模式 standalone 单机 sentinel 哨兵 cluster 集群, 为空时为 standalone
+		Mode     string `mapstructure:"mode" json:"mode" yaml:"mode"`
+		UserName string `mapstructure:"user_name" json:"user_name" yaml:"user_name"`
+		Password string `mapstructure:"password" json:"password" yaml:"password"`
+		// 单机模式的地址
+		Addr string `mapstructure:"addr" json:"addr" yaml:"addr"`
+		// 哨兵模式的哨兵地址, 集群模式的任意几个节点地址
+		Addrs []string `mapstructure:"addrs" json:"addrs" yaml:"addrs"`
+		// 哨兵模式的主节点名称以及哨兵自身的认证信息
+		MasterName       string `mapstructure:"master_name" json:"master_name" yaml:"master_name"`
+		SentinelUserName string `mapstructure:"sentinel_user_name" json:"sentinel_user_name" yaml:"sentinel_user_name"`
+		SentinelPassword string `mapstructure:"sentinel_password" json:"sentinel_password" yaml:"sentinel_password"`
+		// 集群模式只支持 0
+		DB int `mapstructure:"db" json:"db" yaml:"db"`
+		// 每个节点的最大连接数以及最少空闲连接数, 0 表示使用默认值 CPU 核数 * 10
+		PoolSize     int `mapstructure:"pool_size" json:"pool_size" yaml:"pool_size"`
+		MinIdleConns int `mapstructure:"min_idle_conns" json:"min_idle_conns" yaml:"min_idle_conns"`
+		// 连接池满时等待空闲连接的时间
+		PoolTimeout  time.Duration `mapstructure:"pool_timeout" json:"pool_timeout" yaml:"pool_timeout"`
+		DialTimeout  time.Duration `mapstructure:"dial_timeout" json:"dial_timeout" yaml:"dial_timeout"`
 		ReadTimeout  time.Duration `mapstructure:"read_timeout" json:"read_timeout" yaml:"read_timeout"`
 		WriteTimeout time.Duration `mapstructure:"write_timeout" json:"write_timeout" yaml:"write_timeout"`
+
+		TLS struct {
+			Enable bool `mapstructure:"enable" json:"enable" yaml:"enable"`
+			// 自签名证书的 CA, 为空时使用系统证书
+			CAFile string `mapstructure:"ca_file" json:"ca_file" yaml:"ca_file"`
+			// 服务端要求客户端证书时配置
+			CertFile string `mapstructure:"cert_file" json:"cert_file" yaml:"cert_file"`
+			KeyFile  string `mapstructure:"key_file" json:"key_file" yaml:"key_file"`
+			// 证书中的域名和连接地址不一致时指定
+			ServerName         string `mapstructure:"server_name" json:"server_name" yaml:"server_name"`
+			InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify" json:"insecure_skip_verify" yaml:"insecure_skip_verify"`
+		} `mapstructure:"tls" json:"tls" yaml:"tls"`
 	} `yaml:"redis"`
 
 	Mongo struct {
@@ -105,14 +359,47 @@ type JWT struct {
 	Issuer            string `mapstructure:"issuer" json:"issuer" yaml:"issuer"`
 }
 
+type RateLimitRule struct {
+	// 限流算法 sliding_window 滑动窗口 token_bucket 令牌桶
+	Algorithm string `mapstructure:"algorithm" json:"algorithm" yaml:"algorithm"`
+	// 限流维度 ip uid role api_key, 取不到 uid/role/api_key 时按 ip 限流
+	KeyBy string `mapstructure:"key_by" json:"key_by" yaml:"key_by"`
+	// Window 时间内最多允许的请求数 令牌桶为桶容量
+	Limit int64 `mapstructure:"limit" json:"limit" yaml:"limit"`
+	// 时间窗口 令牌桶为补满令牌需要的时间
+	Window time.Duration `mapstructure:"window" json:"window" yaml:"window"`
+	// 只对分组内的这些接口限流 格式为 "POST /api/v1/sysUser/login", 为空时限制整个分组
+	Routes []string `mapstructure:"routes" json:"routes" yaml:"routes"`
+}
+
+type RateLimit struct {
+	Enable bool `mapstructure:"enable" json:"enable" yaml:"enable"`
+	// key_by 为 api_key 时读取的请求头
+	ApiKeyHeader string `mapstructure:"api_key_header" json:"api_key_header" yaml:"api_key_header"`
+	// 按路由分组配置的限流规则, 分组名由 middleware.RateLimit 指定
+	Groups map[string]RateLimitRule `mapstructure:"groups" json:"groups" yaml:"groups"`
+}
+
 type Config struct {
-	Gin      Gin      `mapstructure:"gin" json:"gin" yaml:"gin"`
-	System   System   `mapstructure:"system" json:"system" yaml:"system"`
-	SysEmail SysEmail `mapstructure:"email" json:"email" yaml:"email"`
-	Log      Log      `mapstructure:"log" json:"log" yaml:"log"`
-	Server   Server   `mapstructure:"server" json:"server" yaml:"server"`
-	DataBase DataBase `mapstructure:"database" json:"database" yaml:"database"`
-	JWT      JWT      `mapstructure:"jwt" json:"jwt" yaml:"jwt"`
+	Gin       Gin       `mapstructure:"gin" json:"gin" yaml:"gin"`
+	System    System    `mapstructure:"system" json:"system" yaml:"system"`
+	SysEmail  SysEmail  `mapstructure:"email" json:"email" yaml:"email"`
+	Sms       Sms       `mapstructure:"sms" json:"sms" yaml:"sms"`
+	Captcha   Captcha   `mapstructure:"captcha" json:"captcha" yaml:"captcha"`
+	RateLimit RateLimit `mapstructure:"rate_limit" json:"rate_limit" yaml:"rate_limit"`
+	Storage   Storage   `mapstructure:"storage" json:"storage" yaml:"storage"`
+	Upload    Upload    `mapstructure:"upload" json:"upload" yaml:"upload"`
+	Log       Log       `mapstructure:"log" json:"log" yaml:"log"`
+	Telemetry Telemetry `mapstructure:"telemetry" json:"telemetry" yaml:"telemetry"`
+	Metrics   Metrics   `mapstructure:"metrics" json:"metrics" yaml:"metrics"`
+	Health    Health    `mapstructure:"health" json:"health" yaml:"health"`
+	Monitor   Monitor   `mapstructure:"monitor" json:"monitor" yaml:"monitor"`
+	Websocket Websocket `mapstructure:"websocket" json:"websocket" yaml:"websocket"`
+	Cron      Cron      `mapstructure:"cron" json:"cron" yaml:"cron"`
+	Queue     Queue     `mapstructure:"queue" json:"queue" yaml:"queue"`
+	Server    Server    `mapstructure:"server" json:"server" yaml:"server"`
+	DataBase  DataBase  `mapstructure:"database" json:"database" yaml:"database"`
+	JWT       JWT       `mapstructure:"jwt" json:"jwt" yaml:"jwt"`
 }
 
 func GetConfig() *Config {
@@ -123,7 +410,7 @@ func SetKey(key string, value interface{}) error {
 	xViper.Set(key, value)
 	err := xViper.WriteConfig()
 	if err != nil {
-		fmt.Printf("Failed to write config file: %s", err)
+		log.Errorf("Failed to write config file: %s", err)
 		return err
 	}
 	return nil
@@ -170,13 +457,13 @@ func InitConfig() (*Config, error) {
 	conf.WatchConfig()
 
 	conf.OnConfigChange(func(e fsnotify.Event) {
-		fmt.Println("配置文件已更改: ", e.Name)
+		log.Info("配置文件已更改: ", e.Name)
 		if err = conf.Unmarshal(&v); err != nil {
-			fmt.Println(err)
+			log.Error(err)
 		}
 	})
 	if err = conf.Unmarshal(&v); err != nil {
-		fmt.Println(err)
+		log.Error(err)
 	}
 
 	//为了push到github不暴露邮箱配置信息,放在别的地方解析过来,作为菜鸟的我,只能使用这种简单粗暴的方式实现了
@@ -0,0 +1,108 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"context"
+	"fmt"
+	repo "github.com/go-grain/grain/internal/repo/system"
+	service "github.com/go-grain/grain/internal/service/system"
+	cronx "github.com/go-grain/grain/pkg/cron"
+	"time"
+)
+
+// jobs 通过 RegisterJob 注册的自定义任务
+var jobs []cronx.Job
+
+// RegisterJob 注册自定义定时任务, 需要在 Run 之前调用,
+// 配置文件 cron.jobs 中可以按任务名称覆盖表达式以及超时时间
+func RegisterJob(job ...cronx.Job) {
+	jobs = append(jobs, job...)
+}
+
+// newJobs 定时任务调度, 注册内置任务以及自定义任务
+func newJobs(grain *Grain) (*service.SysJobService, error) {
+	conf := grain.conf.Cron
+	sv := service.NewSysJobService(repo.NewSysJobRepo(), grain.rdb, grain.conf, grain.sysLog)
+	mail := service.NewMailService(repo.NewMailRepo(), grain.tasks, grain.rdb, grain.conf, grain.sysLog)
+	upload := service.NewUploadService(repo.NewUploadRepo(grain.rdb), grain.storage, grain.rdb, grain.conf, grain.sysLog, grain.enforcer)
+
+	builtin := []cronx.Job{
+		{
+			Name:        "upload_session_sweep",
+			Spec:        "@every 1h",
+			Description: "清理过期的分片上传会话留在存储中的分片",
+			Run:         upload.SweepUploadSessions,
+		},
+		{
+			Name:        "upload_quota_reconcile",
+			Spec:        "0 3 * * *",
+			Description: "按上传记录重新统计每个用户的存储用量",
+			Timeout:     time.Hour,
+			Run:         upload.ReconcileUsage,
+		},
+		{
+			Name:        "mail_outbox_recover",
+			Spec:        "@every 1m",
+			Description: "把入队失败以及发送中断的邮件重新放入发信队列",
+			Timeout:     5 * time.Minute,
+			Run:         mail.RecoverOutbox,
+		},
+		{
+			Name:        "recycle_purge",
+			Spec:        "0 4 * * *",
+			Description: "彻底删除回收站中超过保留天数的数据",
+			Timeout:     30 * time.Minute,
+			Run: func(ctx context.Context) (string, error) {
+				return sv.PurgeDeleted(ctx, conf.RecycleRetention)
+			},
+		},
+	}
+
+	// 操作日志保存在 MongoDB 中, 没有配置时只清理任务执行记录
+	var sysLog *service.SysLogService
+	if grain.conf.DataBase.Mongo.URL != "" {
+		mongoDB, err := repo.NewMongoDBRepo(grain.rdb, grain.conf.DataBase.Mongo.URL, "grain", "sysLog")
+		if err != nil {
+			return nil, err
+		}
+		sysLog = service.NewSysLogService(mongoDB, grain.rdb, grain.conf, grain.sysLog)
+	}
+	builtin = append(builtin, cronx.Job{
+		Name:        "log_retention",
+		Spec:        "30 3 * * *",
+		Description: "删除超过保留天数的操作日志以及定时任务执行记录",
+		Timeout:     30 * time.Minute,
+		Run: func(ctx context.Context) (string, error) {
+			var logs int64
+			if sysLog != nil {
+				var err error
+				if logs, err = sysLog.PurgeSysLogs(ctx, conf.LogRetention); err != nil {
+					return "", err
+				}
+			}
+			runs, err := sv.PurgeJobLogs(ctx, conf.LogRetention)
+			return fmt.Sprintf("操作日志 %d 条, 执行记录 %d 条", logs, runs), err
+		},
+	})
+
+	if err := sv.Register(builtin...); err != nil {
+		return nil, err
+	}
+	if err := sv.Register(jobs...); err != nil {
+		return nil, err
+	}
+	return sv, nil
+}
@@ -0,0 +1,111 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/go-grain/grain/internal/repo/data"
+	healthx "github.com/go-grain/grain/pkg/health"
+	monitorx "github.com/go-grain/grain/pkg/monitor"
+	"net"
+)
+
+// newHealthChecker 注册就绪检查依赖, 检查函数在每次探测时执行
+func newHealthChecker(grain *Grain) *healthx.Checker {
+	conf := grain.conf
+	checker := healthx.New(conf.Health.Timeout)
+
+	checker.Add(healthx.Check{
+		Name: conf.DataBase.Driver,
+		Probe: func(ctx context.Context) error {
+			sqlDB, err := grain.db.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		},
+	}, healthx.Check{
+		Name: "redis",
+		Probe: func(ctx context.Context) error {
+			return data.GetRedis().Client.Ping(ctx).Err()
+		},
+	}, healthx.Check{
+		Name: "casbin",
+		Probe: func(ctx context.Context) error {
+			policy, err := grain.enforcer.GetPolicy()
+			if err != nil {
+				return err
+			}
+			if len(policy) == 0 {
+				return errors.New("权限策略未加载")
+			}
+			return nil
+		},
+	})
+
+	// 系统操作日志保存在 MongoDB
+	if conf.DataBase.Mongo.URL != "" {
+		checker.Add(healthx.Check{
+			Name: "mongo",
+			Probe: func(ctx context.Context) error {
+				client := data.GetMongo()
+				if client == nil {
+					return errors.New("MongoDB 未初始化")
+				}
+				return client.Ping(ctx, nil)
+			},
+		})
+	}
+
+	if conf.Health.Smtp {
+		checker.Add(healthx.Check{
+			Name:     "smtp",
+			Optional: true,
+			Probe: func(ctx context.Context) error {
+				addr := net.JoinHostPort(conf.SysEmail.EmailHost, fmt.Sprint(conf.SysEmail.EmailPort))
+				conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+				if err != nil {
+					return err
+				}
+				return conn.Close()
+			},
+		})
+	}
+	return checker
+}
+
+// newMonitor 运行监控, 统计上传目录和日志目录的磁盘占用
+func newMonitor(grain *Grain) *monitorx.Monitor {
+	conf := grain.conf
+	dirs := map[string]string{"log": conf.Log.LogPath}
+	if d := conf.Storage.Driver; d == "" || d == "local" {
+		dirs["uploads"] = conf.Storage.Local.Root
+	}
+	return monitorx.New(monitorx.Options{
+		Interval: conf.Monitor.Interval,
+		Size:     conf.Monitor.Size,
+		Dirs:     dirs,
+		DBStats: func() sql.DBStats {
+			sqlDB, err := grain.db.DB()
+			if err != nil {
+				return sql.DBStats{}
+			}
+			return sqlDB.Stats()
+		},
+	})
+}
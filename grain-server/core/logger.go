@@ -0,0 +1,138 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-grain/grain/config"
+	"github.com/go-grain/grain/internal/repo/data"
+	"github.com/go-grain/grain/log"
+	telemetryx "github.com/go-grain/grain/pkg/telemetry"
+	tracex "github.com/go-grain/grain/pkg/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// newLogger 按 log.format 创建系统日志, 写入 log_path 下的 grain.log, debug 模式下同时输出到控制台
+func newLogger(conf *config.Config) log.Logger {
+	var out io.Writer = data.NewLogWriter(conf.Log, "grain.log")
+	if conf.Gin.Model == "debug" {
+		out = io.MultiWriter(os.Stdout, out)
+	}
+
+	var logger log.Logger
+	switch conf.Log.Format {
+	case "json":
+		logger = log.NewJSONLogger(out)
+	case "zap":
+		encoder := zap.NewProductionEncoderConfig()
+		// 时间和调用位置由下面的 ts、caller 字段统一输出
+		encoder.TimeKey = ""
+		encoder.MessageKey = log.DefaultMessageKey
+		logger = log.NewZapLogger(zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(encoder), zapcore.AddSync(out), conf.Log.Level)))
+	default:
+		logger = log.NewStdLogger(out)
+	}
+
+	return log.NewFilter(log.With(logger,
+		"ts", log.DefaultTimestamp,
+		"caller", log.DefaultCaller,
+		"service.id", id,
+		"service.name", Name,
+		"service.version", Version,
+		"trace.id", tracex.TraceIDValuer(),
+		"span.id", tracex.SpanIDValuer(),
+		"request.id", tracex.RequestIDValuer(),
+		"user.uid", tracex.UIDValuer(),
+		"user.role", tracex.RoleValuer(),
+	), log.FilterLevel(logLevel(conf.Log.Level)))
+}
+
+// logLevel 把配置中的 zap 日志级别换算成 log.Level, 两者 debug 到 error 的取值一致
+func logLevel(level zapcore.Level) log.Level {
+	if level > zapcore.ErrorLevel {
+		return log.LevelFatal
+	}
+	return log.Level(level)
+}
+
+// accessLogRedactParams 访问日志中隐藏这些查询参数的值, 例如 WebSocket 握手时通过 ?token= 传递的令牌
+var accessLogRedactParams = []string{"token", "signature", "nonce"}
+
+// accessLogFormatter 与 gin 默认的访问日志格式一致, 末尾追加请求ID方便与业务日志关联
+func accessLogFormatter(param gin.LogFormatterParams) string {
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+	param.Path = redactQuery(param.Path)
+	return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v | %s\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		param.StatusCode,
+		param.Latency,
+		param.ClientIP,
+		param.Method,
+		param.Path,
+		param.Keys[tracex.RequestIDKey],
+		param.ErrorMessage,
+	)
+}
+
+// redactQuery 把路径中敏感查询参数的值替换为 redacted, 查询参数无法解析时整体去掉
+func redactQuery(path string) string {
+	i := strings.IndexByte(path, '?')
+	if i < 0 {
+		return path
+	}
+	query, err := url.ParseQuery(path[i+1:])
+	if err != nil {
+		return path[:i]
+	}
+	changed := false
+	for key := range query {
+		for _, name := range accessLogRedactParams {
+			if strings.EqualFold(key, name) {
+				query[key] = []string{"redacted"}
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return path
+	}
+	return path[:i+1] + query.Encode()
+}
+
+// newTelemetryOptions 把 telemetry 配置转换成链路追踪初始化参数
+func newTelemetryOptions(conf *config.Config) telemetryx.Options {
+	name := conf.Telemetry.ServiceName
+	if name == "" {
+		name = conf.System.SiteName
+	}
+	return telemetryx.Options{
+		ServiceName:    name,
+		ServiceVersion: Version,
+		Exporter:       conf.Telemetry.Exporter,
+		Endpoint:       conf.Telemetry.Endpoint,
+		Insecure:       conf.Telemetry.Insecure,
+		Headers:        conf.Telemetry.Headers,
+		SampleRatio:    conf.Telemetry.SampleRatio,
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"context"
+	"errors"
+	"github.com/go-grain/grain/internal/repo/data"
+	repo "github.com/go-grain/grain/internal/repo/system"
+	service "github.com/go-grain/grain/internal/service/system"
+	"github.com/go-grain/grain/log"
+	metricsx "github.com/go-grain/grain/pkg/metrics"
+	queuex "github.com/go-grain/grain/pkg/queue"
+	"time"
+)
+
+// tasks 通过 RegisterTask 注册的自定义任务处理函数
+var tasks = map[string]queuex.HandlerFunc{}
+
+// RegisterTask 注册自定义后台任务的处理函数, 需要在 Run 之前调用, 任务通过 Grain 创建的 queuex.Client 投递,
+// 任务所在的队列需要在配置文件 queue.concurrency 中配置并发数
+func RegisterTask(taskType string, h queuex.HandlerFunc) {
+	tasks[taskType] = h
+}
+
+// newQueue 后台任务 worker, 注册邮件 短信以及自定义任务的处理函数
+func newQueue(grain *Grain) *queuex.Server {
+	conf := grain.conf.Queue
+	queues := map[string]int{}
+	for name, n := range conf.Concurrency {
+		queues[name] = n
+	}
+	if _, ok := queues[service.MailQueue]; !ok {
+		queues[service.MailQueue] = grain.conf.SysEmail.Workers
+	}
+
+	helper := log.NewHelper(grain.sysLog)
+	srv := queuex.NewServer(data.GetRedis().Client, queuex.Options{
+		Queues:        queues,
+		PollInterval:  conf.PollInterval,
+		Lease:         conf.Lease,
+		Timeout:       conf.Timeout,
+		DeadRetention: time.Duration(conf.DeadRetention) * 24 * time.Hour,
+		OnResult: func(task *queuex.Task, result string, err error) {
+			metricsx.QueueTasks.WithLabelValues(task.Queue, task.Type, result).Inc()
+			if err != nil {
+				helper.Errorw("errMsg", "后台任务执行失败", "queue", task.Queue, "type", task.Type, "id", task.ID, "result", result, "err", err.Error())
+			}
+		},
+		OnError: func(err error) {
+			// 退出时正在执行的 Redis 命令会被取消
+			if !errors.Is(err, context.Canceled) {
+				helper.Errorw("errMsg", "后台任务队列", "err", err.Error())
+			}
+		},
+	})
+
+	mail := service.NewMailService(repo.NewMailRepo(), grain.tasks, grain.rdb, grain.conf, grain.sysLog)
+	srv.Handle(service.TaskMailDeliver, queuex.Typed(mail.Deliver))
+	srv.Handle(service.TaskSmsDeliver, grain.sms.Deliver)
+	for taskType, h := range tasks {
+		srv.Handle(taskType, h)
+	}
+	return srv
+}
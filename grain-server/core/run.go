@@ -15,20 +15,32 @@
 package core
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"github.com/casbin/casbin/v2"
 	"github.com/gin-gonic/gin"
 	"github.com/go-grain/grain/config"
 	"github.com/go-grain/grain/internal/repo/data"
+	repo "github.com/go-grain/grain/internal/repo/system"
 	"github.com/go-grain/grain/internal/repo/system/query"
 	sysRouter "github.com/go-grain/grain/internal/router/system"
 	service "github.com/go-grain/grain/internal/service/system"
 	"github.com/go-grain/grain/log"
 	"github.com/go-grain/grain/middleware"
+	metricsx "github.com/go-grain/grain/pkg/metrics"
+	monitorx "github.com/go-grain/grain/pkg/monitor"
+	queuex "github.com/go-grain/grain/pkg/queue"
 	redisx "github.com/go-grain/grain/pkg/redis"
 	"github.com/go-grain/grain/pkg/response"
+	storagex "github.com/go-grain/grain/pkg/storage"
+	telemetryx "github.com/go-grain/grain/pkg/telemetry"
+	wsx "github.com/go-grain/grain/pkg/websocket"
 	"gorm.io/gorm"
+	"io"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
@@ -53,7 +65,20 @@ type Grain struct {
 	engine   *gin.Engine
 	conf     *config.Config
 	rdb      redisx.IRedis
+	storage  storagex.Storage
 	enforcer *casbin.CachedEnforcer
+	monitor  *monitorx.Monitor
+	hub      *wsx.Hub
+	jobs     *service.SysJobService
+	// 投递后台任务, 以及本实例处理后台任务的 worker
+	tasks *queuex.Client
+	queue *queuex.Server
+	// 短信渠道只打开一次, 退出时关闭
+	sms *service.SmsService
+	// 操作日志 由中间件写入, 保存在 MongoDB 中
+	operationLog *service.SysLogService
+	// 退出前刷新并关闭链路追踪导出器
+	shutdownTelemetry func(context.Context) error
 }
 
 type InitConf struct{}
@@ -64,20 +89,15 @@ func (InitConf) init(grain *Grain) (err error) {
 		return
 	}
 
-	os.Mkdir(".tmp/", 0o664)
-	file, err := os.OpenFile(".tmp/grain.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o664)
+	grain.sysLog = newLogger(grain.conf)
+	// 全局日志函数以及各个包中零散的日志统一输出到系统日志
+	log.SetLogger(grain.sysLog)
+
+	grain.shutdownTelemetry, err = telemetryx.Init(context.Background(), newTelemetryOptions(grain.conf))
 	if err != nil {
-		return err
+		return
 	}
 
-	grain.sysLog = log.With(log.NewStdLogger(file),
-		"ts", log.DefaultTimestamp,
-		"caller", log.DefaultCaller,
-		"service.id", id,
-		"service.name", Name,
-		"service.version", Version,
-	)
-
 	grain.db, err = data.InitDB(*grain.conf)
 	if err != nil {
 		return
@@ -87,6 +107,12 @@ func (InitConf) init(grain *Grain) (err error) {
 	if err != nil {
 		return
 	}
+	grain.tasks = queuex.NewClient(data.GetRedis().Client)
+
+	grain.storage, err = service.NewStorage(grain.conf, grain.conf.Storage.Driver)
+	if err != nil {
+		return
+	}
 
 	grain.enforcer = service.NewCasbin(grain.db)
 
@@ -96,39 +122,165 @@ func (InitConf) init(grain *Grain) (err error) {
 type InitRouter struct{}
 
 func (InitRouter) init(grain *Grain) (err error) {
-	grain.engine = gin.Default()
 	gin.SetMode(grain.conf.Gin.Model)
+	// 访问日志写入 log_path 下的 access.log, debug 模式下同时输出到控制台
+	var access io.Writer = data.NewLogWriter(grain.conf.Log, "access.log")
+	if gin.IsDebugging() {
+		access = io.MultiWriter(os.Stdout, access)
+	}
+	grain.engine = gin.New()
+	// gin.Context 作为 context.Context 传给 Gorm、Redis 时需要能取到 Request.Context 中的 span
+	grain.engine.ContextWithFallback = true
+	// 请求ID需要最先生成, 访问日志、响应和业务日志都会用到
+	grain.engine.Use(middleware.RequestID(), middleware.Tracing(), middleware.Metrics(), gin.LoggerWithConfig(gin.LoggerConfig{Output: access, Formatter: accessLogFormatter}), gin.Recovery())
 	grain.engine.Use(middleware.Cors())
 
+	mongoDB, err := repo.NewMongoDBRepo(grain.rdb, grain.conf.DataBase.Mongo.URL, "grain", "sysLog")
+	if err != nil {
+		return err
+	}
+	grain.operationLog = service.NewSysLogService(mongoDB, grain.rdb, grain.conf, grain.sysLog)
+
 	routerGroup := grain.engine.Group("api/v1")
+	// 操作日志 全局限流以及人机验证 需要在注册路由之前挂载
+	routerGroup.Use(middleware.SysLog(grain.operationLog), middleware.RateLimit(grain.rdb, "default"), middleware.Captcha(grain.rdb))
 	grain.engine.NoRoute(func(ctx *gin.Context) {
 		reply := response.Response{}
 		reply.WithCode(404).WithMessage("请求路径不正确").Fail(ctx)
 	})
 
+	grain.sms = service.NewSmsService(repo.NewSmsRepo(), grain.tasks, grain.rdb, grain.conf, grain.sysLog)
+
 	sysRouter.InitRouterSwag(routerGroup)
-	sysRouter.NewCaptchaRouter(routerGroup, grain.rdb, grain.conf, grain.sysLog).InitRouters()
-	sysRouter.NewSysLogRouter(routerGroup, grain.rdb, grain.conf, grain.sysLog, grain.enforcer).InitRouters()
+	sysRouter.NewCaptchaRouter(routerGroup, grain.sms, grain.tasks, grain.rdb, grain.conf, grain.sysLog).InitRouters()
+	sysRouter.NewSysLogRouter(routerGroup, grain.operationLog, grain.rdb, grain.enforcer).InitRouters()
+	sysRouter.NewSysAuditRouter(routerGroup, grain.rdb, grain.conf, grain.sysLog, grain.enforcer).InitRouters()
+	sysRouter.NewSmsRouter(routerGroup, grain.sms, grain.rdb, grain.enforcer).InitRouters()
+	sysRouter.NewMailRouter(routerGroup, grain.tasks, grain.rdb, grain.conf, grain.sysLog, grain.enforcer).InitRouters()
 	sysRouter.NewApiRouter(routerGroup, grain.rdb, grain.conf, grain.sysLog, grain.enforcer).InitRouters().InitApi()
 	sysRouter.NewOrganizeRouter(routerGroup, grain.db, grain.rdb, grain.conf, grain.sysLog, grain.enforcer).InitRouters()
 	sysRouter.NewMenuRouter(routerGroup, grain.rdb, grain.conf, grain.sysLog, grain.enforcer).InitRouters().InitMenu()
 	sysRouter.NewRoleRouter(routerGroup, grain.rdb, grain.conf, grain.sysLog, grain.enforcer).InitRouters().InitRole()
-	sysRouter.NewUploadRouter(routerGroup, grain.engine, grain.rdb, grain.conf, grain.sysLog, grain.enforcer).InitRouters()
+	sysRouter.NewUploadRouter(routerGroup, grain.engine, grain.storage, grain.rdb, grain.conf, grain.sysLog, grain.enforcer).InitRouters()
 	sysRouter.NewCasbinRouter(routerGroup, grain.rdb, grain.conf, grain.sysLog, grain.enforcer).InitRouters().InitCasbin()
 	sysRouter.NewCodeAssistantRouter(routerGroup, grain.db, grain.rdb, grain.conf, grain.sysLog, grain.enforcer).InitRouters()
-	sysRouter.NewSysUserRouter(grain.engine, routerGroup, grain.rdb, grain.conf, grain.enforcer, grain.sysLog).InitRouters().InitUser()
+	grain.monitor = newMonitor(grain)
+	grain.hub = newHub(grain)
+	sysRouter.NewSysMessageRouter(routerGroup, grain.hub, grain.rdb, grain.conf, grain.sysLog, grain.enforcer).InitRouters()
+	sysRouter.NewNotificationRouter(routerGroup, grain.hub, grain.rdb, grain.conf, grain.sysLog, grain.enforcer).InitRouters()
+	sysRouter.NewSysMonitorRouter(routerGroup, grain.monitor, grain.rdb, grain.sysLog, grain.enforcer).InitRouters()
+	if grain.jobs, err = newJobs(grain); err != nil {
+		return err
+	}
+	sysRouter.NewSysJobRouter(routerGroup, grain.jobs, grain.rdb, grain.sysLog, grain.enforcer).InitRouters()
+	grain.queue = newQueue(grain)
+	sysTask := service.NewSysTaskService(queuex.NewInspector(data.GetRedis().Client), grain.conf, grain.sysLog)
+	sysRouter.NewSysTaskRouter(routerGroup, sysTask, grain.rdb, grain.sysLog, grain.enforcer).InitRouters()
+	sysRouter.NewSysStatusRouter(grain.engine, routerGroup, newHealthChecker(grain), Name, Version, grain.rdb, grain.sysLog, grain.enforcer).InitRouters()
+	sysRouter.NewSysUserRouter(grain.engine, routerGroup, grain.storage, grain.hub, grain.sms, grain.tasks, grain.rdb, grain.conf, grain.enforcer, grain.sysLog).InitRouters().InitUser()
 	return nil
 }
 
+type InitMetrics struct{}
+
+func (InitMetrics) init(grain *Grain) (err error) {
+	conf := grain.conf.Metrics
+	if !conf.Enable {
+		return nil
+	}
+
+	sqlDB, err := grain.db.DB()
+	if err != nil {
+		return err
+	}
+	if err = metricsx.RegisterDB(sqlDB, grain.conf.DataBase.Driver); err != nil {
+		return err
+	}
+	if err = metricsx.RegisterRedis(data.GetRedis().Client); err != nil {
+		return err
+	}
+
+	if conf.Path == "" {
+		conf.Path = "/metrics"
+	}
+	handler := metricsx.Handler(conf.Token)
+	// 未配置独立监听地址时挂在对外的业务端口上, 不允许匿名访问
+	if conf.Listen == "" {
+		if conf.Token == "" {
+			return errors.New("metrics.listen 为空时指标接口挂在业务端口上, 需要配置 metrics.token")
+		}
+		grain.engine.GET(conf.Path, gin.WrapH(handler))
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle(conf.Path, handler)
+	go func() {
+		if err := http.ListenAndServe(conf.Listen, mux); err != nil {
+			log.Errorw("errMsg", "指标服务退出", "err", err.Error())
+		}
+	}()
+	return nil
+}
+
+type RunWorker struct{}
+
+func (RunWorker) init(grain *Grain) (err error) {
+	// 后台任务 worker, 退出时在 RunGin 中等待正在执行的任务
+	if grain.conf.Queue.Enable {
+		grain.queue.Start(context.Background())
+	}
+	// WebSocket 跨实例消息订阅
+	grain.hub.Run(context.Background())
+	// 运行监控定时采样
+	grain.monitor.Start(context.Background())
+	// 定时任务调度, 退出时在 RunGin 中停止
+	return grain.jobs.Start(context.Background())
+}
+
 type RunGin struct{}
 
 func (RunGin) init(grain *Grain) (err error) {
 	go func() {
 		time.Sleep(time.Second * 1)
-		fmt.Println("swag文档地址:http://127.0.0.1:8080/api/v1/swagger/index.html")
+		log.Info("swag文档地址:http://127.0.0.1:8080/api/v1/swagger/index.html")
+	}()
+	defer grain.shutdownTelemetry(context.Background())
+
+	srv := &http.Server{Addr: grain.conf.Gin.Host, Handler: grain.engine}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
 	}()
-	if err := grain.engine.Run(grain.conf.Gin.Host); err != nil {
+	select {
+	case err = <-serveErr:
 		return err
+	case <-ctx.Done():
+	}
+
+	// 先停止接收新请求, 再等待正在执行的定时任务以及后台任务, 共用 shutdown_timeout,
+	// 超时后没有执行完的后台任务放回队列
+	log.Info("收到退出信号, 开始关闭服务")
+	timeout := grain.conf.Gin.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err = srv.Shutdown(shutdownCtx); err != nil {
+		log.Errorw("errMsg", "关闭 HTTP 服务", "err", err.Error())
+	}
+	// Shutdown 不会等待已经升级的 WebSocket 连接, 需要单独断开
+	grain.hub.Close()
+	if err = grain.jobs.Stop(shutdownCtx); err != nil {
+		log.Errorw("errMsg", "等待定时任务退出", "err", err.Error())
+	}
+	if err = grain.queue.Shutdown(shutdownCtx); err != nil {
+		log.Errorw("errMsg", "等待后台任务退出", "err", err.Error())
+	}
+	if err = grain.sms.Close(); err != nil {
+		log.Errorw("errMsg", "关闭短信渠道", "err", err.Error())
 	}
 	return nil
 }
@@ -166,6 +318,8 @@ func Run() {
 		&InitGenQuery{},
 		&LoadPolicy{},
 		&InitRouter{},
+		&InitMetrics{},
+		&RunWorker{},
 		&RunGin{},
 	}
 
@@ -0,0 +1,43 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	wsx "github.com/go-grain/grain/pkg/websocket"
+	"net/http"
+)
+
+// newHub WebSocket 连接中心, 配置了 allowed_origins 时按配置校验握手来源, 没有配置时只允许同源
+func newHub(grain *Grain) *wsx.Hub {
+	conf := grain.conf.Websocket
+	opts := wsx.Options{
+		SendBuffer:     conf.SendBuffer,
+		MaxMessageSize: conf.MaxMessageSize,
+		PingInterval:   conf.PingInterval,
+		PongWait:       conf.PongWait,
+	}
+	if len(conf.AllowedOrigins) > 0 {
+		opts.CheckOrigin = func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			for _, allowed := range conf.AllowedOrigins {
+				if allowed == "*" || allowed == origin {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return wsx.NewHub(grain.rdb, opts)
+}
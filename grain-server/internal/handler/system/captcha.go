@@ -127,3 +127,66 @@ func (r *CaptchaHandle) SendUserMobileCaptcha(ctx *gin.Context) {
 	}
 	reply.WithMessage("验证码发送成功").Success(ctx)
 }
+
+// GetImageCaptcha 获取数字图形验证码
+// @Summary 获取数字图形验证码
+// @Description 获取数字图形验证码, 图片为 base64 格式
+// @Tags 验证码
+// @Accept json
+// @Produce json
+// @Success 200 {object} model.ImageCaptcha "成功"
+// @Failure 500  {object} model.ErrorRes "失败"
+// @Router /captcha/image [get]
+func (r *CaptchaHandle) GetImageCaptcha(ctx *gin.Context) {
+	reply := r.res.New()
+	captcha, err := r.sv.GetImageCaptcha(ctx)
+	if err != nil {
+		reply.WithCode(consts.GetVisualCaptchaFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").WithData(captcha).Success(ctx)
+}
+
+// GetSliderCaptcha 获取滑块验证码
+// @Summary 获取滑块验证码
+// @Description 获取滑块验证码, 背景图和拼图块均为 base64 格式
+// @Tags 验证码
+// @Accept json
+// @Produce json
+// @Success 200 {object} model.SliderCaptcha "成功"
+// @Failure 500  {object} model.ErrorRes "失败"
+// @Router /captcha/slider [get]
+func (r *CaptchaHandle) GetSliderCaptcha(ctx *gin.Context) {
+	reply := r.res.New()
+	captcha, err := r.sv.GetSliderCaptcha(ctx)
+	if err != nil {
+		reply.WithCode(consts.GetVisualCaptchaFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").WithData(captcha).Success(ctx)
+}
+
+// VerifyCaptcha 校验图形/滑块验证码
+// @Summary 校验图形/滑块验证码
+// @Description 校验通过后返回一次性凭证, 请求受保护的接口时放在 X-Captcha-Ticket 请求头中
+// @Tags 验证码
+// @Accept json
+// @Produce json
+// @Param data body model.VerifyCaptchaReq true "验证码ID和答案"
+// @Success 200 {object} model.CaptchaTicket "成功"
+// @Failure 500  {object} model.ErrorRes "失败"
+// @Router /captcha/verify [post]
+func (r *CaptchaHandle) VerifyCaptcha(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.VerifyCaptchaReq{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	ticket, err := r.sv.VerifyCaptcha(&req, ctx)
+	if err != nil {
+		reply.WithCode(consts.VerifyCaptchaFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("验证通过").WithData(ticket).Success(ctx)
+}
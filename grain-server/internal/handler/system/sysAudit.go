@@ -0,0 +1,90 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	service "github.com/go-grain/grain/internal/service/system"
+	model "github.com/go-grain/grain/model/system"
+	"github.com/go-grain/grain/pkg/response"
+	consts "github.com/go-grain/grain/utils/const"
+)
+
+type SysAuditHandle struct {
+	res response.Response
+	sv  *service.SysAuditService
+}
+
+func NewSysAuditHandle(sv *service.SysAuditService) *SysAuditHandle {
+	return &SysAuditHandle{
+		sv: sv,
+	}
+}
+
+// GetAuditList
+// @Security ApiKeyAuth
+// @Summary 按实体获取审计记录
+// @Description 根据数据表名称和记录主键获取字段级审计记录
+// @Tags 审计日志
+// @Accept json
+// @Produce json
+// @Param data query model.SysAuditReq true "分页列表请求参数"
+// @Success 200 {object} model.SysAudit "成功"
+// @Failure 400 {object} model.ErrorRes "格式错误"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Failure 404 {object} model.ErrorRes "资源不存在"
+// @Router /sysAudit/list [get]
+func (r *SysAuditHandle) GetAuditList(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.SysAuditReq{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	list, err := r.sv.GetAuditList(&req, ctx)
+	if err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").WithTotal(req.Total).WithData(list).Success(ctx)
+}
+
+// GetAuditListByActor
+// @Security ApiKeyAuth
+// @Summary 按操作人获取审计记录
+// @Description 根据操作人UID获取字段级审计记录
+// @Tags 审计日志
+// @Accept json
+// @Produce json
+// @Param data query model.SysAuditReq true "分页列表请求参数"
+// @Success 200 {object} model.SysAudit "成功"
+// @Failure 400 {object} model.ErrorRes "格式错误"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Failure 404 {object} model.ErrorRes "资源不存在"
+// @Router /sysAudit/actor [get]
+func (r *SysAuditHandle) GetAuditListByActor(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.SysAuditReq{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	list, err := r.sv.GetAuditListByActor(&req, ctx)
+	if err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").WithTotal(req.Total).WithData(list).Success(ctx)
+}
@@ -0,0 +1,152 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	service "github.com/go-grain/grain/internal/service/system"
+	model "github.com/go-grain/grain/model/system"
+	"github.com/go-grain/grain/pkg/response"
+	consts "github.com/go-grain/grain/utils/const"
+)
+
+type SysJobHandle struct {
+	res response.Response
+	sv  *service.SysJobService
+}
+
+func NewSysJobHandle(sv *service.SysJobService) *SysJobHandle {
+	return &SysJobHandle{
+		sv: sv,
+	}
+}
+
+// GetJobList
+// @Security ApiKeyAuth
+// @Summary 获取定时任务列表
+// @Description 获取代码中注册的定时任务, 包含启用状态 下一次调度时间以及最近一次执行记录
+// @Tags 定时任务
+// @Produce json
+// @Success 200 {object} model.SysJobInfo "成功"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Router /sysJob/list [get]
+func (r *SysJobHandle) GetJobList(ctx *gin.Context) {
+	reply := r.res.New()
+	list, err := r.sv.GetJobList(ctx)
+	if err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").WithData(list).Success(ctx)
+}
+
+// EnableJob
+// @Security ApiKeyAuth
+// @Summary 启用定时任务
+// @Description 启用定时任务, 对全部实例生效
+// @Tags 定时任务
+// @Accept json
+// @Produce json
+// @Param data body model.SysJobReq true "任务名称"
+// @Success 200 {object} model.ErrorRes "成功"
+// @Failure 400 {object} model.ErrorRes "格式错误"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Router /sysJob/enable [put]
+func (r *SysJobHandle) EnableJob(ctx *gin.Context) {
+	r.setEnabled(ctx, true)
+}
+
+// DisableJob
+// @Security ApiKeyAuth
+// @Summary 停用定时任务
+// @Description 停用定时任务, 对全部实例生效, 停用后仍然可以手动执行
+// @Tags 定时任务
+// @Accept json
+// @Produce json
+// @Param data body model.SysJobReq true "任务名称"
+// @Success 200 {object} model.ErrorRes "成功"
+// @Failure 400 {object} model.ErrorRes "格式错误"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Router /sysJob/disable [put]
+func (r *SysJobHandle) DisableJob(ctx *gin.Context) {
+	r.setEnabled(ctx, false)
+}
+
+func (r *SysJobHandle) setEnabled(ctx *gin.Context, enabled bool) {
+	reply := r.res.New()
+	req := model.SysJobReq{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	if err := r.sv.SetEnabled(req.Name, enabled, ctx); err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").Success(ctx)
+}
+
+// RunJob
+// @Security ApiKeyAuth
+// @Summary 立即执行定时任务
+// @Description 立即在后台执行一次, 执行结果在执行记录中查看
+// @Tags 定时任务
+// @Accept json
+// @Produce json
+// @Param data body model.SysJobReq true "任务名称"
+// @Success 200 {object} model.ErrorRes "成功"
+// @Failure 400 {object} model.ErrorRes "格式错误"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Router /sysJob/run [post]
+func (r *SysJobHandle) RunJob(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.SysJobReq{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	if err := r.sv.RunJob(req.Name, ctx); err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("任务已开始执行").Success(ctx)
+}
+
+// GetJobLogList
+// @Security ApiKeyAuth
+// @Summary 获取定时任务执行记录
+// @Description 获取定时任务执行记录
+// @Tags 定时任务
+// @Accept json
+// @Produce json
+// @Param data query model.SysJobLogReq true "分页列表请求参数"
+// @Success 200 {object} model.SysJobLog "成功"
+// @Failure 400 {object} model.ErrorRes "格式错误"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Router /sysJob/log/list [get]
+func (r *SysJobHandle) GetJobLogList(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.SysJobLogReq{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	list, err := r.sv.GetJobLogList(&req, ctx)
+	if err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").WithTotal(req.Total).WithData(list).Success(ctx)
+}
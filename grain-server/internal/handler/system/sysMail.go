@@ -0,0 +1,120 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	service "github.com/go-grain/grain/internal/service/system"
+	model "github.com/go-grain/grain/model/system"
+	"github.com/go-grain/grain/pkg/response"
+	consts "github.com/go-grain/grain/utils/const"
+)
+
+type MailHandle struct {
+	res response.Response
+	sv  *service.MailService
+}
+
+func NewMailHandle(sv *service.MailService) *MailHandle {
+	return &MailHandle{
+		sv: sv,
+	}
+}
+
+// GetMailList
+// @Security ApiKeyAuth
+// @Summary 获取邮件发送历史
+// @Description 获取邮件发送历史分页数据
+// @Tags 邮件管理
+// @Accept json
+// @Produce json
+// @Param data query model.SysMailReq true "分页列表请求参数"
+// @Success 200 {object} model.SysMail "成功"
+// @Failure 400 {object} model.ErrorRes "格式错误"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Failure 404 {object} model.ErrorRes "资源不存在"
+// @Router /sysMail/list [get]
+func (r *MailHandle) GetMailList(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.SysMailReq{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	list, err := r.sv.GetMailList(&req, ctx)
+	if err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").WithTotal(req.Total).WithData(list).Success(ctx)
+}
+
+// GetDeadMailList
+// @Security ApiKeyAuth
+// @Summary 获取邮件死信列表
+// @Description 获取多次发送失败的邮件
+// @Tags 邮件管理
+// @Accept json
+// @Produce json
+// @Param data query model.SysMailReq true "分页列表请求参数"
+// @Success 200 {object} model.SysMail "成功"
+// @Failure 400 {object} model.ErrorRes "格式错误"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Failure 404 {object} model.ErrorRes "资源不存在"
+// @Router /sysMail/deadLetter [get]
+func (r *MailHandle) GetDeadMailList(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.SysMailReq{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	req.Status = model.MailStatusDead
+	list, err := r.sv.GetMailList(&req, ctx)
+	if err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").WithTotal(req.Total).WithData(list).Success(ctx)
+}
+
+// RetryDeadMails
+// @Security ApiKeyAuth
+// @Summary 重发死信邮件
+// @Description 根据邮件ID把死信邮件重新放回发件箱
+// @Tags 邮件管理
+// @Accept json
+// @Produce json
+// @Param data body []uint true "邮件ID"
+// @Success 200 {object} model.ErrorRes "成功"
+// @Failure 400 {object} model.ErrorRes "格式错误"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Failure 404 {object} model.ErrorRes "资源不存在"
+// @Router /sysMail/retry [post]
+func (r *MailHandle) RetryDeadMails(ctx *gin.Context) {
+	reply := r.res.New()
+	req := struct {
+		Ids []uint `json:"ids"`
+	}{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	if err := r.sv.RetryDeadMails(req.Ids, ctx); err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("已重新放入发件箱").Success(ctx)
+}
@@ -15,9 +15,9 @@
 package handler
 
 import (
-	"fmt"
 	"github.com/gin-gonic/gin"
 	service "github.com/go-grain/grain/internal/service/system"
+	"github.com/go-grain/grain/log"
 	"github.com/go-grain/grain/model/system"
 	"github.com/go-grain/grain/pkg/response"
 	consts "github.com/go-grain/grain/utils/const"
@@ -136,7 +136,7 @@ func (r *MenuHandle) SetMenuAndPermission(ctx *gin.Context) {
 		reply.WithCode(500).WithMessage(err.Error()).Fail(ctx)
 		return
 	}
-	fmt.Println(Keys)
+	log.Debugw("role", Keys.Role, "keys", Keys.Keys)
 	err := r.sv.SetMenuAndPermission(Keys.Keys, Keys.Role)
 	if err != nil {
 		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
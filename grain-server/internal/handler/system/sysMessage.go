@@ -0,0 +1,125 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	service "github.com/go-grain/grain/internal/service/system"
+	"github.com/go-grain/grain/log"
+	model "github.com/go-grain/grain/model/system"
+	"github.com/go-grain/grain/pkg/response"
+	wsx "github.com/go-grain/grain/pkg/websocket"
+	consts "github.com/go-grain/grain/utils/const"
+)
+
+type SysMessageHandle struct {
+	res response.Response
+	hub *wsx.Hub
+	sv  *service.SysMessageService
+}
+
+func NewSysMessageHandle(hub *wsx.Hub, sv *service.SysMessageService) *SysMessageHandle {
+	return &SysMessageHandle{
+		hub: hub,
+		sv:  sv,
+	}
+}
+
+// Connect
+// @Summary 建立 WebSocket 连接
+// @Description 令牌放在 query 参数 token 中, 或者使用子协议 ["grain", token]; 连接后先推送未读数, 客户端发送 Message 格式的聊天消息
+// @Tags 即时消息
+// @Param token query string false "登录令牌"
+// @Success 101 {string} string "切换协议"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Router /ws [get]
+func (r *SysMessageHandle) Connect(ctx *gin.Context) {
+	if err := r.hub.Serve(ctx.Writer, ctx.Request, ctx.GetString("uid"), r.sv.OnConnect, r.sv.HandleMessage); err != nil {
+		// 握手失败时 Upgrader 已经写入了错误响应
+		log.Warnw("errMsg", "WebSocket 握手失败", "err", err.Error())
+	}
+}
+
+// GetMessageList
+// @Security ApiKeyAuth
+// @Summary 获取聊天记录
+// @Description 获取当前用户与某个用户的私聊记录, 或者所属组织的群聊记录, 按时间倒序
+// @Tags 即时消息
+// @Accept json
+// @Produce json
+// @Param data query model.SysMessageReq true "分页列表请求参数"
+// @Success 200 {object} model.SysMessage "成功"
+// @Failure 400 {object} model.ErrorRes "格式错误"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Router /sysMessage/list [get]
+func (r *SysMessageHandle) GetMessageList(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.SysMessageReq{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	list, err := r.sv.GetMessageList(&req, ctx)
+	if err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").WithTotal(req.Total).WithData(list).Success(ctx)
+}
+
+// GetUnreadCount
+// @Security ApiKeyAuth
+// @Summary 获取未读消息数
+// @Description 按会话统计未读消息数, 私聊的 peer 为对方UID, 群聊为组织
+// @Tags 即时消息
+// @Produce json
+// @Success 200 {object} model.UnreadCount "成功"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Router /sysMessage/unread [get]
+func (r *SysMessageHandle) GetUnreadCount(ctx *gin.Context) {
+	reply := r.res.New()
+	counts, err := r.sv.GetUnreadCount(ctx)
+	if err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").WithData(counts).Success(ctx)
+}
+
+// ReadMessage
+// @Security ApiKeyAuth
+// @Summary 标记会话已读
+// @Description 把私聊或群聊会话中的未读消息标记为已读
+// @Tags 即时消息
+// @Accept json
+// @Produce json
+// @Param data body model.ReadMessageReq true "会话"
+// @Success 200 {object} model.ErrorRes "成功"
+// @Failure 400 {object} model.ErrorRes "格式错误"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Router /sysMessage/read [put]
+func (r *SysMessageHandle) ReadMessage(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.ReadMessageReq{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	if err := r.sv.ReadMessage(&req, ctx); err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").Success(ctx)
+}
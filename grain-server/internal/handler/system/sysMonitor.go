@@ -0,0 +1,82 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	service "github.com/go-grain/grain/internal/service/system"
+	"github.com/go-grain/grain/pkg/response"
+	consts "github.com/go-grain/grain/utils/const"
+	"io"
+)
+
+type SysMonitorHandle struct {
+	res response.Response
+	sv  *service.SysMonitorService
+}
+
+func NewSysMonitorHandle(sv *service.SysMonitorService) *SysMonitorHandle {
+	return &SysMonitorHandle{
+		sv: sv,
+	}
+}
+
+// GetMonitor
+// @Security ApiKeyAuth
+// @Summary 获取运行监控
+// @Description 获取主机、进程、Go 运行时、目录磁盘占用以及数据库连接池的最新采样和历史采样
+// @Tags 运行监控
+// @Produce json
+// @Success 200 {object} model.SysMonitorRes "成功"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Router /sysMonitor [get]
+func (r *SysMonitorHandle) GetMonitor(ctx *gin.Context) {
+	reply := r.res.New()
+	res, err := r.sv.GetMonitor(ctx)
+	if err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").WithData(res).Success(ctx)
+}
+
+// StreamMonitor
+// @Security ApiKeyAuth
+// @Summary 实时运行监控
+// @Description 通过 SSE 推送实时采样, 事件名为 sample, 连接建立后先推送最新一条
+// @Tags 运行监控
+// @Produce text/event-stream
+// @Success 200 {string} string "sample 事件, data 为一条采样"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Router /sysMonitor/stream [get]
+func (r *SysMonitorHandle) StreamMonitor(ctx *gin.Context) {
+	samples, cancel := r.sv.Subscribe(ctx)
+	defer cancel()
+
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("X-Accel-Buffering", "no")
+	if latest, ok := r.sv.Latest(); ok {
+		ctx.SSEvent("sample", latest)
+	}
+	ctx.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Request.Context().Done():
+			return false
+		case sample := <-samples:
+			ctx.SSEvent("sample", sample)
+			return true
+		}
+	})
+}
@@ -0,0 +1,186 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	service "github.com/go-grain/grain/internal/service/system"
+	model "github.com/go-grain/grain/model/system"
+	"github.com/go-grain/grain/pkg/response"
+	consts "github.com/go-grain/grain/utils/const"
+)
+
+type NotificationHandle struct {
+	res response.Response
+	sv  *service.NotificationService
+}
+
+func NewNotificationHandle(sv *service.NotificationService) *NotificationHandle {
+	return &NotificationHandle{
+		sv: sv,
+	}
+}
+
+// GetNotificationList
+// @Security ApiKeyAuth
+// @Summary 获取通知列表
+// @Description 获取当前用户的站内通知, 不指定状态时不包含已归档的通知
+// @Tags 站内通知
+// @Accept json
+// @Produce json
+// @Param data query model.SysNotificationReq true "分页列表请求参数"
+// @Success 200 {object} model.SysNotification "成功"
+// @Failure 400 {object} model.ErrorRes "格式错误"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Router /sysNotification/list [get]
+func (r *NotificationHandle) GetNotificationList(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.SysNotificationReq{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	list, err := r.sv.GetNotificationList(&req, ctx)
+	if err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").WithTotal(req.Total).WithData(list).Success(ctx)
+}
+
+// CountUnread
+// @Security ApiKeyAuth
+// @Summary 获取未读通知数
+// @Description 获取当前用户的未读通知数
+// @Tags 站内通知
+// @Produce json
+// @Success 200 {object} model.ErrorRes "成功"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Router /sysNotification/unread [get]
+func (r *NotificationHandle) CountUnread(ctx *gin.Context) {
+	reply := r.res.New()
+	count, err := r.sv.CountUnread(ctx)
+	if err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").WithData(gin.H{"count": count}).Success(ctx)
+}
+
+// ReadNotifications
+// @Security ApiKeyAuth
+// @Summary 标记通知已读
+// @Description 标记指定通知为已读, ids 为空时标记全部未读通知
+// @Tags 站内通知
+// @Accept json
+// @Produce json
+// @Param data body model.NotificationIdsReq true "通知ID"
+// @Success 200 {object} model.ErrorRes "成功"
+// @Failure 400 {object} model.ErrorRes "格式错误"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Router /sysNotification/read [put]
+func (r *NotificationHandle) ReadNotifications(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.NotificationIdsReq{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	if err := r.sv.ReadNotifications(req.IDs, ctx); err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").Success(ctx)
+}
+
+// ArchiveNotifications
+// @Security ApiKeyAuth
+// @Summary 归档通知
+// @Description 归档指定通知, ids 为空时归档全部已读通知
+// @Tags 站内通知
+// @Accept json
+// @Produce json
+// @Param data body model.NotificationIdsReq true "通知ID"
+// @Success 200 {object} model.ErrorRes "成功"
+// @Failure 400 {object} model.ErrorRes "格式错误"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Router /sysNotification/archive [put]
+func (r *NotificationHandle) ArchiveNotifications(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.NotificationIdsReq{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	if err := r.sv.ArchiveNotifications(req.IDs, ctx); err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").Success(ctx)
+}
+
+// Announce
+// @Security ApiKeyAuth
+// @Summary 发布公告
+// @Description 向全部用户、某个角色或者某个组织节点(包含下级节点)的用户发布公告
+// @Tags 站内通知
+// @Accept json
+// @Produce json
+// @Param data body model.CreateAnnouncement true "公告"
+// @Success 200 {object} model.SysAnnouncement "成功"
+// @Failure 400 {object} model.ErrorRes "格式错误"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Router /sysNotification/announcement [post]
+func (r *NotificationHandle) Announce(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.CreateAnnouncement{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	announcement, err := r.sv.Announce(&req, ctx)
+	if err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("发布成功").WithData(announcement).Success(ctx)
+}
+
+// GetAnnouncementList
+// @Security ApiKeyAuth
+// @Summary 获取公告列表
+// @Description 获取已发布的公告
+// @Tags 站内通知
+// @Accept json
+// @Produce json
+// @Param data query model.SysAnnouncementReq true "分页列表请求参数"
+// @Success 200 {object} model.SysAnnouncement "成功"
+// @Failure 400 {object} model.ErrorRes "格式错误"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Router /sysNotification/announcement/list [get]
+func (r *NotificationHandle) GetAnnouncementList(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.SysAnnouncementReq{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	list, err := r.sv.GetAnnouncementList(&req, ctx)
+	if err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").WithTotal(req.Total).WithData(list).Success(ctx)
+}
@@ -0,0 +1,62 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	service "github.com/go-grain/grain/internal/service/system"
+	model "github.com/go-grain/grain/model/system"
+	"github.com/go-grain/grain/pkg/response"
+	consts "github.com/go-grain/grain/utils/const"
+)
+
+type SmsHandle struct {
+	res response.Response
+	sv  *service.SmsService
+}
+
+func NewSmsHandle(sv *service.SmsService) *SmsHandle {
+	return &SmsHandle{
+		sv: sv,
+	}
+}
+
+// GetSmsList
+// @Security ApiKeyAuth
+// @Summary 获取短信投递记录
+// @Description 获取短信投递记录分页数据
+// @Tags 短信管理
+// @Accept json
+// @Produce json
+// @Param data query model.SysSmsReq true "分页列表请求参数"
+// @Success 200 {object} model.SysSms "成功"
+// @Failure 400 {object} model.ErrorRes "格式错误"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Failure 404 {object} model.ErrorRes "资源不存在"
+// @Router /sms/list [get]
+func (r *SmsHandle) GetSmsList(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.SysSmsReq{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	list, err := r.sv.GetSmsList(&req, ctx)
+	if err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").WithTotal(req.Total).WithData(list).Success(ctx)
+}
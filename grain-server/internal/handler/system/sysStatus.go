@@ -0,0 +1,77 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	service "github.com/go-grain/grain/internal/service/system"
+	healthx "github.com/go-grain/grain/pkg/health"
+	"github.com/go-grain/grain/pkg/response"
+	"net/http"
+)
+
+type SysStatusHandle struct {
+	res response.Response
+	sv  *service.SysStatusService
+}
+
+func NewSysStatusHandle(sv *service.SysStatusService) *SysStatusHandle {
+	return &SysStatusHandle{
+		sv: sv,
+	}
+}
+
+// Healthz 存活探针
+// @Summary 存活探针
+// @Description 进程能响应请求即返回 200, 不检查依赖
+// @Tags 系统状态
+// @Produce json
+// @Success 200 {object} healthx.Report "存活"
+// @Router /healthz [get]
+func (r *SysStatusHandle) Healthz(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"status": healthx.StatusUp})
+}
+
+// Readyz 就绪探针
+// @Summary 就绪探针
+// @Description 检查数据库、Redis、MongoDB、Casbin 策略以及可选的 SMTP, 必需依赖异常时返回 503.
+// @Description 不需要登录, 只返回汇总状态, 各依赖的错误信息在 /sysStatus 中查看
+// @Tags 系统状态
+// @Produce json
+// @Success 200 {object} map[string]string "就绪"
+// @Failure 503 {object} map[string]string "未就绪"
+// @Router /readyz [get]
+func (r *SysStatusHandle) Readyz(ctx *gin.Context) {
+	report := r.sv.Ready(ctx)
+	code := http.StatusOK
+	if !report.Ready() {
+		code = http.StatusServiceUnavailable
+	}
+	ctx.JSON(code, gin.H{"status": report.Status})
+}
+
+// GetStatus
+// @Security ApiKeyAuth
+// @Summary 获取系统状态
+// @Description 获取程序名称、版本、运行时长以及各依赖的状态和耗时
+// @Tags 系统状态
+// @Produce json
+// @Success 200 {object} model.SysStatus "成功"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Router /sysStatus [get]
+func (r *SysStatusHandle) GetStatus(ctx *gin.Context) {
+	reply := r.res.New()
+	reply.WithMessage("成功").WithData(r.sv.GetStatus(ctx)).Success(ctx)
+}
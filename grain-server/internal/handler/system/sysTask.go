@@ -0,0 +1,132 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	service "github.com/go-grain/grain/internal/service/system"
+	model "github.com/go-grain/grain/model/system"
+	"github.com/go-grain/grain/pkg/response"
+	consts "github.com/go-grain/grain/utils/const"
+)
+
+type SysTaskHandle struct {
+	res response.Response
+	sv  *service.SysTaskService
+}
+
+func NewSysTaskHandle(sv *service.SysTaskService) *SysTaskHandle {
+	return &SysTaskHandle{
+		sv: sv,
+	}
+}
+
+// GetQueueList
+// @Security ApiKeyAuth
+// @Summary 获取任务队列
+// @Description 获取全部后台任务队列以及各个状态的任务数量
+// @Tags 后台任务
+// @Produce json
+// @Success 200 {object} queuex.QueueInfo "成功"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Router /sysTask/queues [get]
+func (r *SysTaskHandle) GetQueueList(ctx *gin.Context) {
+	reply := r.res.New()
+	list, err := r.sv.GetQueueList(ctx)
+	if err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").WithData(list).Success(ctx)
+}
+
+// GetTaskList
+// @Security ApiKeyAuth
+// @Summary 获取后台任务列表
+// @Description 按队列以及状态分页获取后台任务, 死信按进入时间倒序
+// @Tags 后台任务
+// @Accept json
+// @Produce json
+// @Param data query model.SysTaskReq true "分页列表请求参数"
+// @Success 200 {object} queuex.TaskInfo "成功"
+// @Failure 400 {object} model.ErrorRes "格式错误"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Router /sysTask/list [get]
+func (r *SysTaskHandle) GetTaskList(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.SysTaskReq{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	list, err := r.sv.GetTaskList(&req, ctx)
+	if err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").WithTotal(req.Total).WithData(list).Success(ctx)
+}
+
+// RunTasks
+// @Security ApiKeyAuth
+// @Summary 重试后台任务
+// @Description 立即执行延迟 重试中或者死信任务, 死信的失败次数清零
+// @Tags 后台任务
+// @Accept json
+// @Produce json
+// @Param data body model.SysTaskIdsReq true "队列名称以及任务ID"
+// @Success 200 {object} model.ErrorRes "成功"
+// @Failure 400 {object} model.ErrorRes "格式错误"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Router /sysTask/retry [put]
+func (r *SysTaskHandle) RunTasks(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.SysTaskIdsReq{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	if err := r.sv.RunTasks(&req, ctx); err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").Success(ctx)
+}
+
+// DeleteTasks
+// @Security ApiKeyAuth
+// @Summary 删除后台任务
+// @Description 删除没有在执行的任务
+// @Tags 后台任务
+// @Accept json
+// @Produce json
+// @Param data body model.SysTaskIdsReq true "队列名称以及任务ID"
+// @Success 200 {object} model.ErrorRes "成功"
+// @Failure 400 {object} model.ErrorRes "格式错误"
+// @Failure 401 {object} model.ErrorRes "未经授权"
+// @Router /sysTask/taskByIds [delete]
+func (r *SysTaskHandle) DeleteTasks(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.SysTaskIdsReq{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	if err := r.sv.DeleteTasks(&req, ctx); err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").Success(ctx)
+}
@@ -15,6 +15,7 @@
 package handler
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	service "github.com/go-grain/grain/internal/service/system"
 	"github.com/go-grain/grain/model/system"
@@ -28,13 +29,15 @@ import (
 )
 
 type SysUserHandle struct {
-	res response.Response
-	sv  *service.SysUserService
+	res   response.Response
+	sv    *service.SysUserService
+	files *service.UploadService
 }
 
-func NewSysUserHandle(sv *service.SysUserService) *SysUserHandle {
+func NewSysUserHandle(sv *service.SysUserService, files *service.UploadService) *SysUserHandle {
 	return &SysUserHandle{
-		sv: sv,
+		sv:    sv,
+		files: files,
 	}
 }
 
@@ -445,19 +448,48 @@ func (r *SysUserHandle) DeleteSysUserByIds(ctx *gin.Context) {
 func (r *SysUserHandle) UploadAvatar(ctx *gin.Context) {
 	reply := r.res.New()
 
-	file, err := upload.UploadFile(ctx, "avatar")
+	f, err := upload.OpenFile(ctx, "avatar")
+	var rejected *upload.PolicyError
+	if errors.As(err, &rejected) {
+		reply.WithCode(consts.UploadFileRejected).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
 	if err != nil {
-		reply.WithCode(500).WithMessage(err.Error()).Fail(ctx)
+		reply.WithCode(consts.UploadAvatarFail).WithMessage(err.Error()).Fail(ctx)
 		return
 	}
+	defer f.Close()
 
-	file.FilePurpose = "系统用户头像"
-	err = r.sv.UploadAvatar(file, ctx)
+	f.Upload.FilePurpose = "系统用户头像"
+	f.Upload.Visibility = model.VisibilityPublic
+	var avatar string
+	err = r.files.SaveFile(f, ctx, func(file *model.Upload) error {
+		// 按上传策略生成头像的图片规格, 头像地址使用第一个规格, 列表页不再加载原图
+		avatar = file.FileUrl
+		for i, preset := range upload.Policy("avatar").Variants {
+			variant, err := r.files.Variant(ctx, file, preset)
+			if err != nil {
+				return errors.New("头像处理失败")
+			}
+			if i == 0 {
+				avatar = r.files.ObjectURL(variant.Storage, variant.FileKey)
+			}
+		}
+		quota, err := r.files.QuotaOf(ctx.GetString("uid"))
+		if err != nil {
+			return err
+		}
+		return r.sv.UploadAvatar(file, avatar, quota, ctx)
+	})
+	if errors.Is(err, service.ErrQuotaExceeded) {
+		reply.WithCode(consts.UploadQuotaExceeded).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
 	if err != nil {
 		reply.WithCode(consts.UploadAvatarFail).WithMessage(err.Error()).Fail(ctx)
 		return
 	}
-	reply.WithMessage("上传文件成功").WithData(jsonx.G{"fileUrl": file.FileUrl}).Success(ctx)
+	reply.WithMessage("上传文件成功").WithData(jsonx.G{"fileUrl": avatar}).Success(ctx)
 }
 
 // SwitchRole 切换角色
@@ -467,10 +499,16 @@ func (r *SysUserHandle) UploadAvatar(ctx *gin.Context) {
 // @Tags 系统用户
 // @Accept json
 // @Produce json
-// @Param role query int true "角色"
+// @Param role query string true "角色"
 // @Success 200  {object} model.LoginRes "成功"
 // @Failure 500  {object} model.ErrorRes "失败"
 // @Router /sysUser/switchRole [post]
 func (r *SysUserHandle) SwitchRole(ctx *gin.Context) {
-
+	reply := r.res.New()
+	token, err := r.sv.SwitchRole(ctx.Query("role"), ctx)
+	if err != nil {
+		reply.WithCode(consts.SwitchRoleFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("切换角色成功").WithData(gin.H{"token": token}).Success(ctx)
 }
@@ -15,25 +15,36 @@
 package handler
 
 import (
+	"bufio"
+	"errors"
 	"github.com/gin-gonic/gin"
 	service "github.com/go-grain/grain/internal/service/system"
 	_ "github.com/go-grain/grain/model/system"
 	model "github.com/go-grain/grain/model/system"
 	jsonx "github.com/go-grain/grain/pkg/encoding/json"
 	"github.com/go-grain/grain/pkg/response"
+	storagex "github.com/go-grain/grain/pkg/storage"
 	consts "github.com/go-grain/grain/utils/const"
 	"github.com/go-grain/grain/utils/upload"
+	"io"
+	"mime"
+	"net/http"
+	"path"
 	"strconv"
+	"strings"
 )
 
 type UploadHandle struct {
-	res response.Response
-	sv  *service.UploadService
+	res  response.Response
+	sv   *service.UploadService
+	root http.Dir
 }
 
-func NewUploadHandle(sv *service.UploadService) *UploadHandle {
+// NewUploadHandle root 为本地文件根目录, 用于下载本地驱动保存的文件
+func NewUploadHandle(sv *service.UploadService, root string) *UploadHandle {
 	return &UploadHandle{
-		sv: sv,
+		sv:   sv,
+		root: http.Dir(root),
 	}
 }
 
@@ -46,25 +57,54 @@ func NewUploadHandle(sv *service.UploadService) *UploadHandle {
 // @Produce json
 // @Accept multipart/form-data
 // @Param file formData file true "文件"
+// @Param visibility formData string false "可见范围 public private, 默认 private"
 // @Success 200  {object} model.ErrorRes "成功"
 // @Failure 500  {object} model.ErrorRes "失败"
 // @Router /upload [post]
 func (r *UploadHandle) UploadFile(ctx *gin.Context) {
 	reply := r.res.New()
 
-	file, err := upload.UploadFile(ctx, "systemFile")
+	// 写入存储之前先检查配额
+	if header, err := ctx.FormFile("file"); err == nil {
+		if err = r.sv.CheckQuota(header.Size, ctx); err != nil {
+			r.quotaFail(ctx, err)
+			return
+		}
+	}
+
+	f, err := upload.OpenFile(ctx, "file")
+	var rejected *upload.PolicyError
+	if errors.As(err, &rejected) {
+		reply.WithCode(consts.UploadFileRejected).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
 	if err != nil {
-		reply.WithCode(500).WithMessage(err.Error()).Fail(ctx)
+		reply.WithCode(consts.UploadFileFail).WithMessage(err.Error()).Fail(ctx)
 		return
 	}
+	defer f.Close()
 
+	file := f.Upload
 	file.FilePurpose = "普通文件"
-	err = r.sv.CreateUpload(file, ctx)
-	if err != nil {
-		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+	file.Visibility = model.VisibilityPrivate
+	if ctx.PostForm("visibility") == model.VisibilityPublic {
+		file.Visibility = model.VisibilityPublic
+	}
+	if err = r.sv.SaveUpload(f, ctx); err != nil {
+		r.quotaFail(ctx, err)
+		return
+	}
+	reply.WithMessage("上传文件成功").WithData(jsonx.G{"id": file.ID, "fileUrl": r.sv.FileURL(file)}).Success(ctx)
+}
+
+// quotaFail 超出存储配额时返回单独的错误码, 其它错误按请求失败处理
+func (r *UploadHandle) quotaFail(ctx *gin.Context, err error) {
+	reply := r.res.New()
+	if errors.Is(err, service.ErrQuotaExceeded) {
+		reply.WithCode(consts.UploadQuotaExceeded).WithMessage(err.Error()).Fail(ctx)
 		return
 	}
-	reply.WithMessage("上传文件成功").WithData(jsonx.G{"fileUrl": file.FileUrl}).Success(ctx)
+	reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
 }
 
 // GetUploadList
@@ -144,3 +184,526 @@ func (r *UploadHandle) DeleteUploadByIds(ctx *gin.Context) {
 	}
 	reply.WithMessage("删除文件成功").Success(ctx)
 }
+
+// InitUploadSession 创建分片上传会话
+// @Security ApiKeyAuth
+// @Summary 创建分片上传会话
+// @Description 创建分片上传会话, 返回分片大小和分片数量
+// @Tags 上传文件
+// @Accept json
+// @Produce json
+// @Param data body model.UploadSessionReq true "文件名 文件大小 SHA-256"
+// @Success 200  {object} model.UploadSession "成功"
+// @Failure 500  {object} model.ErrorRes "失败"
+// @Router /upload/session [post]
+func (r *UploadHandle) InitUploadSession(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.UploadSessionReq{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	session, err := r.sv.InitUploadSession(&req, ctx)
+	var rejected *upload.PolicyError
+	if errors.As(err, &rejected) {
+		reply.WithCode(consts.UploadFileRejected).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	if err != nil {
+		r.quotaFail(ctx, err)
+		return
+	}
+	reply.WithMessage("成功").WithData(session).Success(ctx)
+}
+
+// GetUploadSession 查询分片上传会话
+// @Security ApiKeyAuth
+// @Summary 查询分片上传会话
+// @Description 查询分片上传会话以及已收到的分片, 用于断点续传
+// @Tags 上传文件
+// @Accept json
+// @Produce json
+// @Param uploadId query string true "上传会话ID"
+// @Success 200  {object} model.UploadSession "成功"
+// @Failure 500  {object} model.ErrorRes "失败"
+// @Router /upload/session [get]
+func (r *UploadHandle) GetUploadSession(ctx *gin.Context) {
+	reply := r.res.New()
+	session, err := r.sv.GetUploadSession(ctx.Query("uploadId"), ctx)
+	if err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").WithData(session).Success(ctx)
+}
+
+// UploadChunk 上传分片
+// @Security ApiKeyAuth
+// @Summary 上传分片
+// @Description 上传分片, 分片序号从 0 开始
+// @Tags 上传文件
+// @Accept multipart/form-data
+// @Produce json
+// @Param uploadId formData string true "上传会话ID"
+// @Param index formData int true "分片序号"
+// @Param file formData file true "分片"
+// @Success 200  {object} model.UploadSession "成功"
+// @Failure 500  {object} model.ErrorRes "失败"
+// @Router /upload/session/chunk [post]
+func (r *UploadHandle) UploadChunk(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.UploadChunkReq{}
+	if err := ctx.ShouldBind(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	file, err := ctx.FormFile("file")
+	if err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("分片不能为空").Fail(ctx)
+		return
+	}
+	session, err := r.sv.UploadChunk(&req, file, ctx)
+	if err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").WithData(session).Success(ctx)
+}
+
+// CompleteUploadSession 完成分片上传
+// @Security ApiKeyAuth
+// @Summary 完成分片上传
+// @Description 合并分片并校验 SHA-256
+// @Tags 上传文件
+// @Accept json
+// @Produce json
+// @Param data body object true "上传会话ID uploadId"
+// @Success 200  {object} model.ErrorRes "成功"
+// @Failure 500  {object} model.ErrorRes "失败"
+// @Router /upload/session/complete [post]
+func (r *UploadHandle) CompleteUploadSession(ctx *gin.Context) {
+	reply := r.res.New()
+	req := struct {
+		UploadId string `json:"uploadId" binding:"required"`
+	}{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	file, err := r.sv.CompleteUploadSession(req.UploadId, ctx)
+	var rejected *upload.PolicyError
+	if errors.As(err, &rejected) {
+		reply.WithCode(consts.UploadFileRejected).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	if err != nil {
+		r.quotaFail(ctx, err)
+		return
+	}
+	reply.WithMessage("上传文件成功").WithData(jsonx.G{"id": file.ID, "fileUrl": r.sv.FileURL(file)}).Success(ctx)
+}
+
+// InstantUpload 秒传
+// @Security ApiKeyAuth
+// @Summary 秒传
+// @Description 提交秒传校验挑战的回答 hex(SHA-256(nonce + 文件指定范围的内容)), 通过后直接引用已有的文件
+// @Tags 上传文件
+// @Accept json
+// @Produce json
+// @Param data body model.UploadInstantReq true "上传会话ID以及校验结果"
+// @Success 200  {object} model.ErrorRes "成功"
+// @Failure 500  {object} model.ErrorRes "失败"
+// @Router /upload/session/instant [post]
+func (r *UploadHandle) InstantUpload(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.UploadInstantReq{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	file, err := r.sv.InstantUpload(&req, ctx)
+	if err != nil {
+		r.quotaFail(ctx, err)
+		return
+	}
+	reply.WithMessage("上传文件成功").WithData(jsonx.G{"id": file.ID, "fileUrl": r.sv.FileURL(file)}).Success(ctx)
+}
+
+// AbortUploadSession 取消分片上传
+// @Security ApiKeyAuth
+// @Summary 取消分片上传
+// @Description 取消分片上传并删除已上传的分片
+// @Tags 上传文件
+// @Accept json
+// @Produce json
+// @Param uploadId query string true "上传会话ID"
+// @Success 200  {object} model.ErrorRes "成功"
+// @Failure 500  {object} model.ErrorRes "失败"
+// @Router /upload/session [delete]
+func (r *UploadHandle) AbortUploadSession(ctx *gin.Context) {
+	reply := r.res.New()
+	if err := r.sv.AbortUploadSession(ctx.Query("uploadId"), ctx); err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").Success(ctx)
+}
+
+// GetUploadUsage 存储用量报表
+// @Security ApiKeyAuth
+// @Summary 存储用量报表
+// @Description 按用户以及文件用途统计文件数和占用空间
+// @Tags 上传文件
+// @Accept json
+// @Produce json
+// @Success 200  {object} model.UploadUsageRes "成功"
+// @Failure 500  {object} model.ErrorRes "失败"
+// @Router /upload/usage [get]
+func (r *UploadHandle) GetUploadUsage(ctx *gin.Context) {
+	reply := r.res.New()
+	res, err := r.sv.GetUploadUsage(ctx)
+	if err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage("统计存储用量失败").Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").WithData(res).Success(ctx)
+}
+
+// ServeFile 通过 uploads 路径直接访问本地文件, 只能访问公开的文件
+// @Summary 访问文件
+// @Description 访问本地存储的公开文件, 支持 Range 请求
+// @Tags 上传文件
+// @Param filepath path string true "文件路径"
+// @Param preset query string false "图片规格 例如 avatar128 thumbnail"
+// @Success 200 {file} file "文件内容"
+// @Failure 404 "文件不存在"
+// @Router /uploads/{filepath} [get]
+func (r *UploadHandle) ServeFile(ctx *gin.Context) {
+	key := strings.TrimPrefix(ctx.Param("filepath"), "/")
+	// 权限按对象键判断, 只接受规范的路径, 避免 // ../ ./ 之类的写法绕过
+	if key == "" || path.Clean("/"+key) != "/"+key {
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+	if strings.HasPrefix(key, upload.ChunkPrefix) || !r.sv.PublicObject(key) {
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+	// 按内容寻址的文件可以通过 preset 参数获取图片规格, 原图的 Hash 取自公开的上传记录, 不使用路径中的内容
+	if preset := ctx.Query("preset"); preset != "" {
+		file, ok := r.sv.PublicUpload(key)
+		if !ok {
+			ctx.Status(http.StatusNotFound)
+			return
+		}
+		r.serveVariant(ctx, file, preset, false)
+		return
+	}
+	r.serveLocal(ctx, key, "")
+}
+
+// Download 下载文件, 非公开的文件需要是上传者 共享的角色或者有附件管理权限
+// @Security ApiKeyAuth
+// @Summary 下载文件
+// @Description 下载文件, 支持 Range 请求, 对象存储中的文件会重定向到临时访问地址
+// @Tags 上传文件
+// @Param id query int true "文件ID"
+// @Param preset query string false "图片规格 例如 avatar128 thumbnail"
+// @Success 200 {file} file "文件内容"
+// @Failure 403 "无权访问"
+// @Failure 404 "文件不存在"
+// @Router /upload/download [get]
+func (r *UploadHandle) Download(ctx *gin.Context) {
+	uploadId, _ := strconv.Atoi(ctx.Query("id"))
+	file, err := r.sv.GetDownload(uint(uploadId), ctx)
+	r.serveUpload(ctx, file, err, false)
+}
+
+// SignedDownload 通过带签名的临时地址下载文件, 不需要登录
+// @Summary 通过临时地址下载文件
+// @Description 校验签名以及有效期, 支持 Range 请求. 一次性地址下载对象存储中的文件时由服务端读取后返回, 不支持 Range
+// @Tags 上传文件
+// @Param id path int true "文件ID"
+// @Param expires query int true "过期时间戳"
+// @Param nonce query string false "一次性地址的随机数"
+// @Param signature query string true "签名"
+// @Param preset query string false "图片规格 例如 avatar128 thumbnail"
+// @Success 200 {file} file "文件内容"
+// @Failure 403 "签名无效或已过期"
+// @Failure 404 "文件不存在"
+// @Router /upload/file/{id} [get]
+func (r *UploadHandle) SignedDownload(ctx *gin.Context) {
+	uploadId, _ := strconv.Atoi(ctx.Param("id"))
+	nonce := ctx.Query("nonce")
+	file, err := r.sv.GetSignedDownload(uint(uploadId), ctx.Query("expires"), nonce, ctx.Query("signature"), ctx)
+	// 一次性地址不能重定向到可以重复使用的临时访问地址
+	r.serveUpload(ctx, file, err, nonce != "")
+}
+
+// serveUpload stream 为 true 时对象存储中的文件由服务端读取后返回, 不重定向
+func (r *UploadHandle) serveUpload(ctx *gin.Context, file *model.Upload, err error, stream bool) {
+	switch {
+	case errors.Is(err, service.ErrUploadNotFound):
+		ctx.String(http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, service.ErrUploadForbidden):
+		ctx.String(http.StatusForbidden, err.Error())
+		return
+	case err != nil:
+		ctx.String(http.StatusInternalServerError, "下载文件失败")
+		return
+	}
+	if preset := ctx.Query("preset"); preset != "" {
+		r.serveVariant(ctx, file, preset, stream)
+		return
+	}
+	if key, ok := r.sv.LocalKey(file); ok {
+		r.serveLocal(ctx, key, file.FileName)
+		return
+	}
+	r.serveObject(ctx, file.Storage, file.FileKey, file.FileName, stream)
+}
+
+// serveVariant 返回图片规格, 第一次访问时生成
+func (r *UploadHandle) serveVariant(ctx *gin.Context, file *model.Upload, preset string, stream bool) {
+	variant, err := r.sv.Variant(ctx, file, preset)
+	switch {
+	case errors.Is(err, service.ErrVariantUnsupported):
+		ctx.String(http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, service.ErrVariantUnavailable):
+		ctx.Header("Retry-After", "1")
+		ctx.String(http.StatusServiceUnavailable, err.Error())
+		return
+	case errors.Is(err, service.ErrUploadNotFound):
+		ctx.String(http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		ctx.String(http.StatusInternalServerError, "图片处理失败")
+		return
+	}
+	r.serveObject(ctx, variant.Storage, variant.FileKey, "", stream)
+}
+
+// serveObject 本地文件直接返回, 对象存储中的文件重定向到临时访问地址, stream 为 true 时读取后返回
+func (r *UploadHandle) serveObject(ctx *gin.Context, driver, key, filename string, stream bool) {
+	if driver == "" || driver == "local" {
+		r.serveLocal(ctx, key, filename)
+		return
+	}
+	if stream {
+		r.streamObject(ctx, driver, key, filename)
+		return
+	}
+	url, err := r.sv.PresignedURL(driver, key, ctx)
+	if err != nil {
+		ctx.String(http.StatusInternalServerError, "下载文件失败")
+		return
+	}
+	ctx.Redirect(http.StatusFound, url)
+}
+
+// serveLocal 按文件内容识别 Content-Type 并禁止浏览器再次嗅探,
+// 只有图片 音视频 PDF 等类型可以在浏览器内直接打开, 其它类型一律作为附件下载
+func (r *UploadHandle) serveLocal(ctx *gin.Context, key, filename string) {
+	f, err := r.root.Open("/" + key)
+	if err != nil {
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		return
+	}
+	setFileHeader(ctx, head[:n], filename)
+	http.ServeContent(ctx.Writer, ctx.Request, info.Name(), info.ModTime(), f)
+}
+
+// streamObject 读取对象存储中的文件后返回, 不支持 Range 请求
+func (r *UploadHandle) streamObject(ctx *gin.Context, driver, key, filename string) {
+	rc, obj, err := r.sv.OpenObject(driver, key, ctx)
+	if errors.Is(err, storagex.ErrNotExist) {
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		ctx.String(http.StatusInternalServerError, "下载文件失败")
+		return
+	}
+	defer rc.Close()
+
+	br := bufio.NewReaderSize(rc, 512)
+	head, _ := br.Peek(512)
+	setFileHeader(ctx, head, filename)
+	if obj.Size >= 0 {
+		ctx.Writer.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	}
+	ctx.Status(http.StatusOK)
+	if ctx.Request.Method == http.MethodHead {
+		return
+	}
+	_, _ = io.Copy(ctx.Writer, br)
+}
+
+// setFileHeader 按文件开头的内容设置 Content-Type 和 Content-Disposition
+func setFileHeader(ctx *gin.Context, head []byte, filename string) {
+	mimeType := upload.DetectMime(head)
+	disposition := "attachment"
+	if upload.InlineMime(mimeType) {
+		disposition = "inline"
+	}
+	if filename != "" {
+		disposition = mime.FormatMediaType(disposition, map[string]string{"filename": filename})
+	}
+
+	header := ctx.Writer.Header()
+	header.Set("Content-Type", mimeType)
+	header.Set("Content-Disposition", disposition)
+	header.Set("X-Content-Type-Options", "nosniff")
+}
+
+// UpdateVisibility 修改文件可见范围
+// @Security ApiKeyAuth
+// @Summary 修改文件可见范围
+// @Description 只能修改自己上传的文件, 可见范围为 roles 时共享给 sharedRoles 中的角色
+// @Tags 上传文件
+// @Accept json
+// @Produce json
+// @Param data body model.UploadVisibilityReq true "可见范围"
+// @Success 200  {object} model.ErrorRes "成功"
+// @Failure 500  {object} model.ErrorRes "失败"
+// @Router /upload/visibility [put]
+func (r *UploadHandle) UpdateVisibility(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.UploadVisibilityReq{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	if err := r.sv.UpdateVisibility(&req, ctx); err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").Success(ctx)
+}
+
+// SignURL 生成临时下载地址
+// @Security ApiKeyAuth
+// @Summary 生成临时下载地址
+// @Description 生成带签名和有效期的下载地址, 可以设置为只能使用一次
+// @Tags 上传文件
+// @Accept json
+// @Produce json
+// @Param data body model.UploadSignReq true "文件ID以及有效期"
+// @Success 200  {object} model.UploadSignRes "成功"
+// @Failure 500  {object} model.ErrorRes "失败"
+// @Router /upload/sign [post]
+func (r *UploadHandle) SignURL(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.UploadSignReq{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	res, err := r.sv.SignURL(&req, ctx)
+	if err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").WithData(res).Success(ctx)
+}
+
+// GetUserQuota 当前用户的存储用量以及配额
+// @Security ApiKeyAuth
+// @Summary 我的存储用量
+// @Description 返回已用空间 文件数以及配额, 配额为 0 表示不限制
+// @Tags 上传文件
+// @Accept json
+// @Produce json
+// @Success 200  {object} model.UploadQuotaRes "成功"
+// @Failure 500  {object} model.ErrorRes "失败"
+// @Router /upload/quota [get]
+func (r *UploadHandle) GetUserQuota(ctx *gin.Context) {
+	reply := r.res.New()
+	res, err := r.sv.GetUserQuota(ctx)
+	if err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage("查询存储用量失败").Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").WithData(res).Success(ctx)
+}
+
+// GetQuotaList 存储配额列表
+// @Security ApiKeyAuth
+// @Summary 存储配额列表
+// @Description 角色以及用户的存储配额
+// @Tags 上传文件
+// @Accept json
+// @Produce json
+// @Success 200  {object} []model.UploadQuota "成功"
+// @Failure 500  {object} model.ErrorRes "失败"
+// @Router /upload/quota/list [get]
+func (r *UploadHandle) GetQuotaList(ctx *gin.Context) {
+	reply := r.res.New()
+	list, err := r.sv.GetQuotaList(ctx)
+	if err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage("查询存储配额失败").Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").WithData(list).Success(ctx)
+}
+
+// SetQuota 设置存储配额
+// @Security ApiKeyAuth
+// @Summary 设置存储配额
+// @Description 设置角色或者用户的存储配额, 用户配额优先于角色配额
+// @Tags 上传文件
+// @Accept json
+// @Produce json
+// @Param data body model.UploadQuotaReq true "配额"
+// @Success 200  {object} model.ErrorRes "成功"
+// @Failure 500  {object} model.ErrorRes "失败"
+// @Router /upload/quota [put]
+func (r *UploadHandle) SetQuota(ctx *gin.Context) {
+	reply := r.res.New()
+	req := model.UploadQuotaReq{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		reply.WithCode(consts.InvalidParameter).WithMessage("参数解析失败").Fail(ctx)
+		return
+	}
+	if err := r.sv.SetQuota(&req, ctx); err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage(err.Error()).Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").Success(ctx)
+}
+
+// DeleteQuotaById 删除存储配额
+// @Security ApiKeyAuth
+// @Summary 删除存储配额
+// @Description 删除后按角色配额或者默认配额计算
+// @Tags 上传文件
+// @Accept json
+// @Produce json
+// @Param id query int true "配额ID"
+// @Success 200  {object} model.ErrorRes "成功"
+// @Failure 500  {object} model.ErrorRes "失败"
+// @Router /upload/quota [delete]
+func (r *UploadHandle) DeleteQuotaById(ctx *gin.Context) {
+	reply := r.res.New()
+	id, _ := strconv.Atoi(ctx.Query("id"))
+	if err := r.sv.DeleteQuotaById(uint(id), ctx); err != nil {
+		reply.WithCode(consts.ReqFail).WithMessage("删除存储配额失败").Fail(ctx)
+		return
+	}
+	reply.WithMessage("成功").Success(ctx)
+}
@@ -0,0 +1,341 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package data
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	sysModel "github.com/go-grain/grain/model/system"
+	jsonx "github.com/go-grain/grain/pkg/encoding/json"
+	tracex "github.com/go-grain/grain/pkg/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	auditBeforeKey = "grain:audit_before"
+	// 与 JwtAuth 中间件塞进 gin.Context 的 key 保持一致
+	auditUIDKey = tracex.UIDKey
+)
+
+// auditIgnoreFields 不参与 diff 计算的字段
+var auditIgnoreFields = map[string]struct{}{
+	"updated_at": {},
+}
+
+// auditRedactKeywords 列名包含这些关键字的字段不把值写入审计记录
+var auditRedactKeywords = []string{"password", "secret", "token", "private_key", "access_key", "api_key", "salt"}
+
+// AuditPlugin 基于 Gorm callback 的字段级审计插件,
+// 只处理实现了 model.Auditable 的模型, 操作人和请求ID从 Statement.Context 中获取,
+// 所以需要审计的写操作请使用 query.WithContext(ctx) 把 gin.Context 传进来
+type AuditPlugin struct{}
+
+func (AuditPlugin) Name() string {
+	return "grain:audit"
+}
+
+func (p AuditPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().After("gorm:create").Register("grain:audit_after_create", p.afterCreate); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("grain:audit_before_update", p.before); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register("grain:audit_after_update", p.afterUpdate); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("grain:audit_before_delete", p.before); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:delete").Register("grain:audit_after_delete", p.afterDelete)
+}
+
+func (p AuditPlugin) before(db *gorm.DB) {
+	if !auditable(db) {
+		return
+	}
+	db.InstanceSet(auditBeforeKey, auditSnapshot(db, nil))
+}
+
+func (p AuditPlugin) afterCreate(db *gorm.DB) {
+	if !auditable(db) || db.RowsAffected == 0 {
+		return
+	}
+	after := auditSnapshot(db, auditPrimaryKeys(db.Statement))
+	p.save(db, sysModel.AuditCreate, nil, after)
+}
+
+func (p AuditPlugin) afterUpdate(db *gorm.DB) {
+	if !auditable(db) || db.RowsAffected == 0 {
+		return
+	}
+	before := auditBefore(db)
+	if len(before) == 0 {
+		return
+	}
+	pk := db.Statement.Schema.PrioritizedPrimaryField
+	ids := make([]interface{}, 0, len(before))
+	for _, row := range before {
+		ids = append(ids, row[pk.DBName])
+	}
+	p.save(db, sysModel.AuditUpdate, before, auditSnapshot(db, ids))
+}
+
+func (p AuditPlugin) afterDelete(db *gorm.DB) {
+	if !auditable(db) || db.RowsAffected == 0 {
+		return
+	}
+	p.save(db, sysModel.AuditDelete, auditBefore(db), nil)
+}
+
+func (p AuditPlugin) save(db *gorm.DB, action string, before, after []map[string]interface{}) {
+	pk := db.Statement.Schema.PrioritizedPrimaryField
+	uid, requestId := auditActor(db.Statement.Context)
+
+	afterById := make(map[string]map[string]interface{}, len(after))
+	for _, row := range after {
+		afterById[fmt.Sprint(row[pk.DBName])] = row
+	}
+
+	redact := auditRedactFields(db)
+	var audits []*sysModel.SysAudit
+	appendAudit := func(id string, b, a map[string]interface{}) {
+		// 先用原始值计算 diff, 脱敏字段被修改时仍然会出现在变更列表中
+		diff := auditDiff(b, a)
+		if action == sysModel.AuditUpdate && len(diff) == 0 {
+			return
+		}
+		b, a = auditRedactRow(b, redact), auditRedactRow(a, redact)
+		for i := range diff {
+			if redact(diff[i].Field) {
+				diff[i].Before, diff[i].After = auditRedactValue(diff[i].Before), auditRedactValue(diff[i].After)
+			}
+		}
+		audits = append(audits, &sysModel.SysAudit{
+			Entity:    db.Statement.Table,
+			RecordID:  id,
+			Action:    action,
+			UID:       uid,
+			RequestID: requestId,
+			Before:    auditJSON(b),
+			After:     auditJSON(a),
+			Diff:      auditJSON(diff),
+		})
+	}
+
+	if action == sysModel.AuditCreate {
+		for id, row := range afterById {
+			appendAudit(id, nil, row)
+		}
+	} else {
+		for _, row := range before {
+			id := fmt.Sprint(row[pk.DBName])
+			appendAudit(id, row, afterById[id])
+		}
+	}
+	if len(audits) == 0 {
+		return
+	}
+
+	// 与业务写操作共用同一个连接(事务), 审计记录写入失败只打印日志不影响业务
+	err := db.Session(&gorm.Session{NewDB: true}).Create(&audits).Error
+	if err != nil {
+		db.Logger.Error(db.Statement.Context, "写入审计记录失败: %v", err)
+	}
+}
+
+func auditable(db *gorm.DB) bool {
+	if db.Error != nil || db.Statement.Schema == nil || db.Statement.Schema.PrioritizedPrimaryField == nil {
+		return false
+	}
+	m, ok := reflect.New(db.Statement.Schema.ModelType).Interface().(sysModel.Auditable)
+	return ok && m.Audited()
+}
+
+// auditRedactFields 返回判断字段是否需要脱敏的函数, 包括默认关键字和模型 AuditRedact 返回的字段
+func auditRedactFields(db *gorm.DB) func(field string) bool {
+	extra := map[string]struct{}{}
+	if m, ok := reflect.New(db.Statement.Schema.ModelType).Interface().(sysModel.AuditRedactor); ok {
+		for _, f := range m.AuditRedact() {
+			extra[f] = struct{}{}
+		}
+	}
+	return func(field string) bool {
+		if _, ok := extra[field]; ok {
+			return true
+		}
+		name := strings.ToLower(field)
+		for _, kw := range auditRedactKeywords {
+			if strings.Contains(name, kw) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// auditRedactRow 复制一份快照, 脱敏字段的非空值替换为 AuditRedacted
+func auditRedactRow(row map[string]interface{}, redact func(string) bool) map[string]interface{} {
+	if row == nil {
+		return nil
+	}
+	res := make(map[string]interface{}, len(row))
+	for k, v := range row {
+		if redact(k) {
+			v = auditRedactValue(v)
+		}
+		res[k] = v
+	}
+	return res
+}
+
+// auditRedactValue 非空值替换为 AuditRedacted, 空值保持原样, 仍然能看出字段有没有设置
+func auditRedactValue(v interface{}) interface{} {
+	if v == nil || fmt.Sprint(v) == "" {
+		return v
+	}
+	return sysModel.AuditRedacted
+}
+
+func auditBefore(db *gorm.DB) []map[string]interface{} {
+	v, ok := db.InstanceGet(auditBeforeKey)
+	if !ok {
+		return nil
+	}
+	rows, _ := v.([]map[string]interface{})
+	return rows
+}
+
+// auditSnapshot 按主键或者当前语句的 WHERE 条件查询出受影响的记录快照
+func auditSnapshot(db *gorm.DB, ids []interface{}) []map[string]interface{} {
+	stmt := db.Statement
+	pk := stmt.Schema.PrioritizedPrimaryField
+	tx := db.Session(&gorm.Session{NewDB: true}).Table(stmt.Table)
+
+	if ids == nil {
+		hasCond := false
+		if c, ok := stmt.Clauses["WHERE"]; ok {
+			if where, ok := c.Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+				tx.Statement.AddClause(where)
+				hasCond = true
+			}
+		}
+		if keys := auditPrimaryKeys(stmt); len(keys) > 0 {
+			tx.Statement.AddClause(clause.Where{Exprs: []clause.Expression{clause.IN{Column: pk.DBName, Values: keys}}})
+			hasCond = true
+		}
+		// 没有任何条件的语句不做快照, 避免全表扫描
+		if !hasCond {
+			return nil
+		}
+	} else {
+		if len(ids) == 0 {
+			return nil
+		}
+		tx.Statement.AddClause(clause.Where{Exprs: []clause.Expression{clause.IN{Column: pk.DBName, Values: ids}}})
+	}
+
+	var rows []map[string]interface{}
+	if err := tx.Find(&rows).Error; err != nil {
+		db.Logger.Error(stmt.Context, "获取审计快照失败: %v", err)
+		return nil
+	}
+	for _, row := range rows {
+		for k, v := range row {
+			if b, ok := v.([]byte); ok {
+				row[k] = string(b)
+			}
+		}
+	}
+	return rows
+}
+
+// auditPrimaryKeys 从 Statement 绑定的模型中取出非零主键
+func auditPrimaryKeys(stmt *gorm.Statement) []interface{} {
+	pk := stmt.Schema.PrioritizedPrimaryField
+	rv := stmt.ReflectValue
+	var ids []interface{}
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			elem := reflect.Indirect(rv.Index(i))
+			if elem.Type() != stmt.Schema.ModelType {
+				return nil
+			}
+			if v, zero := pk.ValueOf(stmt.Context, elem); !zero {
+				ids = append(ids, v)
+			}
+		}
+	case reflect.Struct:
+		if rv.Type() != stmt.Schema.ModelType {
+			return nil
+		}
+		if v, zero := pk.ValueOf(stmt.Context, rv); !zero {
+			ids = append(ids, v)
+		}
+	}
+	return ids
+}
+
+func auditDiff(before, after map[string]interface{}) []sysModel.AuditDiff {
+	keys := make([]string, 0, len(before)+len(after))
+	seen := make(map[string]struct{}, len(before)+len(after))
+	for _, m := range []map[string]interface{}{before, after} {
+		for k := range m {
+			if _, ok := seen[k]; ok {
+				continue
+			}
+			seen[k] = struct{}{}
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var diff []sysModel.AuditDiff
+	for _, k := range keys {
+		if _, ok := auditIgnoreFields[k]; ok {
+			continue
+		}
+		b, a := before[k], after[k]
+		if fmt.Sprint(b) == fmt.Sprint(a) {
+			continue
+		}
+		diff = append(diff, sysModel.AuditDiff{Field: k, Before: b, After: a})
+	}
+	return diff
+}
+
+func auditJSON(v interface{}) string {
+	if rv := reflect.ValueOf(v); !rv.IsValid() || rv.IsNil() {
+		return ""
+	}
+	return string(jsonx.Marshal(v))
+}
+
+// auditActor 取出操作人UID和请求ID, gin.Context 的 Value 方法会直接读取 ctx.Keys, 请求ID由 RequestID 中间件生成
+func auditActor(ctx context.Context) (uid, requestId string) {
+	if ctx == nil {
+		return
+	}
+	uid, _ = ctx.Value(auditUIDKey).(string)
+	requestId = tracex.RequestID(ctx)
+	return
+}
@@ -0,0 +1,260 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package data
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	sysModel "github.com/go-grain/grain/model/system"
+	tracex "github.com/go-grain/grain/pkg/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// auditUser 开启审计的测试模型, password api_secret 按默认关键字脱敏, note 由 AuditRedact 指定脱敏
+type auditUser struct {
+	ID        uint `gorm:"primarykey"`
+	Name      string
+	Password  string
+	ApiSecret string
+	Note      string
+	UpdatedAt time.Time
+}
+
+func (auditUser) TableName() string {
+	return "audit_users"
+}
+
+func (auditUser) Audited() bool {
+	return true
+}
+
+func (auditUser) AuditRedact() []string {
+	return []string{"note"}
+}
+
+const auditPlain = "hunter2"
+
+func newAuditDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接各有一份, 限制为一个连接
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err = db.AutoMigrate(&auditUser{}, &sysModel.SysAudit{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Use(&AuditPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// auditContext 模拟经过 JwtAuth 和 RequestID 中间件的 gin.Context
+func auditContext() *gin.Context {
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	ctx.Set(tracex.UIDKey, "u1")
+	ctx.Set(tracex.RequestIDKey, "req-1")
+	return ctx
+}
+
+func audits(t *testing.T, db *gorm.DB) []*sysModel.SysAudit {
+	t.Helper()
+	var list []*sysModel.SysAudit
+	if err := db.Order("id").Find(&list).Error; err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func auditDiffs(t *testing.T, audit *sysModel.SysAudit) map[string]sysModel.AuditDiff {
+	t.Helper()
+	var diff []sysModel.AuditDiff
+	if err := json.Unmarshal([]byte(audit.Diff), &diff); err != nil {
+		t.Fatal(err)
+	}
+	res := map[string]sysModel.AuditDiff{}
+	for _, d := range diff {
+		res[d.Field] = d
+	}
+	return res
+}
+
+// assertRedacted 脱敏字段的原始值不能出现在任何快照中
+func assertRedacted(t *testing.T, audit *sysModel.SysAudit) {
+	t.Helper()
+	for _, s := range []string{audit.Before, audit.After, audit.Diff} {
+		if strings.Contains(s, auditPlain) {
+			t.Errorf("%s 审计记录中出现了脱敏字段的原始值: %s", audit.Action, s)
+		}
+	}
+}
+
+func TestAuditCreate(t *testing.T) {
+	db := newAuditDB(t)
+	user := &auditUser{Name: "tom", Password: auditPlain, ApiSecret: auditPlain, Note: auditPlain}
+	if err := db.WithContext(auditContext()).Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	list := audits(t, db)
+	if len(list) != 1 {
+		t.Fatalf("审计记录 %d 条, 期望 1 条", len(list))
+	}
+	a := list[0]
+	if a.Action != sysModel.AuditCreate || a.Entity != "audit_users" || a.RecordID != "1" {
+		t.Errorf("审计记录 = %s %s %s", a.Action, a.Entity, a.RecordID)
+	}
+	if a.UID != "u1" || a.RequestID != "req-1" {
+		t.Errorf("操作人 = %q 请求ID = %q", a.UID, a.RequestID)
+	}
+	if a.Before != "" || !strings.Contains(a.After, `"tom"`) {
+		t.Errorf("创建快照 before = %q after = %q", a.Before, a.After)
+	}
+	diff := auditDiffs(t, a)
+	if d := diff["name"]; d.Before != nil || d.After != "tom" {
+		t.Errorf("name 变更 = %+v", d)
+	}
+	for _, f := range []string{"password", "api_secret", "note"} {
+		if d, ok := diff[f]; !ok || d.Before != nil || d.After != sysModel.AuditRedacted {
+			t.Errorf("%s 变更 = %+v, 期望脱敏", f, d)
+		}
+	}
+	assertRedacted(t, a)
+}
+
+func TestAuditUpdate(t *testing.T) {
+	db := newAuditDB(t)
+	user := &auditUser{Name: "tom", Password: "old-password"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := auditContext()
+	if err := db.WithContext(ctx).Model(user).Updates(map[string]interface{}{"name": "jerry", "password": auditPlain}).Error; err != nil {
+		t.Fatal(err)
+	}
+	list := audits(t, db)
+	if len(list) != 2 {
+		t.Fatalf("审计记录 %d 条, 期望 2 条", len(list))
+	}
+	a := list[1]
+	if a.Action != sysModel.AuditUpdate || a.RecordID != "1" || a.UID != "u1" || a.RequestID != "req-1" {
+		t.Errorf("审计记录 = %s %s %q %q", a.Action, a.RecordID, a.UID, a.RequestID)
+	}
+	if !strings.Contains(a.Before, `"tom"`) || !strings.Contains(a.After, `"jerry"`) {
+		t.Errorf("更新快照 before = %q after = %q", a.Before, a.After)
+	}
+	diff := auditDiffs(t, a)
+	if d := diff["name"]; d.Before != "tom" || d.After != "jerry" {
+		t.Errorf("name 变更 = %+v", d)
+	}
+	// 脱敏字段被修改时出现在变更列表中, 但只记录脱敏后的值
+	if d, ok := diff["password"]; !ok || d.Before != sysModel.AuditRedacted || d.After != sysModel.AuditRedacted {
+		t.Errorf("password 变更 = %+v, 期望脱敏", d)
+	}
+	if _, ok := diff["updated_at"]; ok {
+		t.Error("updated_at 不应该出现在变更列表中")
+	}
+	if strings.Contains(a.Before, "old-password") {
+		t.Errorf("修改前快照中出现了旧密码: %s", a.Before)
+	}
+	assertRedacted(t, a)
+
+	// 值没有变化的更新不写审计记录
+	if err := db.WithContext(ctx).Model(user).Update("name", "jerry").Error; err != nil {
+		t.Fatal(err)
+	}
+	if n := len(audits(t, db)); n != 2 {
+		t.Errorf("没有变化的更新写入了审计记录, 共 %d 条", n)
+	}
+}
+
+func TestAuditDelete(t *testing.T) {
+	db := newAuditDB(t)
+	users := []*auditUser{{Name: "tom", Password: auditPlain}, {Name: "jerry"}}
+	if err := db.Create(users).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.WithContext(auditContext()).Where("name = ?", "tom").Delete(&auditUser{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	list := audits(t, db)
+	if len(list) != 3 {
+		t.Fatalf("审计记录 %d 条, 期望 3 条", len(list))
+	}
+	a := list[2]
+	if a.Action != sysModel.AuditDelete || a.RecordID != "1" || a.UID != "u1" || a.RequestID != "req-1" {
+		t.Errorf("审计记录 = %s %s %q %q", a.Action, a.RecordID, a.UID, a.RequestID)
+	}
+	if !strings.Contains(a.Before, `"tom"`) || a.After != "" {
+		t.Errorf("删除快照 before = %q after = %q", a.Before, a.After)
+	}
+	// 删除后没有值, 只有修改前的值脱敏
+	if d := auditDiffs(t, a)["password"]; d.Before != sysModel.AuditRedacted || d.After != nil {
+		t.Errorf("password 变更 = %+v, 期望脱敏", d)
+	}
+	assertRedacted(t, a)
+}
+
+func TestAuditDiff(t *testing.T) {
+	before := map[string]interface{}{"id": 1, "name": "tom", "age": int64(3), "updated_at": "a"}
+	after := map[string]interface{}{"id": 1, "name": "jerry", "age": 3, "updated_at": "b", "email": "x"}
+	diff := auditDiff(before, after)
+	// 按字段名排序, 忽略 updated_at, 数值类型不同但值相同不算变化
+	if len(diff) != 2 || diff[0].Field != "email" || diff[1].Field != "name" {
+		t.Fatalf("diff = %+v", diff)
+	}
+	if diff[0].Before != nil || diff[0].After != "x" {
+		t.Errorf("email 变更 = %+v", diff[0])
+	}
+}
+
+func TestAuditRedactRow(t *testing.T) {
+	redact := func(field string) bool { return field == "password" || field == "token" }
+	row := map[string]interface{}{"name": "tom", "password": auditPlain, "token": ""}
+	res := auditRedactRow(row, redact)
+	if res["password"] != sysModel.AuditRedacted || res["name"] != "tom" {
+		t.Errorf("脱敏结果 = %v", res)
+	}
+	// 空值保持为空, 能区分有没有设置
+	if res["token"] != "" {
+		t.Errorf("空值不应该替换, token = %v", res["token"])
+	}
+	// 不修改原始快照
+	if row["password"] != auditPlain {
+		t.Error("auditRedactRow 修改了原始快照")
+	}
+	if auditRedactRow(nil, redact) != nil {
+		t.Error("nil 快照应该返回 nil")
+	}
+}
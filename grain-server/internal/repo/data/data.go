@@ -34,29 +34,31 @@ type DB struct {
 	DB *gorm.DB
 }
 
-func InitDB(conf config.Config) (*gorm.DB, error) {
+func InitDB(conf config.Config) (gormDB *gorm.DB, err error) {
 	switch conf.DataBase.Driver {
 	case dbMySQL:
-		mysql, err := InitMysql(conf)
-		if err != nil {
-			return nil, err
-		}
-		return mysql, err
+		gormDB, err = InitMysql(conf)
 	case dbPostgres:
-		pgsql, err := InitPgsql(conf.DataBase)
-		if err != nil {
-			return nil, err
-		}
-		return pgsql, err
+		gormDB, err = InitPgsql(conf)
 	case dbTidb:
-		tidb, err := InitTiDB(conf.DataBase)
-		if err != nil {
-			return nil, err
-		}
-		return tidb, err
+		gormDB, err = InitTiDB(conf)
 	default:
 		return nil, errors.New("数据库配置有问题")
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 注册 SQL 链路追踪插件
+	if err = gormDB.Use(&TracingPlugin{}); err != nil {
+		return nil, err
+	}
+
+	// 注册字段级审计插件
+	if err = gormDB.Use(&AuditPlugin{}); err != nil {
+		return nil, err
+	}
+	return gormDB, nil
 }
 
 func NewDB() *DB {
@@ -74,6 +76,18 @@ func (db *DB) autoMigrate() error {
 		sysModel.Project{},
 		sysModel.Models{},
 		sysModel.Fields{},
+		sysModel.SysAudit{},
+		sysModel.SysSms{},
+		sysModel.SysMail{},
+		sysModel.UploadBlob{},
+		sysModel.UploadVariant{},
+		sysModel.UploadQuota{},
+		sysModel.UploadUserUsage{},
+		sysModel.SysMessage{},
+		sysModel.SysNotification{},
+		sysModel.SysAnnouncement{},
+		sysModel.SysJob{},
+		sysModel.SysJobLog{},
 	)
 	if err != nil {
 		return err
@@ -0,0 +1,60 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package data
+
+import (
+	"github.com/go-grain/grain/config"
+	rotatex "github.com/go-grain/grain/pkg/rotate"
+	"gorm.io/gorm/logger"
+	"io"
+	stdlog "log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// NewLogWriter 按 log 配置创建滚动日志文件, 文件放在 log_path 目录下
+func NewLogWriter(conf config.Log, name string) *rotatex.Writer {
+	dir := conf.LogPath
+	if dir == "" {
+		dir = "log"
+	}
+	return rotatex.New(rotatex.Options{
+		Filename:   filepath.Join(dir, name),
+		MaxSize:    conf.SplitSize,
+		Interval:   conf.SplitTime,
+		MaxBackups: conf.MaxBackups,
+		MaxAge:     conf.MaxAge,
+		Compress:   conf.Compress,
+	})
+}
+
+// newGormLogger SQL 日志, debug 模式下输出到控制台, 其它模式写入 log_path 下以驱动命名的文件, 例如 mysql.log
+func newGormLogger(conf config.Config) logger.Interface {
+	var out io.Writer = os.Stdout
+	debug := conf.Gin.Model == "debug"
+	if !debug {
+		out = NewLogWriter(conf.Log, conf.DataBase.Driver+".log")
+	}
+	return logger.New(
+		stdlog.New(out, "\r\n", stdlog.LstdFlags), // io writer（日志输出的目标，前缀和日志包含的内容——译者注）
+		logger.Config{
+			SlowThreshold:             200 * time.Millisecond, // 慢 SQL 阈值
+			LogLevel:                  conf.DataBase.LogLevel, // 日志级别
+			IgnoreRecordNotFoundError: true,                   // 忽略ErrRecordNotFound（记录未找到）错误
+			Colorful:                  debug,                  // 非 debug 模式禁用彩色打印
+		},
+	)
+}
@@ -21,6 +21,9 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
+// mongoClient 最近一次初始化的 MongoDB 连接, 供健康检查使用
+var mongoClient *mongo.Client
+
 type MongoDB struct {
 	Client     *mongo.Client
 	Database   *mongo.Database
@@ -28,7 +31,7 @@ type MongoDB struct {
 }
 
 func (m *MongoDB) NewMongoDBRepo(mongoUrl, dbName, collection string) (err error) {
-	clientOptions := options.Client().ApplyURI(mongoUrl)
+	clientOptions := options.Client().ApplyURI(mongoUrl).SetMonitor(newMongoMonitor())
 
 	m.Client, err = mongo.Connect(context.Background(), clientOptions)
 	if err != nil {
@@ -40,8 +43,14 @@ func (m *MongoDB) NewMongoDBRepo(mongoUrl, dbName, collection string) (err error
 		return err
 	}
 
+	mongoClient = m.Client
 	m.Database = m.Client.Database(dbName)
 	m.Collection = m.Database.Collection(collection)
 
 	return nil
 }
+
+// GetMongo 获取 MongoDB 连接, 未初始化时返回 nil
+func GetMongo() *mongo.Client {
+	return mongoClient
+}
@@ -16,33 +16,20 @@ package data
 
 import (
 	"github.com/go-grain/grain/config"
-	"github.com/go-pay/gopay/pkg/xlog"
+	"github.com/go-grain/grain/log"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
-	"log"
-	"os"
 	"time"
 )
 
-func InitPgsql(conf config.DataBase) (*gorm.DB, error) {
-	newLogger := logger.New(
-		log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer（日志输出的目标，前缀和日志包含的内容——译者注）
-		logger.Config{
-			SlowThreshold:             200 * time.Millisecond,               // 慢 SQL 阈值
-			LogLevel:                  config.GetConfig().DataBase.LogLevel, // 日志级别
-			IgnoreRecordNotFoundError: true,                                 // 忽略ErrRecordNotFound（记录未找到）错误
-			Colorful:                  true,                                 // 禁用彩色打印
-		},
-	)
-
+func InitPgsql(conf config.Config) (*gorm.DB, error) {
 	pgsqlConfig := postgres.Config{
 		DriverName: "postgres",
-		DSN:        conf.Pgsql.Source,
+		DSN:        conf.DataBase.Pgsql.Source,
 	}
-	gormDB, err := gorm.Open(postgres.New(pgsqlConfig), &gorm.Config{Logger: newLogger})
+	gormDB, err := gorm.Open(postgres.New(pgsqlConfig), &gorm.Config{Logger: newGormLogger(conf)})
 	if err != nil {
-		log.Println(err)
+		log.Error(err)
 		return nil, err
 	}
 
@@ -51,12 +38,12 @@ func InitPgsql(conf config.DataBase) (*gorm.DB, error) {
 	sqlDB.SetMaxOpenConns(500)
 	sqlDB.SetConnMaxIdleTime(time.Second * 5)
 	sqlDB.SetConnMaxLifetime(time.Hour)
-	xlog.Info("初始化Pgsql成功")
+	log.Info("初始化Pgsql成功")
 
 	db = &DB{DB: gormDB}
 	err = db.autoMigrate()
 	if err != nil {
-		xlog.Info("Pgsql AutoMigrate error", err.Error())
+		log.Errorw("msg", "Pgsql AutoMigrate error", "err", err.Error())
 		return nil, err
 	}
 	return gormDB, err
@@ -16,326 +16,296 @@ package data
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"github.com/go-grain/grain/config"
+	"github.com/go-grain/grain/log"
 	jsonx "github.com/go-grain/grain/pkg/encoding/json"
 	redisx "github.com/go-grain/grain/pkg/redis"
-	"github.com/go-pay/gopay/pkg/xlog"
 	"github.com/redis/go-redis/v9"
-	"strconv"
+	"os"
+	"sync"
 	"time"
 )
 
 var rdb *Redis
 
+const (
+	RedisModeStandalone = "standalone"
+	RedisModeSentinel   = "sentinel"
+	RedisModeCluster    = "cluster"
+)
+
 type Redis struct {
-	Client *redis.Client
-	ctx    context.Context
+	// 单机为 *redis.Client, 哨兵为主节点的 *redis.Client, 集群为 *redis.ClusterClient
+	Client redis.UniversalClient
 }
 
 func InitRedis() (client redisx.IRedis, err error) {
-	conf := config.GetConfig().DataBase.Redis
-	rdbClient := redis.NewClient(&redis.Options{
-		Addr:         conf.Addr,
-		Password:     conf.Password,
-		Username:     conf.UserName,
-		DB:           conf.DB,
-		WriteTimeout: conf.WriteTimeout,
-		ReadTimeout:  conf.ReadTimeout,
-	})
+	rdbClient, err := newRedisClient()
+	if err != nil {
+		return nil, err
+	}
+	// Redis 命令链路追踪
+	rdbClient.AddHook(redisTracingHook{})
 	_, err = rdbClient.Ping(context.Background()).Result()
 	if err != nil {
+		_ = rdbClient.Close()
 		return nil, errors.New("Redis 连接失败: " + err.Error())
 	}
-	xlog.Debug("初始化Redis成功")
+	log.Info("初始化Redis成功")
 	rdb = &Redis{
 		Client: rdbClient,
-		ctx:    context.Background(),
+	}
+	if err = rdb.LoadScripts(context.Background()); err != nil {
+		return nil, err
 	}
 	return rdb, nil
 }
 
-func GetRedis() *Redis {
-	return rdb
-}
-
-func (rs Redis) Subscribe(channel string) *redis.PubSub {
-	pubs := rs.Client.Subscribe(rs.ctx, channel)
-	return pubs
-}
-
-func (rs Redis) Publish(data []byte, channel string) error {
-	err := rs.Client.Publish(rs.ctx, channel, data).Err()
-	if err != nil {
-		return err
+// newRedisClient 按部署模式创建客户端
+func newRedisClient() (redis.UniversalClient, error) {
+	conf := config.GetConfig().DataBase.Redis
+	opts := &redis.UniversalOptions{
+		Addrs:            conf.Addrs,
+		DB:               conf.DB,
+		Username:         conf.UserName,
+		Password:         conf.Password,
+		MasterName:       conf.MasterName,
+		SentinelUsername: conf.SentinelUserName,
+		SentinelPassword: conf.SentinelPassword,
+		DialTimeout:      conf.DialTimeout,
+		ReadTimeout:      conf.ReadTimeout,
+		WriteTimeout:     conf.WriteTimeout,
+		PoolSize:         conf.PoolSize,
+		MinIdleConns:     conf.MinIdleConns,
+		PoolTimeout:      conf.PoolTimeout,
 	}
-	return nil
-}
-
-func (rs Redis) Set(key string, value interface{}, ex time.Duration) {
-	err := rs.Client.Set(rs.ctx, key, value, ex*time.Second).Err()
-	if err != nil {
-		fmt.Println(err)
+	if conf.TLS.Enable {
+		tlsConf, err := redisTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSConfig = tlsConf
 	}
-}
 
-func (rs Redis) Get(key string) string {
-	val, err := rs.Client.Get(rs.ctx, key).Result()
-	if err != nil {
-		return ""
+	switch conf.Mode {
+	case "", RedisModeStandalone:
+		if len(opts.Addrs) == 0 {
+			opts.Addrs = []string{conf.Addr}
+		}
+		if opts.Addrs[0] == "" {
+			return nil, errors.New("Redis 单机模式需要配置 addr")
+		}
+		return redis.NewClient(opts.Simple()), nil
+	case RedisModeSentinel:
+		if len(opts.Addrs) == 0 || opts.MasterName == "" {
+			return nil, errors.New("Redis 哨兵模式需要配置 addrs 和 master_name")
+		}
+		return redis.NewFailoverClient(opts.Failover()), nil
+	case RedisModeCluster:
+		if len(opts.Addrs) == 0 {
+			return nil, errors.New("Redis 集群模式需要配置 addrs")
+		}
+		if opts.DB != 0 {
+			return nil, errors.New("Redis 集群模式只支持 db 0")
+		}
+		return redis.NewClusterClient(opts.Cluster()), nil
+	default:
+		return nil, fmt.Errorf("不支持的 Redis 部署模式: %s", conf.Mode)
 	}
-	return val
 }
 
-func (rs Redis) Del(key string) int64 {
-	val, err := rs.Client.Del(rs.ctx, key).Result()
-	if err != nil {
-		return 0
+func redisTLSConfig() (*tls.Config, error) {
+	conf := config.GetConfig().DataBase.Redis.TLS
+	tlsConf := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         conf.ServerName,
+		InsecureSkipVerify: conf.InsecureSkipVerify,
 	}
-	return val
-}
-
-func (rs Redis) GetInt64(key string) (int64, error) {
-	result, err := rs.Client.Get(rs.ctx, key).Result()
-	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			return 0, nil
+	if conf.CAFile != "" {
+		ca, err := os.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取 Redis CA 证书: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.New("Redis CA 证书格式错误")
 		}
-		return 0, err
+		tlsConf.RootCAs = pool
 	}
-	return strconv.ParseInt(result, 10, 64)
-}
-
-func (rs Redis) GetInt(key string) (int, error) {
-	result, err := rs.Client.Get(rs.ctx, key).Result()
-	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			return 0, nil
+	if conf.CertFile != "" || conf.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取 Redis 客户端证书: %w", err)
 		}
-		return 0, err
+		tlsConf.Certificates = []tls.Certificate{cert}
 	}
-	return strconv.Atoi(result)
+	return tlsConf, nil
 }
 
-func (rs Redis) SetInt(key string, value int64, expiration time.Duration) error {
-	return rs.Client.Set(rs.ctx, key, strconv.FormatInt(value, 10), expiration*time.Second).Err()
+func GetRedis() *Redis {
+	return rdb
 }
 
-func (rs Redis) IncrInt(key string, value int64) (int64, error) {
-	return rs.Client.IncrBy(rs.ctx, key, value).Result()
+func (rs Redis) Subscribe(ctx context.Context, channels ...string) *redis.PubSub {
+	return rs.Client.Subscribe(ctx, channels...)
 }
 
-func (rs Redis) DecrInt(key string, value int64) (int64, error) {
-	return rs.Client.DecrBy(rs.ctx, key, value).Result()
+func (rs Redis) Publish(ctx context.Context, channel string, message interface{}) error {
+	return rs.Client.Publish(ctx, channel, message).Err()
 }
 
-func (rs Redis) GetFloat(key string) (float64, error) {
-	result, err := rs.Client.Get(rs.ctx, key).Result()
-	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			return 0, nil
-		}
-		return 0, err
-	}
-	return strconv.ParseFloat(result, 64)
+func (rs Redis) Get(ctx context.Context, key string) (string, error) {
+	return rs.Client.Get(ctx, key).Result()
 }
 
-func (rs Redis) SetFloat(key string, value float64, expiration time.Duration) error {
-	return rs.Client.Set(rs.ctx, key, strconv.FormatFloat(value, 'f', -1, 64), expiration*time.Second).Err()
+func (rs Redis) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	return rs.Client.Set(ctx, key, value, expiration).Err()
 }
 
-func (rs Redis) IncrFloat(key string, value float64) (float64, error) {
-	return rs.Client.IncrByFloat(rs.ctx, key, value).Result()
+func (rs Redis) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	return rs.Client.SetNX(ctx, key, value, expiration).Result()
 }
 
-func (rs Redis) GetObject(key string, v interface{}) error {
-	result, err := rs.Client.Get(rs.ctx, key).Result()
-	if err != nil {
-		//if errors.Is(err, redis.Nil) {
-		//	return nil
-		//}
-		return err
-	}
-	return jsonx.Unmarshal([]byte(result), v)
+func (rs Redis) Del(ctx context.Context, keys ...string) (int64, error) {
+	return rs.Client.Del(ctx, keys...).Result()
 }
 
-func (rs Redis) SetObject(key string, value any, expiration time.Duration) error {
-	data := jsonx.Marshal(value)
-	if data == nil {
-		return errors.New("SetObject Fail")
-	}
-	return rs.Client.Set(rs.ctx, key, data, expiration*time.Second).Err()
+func (rs Redis) Exists(ctx context.Context, key string) (bool, error) {
+	n, err := rs.Client.Exists(ctx, key).Result()
+	return n == 1, err
 }
 
-func (rs Redis) Incr(key string, value interface{}) (interface{}, error) {
-	switch v := value.(type) {
-	case int64:
-		return rs.IncrInt(key, v)
-	case float64:
-		return rs.IncrFloat(key, v)
-	default:
-		return nil, fmt.Errorf("unsupported type: %T", v)
-	}
+func (rs Redis) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	return rs.Client.Expire(ctx, key, expiration).Result()
 }
 
-func (rs Redis) SetEx(key string, t time.Duration) {
-	rs.Client.Expire(rs.ctx, key, t*time.Second)
+func (rs Redis) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return rs.Client.TTL(ctx, key).Result()
 }
 
-func (rs Redis) GetTTL(key string) float64 {
-	ttlResult, err := rs.Client.TTL(rs.ctx, key).Result()
-	if err != nil {
-		// 处理错误
+func (rs Redis) Scan(ctx context.Context, match string, count int64) ([]string, error) {
+	cluster, ok := rs.Client.(*redis.ClusterClient)
+	if !ok {
+		return scanKeys(ctx, rs.Client, match, count)
 	}
-	return ttlResult.Seconds()
+	// 集群中每个主节点只保存自己槽位的 key, 需要逐个节点扫描后合并
+	var (
+		mu   sync.Mutex
+		keys []string
+	)
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		nodeKeys, err := scanKeys(ctx, node, match, count)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		keys = append(keys, nodeKeys...)
+		mu.Unlock()
+		return nil
+	})
+	return keys, err
 }
 
-func (rs Redis) Scan(key string, count int64) []string {
-	var cursor uint64
+func scanKeys(ctx context.Context, client redis.Cmdable, match string, count int64) ([]string, error) {
 	var keys []string
-	var allKeys []string
-	for {
-
-		var err error
-		keys, cursor, err = rs.Client.Scan(rs.ctx, cursor, fmt.Sprintf("%s:*", key), 10).Result()
-		if err != nil {
-			return nil
-		}
+	iter := client.Scan(ctx, 0, match, count).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
 
-		for _, key := range keys {
-			allKeys = append(allKeys, key)
-		}
+func (rs Redis) GetInt(ctx context.Context, key string) (int, error) {
+	n, err := rs.GetInt64(ctx, key)
+	return int(n), err
+}
 
-		// 没有更多key了
-		if cursor == 0 {
-			break
-		}
+func (rs Redis) GetInt64(ctx context.Context, key string) (int64, error) {
+	n, err := rs.Client.Get(ctx, key).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
 	}
-	return allKeys
+	return n, err
 }
 
-func (rs Redis) SetNX(key string, value interface{}, expiration time.Duration) error {
-	result := rdb.Client.SetNX(rs.ctx, key, value, expiration*time.Second)
-	if result.Val() {
-		return nil
-	} else {
-		return errors.New("key已存在")
+func (rs Redis) GetFloat(ctx context.Context, key string) (float64, error) {
+	f, err := rs.Client.Get(ctx, key).Float64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
 	}
+	return f, err
 }
 
-func (rs Redis) ZAdd(key string, data interface{}) error {
-	marshal := jsonx.Marshal(data)
-	if marshal == nil {
-		return errors.New("ZAdd操作失败")
-	}
-	score := float64(time.Now().Unix())
-	member := marshal
-	result := rdb.Client.ZAdd(rs.ctx, key, redis.Z{Score: score, Member: member})
-	_, err := result.Result()
-	if err != nil {
-		return err
-	}
-	return nil
+func (rs Redis) IncrBy(ctx context.Context, key string, value int64) (int64, error) {
+	return rs.Client.IncrBy(ctx, key, value).Result()
 }
 
-func (rs Redis) ZRange(key string) []string {
-	var v []string
-	result := rdb.Client.ZRange(rs.ctx, key, 0, -1)
-	dates := result.Val()
-	for _, val := range dates {
-		v = append(v, val)
-	}
-	return v
+func (rs Redis) DecrBy(ctx context.Context, key string, value int64) (int64, error) {
+	return rs.Client.DecrBy(ctx, key, value).Result()
 }
 
-func (rs Redis) UserSign(userID string) error {
-	date := time.Now().Format("2006-01-02")
-	score := float64(time.Now().Unix())
-	member := date
+func (rs Redis) IncrByFloat(ctx context.Context, key string, value float64) (float64, error) {
+	return rs.Client.IncrByFloat(ctx, key, value).Result()
+}
 
-	key := fmt.Sprintf("user:%s:sign", userID)
-	// 判断用户是否已经签到过了
-	result := rdb.Client.ZRank(rs.ctx, key, member)
-	_, err := result.Result()
+func (rs Redis) GetObject(ctx context.Context, key string, v interface{}) error {
+	data, err := rs.Client.Get(ctx, key).Bytes()
 	if err != nil {
-		// 用户未签到过，执行签到操作
-		rdb.Client.ZAdd(rs.ctx, key, redis.Z{Score: score, Member: member})
-		xlog.Debug("签到成功！")
-
-		//// 查询用户签到情况
-		//result := client.ZRange(rs.ctx, key, 0, -1)
-		//dates := result.Val()
-		//for _, date := range dates {
-		//	xlog.Debug(date)
-		//}
-		return nil
-	} else {
-		// 用户已经签到过，不能重复签到
-		return errors.New("您今天已经签到过了")
+		return err
 	}
+	return jsonx.Unmarshal(data, v)
 }
 
-func (rs Redis) Exists(key string) (bool, error) {
-	exists, err := rdb.Client.Exists(rs.ctx, key).Result()
-	if err != nil {
-		return false, err
+func (rs Redis) SetObject(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	data := jsonx.Marshal(value)
+	if data == nil {
+		return fmt.Errorf("序列化 %s 失败", key)
 	}
+	return rs.Client.Set(ctx, key, data, expiration).Err()
+}
 
-	if exists == 1 {
-		return true, nil
-	} else {
-		return false, nil
-	}
+func (rs Redis) ZAdd(ctx context.Context, key string, members ...redis.Z) error {
+	return rs.Client.ZAdd(ctx, key, members...).Err()
 }
 
-func (rs Redis) Enqueue(key string, item interface{}) error {
-	data := jsonx.Marshal(item)
-	return rs.Client.LPush(rs.ctx, key, data).Err()
+func (rs Redis) ZRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	return rs.Client.ZRange(ctx, key, start, stop).Result()
 }
 
-func (rs Redis) Dequeue(key string, item interface{}) error {
-	result, err := rs.Client.BRPop(rs.ctx, 0, key).Result()
-	if err != nil {
-		return err
-	}
-	if len(result) != 2 {
-		return errors.New("invalid result length")
-	}
-	data := result[1]
-	return jsonx.Unmarshal([]byte(data), item)
+func (rs Redis) SAdd(ctx context.Context, key string, members ...interface{}) error {
+	return rs.Client.SAdd(ctx, key, members...).Err()
 }
 
-// Peek returns the first item from the queue without removing it.
-func (rs Redis) Peek(key string, item interface{}) error {
-	result, err := rs.Client.LIndex(rs.ctx, key, 0).Result()
-	if err == redis.Nil {
-		return errors.New("queue is empty")
-	}
+func (rs Redis) SMembers(ctx context.Context, key string) ([]string, error) {
+	return rs.Client.SMembers(ctx, key).Result()
+}
 
-	return jsonx.Unmarshal([]byte(result), item)
+func (rs Redis) Pipelined(ctx context.Context, fn func(pipe redis.Pipeliner) error) ([]redis.Cmder, error) {
+	return rs.Client.Pipelined(ctx, fn)
 }
 
-// Length returns the number of items in the queue.
-func (rs Redis) Length(key string) (int64, error) {
-	return rs.Client.LLen(rs.ctx, key).Result()
+func (rs Redis) TxPipelined(ctx context.Context, fn func(pipe redis.Pipeliner) error) ([]redis.Cmder, error) {
+	return rs.Client.TxPipelined(ctx, fn)
 }
 
-// Clear removes all items from the queue.
-func (rs Redis) Clear(key string) error {
-	return rs.Client.Del(rs.ctx, key).Err()
+func (rs Redis) Watch(ctx context.Context, fn func(tx *redis.Tx) error, keys ...string) error {
+	return rs.Client.Watch(ctx, fn, keys...)
 }
 
-// EnqueueWithTTL adds an item to the end of the queue with a TTL (time-to-live) value.
-func (rs Redis) EnqueueWithTTL(key string, item interface{}, ttl time.Duration) error {
-	data := jsonx.Marshal(item)
-	_, err := rs.Client.Pipelined(rs.ctx, func(pipe redis.Pipeliner) error {
-		pipe.LPush(rs.ctx, key, data)
-		pipe.Expire(rs.ctx, key, ttl*time.Second)
-		return nil
-	})
-	if err != nil {
-		return err
+func (rs Redis) RunScript(ctx context.Context, script *redisx.Script, keys []string, args ...interface{}) (interface{}, error) {
+	return script.Run(ctx, rs.Client, keys, args...).Result()
+}
+
+func (rs Redis) LoadScripts(ctx context.Context) error {
+	// 集群模式下 ScriptLoad 会在所有分片上加载, 故障切换后新节点缺少脚本时 Run 会退回 EVAL
+	for _, script := range redisx.Scripts() {
+		if err := script.Load(ctx, rs.Client).Err(); err != nil {
+			return fmt.Errorf("加载脚本 %s: %w", script.Name, err)
+		}
 	}
 	return nil
 }
@@ -17,35 +17,22 @@ package data
 import (
 	"errors"
 	"github.com/go-grain/grain/config"
-	"github.com/go-pay/gopay/pkg/xlog"
+	"github.com/go-grain/grain/log"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
-	"log"
-	"os"
 	"time"
 )
 
-func InitTiDB(conf config.DataBase) (*gorm.DB, error) {
-	newLogger := logger.New(
-		log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer（日志输出的目标，前缀和日志包含的内容——译者注）
-		logger.Config{
-			SlowThreshold:             200 * time.Millisecond,               // 慢 SQL 阈值
-			LogLevel:                  config.GetConfig().DataBase.LogLevel, // 日志级别
-			IgnoreRecordNotFoundError: true,                                 // 忽略ErrRecordNotFound（记录未找到）错误
-			Colorful:                  true,                                 // 禁用彩色打印
-		},
-	)
-
+func InitTiDB(conf config.Config) (*gorm.DB, error) {
 	mysqlConfig := mysql.Config{
-		DSN:                       conf.TiDB.Source, // DSN data source name
-		DefaultStringSize:         191,              // string 类型字段的默认长度
-		DisableDatetimePrecision:  false,            // 禁用 datetime 精度，MySQL 5.6 之前的数据库不支持
-		DontSupportRenameIndex:    true,             // 重命名索引时采用删除并新建的方式，MySQL 5.7 之前的数据库和 MariaDB 不支持重命名索引
-		DontSupportRenameColumn:   true,             // 用 `change` 重命名列，MySQL 8 之前的数据库和 MariaDB 不支持重命名列
-		SkipInitializeWithVersion: false,            // 根据版本自动配置
+		DSN:                       conf.DataBase.TiDB.Source, // DSN data source name
+		DefaultStringSize:         191,                       // string 类型字段的默认长度
+		DisableDatetimePrecision:  false,                     // 禁用 datetime 精度，MySQL 5.6 之前的数据库不支持
+		DontSupportRenameIndex:    true,                      // 重命名索引时采用删除并新建的方式，MySQL 5.7 之前的数据库和 MariaDB 不支持重命名索引
+		DontSupportRenameColumn:   true,                      // 用 `change` 重命名列，MySQL 8 之前的数据库和 MariaDB 不支持重命名列
+		SkipInitializeWithVersion: false,                     // 根据版本自动配置
 	}
-	gormDB, err := gorm.Open(mysql.New(mysqlConfig), &gorm.Config{Logger: newLogger})
+	gormDB, err := gorm.Open(mysql.New(mysqlConfig), &gorm.Config{Logger: newGormLogger(conf)})
 	if err != nil {
 		return nil, errors.New(err.Error())
 	}
@@ -59,11 +46,11 @@ func InitTiDB(conf config.DataBase) (*gorm.DB, error) {
 	db = &DB{DB: gormDB}
 	err = db.autoMigrate()
 	if err != nil {
-		xlog.Info("TiDB AutoMigrate error", err.Error())
+		log.Errorw("msg", "TiDB AutoMigrate error", "err", err.Error())
 		return nil, err
 	}
 
-	xlog.Info("初始化TiDB成功")
+	log.Info("初始化TiDB成功")
 
 	return gormDB, nil
 }
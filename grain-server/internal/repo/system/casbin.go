@@ -15,6 +15,7 @@
 package repo
 
 import (
+	"context"
 	"github.com/go-grain/grain/internal/repo/system/query"
 	service "github.com/go-grain/grain/internal/service/system"
 	"github.com/go-grain/grain/model/system"
@@ -30,8 +31,8 @@ func NewCasbinRepo() service.ICasbinRepo {
 	}
 }
 
-func (r *CasbinRepo) Update(roles []*model.CasbinRule) error {
-	if err := r.query.CasbinRule.Save(roles...); err != nil {
+func (r *CasbinRepo) Update(ctx context.Context, roles []*model.CasbinRule) error {
+	if err := r.query.CasbinRule.WithContext(ctx).Save(roles...); err != nil {
 		return err
 	}
 	return nil
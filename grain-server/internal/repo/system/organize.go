@@ -1,14 +1,15 @@
 package repo
 
 import (
+	"context"
 	"fmt"
 	"github.com/go-grain/grain/internal/repo/data"
 	"github.com/go-grain/grain/internal/repo/system/query"
 	service "github.com/go-grain/grain/internal/service/system"
 	model "github.com/go-grain/grain/model/system"
 	redisx "github.com/go-grain/grain/pkg/redis"
-	stringsx "github.com/go-grain/grain/pkg/strings"
 	"gorm.io/gorm"
+	"time"
 )
 
 type OrganizeRepo struct {
@@ -29,30 +30,32 @@ func NewOrganizeRepo(db *gorm.DB, rdb redisx.IRedis) service.IOrganizeRepo {
 	}
 }
 
-func (r *OrganizeRepo) CreateOrganize(organize *model.Organize) error {
-	return r.query.Organize.Create(organize)
+func (r *OrganizeRepo) CreateOrganize(ctx context.Context, organize *model.Organize) error {
+	return r.query.Organize.WithContext(ctx).Create(organize)
 }
 
-func (r *OrganizeRepo) UpdateOrganize(organize *model.Organize) error {
-	if _, err := r.query.Organize.Where(r.query.Organize.ID.Eq(organize.ID)).Updates(organize); err != nil {
+func (r *OrganizeRepo) UpdateOrganize(ctx context.Context, organize *model.Organize) error {
+	if _, err := r.query.Organize.WithContext(ctx).Where(r.query.Organize.ID.Eq(organize.ID)).Updates(organize); err != nil {
 		return err
 	}
 	Neworganize, err := r.query.Organize.Where(r.query.Organize.ID.Eq(organize.ID)).First()
 	if err != nil {
 		return err
 	}
-	_ = r.rdb.SetObject(fmt.Sprintf("%s:%d", organize.TableName(), organize.ID), Neworganize, 180)
+	_ = r.rdb.SetObject(ctx, fmt.Sprintf("%s:%d", organize.TableName(), organize.ID), Neworganize, 3*time.Minute)
 	return nil
 }
 
-func (r *OrganizeRepo) GetOrganizeById(id uint) (organize *model.Organize, err error) {
-	err = r.rdb.GetObject("", organize)
+func (r *OrganizeRepo) GetOrganizeById(ctx context.Context, id uint) (organize *model.Organize, err error) {
+	key := fmt.Sprintf("%s:%d", model.Organize{}.TableName(), id)
+	organize = &model.Organize{}
+	err = r.rdb.GetObject(ctx, key, organize)
 	if err != nil || organize.ID == 0 {
-		organize, err = r.query.Organize.Where(r.query.Organize.ID.Eq(id)).First()
+		organize, err = r.query.Organize.WithContext(ctx).Where(r.query.Organize.ID.Eq(id)).First()
 		if err != nil {
 			return nil, err
 		}
-		r.rdb.SetObject(stringsx.ToString(id), organize, 180)
+		_ = r.rdb.SetObject(ctx, key, organize, 3*time.Minute)
 	}
 	return
 }
@@ -98,15 +101,15 @@ func (r *OrganizeRepo) GetOrganizeList(req *model.OrganizeQuery) (list []*model.
 	return list, nil
 }
 
-func (r *OrganizeRepo) DeleteOrganizeById(id uint) error {
-	if _, err := r.query.Organize.Where(r.query.Organize.ID.Eq(id)).Delete(); err != nil {
+func (r *OrganizeRepo) DeleteOrganizeById(ctx context.Context, id uint) error {
+	if _, err := r.query.Organize.WithContext(ctx).Where(r.query.Organize.ID.Eq(id)).Delete(); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (r *OrganizeRepo) DeleteOrganizeByIds(ids []uint) error {
-	if _, err := r.query.Organize.Where(r.query.Organize.ID.In(ids...)).Delete(); err != nil {
+func (r *OrganizeRepo) DeleteOrganizeByIds(ctx context.Context, ids []uint) error {
+	if _, err := r.query.Organize.WithContext(ctx).Where(r.query.Organize.ID.In(ids...)).Delete(); err != nil {
 		return err
 	}
 	return nil
@@ -15,6 +15,7 @@
 package repo
 
 import (
+	"context"
 	"github.com/go-grain/grain/internal/repo/system/query"
 	service "github.com/go-grain/grain/internal/service/system"
 	"github.com/go-grain/grain/model/system"
@@ -35,8 +36,8 @@ func NewApiRepo(rdb redisx.IRedis) service.IApiRepo {
 	}
 }
 
-func (r *ApiRepo) CreateApi(api *model.SysApi) error {
-	return r.query.SysApi.Create(api)
+func (r *ApiRepo) CreateApi(ctx context.Context, api *model.SysApi) error {
+	return r.query.SysApi.WithContext(ctx).Create(api)
 }
 
 func (r *ApiRepo) GetApiList(req *model.SysApiReq) (list []*model.SysApi, err error) {
@@ -81,22 +82,22 @@ func (r *ApiRepo) GetAllApi() (list []*model.SysApi, err error) {
 	return
 }
 
-func (r *ApiRepo) UpdateApi(api *model.SysApi) error {
-	if _, err := r.query.SysApi.Updates(api); err != nil {
+func (r *ApiRepo) UpdateApi(ctx context.Context, api *model.SysApi) error {
+	if _, err := r.query.SysApi.WithContext(ctx).Updates(api); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (r *ApiRepo) DeleteApiById(id uint) error {
-	if _, err := r.query.SysApi.Where(r.query.SysApi.ID.Eq(id)).Delete(); err != nil {
+func (r *ApiRepo) DeleteApiById(ctx context.Context, id uint) error {
+	if _, err := r.query.SysApi.WithContext(ctx).Where(r.query.SysApi.ID.Eq(id)).Delete(); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (r *ApiRepo) DeleteApiByIds(ids []uint) error {
-	if _, err := r.query.SysApi.Where(r.query.SysApi.ID.In(ids...)).Delete(); err != nil {
+func (r *ApiRepo) DeleteApiByIds(ctx context.Context, ids []uint) error {
+	if _, err := r.query.SysApi.WithContext(ctx).Where(r.query.SysApi.ID.In(ids...)).Delete(); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,79 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"strings"
+
+	"github.com/go-grain/grain/internal/repo/system/query"
+	service "github.com/go-grain/grain/internal/service/system"
+	model "github.com/go-grain/grain/model/system"
+	timex "github.com/go-grain/grain/pkg/time"
+)
+
+type SysAuditRepo struct {
+	query *query.Query
+}
+
+func NewSysAuditRepo() service.ISysAuditRepo {
+	return &SysAuditRepo{
+		query: query.Q,
+	}
+}
+
+func (r *SysAuditRepo) GetAuditList(req *model.SysAuditReq) (list []*model.SysAudit, err error) {
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+
+	if req.PageSize <= 0 || req.PageSize >= 100 {
+		req.PageSize = 20
+	}
+
+	q := r.query.SysAudit.Where()
+
+	if req.Entity != "" {
+		q = q.Where(r.query.SysAudit.Entity.Eq(req.Entity))
+	}
+	if req.RecordID != "" {
+		q = q.Where(r.query.SysAudit.RecordID.Eq(req.RecordID))
+	}
+	if req.Actor != "" {
+		q = q.Where(r.query.SysAudit.UID.Eq(req.Actor))
+	}
+	if req.Action != "" {
+		q = q.Where(r.query.SysAudit.Action.Eq(req.Action))
+	}
+	if req.QueryTime != "" {
+		t := strings.Split(req.QueryTime, ",")
+		if len(t) == 2 {
+			s := timex.GetStringToDate(t[0], timex.YMD)
+			e := timex.GetStringToDate(t[1], timex.YMD)
+			q = q.Where(r.query.SysAudit.CreatedAt.Between(s, e))
+		}
+	}
+
+	count, err := q.Count()
+	if err != nil {
+		return nil, err
+	}
+	req.Total = count
+	q = q.Order(r.query.SysAudit.ID.Desc()).Limit(req.PageSize).Offset((req.Page - 1) * req.PageSize)
+	list, err = q.Find()
+	if err != nil {
+		return nil, err
+	}
+	return
+}
@@ -0,0 +1,152 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-grain/grain/internal/repo/system/query"
+	service "github.com/go-grain/grain/internal/service/system"
+	model "github.com/go-grain/grain/model/system"
+	"gorm.io/gorm"
+)
+
+// recyclable 软删除后进入回收站的数据, 超过保留期后彻底删除.
+// 上传文件的删除需要维护引用计数以及存储用量, 不在这里清理
+var recyclable = []any{
+	&model.SysUser{},
+	&model.SysRole{},
+	&model.SysApi{},
+	&model.SysMenu{},
+	&model.SysUserMenu{},
+	&model.Organize{},
+	&model.Project{},
+	&model.Models{},
+	&model.Fields{},
+	&model.SysNotification{},
+	&model.SysAnnouncement{},
+}
+
+type SysJobRepo struct {
+	query *query.Query
+}
+
+func NewSysJobRepo() service.ISysJobRepo {
+	return &SysJobRepo{
+		query: query.Q,
+	}
+}
+
+// SyncJob 同步代码中注册的任务, 新任务默认启用, 已有任务只更新表达式以及说明
+func (r *SysJobRepo) SyncJob(ctx context.Context, job *model.SysJob) error {
+	j := r.query.SysJob
+	old, err := j.WithContext(ctx).Where(j.Name.Eq(job.Name)).First()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		job.Enabled = true
+		return j.WithContext(ctx).Create(job)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = j.WithContext(ctx).Where(j.ID.Eq(old.ID)).UpdateSimple(j.Spec.Value(job.Spec), j.Description.Value(job.Description))
+	return err
+}
+
+func (r *SysJobRepo) GetJob(ctx context.Context, name string) (*model.SysJob, error) {
+	j := r.query.SysJob
+	return j.WithContext(ctx).Where(j.Name.Eq(name)).First()
+}
+
+func (r *SysJobRepo) GetJobs(ctx context.Context) ([]*model.SysJob, error) {
+	return r.query.SysJob.WithContext(ctx).Find()
+}
+
+func (r *SysJobRepo) SetEnabled(ctx context.Context, name string, enabled bool) error {
+	j := r.query.SysJob
+	_, err := j.WithContext(ctx).Where(j.Name.Eq(name)).UpdateSimple(j.Enabled.Value(enabled))
+	return err
+}
+
+func (r *SysJobRepo) CreateJobLog(ctx context.Context, jobLog *model.SysJobLog) error {
+	return r.query.SysJobLog.WithContext(ctx).Create(jobLog)
+}
+
+// GetLastJobLog 任务最近一次的执行记录, 没有执行过时返回 nil
+func (r *SysJobRepo) GetLastJobLog(ctx context.Context, name string) (*model.SysJobLog, error) {
+	l := r.query.SysJobLog
+	list, err := l.WithContext(ctx).Where(l.JobName.Eq(name)).Order(l.ID.Desc()).Limit(1).Find()
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+	return list[0], nil
+}
+
+func (r *SysJobRepo) GetJobLogList(req *model.SysJobLogReq) (list []*model.SysJobLog, err error) {
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+
+	if req.PageSize <= 0 || req.PageSize >= 100 {
+		req.PageSize = 20
+	}
+
+	l := r.query.SysJobLog
+	q := l.Where()
+	if req.JobName != "" {
+		q = q.Where(l.JobName.Eq(req.JobName))
+	}
+	if req.Status != "" {
+		q = q.Where(l.Status.Eq(req.Status))
+	}
+	if req.Trigger != "" {
+		q = q.Where(l.Trigger.Eq(req.Trigger))
+	}
+
+	count, err := q.Count()
+	if err != nil {
+		return nil, err
+	}
+	req.Total = count
+	return q.Order(l.ID.Desc()).Limit(req.PageSize).Offset((req.Page - 1) * req.PageSize).Find()
+}
+
+// PurgeJobLogs 删除 before 之前的执行记录
+func (r *SysJobRepo) PurgeJobLogs(ctx context.Context, before time.Time) (int64, error) {
+	l := r.query.SysJobLog
+	info, err := l.WithContext(ctx).Unscoped().Where(l.StartAt.Lt(before)).Delete()
+	return info.RowsAffected, err
+}
+
+// PurgeDeleted 彻底删除 before 之前软删除的数据, 返回每张表删除的行数
+func (r *SysJobRepo) PurgeDeleted(ctx context.Context, before time.Time) (map[string]int64, error) {
+	db := r.query.SysJob.WithContext(ctx).UnderlyingDB().Session(&gorm.Session{NewDB: true})
+	counts := map[string]int64{}
+	for _, m := range recyclable {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(m); err != nil {
+			return counts, err
+		}
+		res := db.Unscoped().Where("deleted_at < ?", before).Delete(m)
+		if res.Error != nil {
+			return counts, res.Error
+		}
+		if res.RowsAffected > 0 {
+			counts[stmt.Schema.Table] = res.RowsAffected
+		}
+	}
+	return counts, nil
+}
@@ -19,12 +19,13 @@ import (
 	"fmt"
 	"github.com/go-grain/grain/internal/repo/data"
 	service "github.com/go-grain/grain/internal/service/system"
+	"github.com/go-grain/grain/log"
 	model "github.com/go-grain/grain/model/system"
 	redisx "github.com/go-grain/grain/pkg/redis"
 	timex "github.com/go-grain/grain/pkg/time"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"log"
 	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -40,10 +41,10 @@ func NewMongoDBRepo(rdb redisx.IRedis, mongoUrl, dbName, collectionName string)
 	return &mongoDB, mongoDB.NewMongoDBRepo(mongoUrl, dbName, collectionName)
 }
 
-func (r *MongoDBRepo) CreateSysLog(operationLog *model.SysLog) error {
-	_, err := r.Collection.InsertOne(context.TODO(), operationLog)
+func (r *MongoDBRepo) CreateSysLog(ctx context.Context, operationLog *model.SysLog) error {
+	_, err := r.Collection.InsertOne(ctx, operationLog)
 	if err != nil {
-		log.Printf("Failed to create operationLog: %v", err)
+		log.Errorf("Failed to create operationLog: %v", err)
 		return err
 	}
 	return nil
@@ -76,6 +77,10 @@ func (r *MongoDBRepo) GetSysLogList(req *model.SysLogReq) ([]*model.SysLog, erro
 		filter["method"] = req.Method
 	}
 
+	if req.RequestID != "" {
+		filter["request_id"] = req.RequestID
+	}
+
 	if req.QueryTime != "" {
 		t := strings.Split(req.QueryTime, ",")
 		if len(t) == 2 {
@@ -86,8 +91,8 @@ func (r *MongoDBRepo) GetSysLogList(req *model.SysLogReq) ([]*model.SysLog, erro
 		}
 	}
 
-	fmt.Printf("%#v\n", req)
-	fmt.Printf("%#v\n", filter)
+	log.Debugf("%#v", req)
+	log.Debugf("%#v", filter)
 	options := options.Find()
 	options.SetSort(bson.M{"_id": -1})
 	options.SetSkip(int64((req.Page - 1) * req.PageSize))
@@ -100,7 +105,7 @@ func (r *MongoDBRepo) GetSysLogList(req *model.SysLogReq) ([]*model.SysLog, erro
 	req.Total = documents
 	cursor, err := r.Collection.Find(context.TODO(), filter, options)
 	if err != nil {
-		log.Printf("Failed to get operationLog list: %v", err)
+		log.Errorf("Failed to get operationLog list: %v", err)
 		return nil, err
 	}
 	defer cursor.Close(context.TODO())
@@ -110,14 +115,14 @@ func (r *MongoDBRepo) GetSysLogList(req *model.SysLogReq) ([]*model.SysLog, erro
 		var operationLog model.SysLog
 		err := cursor.Decode(&operationLog)
 		if err != nil {
-			log.Printf("Failed to decode operationLog: %v", err)
+			log.Errorf("Failed to decode operationLog: %v", err)
 			continue
 		}
 		operationLogs = append(operationLogs, &operationLog)
 	}
 
 	if err := cursor.Err(); err != nil {
-		log.Printf("Cursor error: %v", err)
+		log.Errorf("Cursor error: %v", err)
 		return nil, err
 	}
 
@@ -129,7 +134,7 @@ func (r *MongoDBRepo) DeleteSysLogById(id primitive.ObjectID, uid string) error
 
 	result, err := r.Collection.DeleteOne(context.TODO(), filter)
 	if err != nil {
-		log.Printf("Failed to delete operationLog: %v", err)
+		log.Errorf("Failed to delete operationLog: %v", err)
 		return err
 	}
 
@@ -150,7 +155,7 @@ func (r *MongoDBRepo) DeleteSysLogByIds(ids []primitive.ObjectID, uid string) er
 
 	result, err := r.Collection.DeleteMany(context.TODO(), filter)
 	if err != nil {
-		log.Printf("Failed to delete operationLogs: %v", err)
+		log.Errorf("Failed to delete operationLogs: %v", err)
 		return err
 	}
 
@@ -160,3 +165,12 @@ func (r *MongoDBRepo) DeleteSysLogByIds(ids []primitive.ObjectID, uid string) er
 
 	return nil
 }
+
+// PurgeSysLogs 删除 before 之前的操作日志
+func (r *MongoDBRepo) PurgeSysLogs(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.Collection.DeleteMany(ctx, bson.M{"created_at": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
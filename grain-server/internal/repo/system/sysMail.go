@@ -0,0 +1,132 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-grain/grain/internal/repo/system/query"
+	service "github.com/go-grain/grain/internal/service/system"
+	model "github.com/go-grain/grain/model/system"
+	timex "github.com/go-grain/grain/pkg/time"
+)
+
+type MailRepo struct {
+	query *query.Query
+}
+
+func NewMailRepo() service.IMailRepo {
+	return &MailRepo{
+		query: query.Q,
+	}
+}
+
+func (r *MailRepo) CreateMail(ctx context.Context, mail *model.SysMail) error {
+	return r.query.SysMail.WithContext(ctx).Create(mail)
+}
+
+// ClaimMail 把待发送的邮件标记为发送中, 同一封邮件只会被一个 worker 领取到,
+// 发送中但是在 staleBefore 之前就没有更新过的邮件视为 worker 异常退出遗留, 允许重新领取
+func (r *MailRepo) ClaimMail(id uint, staleBefore time.Time) (*model.SysMail, error) {
+	q := r.query.SysMail
+	info, err := q.Where(q.ID.Eq(id), q.Status.In(model.MailStatusPending, model.MailStatusRetry)).
+		Or(q.ID.Eq(id), q.Status.Eq(model.MailStatusSending), q.UpdatedAt.Lte(staleBefore)).
+		Update(q.Status, model.MailStatusSending)
+	if err != nil {
+		return nil, err
+	}
+	if info.RowsAffected == 0 {
+		return nil, nil
+	}
+	return q.Where(q.ID.Eq(id)).First()
+}
+
+func (r *MailRepo) UpdateMailStatus(mail *model.SysMail) error {
+	q := r.query.SysMail
+	_, err := q.Where(q.ID.Eq(mail.ID)).
+		Select(q.Status, q.Attempts, q.NextRetryAt, q.SentAt, q.Error, q.UpdatedAt).
+		Updates(mail)
+	return err
+}
+
+// GetDueMails 获取需要重新入队的邮件: 到达重试时间的, 长时间没有被领取的, 以及 worker 异常退出遗留的
+func (r *MailRepo) GetDueMails(now, staleBefore time.Time, limit int) ([]*model.SysMail, error) {
+	q := r.query.SysMail
+	return q.Select(q.ID).
+		Where(q.Status.Eq(model.MailStatusRetry), q.NextRetryAt.Lte(now)).
+		Or(q.Status.Eq(model.MailStatusPending), q.CreatedAt.Lte(now.Add(-time.Minute))).
+		Or(q.Status.Eq(model.MailStatusSending), q.UpdatedAt.Lte(staleBefore)).
+		Limit(limit).Find()
+}
+
+// ResetDeadMails 把死信重新置为待发送
+func (r *MailRepo) ResetDeadMails(ids []uint) ([]uint, error) {
+	q := r.query.SysMail
+	var reset []uint
+	err := q.Where(q.ID.In(ids...), q.Status.Eq(model.MailStatusDead)).Pluck(q.ID, &reset)
+	if err != nil || len(reset) == 0 {
+		return nil, err
+	}
+	_, err = q.Where(q.ID.In(reset...)).UpdateSimple(
+		q.Status.Value(model.MailStatusPending),
+		q.Attempts.Value(0),
+		q.Error.Value(""),
+	)
+	return reset, err
+}
+
+func (r *MailRepo) GetMailList(req *model.SysMailReq) (list []*model.SysMail, err error) {
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+
+	if req.PageSize <= 0 || req.PageSize >= 100 {
+		req.PageSize = 20
+	}
+
+	q := r.query.SysMail.Where()
+
+	if req.To != "" {
+		q = q.Where(r.query.SysMail.To.Eq(req.To))
+	}
+	if req.Template != "" {
+		q = q.Where(r.query.SysMail.Template.Eq(req.Template))
+	}
+	if req.Status != "" {
+		q = q.Where(r.query.SysMail.Status.Eq(req.Status))
+	}
+	if req.QueryTime != "" {
+		t := strings.Split(req.QueryTime, ",")
+		if len(t) == 2 {
+			s := timex.GetStringToDate(t[0], timex.YMD)
+			e := timex.GetStringToDate(t[1], timex.YMD)
+			q = q.Where(r.query.SysMail.CreatedAt.Between(s, e))
+		}
+	}
+
+	count, err := q.Count()
+	if err != nil {
+		return nil, err
+	}
+	req.Total = count
+	q = q.Order(r.query.SysMail.ID.Desc()).Limit(req.PageSize).Offset((req.Page - 1) * req.PageSize)
+	list, err = q.Find()
+	if err != nil {
+		return nil, err
+	}
+	return
+}
@@ -15,6 +15,7 @@
 package repo
 
 import (
+	"context"
 	"github.com/go-grain/grain/internal/repo/system/query"
 	service "github.com/go-grain/grain/internal/service/system"
 	"github.com/go-grain/grain/model/system"
@@ -33,8 +34,8 @@ func NewMenuRepo(rdb redisx.IRedis) service.IMenuRepo {
 	}
 }
 
-func (r *MenuRepo) CreateMenu(menu *model.SysMenu) error {
-	return r.query.SysMenu.Create(menu)
+func (r *MenuRepo) CreateMenu(ctx context.Context, menu *model.SysMenu) error {
+	return r.query.SysMenu.WithContext(ctx).Create(menu)
 }
 
 func (r *MenuRepo) GetMenuById(parentId uint) (menu *model.SysMenu, err error) {
@@ -71,29 +72,29 @@ func (r *MenuRepo) GetMenuListByParentId(req *model.SysMenuReq, parentId uint) (
 	return
 }
 
-func (r *MenuRepo) UpdateMenus(menu []*model.SysMenu) error {
-	if _, err := r.query.SysMenu.Updates(&menu); err != nil {
+func (r *MenuRepo) UpdateMenus(ctx context.Context, menu []*model.SysMenu) error {
+	if _, err := r.query.SysMenu.WithContext(ctx).Updates(&menu); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (r *MenuRepo) UpdateMenu(menu *model.SysMenu) error {
-	if _, err := r.query.SysMenu.Updates(menu); err != nil {
+func (r *MenuRepo) UpdateMenu(ctx context.Context, menu *model.SysMenu) error {
+	if _, err := r.query.SysMenu.WithContext(ctx).Updates(menu); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (r *MenuRepo) DeleteMenuById(menuId uint) error {
-	if _, err := r.query.SysMenu.Where(r.query.SysMenu.ID.Eq(menuId)).Delete(); err != nil {
+func (r *MenuRepo) DeleteMenuById(ctx context.Context, menuId uint) error {
+	if _, err := r.query.SysMenu.WithContext(ctx).Where(r.query.SysMenu.ID.Eq(menuId)).Delete(); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (r *MenuRepo) DeleteMenuByIds(ids []uint) error {
-	if _, err := r.query.SysMenu.Where(r.query.SysMenu.ID.In(ids...)).Delete(); err != nil {
+func (r *MenuRepo) DeleteMenuByIds(ctx context.Context, ids []uint) error {
+	if _, err := r.query.SysMenu.WithContext(ctx).Where(r.query.SysMenu.ID.In(ids...)).Delete(); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,107 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"context"
+
+	"github.com/go-grain/grain/internal/repo/system/query"
+	service "github.com/go-grain/grain/internal/service/system"
+	model "github.com/go-grain/grain/model/system"
+)
+
+type SysMessageRepo struct {
+	query *query.Query
+}
+
+func NewSysMessageRepo() service.ISysMessageRepo {
+	return &SysMessageRepo{
+		query: query.Q,
+	}
+}
+
+func (r *SysMessageRepo) CreateMessages(ctx context.Context, messages []*model.SysMessage) error {
+	return r.query.SysMessage.WithContext(ctx).Create(messages...)
+}
+
+// GetMessageList 获取 uid 与 peer 之间的会话记录, 只查询 uid 自己的收件箱
+func (r *SysMessageRepo) GetMessageList(req *model.SysMessageReq) (list []*model.SysMessage, err error) {
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+
+	if req.PageSize <= 0 || req.PageSize >= 100 {
+		req.PageSize = 20
+	}
+
+	m := r.query.SysMessage
+	q := m.Where(m.Owner.Eq(req.UID), m.ChatType.Eq(req.ChatType))
+	if req.ChatType == model.ChatTypeGroup {
+		q = q.Where(m.Recipient.Eq(req.Peer))
+	} else {
+		q = q.Where(m.Where(m.Sender.Eq(req.Peer), m.Recipient.Eq(req.UID)).Or(m.Sender.Eq(req.UID), m.Recipient.Eq(req.Peer)))
+	}
+
+	count, err := q.Count()
+	if err != nil {
+		return nil, err
+	}
+	req.Total = count
+	return q.Order(m.ID.Desc()).Limit(req.PageSize).Offset((req.Page - 1) * req.PageSize).Find()
+}
+
+func (r *SysMessageRepo) GetUnreadRows(ctx context.Context, uid string) (rows []*model.UnreadRow, err error) {
+	m := r.query.SysMessage
+	err = m.WithContext(ctx).
+		Select(m.ChatType, m.Sender, m.Recipient, m.ID.Count().As("count")).
+		Where(m.Owner.Eq(uid), m.IsRead.Is(false)).
+		Group(m.ChatType, m.Sender, m.Recipient).
+		Scan(&rows)
+	return
+}
+
+// ReadMessages 把会话中未读的消息标记为已读, 私聊按发送者, 群聊按组织
+func (r *SysMessageRepo) ReadMessages(ctx context.Context, uid string, chatType int, peer string) (int64, error) {
+	m := r.query.SysMessage
+	q := m.WithContext(ctx).Where(m.Owner.Eq(uid), m.ChatType.Eq(chatType), m.IsRead.Is(false))
+	if chatType == model.ChatTypeGroup {
+		q = q.Where(m.Recipient.Eq(peer))
+	} else {
+		q = q.Where(m.Sender.Eq(peer))
+	}
+	info, err := q.UpdateSimple(m.IsRead.Value(true))
+	return info.RowsAffected, err
+}
+
+func (r *SysMessageRepo) GetOrganize(ctx context.Context, uid string) (string, error) {
+	u := r.query.SysUser
+	user, err := u.WithContext(ctx).Select(u.Organize).Where(u.UID.Eq(uid)).First()
+	if err != nil {
+		return "", err
+	}
+	return user.Organize, nil
+}
+
+func (r *SysMessageRepo) GetOrganizeMembers(ctx context.Context, organize string) (uids []string, err error) {
+	u := r.query.SysUser
+	err = u.WithContext(ctx).Where(u.Organize.Eq(organize)).Pluck(u.UID, &uids)
+	return
+}
+
+func (r *SysMessageRepo) UserExists(ctx context.Context, uid string) (bool, error) {
+	u := r.query.SysUser
+	count, err := u.WithContext(ctx).Where(u.UID.Eq(uid)).Count()
+	return count > 0, err
+}
@@ -0,0 +1,161 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-grain/grain/internal/repo/system/query"
+	service "github.com/go-grain/grain/internal/service/system"
+	model "github.com/go-grain/grain/model/system"
+	"gorm.io/gen/field"
+)
+
+type NotificationRepo struct {
+	query *query.Query
+}
+
+func NewNotificationRepo() service.INotificationRepo {
+	return &NotificationRepo{
+		query: query.Q,
+	}
+}
+
+func (r *NotificationRepo) CreateNotifications(ctx context.Context, notifications []*model.SysNotification) error {
+	return r.query.SysNotification.WithContext(ctx).CreateInBatches(notifications, 500)
+}
+
+func (r *NotificationRepo) GetNotificationList(req *model.SysNotificationReq) (list []*model.SysNotification, err error) {
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+
+	if req.PageSize <= 0 || req.PageSize >= 100 {
+		req.PageSize = 20
+	}
+
+	n := r.query.SysNotification
+	q := n.Where(n.UID.Eq(req.UID))
+	if req.Status != "" {
+		q = q.Where(n.Status.Eq(req.Status))
+	} else {
+		// 默认不显示已归档的通知
+		q = q.Where(n.Status.Neq(model.NotificationStatusArchived))
+	}
+	if req.Category != "" {
+		q = q.Where(n.Category.Eq(req.Category))
+	}
+
+	count, err := q.Count()
+	if err != nil {
+		return nil, err
+	}
+	req.Total = count
+	return q.Order(n.ID.Desc()).Limit(req.PageSize).Offset((req.Page - 1) * req.PageSize).Find()
+}
+
+func (r *NotificationRepo) CountUnread(ctx context.Context, uid string) (int64, error) {
+	n := r.query.SysNotification
+	return n.WithContext(ctx).Where(n.UID.Eq(uid), n.Status.Eq(model.NotificationStatusUnread)).Count()
+}
+
+// ReadNotifications 标记已读, ids 为空时标记该用户全部未读通知
+func (r *NotificationRepo) ReadNotifications(ctx context.Context, uid string, ids []uint) (int64, error) {
+	n := r.query.SysNotification
+	q := n.WithContext(ctx).Where(n.UID.Eq(uid), n.Status.Eq(model.NotificationStatusUnread))
+	if len(ids) > 0 {
+		q = q.Where(n.ID.In(ids...))
+	}
+	info, err := q.UpdateSimple(n.Status.Value(model.NotificationStatusRead), n.ReadAt.Value(time.Now()))
+	return info.RowsAffected, err
+}
+
+// ArchiveNotifications 归档通知, ids 为空时归档该用户全部已读通知
+func (r *NotificationRepo) ArchiveNotifications(ctx context.Context, uid string, ids []uint) (int64, error) {
+	n := r.query.SysNotification
+	q := n.WithContext(ctx).Where(n.UID.Eq(uid), n.Status.Neq(model.NotificationStatusArchived))
+	if len(ids) > 0 {
+		q = q.Where(n.ID.In(ids...))
+	} else {
+		q = q.Where(n.Status.Eq(model.NotificationStatusRead))
+	}
+	info, err := q.UpdateSimple(n.Status.Value(model.NotificationStatusArchived))
+	return info.RowsAffected, err
+}
+
+// CreateAnnouncement 在同一个事务中保存公告和展开后的每条通知
+func (r *NotificationRepo) CreateAnnouncement(ctx context.Context, announcement *model.SysAnnouncement, notifications []*model.SysNotification) error {
+	return r.query.Transaction(func(tx *query.Query) error {
+		if err := tx.SysAnnouncement.WithContext(ctx).Create(announcement); err != nil {
+			return err
+		}
+		for _, notification := range notifications {
+			notification.AnnouncementID = announcement.ID
+		}
+		return tx.SysNotification.WithContext(ctx).CreateInBatches(notifications, 500)
+	})
+}
+
+func (r *NotificationRepo) GetAnnouncementList(req *model.SysAnnouncementReq) (list []*model.SysAnnouncement, err error) {
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+
+	if req.PageSize <= 0 || req.PageSize >= 100 {
+		req.PageSize = 20
+	}
+
+	a := r.query.SysAnnouncement
+	q := a.Where()
+	count, err := q.Count()
+	if err != nil {
+		return nil, err
+	}
+	req.Total = count
+	return q.Order(a.ID.Desc()).Limit(req.PageSize).Offset((req.Page - 1) * req.PageSize).Find()
+}
+
+func (r *NotificationRepo) GetAllUIDs(ctx context.Context) (uids []string, err error) {
+	u := r.query.SysUser
+	err = u.WithContext(ctx).Pluck(u.UID, &uids)
+	return
+}
+
+// GetUIDsByRole 当前角色或者拥有该角色的用户, roles 字段保存的是 JSON 数组
+func (r *NotificationRepo) GetUIDsByRole(ctx context.Context, role string) (uids []string, err error) {
+	u := r.query.SysUser
+	roles := field.NewString(u.TableName(), "roles")
+	err = u.WithContext(ctx).
+		Where(u.Where(u.Role.Eq(role)).Or(roles.Like("%"+strconv.Quote(role)+"%"))).
+		Pluck(u.UID, &uids)
+	return
+}
+
+// GetUIDsByOrganize 组织或部门属于 organizeIds 中任意一个节点的用户
+func (r *NotificationRepo) GetUIDsByOrganize(ctx context.Context, organizeIds []string) (uids []string, err error) {
+	u := r.query.SysUser
+	err = u.WithContext(ctx).
+		Where(u.Where(u.Organize.In(organizeIds...)).Or(u.Department.In(organizeIds...))).
+		Pluck(u.UID, &uids)
+	return
+}
+
+// GetOrganizeNodes 只查询 ID 和父ID, 用于展开下级节点
+func (r *NotificationRepo) GetOrganizeNodes(ctx context.Context) ([]*model.Organize, error) {
+	o := r.query.Organize
+	return o.WithContext(ctx).Select(o.ID, o.ParentId).Find()
+}
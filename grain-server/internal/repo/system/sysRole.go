@@ -15,6 +15,7 @@
 package repo
 
 import (
+	"context"
 	"fmt"
 	"github.com/go-grain/grain/internal/repo/system/query"
 	service "github.com/go-grain/grain/internal/service/system"
@@ -34,8 +35,8 @@ func NewRoleRepo(rdb redisx.IRedis) service.IRoleRepo {
 	}
 }
 
-func (r *RoleRepo) CreateRole(role *model.SysRole) error {
-	return r.query.SysRole.Create(role)
+func (r *RoleRepo) CreateRole(ctx context.Context, role *model.SysRole) error {
+	return r.query.SysRole.WithContext(ctx).Create(role)
 }
 
 func (r *RoleRepo) GetRoleList(req *model.SysRoleQueryPage) (list []*model.SysRole, err error) {
@@ -70,22 +71,22 @@ func (r *RoleRepo) GetRoleList(req *model.SysRoleQueryPage) (list []*model.SysRo
 	return
 }
 
-func (r *RoleRepo) UpdateRole(role *model.SysRole) error {
-	if _, err := r.query.SysRole.Updates(role); err != nil {
+func (r *RoleRepo) UpdateRole(ctx context.Context, role *model.SysRole) error {
+	if _, err := r.query.SysRole.WithContext(ctx).Updates(role); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (r *RoleRepo) DeleteRoleById(roleId uint) error {
-	if _, err := r.query.SysRole.Where(r.query.SysRole.ID.Eq(roleId)).Delete(); err != nil {
+func (r *RoleRepo) DeleteRoleById(ctx context.Context, roleId uint) error {
+	if _, err := r.query.SysRole.WithContext(ctx).Where(r.query.SysRole.ID.Eq(roleId)).Delete(); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (r *RoleRepo) DeleteRoleByIds(roles []uint) error {
-	if _, err := r.query.SysRole.Where(r.query.SysRole.ID.In(roles...)).Delete(); err != nil {
+func (r *RoleRepo) DeleteRoleByIds(ctx context.Context, roles []uint) error {
+	if _, err := r.query.SysRole.WithContext(ctx).Where(r.query.SysRole.ID.In(roles...)).Delete(); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,89 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-grain/grain/internal/repo/system/query"
+	service "github.com/go-grain/grain/internal/service/system"
+	model "github.com/go-grain/grain/model/system"
+	timex "github.com/go-grain/grain/pkg/time"
+)
+
+type SmsRepo struct {
+	query *query.Query
+}
+
+func NewSmsRepo() service.ISmsRepo {
+	return &SmsRepo{
+		query: query.Q,
+	}
+}
+
+func (r *SmsRepo) CreateSms(ctx context.Context, sms *model.SysSms) error {
+	return r.query.SysSms.WithContext(ctx).Create(sms)
+}
+
+func (r *SmsRepo) UpdateSms(ctx context.Context, sms *model.SysSms) error {
+	if _, err := r.query.SysSms.WithContext(ctx).Where(r.query.SysSms.ID.Eq(sms.ID)).Updates(sms); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *SmsRepo) GetSmsById(ctx context.Context, id uint) (*model.SysSms, error) {
+	return r.query.SysSms.WithContext(ctx).Where(r.query.SysSms.ID.Eq(id)).First()
+}
+
+func (r *SmsRepo) GetSmsList(req *model.SysSmsReq) (list []*model.SysSms, err error) {
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+
+	if req.PageSize <= 0 || req.PageSize >= 100 {
+		req.PageSize = 20
+	}
+
+	q := r.query.SysSms.Where()
+
+	if req.Mobile != "" {
+		q = q.Where(r.query.SysSms.Mobile.Eq(req.Mobile))
+	}
+	if req.Status != "" {
+		q = q.Where(r.query.SysSms.Status.Eq(req.Status))
+	}
+	if req.QueryTime != "" {
+		t := strings.Split(req.QueryTime, ",")
+		if len(t) == 2 {
+			s := timex.GetStringToDate(t[0], timex.YMD)
+			e := timex.GetStringToDate(t[1], timex.YMD)
+			q = q.Where(r.query.SysSms.CreatedAt.Between(s, e))
+		}
+	}
+
+	count, err := q.Count()
+	if err != nil {
+		return nil, err
+	}
+	req.Total = count
+	q = q.Order(r.query.SysSms.ID.Desc()).Limit(req.PageSize).Offset((req.Page - 1) * req.PageSize)
+	list, err = q.Find()
+	if err != nil {
+		return nil, err
+	}
+	return
+}
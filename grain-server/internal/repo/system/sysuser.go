@@ -15,6 +15,7 @@
 package repo
 
 import (
+	"context"
 	"github.com/go-grain/grain/internal/repo/system/query"
 	service "github.com/go-grain/grain/internal/service/system"
 	"github.com/go-grain/grain/model/system"
@@ -41,8 +42,8 @@ func (r *SysUserRepo) Login(user *model.LoginReq) (*model.SysUser, error) {
 	return userinfo, err
 }
 
-func (r *SysUserRepo) CreateSysUser(sysUser *model.SysUser) error {
-	return r.query.SysUser.Create(sysUser)
+func (r *SysUserRepo) CreateSysUser(ctx context.Context, sysUser *model.SysUser) error {
+	return r.query.SysUser.WithContext(ctx).Create(sysUser)
 }
 
 func (r *SysUserRepo) GetSysUserById(sysUserId uint) (*model.SysUser, error) {
@@ -95,48 +96,49 @@ func (r *SysUserRepo) GetSysUserList(req *model.SysUserReq) (list []*model.SysUs
 	return
 }
 
-func (r *SysUserRepo) UpdateSysUser(sysUser *model.UpdateUserInfo) error {
+func (r *SysUserRepo) UpdateSysUser(ctx context.Context, sysUser *model.UpdateUserInfo) error {
 	q := r.query.SysUser
-	if _, err := q.Where(q.UID.Eq(sysUser.UID)).Updates(sysUser); err != nil {
+	if _, err := q.WithContext(ctx).Where(q.UID.Eq(sysUser.UID)).Updates(sysUser); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (r *SysUserRepo) EditSysUser(sysUser *model.SysUser) error {
-	if _, err := r.query.SysUser.Updates(sysUser); err != nil {
+func (r *SysUserRepo) EditSysUser(ctx context.Context, sysUser *model.SysUser) error {
+	if _, err := r.query.SysUser.WithContext(ctx).Updates(sysUser); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (r *SysUserRepo) SetDefaultRole(sysUser *model.SysUser) error {
-	if _, err := r.query.SysUser.Updates(sysUser); err != nil {
+func (r *SysUserRepo) SetDefaultRole(ctx context.Context, sysUser *model.SysUser) error {
+	if _, err := r.query.SysUser.WithContext(ctx).Updates(sysUser); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (r *SysUserRepo) DeleteSysUserById(sysUserId uint) error {
-	if _, err := r.query.SysUser.Where(r.query.SysUser.ID.Eq(sysUserId)).Delete(); err != nil {
+func (r *SysUserRepo) DeleteSysUserById(ctx context.Context, sysUserId uint) error {
+	if _, err := r.query.SysUser.WithContext(ctx).Where(r.query.SysUser.ID.Eq(sysUserId)).Delete(); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (r *SysUserRepo) DeleteSysUserByIds(sysUserIds []uint) error {
-	if _, err := r.query.SysUser.Where(r.query.SysUser.ID.In(sysUserIds...)).Delete(); err != nil {
+func (r *SysUserRepo) DeleteSysUserByIds(ctx context.Context, sysUserIds []uint) error {
+	if _, err := r.query.SysUser.WithContext(ctx).Where(r.query.SysUser.ID.In(sysUserIds...)).Delete(); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (r *SysUserRepo) UploadAvatar(avatar *model.Upload, uid string) error {
-	q := r.query.SysUser
-	_, err := q.Where(q.UID.Eq(uid)).Update(q.Avatar, avatar.FileUrl)
-	if err != nil {
-		return err
-	}
-	_ = r.query.Upload.Create(avatar)
-	return nil
+func (r *SysUserRepo) UploadAvatar(ctx context.Context, avatar *model.Upload, avatarUrl, uid string, quota int64) error {
+	avatar.UID = uid
+	return r.query.Transaction(func(tx *query.Query) error {
+		q := tx.SysUser
+		if _, err := q.WithContext(ctx).Where(q.UID.Eq(uid)).Update(q.Avatar, avatarUrl); err != nil {
+			return err
+		}
+		return createUpload(tx, avatar, quota)
+	})
 }
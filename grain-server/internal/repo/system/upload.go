@@ -15,12 +15,15 @@
 package repo
 
 import (
+	"errors"
 	"fmt"
 	"github.com/go-grain/grain/internal/repo/system/query"
 	service "github.com/go-grain/grain/internal/service/system"
 	model "github.com/go-grain/grain/model/system"
 	redisx "github.com/go-grain/grain/pkg/redis"
 	timex "github.com/go-grain/grain/pkg/time"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"strings"
 )
 
@@ -36,8 +39,88 @@ func NewUploadRepo(rdb redisx.IRedis) service.IUploadRepo {
 	}
 }
 
-func (r *UploadRepo) CreateUpload(upload *model.Upload) error {
-	return r.query.Upload.Create(upload)
+func (r *UploadRepo) CreateUpload(upload *model.Upload, quota int64) error {
+	return r.query.Transaction(func(tx *query.Query) error {
+		return createUpload(tx, upload, quota)
+	})
+}
+
+// createUpload 写入上传记录并计入上传者的用量, 超出配额时返回 service.ErrQuotaExceeded.
+// 有 Hash 的记录同时增加对应 UploadBlob 的引用数, 内容已经存在时上传记录指向已有的文件
+func createUpload(tx *query.Query, upload *model.Upload, quota int64) error {
+	if err := chargeUsage(tx, upload.UID, upload.FileSize, quota); err != nil {
+		return err
+	}
+	if upload.Hash != "" {
+		b := tx.UploadBlob
+		blob, err := b.Clauses(clause.Locking{Strength: "UPDATE"}).Where(b.Hash.Eq(upload.Hash)).First()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			blob = &model.UploadBlob{
+				Hash:     upload.Hash,
+				Size:     upload.FileSize,
+				Storage:  upload.Storage,
+				FileKey:  upload.FileKey,
+				RefCount: 1,
+			}
+			// 两个请求同时第一次上传相同内容时唯一索引冲突, 没有写入的一方重新读取已有的记录
+			if err = b.Clauses(clause.OnConflict{DoNothing: true}).Create(blob); err != nil {
+				return err
+			}
+			if blob.ID != 0 {
+				return tx.Upload.Create(upload)
+			}
+			blob, err = b.Clauses(clause.Locking{Strength: "UPDATE"}).Where(b.Hash.Eq(upload.Hash)).First()
+		}
+		if err != nil {
+			return err
+		}
+		if _, err = b.Where(b.ID.Eq(blob.ID)).UpdateSimple(b.RefCount.Add(1)); err != nil {
+			return err
+		}
+		upload.Storage, upload.FileKey = blob.Storage, blob.FileKey
+	}
+	return tx.Upload.Create(upload)
+}
+
+// releaseBlobs 上传记录删除之后减少引用数, 返回引用数归零 需要删除存储文件的 UploadBlob,
+// 原图的图片规格也一起删除
+func releaseBlobs(tx *query.Query, list []*model.Upload) ([]*model.UploadBlob, error) {
+	b := tx.UploadBlob
+	var released []*model.UploadBlob
+	for _, upload := range list {
+		if upload.Hash == "" {
+			continue
+		}
+		blob, err := b.Clauses(clause.Locking{Strength: "UPDATE"}).Where(b.Hash.Eq(upload.Hash)).First()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if blob.RefCount > 1 {
+			if _, err = b.Where(b.ID.Eq(blob.ID)).UpdateSimple(b.RefCount.Sub(1)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if _, err = b.Unscoped().Where(b.ID.Eq(blob.ID)).Delete(); err != nil {
+			return nil, err
+		}
+		v := tx.UploadVariant
+		if blob.Variants, err = v.Where(v.Hash.Eq(blob.Hash)).Find(); err != nil {
+			return nil, err
+		}
+		if _, err = v.Unscoped().Where(v.Hash.Eq(blob.Hash)).Delete(); err != nil {
+			return nil, err
+		}
+		released = append(released, blob)
+	}
+	return released, nil
+}
+
+func (r *UploadRepo) GetBlobByHash(hash string) (*model.UploadBlob, error) {
+	return r.query.UploadBlob.Where(r.query.UploadBlob.Hash.Eq(hash)).First()
 }
 
 func (r *UploadRepo) GetUploadList(req *model.UploadReq) (list []*model.Upload, err error) {
@@ -77,16 +160,130 @@ func (r *UploadRepo) GetUploadList(req *model.UploadReq) (list []*model.Upload,
 	return list, nil
 }
 
-func (r *UploadRepo) DeleteUploadById(id uint, uid string) error {
-	if _, err := r.query.Upload.Where(r.query.Upload.UID.Eq(uid)).Where(r.query.Upload.ID.Eq(id)).Delete(); err != nil {
+func (r *UploadRepo) GetUploadByIds(ids []uint, uid string) ([]*model.Upload, error) {
+	return r.query.Upload.Where(r.query.Upload.UID.Eq(uid)).Where(r.query.Upload.ID.In(ids...)).Find()
+}
+
+func (r *UploadRepo) GetVariant(hash, preset string) (*model.UploadVariant, error) {
+	v := r.query.UploadVariant
+	return v.Where(v.Hash.Eq(hash), v.Preset.Eq(preset)).First()
+}
+
+// SaveVariant 保存生成的图片规格, 并发生成同一个规格时以先写入的为准
+func (r *UploadRepo) SaveVariant(variant *model.UploadVariant) (*model.UploadVariant, error) {
+	if err := r.query.UploadVariant.Clauses(clause.OnConflict{DoNothing: true}).Create(variant); err != nil {
+		return nil, err
+	}
+	if variant.ID != 0 {
+		return variant, nil
+	}
+	return r.GetVariant(variant.Hash, variant.Preset)
+}
+
+func (r *UploadRepo) GetUploadById(id uint) (*model.Upload, error) {
+	return r.query.Upload.Where(r.query.Upload.ID.Eq(id)).First()
+}
+
+// UpdateVisibility 修改可见范围, 只能修改自己上传的文件
+func (r *UploadRepo) UpdateVisibility(req *model.UploadVisibilityReq, uid string) error {
+	u := r.query.Upload
+	q := u.Where(u.UID.Eq(uid)).Where(u.ID.Eq(req.ID))
+	if _, err := q.First(); err != nil {
 		return err
 	}
-	return nil
+	roles := req.SharedRoles
+	if req.Visibility != model.VisibilityRoles {
+		roles = model.Roles{}
+	}
+	_, err := q.Select(u.Visibility, u.SharedRoles).Updates(&model.Upload{Visibility: req.Visibility, SharedRoles: &roles})
+	return err
+}
+
+// PublicObject 本地文件是否可以通过 uploads 路径直接访问, 引用它的记录中有公开的才可以访问,
+// 图片规格跟随原图的上传记录. 没有任何记录引用这个文件时 found 为 false, 由调用方决定是否允许访问
+func (r *UploadRepo) PublicObject(key string) (public, found bool, err error) {
+	u := r.query.Upload
+	list, err := u.Select(u.Visibility).Where(u.FileKey.Eq(key)).Or(u.FileKey.Eq(""), u.FileUrl.Eq("uploads/"+key)).Find()
+	if err != nil {
+		return false, false, err
+	}
+	if len(list) == 0 {
+		v := r.query.UploadVariant
+		variant, err := v.Where(v.FileKey.Eq(key)).First()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		if list, err = u.Select(u.Visibility).Where(u.Hash.Eq(variant.Hash)).Find(); err != nil {
+			return false, false, err
+		}
+	}
+	for _, upload := range list {
+		if upload.Visibility == model.VisibilityPublic || upload.Visibility == "" {
+			return true, true, nil
+		}
+	}
+	return false, true, nil
+}
+
+// GetPublicUploadByKey 引用这个对象键的公开上传记录
+func (r *UploadRepo) GetPublicUploadByKey(key string) (*model.Upload, error) {
+	u := r.query.Upload
+	return u.Where(u.FileKey.Eq(key), u.Visibility.In(model.VisibilityPublic, "")).First()
+}
+
+func (r *UploadRepo) DeleteUploadById(id uint, uid string) ([]*model.UploadBlob, error) {
+	return r.DeleteUploadByIds([]uint{id}, uid)
 }
 
-func (r *UploadRepo) DeleteUploadByIds(ids []uint, uid string) error {
-	if _, err := r.query.Upload.Where(r.query.Upload.UID.Eq(uid)).Where(r.query.Upload.ID.In(ids...)).Delete(); err != nil {
+func (r *UploadRepo) DeleteUploadByIds(ids []uint, uid string) (released []*model.UploadBlob, err error) {
+	err = r.query.Transaction(func(tx *query.Query) error {
+		q := tx.Upload.Where(tx.Upload.UID.Eq(uid)).Where(tx.Upload.ID.In(ids...))
+		list, err := q.Find()
+		if err != nil {
+			return err
+		}
+		if _, err = q.Delete(); err != nil {
+			return err
+		}
+		if err = refundUsage(tx, list); err != nil {
+			return err
+		}
+		released, err = releaseBlobs(tx, list)
 		return err
+	})
+	return released, err
+}
+
+func (r *UploadRepo) GetUploadUsage() (*model.UploadUsageRes, error) {
+	u := r.query.Upload
+	su := r.query.SysUser
+	res := &model.UploadUsageRes{}
+
+	err := u.Select(u.UID.As("name"), su.Username.As("username"), u.ID.Count().As("files"), u.FileSize.Sum().As("size")).
+		LeftJoin(su, su.UID.EqCol(u.UID)).
+		Group(u.UID, su.Username).
+		Order(u.FileSize.Sum().Desc()).
+		Scan(&res.ByUser)
+	if err != nil {
+		return nil, err
+	}
+
+	err = u.Select(u.FilePurpose.As("name"), u.ID.Count().As("files"), u.FileSize.Sum().As("size")).
+		Group(u.FilePurpose).
+		Order(u.FileSize.Sum().Desc()).
+		Scan(&res.ByPurpose)
+	if err != nil {
+		return nil, err
+	}
+
+	b := r.query.UploadBlob
+	blobs := model.UploadUsage{}
+	if err = b.Select(b.ID.Count().As("files"), b.Size.Sum().As("size")).Scan(&blobs); err != nil {
+		return nil, err
 	}
-	return nil
+	res.Blobs, res.BlobSize = blobs.Files, blobs.Size
+	return res, nil
 }
@@ -0,0 +1,181 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"context"
+	"errors"
+	"github.com/go-grain/grain/internal/repo/system/query"
+	service "github.com/go-grain/grain/internal/service/system"
+	model "github.com/go-grain/grain/model/system"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// lockUsage 锁定用户的用量记录, 没有时先创建
+func lockUsage(ctx context.Context, tx *query.Query, uid string) (*model.UploadUserUsage, error) {
+	u := tx.UploadUserUsage
+	usage, err := u.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Where(u.UID.Eq(uid)).First()
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return usage, err
+	}
+	if err = u.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&model.UploadUserUsage{UID: uid}); err != nil {
+		return nil, err
+	}
+	return u.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Where(u.UID.Eq(uid)).First()
+}
+
+// chargeUsage 写入上传记录之前锁定用户的用量记录并检查配额, quota 为 0 表示不限制
+func chargeUsage(tx *query.Query, uid string, size, quota int64) error {
+	usage, err := lockUsage(context.Background(), tx, uid)
+	if err != nil {
+		return err
+	}
+	if quota > 0 && size > 0 && usage.Used+size > quota {
+		return service.ErrQuotaExceeded
+	}
+	u := tx.UploadUserUsage
+	_, err = u.Where(u.ID.Eq(usage.ID)).UpdateSimple(u.Used.Add(size), u.Files.Add(1))
+	return err
+}
+
+// refundUsage 上传记录删除之后扣减对应用户的用量
+func refundUsage(tx *query.Query, list []*model.Upload) error {
+	size := map[string]int64{}
+	files := map[string]int64{}
+	for _, upload := range list {
+		size[upload.UID] += upload.FileSize
+		files[upload.UID]++
+	}
+	u := tx.UploadUserUsage
+	for uid, n := range files {
+		if _, err := u.Where(u.UID.Eq(uid)).UpdateSimple(u.Used.Sub(size[uid]), u.Files.Sub(n)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *UploadRepo) GetUserUsage(uid string) (*model.UploadUserUsage, error) {
+	u := r.query.UploadUserUsage
+	usage, err := u.Where(u.UID.Eq(uid)).First()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &model.UploadUserUsage{UID: uid}, nil
+	}
+	return usage, err
+}
+
+// GetQuota 用户的存储配额, 有用户配额时使用用户配额, 否则取用户所有角色中最大的配额,
+// 有一个角色不限制就不限制. 都没有配置时 found 为 false
+func (r *UploadRepo) GetQuota(uid string) (quota int64, found bool, err error) {
+	q := r.query.UploadQuota
+	userQuota, err := q.Where(q.UID.Eq(uid)).First()
+	if err == nil {
+		return userQuota.Quota, true, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, false, err
+	}
+
+	user, err := r.query.SysUser.Select(r.query.SysUser.Roles).Where(r.query.SysUser.UID.Eq(uid)).First()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, false, nil
+	}
+	if err != nil || user.Roles == nil || len(*user.Roles) == 0 {
+		return 0, false, err
+	}
+	roleQuotas, err := q.Where(q.Role.In(*user.Roles...), q.UID.Eq("")).Find()
+	if err != nil || len(roleQuotas) == 0 {
+		return 0, false, err
+	}
+	for _, rq := range roleQuotas {
+		if rq.Quota == 0 {
+			return 0, true, nil
+		}
+		if rq.Quota > quota {
+			quota = rq.Quota
+		}
+	}
+	return quota, true, nil
+}
+
+func (r *UploadRepo) GetQuotaList() ([]*model.UploadQuota, error) {
+	q := r.query.UploadQuota
+	return q.Order(q.Role, q.UID).Find()
+}
+
+// SetQuota 设置角色或者用户的配额, 已经存在时更新
+func (r *UploadRepo) SetQuota(quota *model.UploadQuota) error {
+	q := r.query.UploadQuota
+	return q.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: q.Role.ColumnName().String()}, {Name: q.UID.ColumnName().String()}},
+		DoUpdates: clause.AssignmentColumns([]string{q.Quota.ColumnName().String(), q.UpdatedAt.ColumnName().String()}),
+	}).Create(quota)
+}
+
+func (r *UploadRepo) DeleteQuotaById(id uint) error {
+	q := r.query.UploadQuota
+	_, err := q.Unscoped().Where(q.ID.Eq(id)).Delete()
+	return err
+}
+
+// ReconcileUsage 按 uploads 表重新统计每个用户的用量, 逐个用户锁定用量记录后统计,
+// 和同时进行的上传删除不会互相覆盖. 返回用量有变化的用户数
+func (r *UploadRepo) ReconcileUsage(ctx context.Context) (int, error) {
+	var uids, tracked []string
+	u := r.query.Upload
+	if err := u.WithContext(ctx).Distinct(u.UID).Pluck(u.UID, &uids); err != nil {
+		return 0, err
+	}
+	usage := r.query.UploadUserUsage
+	if err := usage.WithContext(ctx).Pluck(usage.UID, &tracked); err != nil {
+		return 0, err
+	}
+	seen := map[string]bool{}
+	changed := 0
+	for _, uid := range append(uids, tracked...) {
+		if seen[uid] {
+			continue
+		}
+		seen[uid] = true
+		if err := ctx.Err(); err != nil {
+			return changed, err
+		}
+		err := r.query.Transaction(func(tx *query.Query) error {
+			current, err := lockUsage(ctx, tx, uid)
+			if err != nil {
+				return err
+			}
+			actual := model.UploadUserUsage{}
+			err = tx.Upload.WithContext(ctx).Select(tx.Upload.ID.Count().As("files"), tx.Upload.FileSize.Sum().As("used")).
+				Where(tx.Upload.UID.Eq(uid)).
+				Scan(&actual)
+			if err != nil {
+				return err
+			}
+			if actual.Files == current.Files && actual.Used == current.Used {
+				return nil
+			}
+			changed++
+			uu := tx.UploadUserUsage
+			_, err = uu.WithContext(ctx).Where(uu.ID.Eq(current.ID)).UpdateSimple(uu.Files.Value(actual.Files), uu.Used.Value(actual.Used))
+			return err
+		})
+		if err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
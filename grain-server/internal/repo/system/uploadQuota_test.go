@@ -0,0 +1,239 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/go-grain/grain/internal/repo/system/query"
+	service "github.com/go-grain/grain/internal/service/system"
+	model "github.com/go-grain/grain/model/system"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newQuotaRepo 基于内存 SQLite 的 UploadRepo, 只迁移配额相关的表
+func newQuotaRepo(t *testing.T) (*UploadRepo, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接各有一份, 限制为一个连接
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	err = db.AutoMigrate(&model.Upload{}, &model.UploadBlob{}, &model.UploadVariant{},
+		&model.UploadUserUsage{}, &model.UploadQuota{}, &model.SysUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &UploadRepo{query: query.Use(db)}, db
+}
+
+func assertUsage(t *testing.T, r *UploadRepo, uid string, files, used int64) {
+	t.Helper()
+	usage, err := r.GetUserUsage(uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Files != files || usage.Used != used {
+		t.Errorf("%s 用量 = %d 个 %d 字节, 期望 %d 个 %d 字节", uid, usage.Files, usage.Used, files, used)
+	}
+}
+
+func TestCreateUploadCharge(t *testing.T) {
+	r, db := newQuotaRepo(t)
+
+	if err := r.CreateUpload(&model.Upload{UID: "u1", FileSize: 60}, 100); err != nil {
+		t.Fatal(err)
+	}
+	assertUsage(t, r, "u1", 1, 60)
+
+	// 超出配额时不写入上传记录, 用量不变
+	err := r.CreateUpload(&model.Upload{UID: "u1", FileSize: 50}, 100)
+	if !errors.Is(err, service.ErrQuotaExceeded) {
+		t.Fatalf("超出配额 err = %v", err)
+	}
+	var count int64
+	db.Model(&model.Upload{}).Where("uid = ?", "u1").Count(&count)
+	if count != 1 {
+		t.Errorf("上传记录 %d 条, 期望 1 条", count)
+	}
+	assertUsage(t, r, "u1", 1, 60)
+
+	// 刚好用满配额可以上传, 0 表示不限制
+	if err = r.CreateUpload(&model.Upload{UID: "u1", FileSize: 40}, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.CreateUpload(&model.Upload{UID: "u1", FileSize: 1000}, 0); err != nil {
+		t.Fatal(err)
+	}
+	assertUsage(t, r, "u1", 3, 1100)
+}
+
+func TestDeleteUploadRefund(t *testing.T) {
+	r, _ := newQuotaRepo(t)
+
+	a := &model.Upload{UID: "u1", FileSize: 10, Hash: "h1", Storage: "local", FileKey: "a"}
+	b := &model.Upload{UID: "u2", FileSize: 10, Hash: "h1", Storage: "local", FileKey: "b"}
+	c := &model.Upload{UID: "u1", FileSize: 5}
+	for _, upload := range []*model.Upload{a, b, c} {
+		if err := r.CreateUpload(upload, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 相同内容指向已有的文件, 引用数加一
+	if b.FileKey != "a" {
+		t.Errorf("重复内容 FileKey = %q, 期望指向已有的 a", b.FileKey)
+	}
+	blob, err := r.GetBlobByHash("h1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blob.RefCount != 2 {
+		t.Errorf("RefCount = %d, 期望 2", blob.RefCount)
+	}
+
+	// 不能删除别人的文件
+	released, err := r.DeleteUploadByIds([]uint{b.ID}, "u1")
+	if err != nil || len(released) != 0 {
+		t.Fatalf("删除别人的文件 released = %v err = %v", released, err)
+	}
+	assertUsage(t, r, "u2", 1, 10)
+
+	released, err = r.DeleteUploadByIds([]uint{a.ID, c.ID}, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(released) != 0 {
+		t.Errorf("还有引用时不应该释放文件, released = %d", len(released))
+	}
+	assertUsage(t, r, "u1", 0, 0)
+
+	// 最后一个引用删除后返回需要删除的存储文件
+	released, err = r.DeleteUploadByIds([]uint{b.ID}, "u2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(released) != 1 || released[0].FileKey != "a" {
+		t.Errorf("released = %v, 期望释放 a", released)
+	}
+	assertUsage(t, r, "u2", 0, 0)
+	if _, err = r.GetBlobByHash("h1"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("引用数归零后 blob 应该删除, err = %v", err)
+	}
+}
+
+func TestGetQuota(t *testing.T) {
+	r, db := newQuotaRepo(t)
+
+	users := []*model.SysUser{
+		{UID: "admin", Username: "admin", Roles: &model.Roles{"admin", "user"}},
+		{UID: "user", Username: "user", Roles: &model.Roles{"user", "guest"}},
+		{UID: "guest", Username: "guest", Roles: &model.Roles{"other"}},
+		{UID: "custom", Username: "custom", Roles: &model.Roles{"user"}},
+	}
+	if err := db.Create(users).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []*model.UploadQuota{
+		{Role: "admin", Quota: 0},
+		{Role: "user", Quota: 100},
+		{Role: "guest", Quota: 300},
+		{UID: "custom", Quota: 50},
+	} {
+		if err := r.SetQuota(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 已经存在时更新
+	if err := r.SetQuota(&model.UploadQuota{Role: "guest", Quota: 200}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		uid   string
+		quota int64
+		found bool
+	}{
+		// 有一个角色不限制就不限制
+		{"admin", 0, true},
+		// 取角色中最大的配额
+		{"user", 200, true},
+		// 角色没有配置配额
+		{"guest", 0, false},
+		// 用户配额优先于角色配额
+		{"custom", 50, true},
+		// 用户不存在
+		{"nobody", 0, false},
+	}
+	for _, tt := range tests {
+		quota, found, err := r.GetQuota(tt.uid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if quota != tt.quota || found != tt.found {
+			t.Errorf("GetQuota(%s) = %d %v, 期望 %d %v", tt.uid, quota, found, tt.quota, tt.found)
+		}
+	}
+}
+
+func TestReconcileUsage(t *testing.T) {
+	r, db := newQuotaRepo(t)
+
+	for _, upload := range []*model.Upload{
+		{UID: "u1", FileSize: 10},
+		{UID: "u1", FileSize: 20},
+		{UID: "u2", FileSize: 5},
+	} {
+		if err := r.CreateUpload(upload, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	changed, err := r.ReconcileUsage(context.Background())
+	if err != nil || changed != 0 {
+		t.Fatalf("用量一致时 changed = %d err = %v", changed, err)
+	}
+
+	// 模拟用量和上传记录不一致: u1 的记录被直接删除, u2 的用量被改错, u3 只有用量没有记录
+	db.Where("uid = ? AND file_size = ?", "u1", 20).Delete(&model.Upload{})
+	db.Model(&model.UploadUserUsage{}).Where("uid = ?", "u2").Update("used", 999)
+	db.Create(&model.UploadUserUsage{UID: "u3", Files: 2, Used: 30})
+
+	changed, err = r.ReconcileUsage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != 3 {
+		t.Errorf("changed = %d, 期望 3", changed)
+	}
+	assertUsage(t, r, "u1", 1, 10)
+	assertUsage(t, r, "u2", 1, 5)
+	assertUsage(t, r, "u3", 0, 0)
+
+	// 取消后不再继续统计
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = r.ReconcileUsage(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("取消后 err = %v, 期望 context.Canceled", err)
+	}
+}
@@ -18,9 +18,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/go-grain/grain/config"
 	handler "github.com/go-grain/grain/internal/handler/system"
+	repo "github.com/go-grain/grain/internal/repo/system"
 	service "github.com/go-grain/grain/internal/service/system"
 	"github.com/go-grain/grain/log"
 	"github.com/go-grain/grain/middleware"
+	queuex "github.com/go-grain/grain/pkg/queue"
 	redisx "github.com/go-grain/grain/pkg/redis"
 )
 
@@ -30,13 +32,17 @@ type CaptchaRouter struct {
 	private gin.IRoutes
 }
 
-func NewCaptchaRouter(routerGroup *gin.RouterGroup, rdb redisx.IRedis, conf *config.Config, logger log.Logger) *CaptchaRouter {
-	sv := service.NewCaptcha(rdb, conf, logger)
+func NewCaptchaRouter(routerGroup *gin.RouterGroup, sms *service.SmsService, queue *queuex.Client, rdb redisx.IRedis, conf *config.Config, logger log.Logger) *CaptchaRouter {
+	mail := service.NewMailService(repo.NewMailRepo(), queue, rdb, conf, logger)
+	sv := service.NewCaptcha(sms, mail, rdb, conf, logger)
 	return &CaptchaRouter{
-		api:    handler.NewCaptchaHandle(sv),
-		public: routerGroup.Group("captcha"),
+		api: handler.NewCaptchaHandle(sv),
+		public: routerGroup.Group("captcha").Use(
+			middleware.RateLimit(rdb, "captcha"),
+		),
 		private: routerGroup.Group("captcha").Use(
 			middleware.JwtAuth(rdb),
+			middleware.RateLimit(rdb, "user"),
 		),
 	}
 }
@@ -50,4 +56,10 @@ func (r *CaptchaRouter) InitRouters() {
 	r.private.POST("sendUserMobileCaptcha", r.api.SendUserMobileCaptcha)
 	// 发送用户 email 验证码
 	r.private.POST("sendUserEmailCaptcha", r.api.SendUserEmailCaptcha)
+	// 获取数字图形验证码
+	r.public.GET("image", r.api.GetImageCaptcha)
+	// 获取滑块验证码
+	r.public.GET("slider", r.api.GetSliderCaptcha)
+	// 校验图形/滑块验证码
+	r.public.POST("verify", r.api.VerifyCaptcha)
 }
@@ -0,0 +1,51 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"github.com/casbin/casbin/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-grain/grain/config"
+	handler "github.com/go-grain/grain/internal/handler/system"
+	repo "github.com/go-grain/grain/internal/repo/system"
+	service "github.com/go-grain/grain/internal/service/system"
+	"github.com/go-grain/grain/log"
+	"github.com/go-grain/grain/middleware"
+	redisx "github.com/go-grain/grain/pkg/redis"
+	wsx "github.com/go-grain/grain/pkg/websocket"
+)
+
+type SysMessageRouter struct {
+	ws      gin.IRoutes
+	private gin.IRoutes
+	api     *handler.SysMessageHandle
+}
+
+func NewSysMessageRouter(routerGroup *gin.RouterGroup, hub *wsx.Hub, rdb redisx.IRedis, conf *config.Config, logger log.Logger, enforcer *casbin.CachedEnforcer) *SysMessageRouter {
+	data := repo.NewSysMessageRepo()
+	sv := service.NewSysMessageService(data, hub, rdb, conf, logger)
+	return &SysMessageRouter{
+		api:     handler.NewSysMessageHandle(hub, sv),
+		ws:      routerGroup.Group("ws").Use(middleware.WsJwtAuth(rdb), middleware.Casbin(enforcer)),
+		private: routerGroup.Group("sysMessage").Use(middleware.JwtAuth(rdb), middleware.Casbin(enforcer)),
+	}
+}
+
+func (r *SysMessageRouter) InitRouters() {
+	r.ws.GET("", r.api.Connect)
+	r.private.GET("list", r.api.GetMessageList)
+	r.private.GET("unread", r.api.GetUnreadCount)
+	r.private.PUT("read", r.api.ReadMessage)
+}
@@ -0,0 +1,51 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"github.com/casbin/casbin/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-grain/grain/config"
+	handler "github.com/go-grain/grain/internal/handler/system"
+	repo "github.com/go-grain/grain/internal/repo/system"
+	service "github.com/go-grain/grain/internal/service/system"
+	"github.com/go-grain/grain/log"
+	"github.com/go-grain/grain/middleware"
+	redisx "github.com/go-grain/grain/pkg/redis"
+	wsx "github.com/go-grain/grain/pkg/websocket"
+)
+
+type NotificationRouter struct {
+	private gin.IRoutes
+	api     *handler.NotificationHandle
+}
+
+func NewNotificationRouter(routerGroup *gin.RouterGroup, hub *wsx.Hub, rdb redisx.IRedis, conf *config.Config, logger log.Logger, enforcer *casbin.CachedEnforcer) *NotificationRouter {
+	data := repo.NewNotificationRepo()
+	sv := service.NewNotificationService(data, hub, rdb, conf, logger)
+	return &NotificationRouter{
+		api:     handler.NewNotificationHandle(sv),
+		private: routerGroup.Group("sysNotification").Use(middleware.JwtAuth(rdb), middleware.Casbin(enforcer)),
+	}
+}
+
+func (r *NotificationRouter) InitRouters() {
+	r.private.GET("list", r.api.GetNotificationList)
+	r.private.GET("unread", r.api.CountUnread)
+	r.private.PUT("read", r.api.ReadNotifications)
+	r.private.PUT("archive", r.api.ArchiveNotifications)
+	r.private.POST("announcement", r.api.Announce)
+	r.private.GET("announcement/list", r.api.GetAnnouncementList)
+}
@@ -0,0 +1,40 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"github.com/casbin/casbin/v2"
+	"github.com/gin-gonic/gin"
+	handler "github.com/go-grain/grain/internal/handler/system"
+	service "github.com/go-grain/grain/internal/service/system"
+	"github.com/go-grain/grain/middleware"
+	redisx "github.com/go-grain/grain/pkg/redis"
+)
+
+type SmsRouter struct {
+	privateRoleAuth gin.IRoutes
+	api             *handler.SmsHandle
+}
+
+func NewSmsRouter(routerGroup *gin.RouterGroup, sv *service.SmsService, rdb redisx.IRedis, enforcer *casbin.CachedEnforcer) *SmsRouter {
+	return &SmsRouter{
+		api:             handler.NewSmsHandle(sv),
+		privateRoleAuth: routerGroup.Group("sms").Use(middleware.JwtAuth(rdb), middleware.Casbin(enforcer)),
+	}
+}
+
+func (r *SmsRouter) InitRouters() {
+	r.privateRoleAuth.GET("list", r.api.GetSmsList)
+}
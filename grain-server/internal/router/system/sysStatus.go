@@ -0,0 +1,48 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"github.com/casbin/casbin/v2"
+	"github.com/gin-gonic/gin"
+	handler "github.com/go-grain/grain/internal/handler/system"
+	service "github.com/go-grain/grain/internal/service/system"
+	"github.com/go-grain/grain/log"
+	"github.com/go-grain/grain/middleware"
+	healthx "github.com/go-grain/grain/pkg/health"
+	redisx "github.com/go-grain/grain/pkg/redis"
+)
+
+type SysStatusRouter struct {
+	// 探针挂在根路径上, 不经过限流和人机验证
+	engine  *gin.Engine
+	private gin.IRoutes
+	api     *handler.SysStatusHandle
+}
+
+func NewSysStatusRouter(engine *gin.Engine, routerGroup *gin.RouterGroup, checker *healthx.Checker, name, version string, rdb redisx.IRedis, logger log.Logger, enforcer *casbin.CachedEnforcer) *SysStatusRouter {
+	sv := service.NewSysStatusService(checker, name, version, logger)
+	return &SysStatusRouter{
+		engine:  engine,
+		api:     handler.NewSysStatusHandle(sv),
+		private: routerGroup.Group("sysStatus").Use(middleware.JwtAuth(rdb), middleware.Casbin(enforcer)),
+	}
+}
+
+func (r *SysStatusRouter) InitRouters() {
+	r.engine.GET("healthz", r.api.Healthz)
+	r.engine.GET("readyz", r.api.Readyz)
+	r.private.GET("", r.api.GetStatus)
+}
@@ -0,0 +1,44 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"github.com/casbin/casbin/v2"
+	"github.com/gin-gonic/gin"
+	handler "github.com/go-grain/grain/internal/handler/system"
+	service "github.com/go-grain/grain/internal/service/system"
+	"github.com/go-grain/grain/log"
+	"github.com/go-grain/grain/middleware"
+	redisx "github.com/go-grain/grain/pkg/redis"
+)
+
+type SysTaskRouter struct {
+	privateRoleAuth gin.IRoutes
+	api             *handler.SysTaskHandle
+}
+
+func NewSysTaskRouter(routerGroup *gin.RouterGroup, sv *service.SysTaskService, rdb redisx.IRedis, logger log.Logger, enforcer *casbin.CachedEnforcer) *SysTaskRouter {
+	return &SysTaskRouter{
+		api:             handler.NewSysTaskHandle(sv),
+		privateRoleAuth: routerGroup.Group("sysTask").Use(middleware.JwtAuth(rdb), middleware.Casbin(enforcer)),
+	}
+}
+
+func (r *SysTaskRouter) InitRouters() {
+	r.privateRoleAuth.GET("queues", r.api.GetQueueList)
+	r.privateRoleAuth.GET("list", r.api.GetTaskList)
+	r.privateRoleAuth.PUT("retry", r.api.RunTasks)
+	r.privateRoleAuth.DELETE("taskByIds", r.api.DeleteTasks)
+}
@@ -23,7 +23,10 @@ import (
 	service "github.com/go-grain/grain/internal/service/system"
 	"github.com/go-grain/grain/log"
 	"github.com/go-grain/grain/middleware"
+	queuex "github.com/go-grain/grain/pkg/queue"
 	redisx "github.com/go-grain/grain/pkg/redis"
+	storagex "github.com/go-grain/grain/pkg/storage"
+	wsx "github.com/go-grain/grain/pkg/websocket"
 )
 
 type SysUserRouter struct {
@@ -41,14 +44,19 @@ type SysUserRouter struct {
 	privateRoleAuth gin.IRoutes
 }
 
-func NewSysUserRouter(engine *gin.Engine, routerGroup *gin.RouterGroup, rdb redisx.IRedis, conf *config.Config, enforcer *casbin.CachedEnforcer, logger log.Logger) *SysUserRouter {
+func NewSysUserRouter(engine *gin.Engine, routerGroup *gin.RouterGroup, store storagex.Storage, hub *wsx.Hub, sms *service.SmsService, queue *queuex.Client, rdb redisx.IRedis, conf *config.Config, enforcer *casbin.CachedEnforcer, logger log.Logger) *SysUserRouter {
 	data := repo.NewSysUserRepo(rdb)
-	sv := service.NewSysUserService(data, rdb, conf, logger)
+	mail := service.NewMailService(repo.NewMailRepo(), queue, rdb, conf, logger)
+	captcha := service.NewCaptcha(sms, mail, rdb, conf, logger)
+	notify := service.NewNotificationService(repo.NewNotificationRepo(), hub, rdb, conf, logger)
+	sv := service.NewSysUserService(data, captcha, mail, notify, rdb, conf, logger)
+	files := service.NewUploadService(repo.NewUploadRepo(rdb), store, rdb, conf, logger, enforcer)
 	return &SysUserRouter{
 		rdb:    rdb,
-		api:    handler.NewSysUserHandle(sv),
+		api:    handler.NewSysUserHandle(sv, files),
 		engine: engine,
-		public: routerGroup.Group("sysUser"),
+		public: routerGroup.Group("sysUser").Use(
+			middleware.RateLimit(rdb, "login")),
 		private: routerGroup.Group("sysUser").Use(
 			middleware.JwtAuth(rdb)),
 		privateRoleAuth: routerGroup.Group("sysUser").Use(
@@ -82,7 +90,7 @@ func (r *SysUserRouter) InitRouters() *SysUserRouter {
 	//获取用户列表数据接口
 	r.privateRoleAuth.GET("list", r.api.GetSysUserList)
 	//切换角色接口
-	r.private.POST("switchRole", middleware.SwitchRole(r.rdb), r.api.SwitchRole)
+	r.private.POST("switchRole", r.api.SwitchRole)
 	//设置默认角色接口
 	r.privateRoleAuth.PUT("setDefaultRole", r.api.SetDefaultRole)
 	//编辑用户信息接口
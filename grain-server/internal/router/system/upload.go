@@ -24,23 +24,34 @@ import (
 	"github.com/go-grain/grain/log"
 	"github.com/go-grain/grain/middleware"
 	redisx "github.com/go-grain/grain/pkg/redis"
+	storagex "github.com/go-grain/grain/pkg/storage"
 )
 
 type UploadRouter struct {
 	engine          *gin.Engine
+	conf            *config.Config
 	public          gin.IRoutes
 	private         gin.IRoutes
 	privateRoleAuth gin.IRoutes
-	api             *handler.UploadHandle
+	// 只需要登录的接口, 文件的访问权限由接口自己判断
+	auth gin.IRoutes
+	api  *handler.UploadHandle
 }
 
-func NewUploadRouter(routerGroup *gin.RouterGroup, engine *gin.Engine, rdb redisx.IRedis, conf *config.Config, logger log.Logger, enforcer *casbin.CachedEnforcer) *UploadRouter {
+func NewUploadRouter(routerGroup *gin.RouterGroup, engine *gin.Engine, store storagex.Storage, rdb redisx.IRedis, conf *config.Config, logger log.Logger, enforcer *casbin.CachedEnforcer) *UploadRouter {
+	// 本地驱动的文件以及切换驱动前上传的旧文件都在本地根目录下
+	root := conf.Storage.Local.Root
+	if root == "" {
+		root = "uploads"
+	}
 	data := repo.NewUploadRepo(rdb)
-	sv := service.NewUploadService(data, rdb, conf, logger)
+	sv := service.NewUploadService(data, store, rdb, conf, logger, enforcer)
 	return &UploadRouter{
 		engine: engine,
+		conf:   conf,
 		public: routerGroup.Group("upload"),
-		api:    handler.NewUploadHandle(sv),
+		api:    handler.NewUploadHandle(sv, root),
+		auth:   routerGroup.Group("upload").Use(middleware.JwtAuth(rdb)),
 		private: routerGroup.Group("upload").Use(
 			middleware.JwtAuth(rdb),
 			middleware.Casbin(enforcer),
@@ -49,9 +60,31 @@ func NewUploadRouter(routerGroup *gin.RouterGroup, engine *gin.Engine, rdb redis
 }
 
 func (r *UploadRouter) InitRouters() {
-	r.engine.Static("uploads", "uploads")
+	r.engine.GET("uploads/*filepath", r.api.ServeFile)
+	r.engine.HEAD("uploads/*filepath", r.api.ServeFile)
+	// 非公开文件的下载 以及带签名的临时下载地址
+	r.auth.GET("download", r.api.Download)
+	r.auth.HEAD("download", r.api.Download)
+	r.public.GET("file/:id", r.api.SignedDownload)
+	r.public.HEAD("file/:id", r.api.SignedDownload)
+	r.private.PUT("visibility", r.api.UpdateVisibility)
+	r.private.POST("sign", r.api.SignURL)
 	r.private.POST("", r.api.UploadFile)
 	r.private.GET("list", r.api.GetUploadList)
 	r.private.DELETE("", r.api.DeleteUploadById)
 	r.private.DELETE("deleteUploadByIds", r.api.DeleteUploadByIds)
+	// 分片上传 断点续传
+	r.private.POST("session", r.api.InitUploadSession)
+	r.private.GET("session", r.api.GetUploadSession)
+	r.private.POST("session/chunk", r.api.UploadChunk)
+	r.private.POST("session/complete", r.api.CompleteUploadSession)
+	r.private.POST("session/instant", r.api.InstantUpload)
+	r.private.DELETE("session", r.api.AbortUploadSession)
+	// 存储用量报表
+	r.private.GET("usage", r.api.GetUploadUsage)
+	// 存储配额
+	r.auth.GET("quota", r.api.GetUserQuota)
+	r.private.GET("quota/list", r.api.GetQuotaList)
+	r.private.PUT("quota", r.api.SetQuota)
+	r.private.DELETE("quota", r.api.DeleteQuotaById)
 }
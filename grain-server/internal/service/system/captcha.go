@@ -15,6 +15,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -22,46 +23,121 @@ import (
 	"github.com/go-grain/grain/internal/repo/system/query"
 	"github.com/go-grain/grain/log"
 	"github.com/go-grain/grain/model/system"
-	"github.com/go-grain/grain/pkg/convert"
+	captchax "github.com/go-grain/grain/pkg/captcha"
 	emailx "github.com/go-grain/grain/pkg/email"
 	randx "github.com/go-grain/grain/pkg/rand"
 	redisx "github.com/go-grain/grain/pkg/redis"
-	"github.com/go-pay/gopay/pkg/xlog"
-	"github.com/jordan-wright/email"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// captchaExpire 短信以及邮件验证码的有效期
+const captchaExpire = 5 * time.Minute
+
 type CaptchaService struct {
-	rdb  redisx.IRedis
-	conf *config.Config
-	log  *log.Helper
+	sms   *SmsService
+	mail  *MailService
+	store *captchax.Store
+	rdb   redisx.IRedis
+	conf  *config.Config
+	log   *log.Helper
 }
 
-func NewCaptcha(rdb redisx.IRedis, conf *config.Config, logger log.Logger) *CaptchaService {
-	return &CaptchaService{rdb: rdb, conf: conf, log: log.NewHelper(logger)}
+func NewCaptcha(sms *SmsService, mail *MailService, rdb redisx.IRedis, conf *config.Config, logger log.Logger) *CaptchaService {
+	return &CaptchaService{
+		sms:   sms,
+		mail:  mail,
+		store: captchax.NewStore(rdb, conf.Captcha.Expire, conf.Captcha.Slider.Tolerance),
+		rdb:   rdb,
+		conf:  conf,
+		log:   log.NewHelper(logger),
+	}
 }
 
-func (s *CaptchaService) SendMobileCaptcha(mobile *model.Mobile, ctx *gin.Context) error {
-	mobile.Mobile = strings.TrimSpace(mobile.Mobile)
+// GetImageCaptcha 生成数字图形验证码
+func (s *CaptchaService) GetImageCaptcha(ctx *gin.Context) (*model.ImageCaptcha, error) {
+	c := s.conf.Captcha
+	length, width, height := c.Length, c.Width, c.Height
+	if length <= 0 {
+		length = 4
+	}
+	if width <= 0 || height <= 0 {
+		width, height = 120, 40
+	}
 
-	i, err := s.rdb.GetInt(fmt.Sprintf("captchaCount:%s", ctx.ClientIP()))
+	answer := captchax.RandomDigits(length)
+	img, err := captchax.NewDigitImage(answer, width, height)
 	if err != nil {
-		return errors.New("获取验证码失败 服务器内部错误")
+		s.log.WithContext(ctx).Errorw("errMsg", "生成图形验证码", "err", err.Error())
+		return nil, errors.New("生成验证码失败")
 	}
-	if i >= 5 {
-		return errors.New("频繁请求")
+	id, err := s.store.Save(ctx, captchax.TypeDigit, answer)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "保存图形验证码", "err", err.Error())
+		return nil, errors.New("生成验证码失败")
+	}
+	return &model.ImageCaptcha{CaptchaId: id, Image: captchax.DataURI(img)}, nil
+}
+
+// GetSliderCaptcha 生成滑块验证码
+func (s *CaptchaService) GetSliderCaptcha(ctx *gin.Context) (*model.SliderCaptcha, error) {
+	c := s.conf.Captcha.Slider
+	width, height, size := c.Width, c.Height, c.Size
+	if width <= 0 || height <= 0 {
+		width, height = 320, 160
+	}
+	if size <= 0 {
+		size = 50
+	}
+
+	slider, err := captchax.NewSlider(width, height, size)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "生成滑块验证码", "err", err.Error())
+		return nil, errors.New("生成验证码失败")
+	}
+	id, err := s.store.Save(ctx, captchax.TypeSlider, strconv.Itoa(slider.X))
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "保存滑块验证码", "err", err.Error())
+		return nil, errors.New("生成验证码失败")
+	}
+	return &model.SliderCaptcha{
+		CaptchaId:  id,
+		Background: captchax.DataURI(slider.Background),
+		Piece:      captchax.DataURI(slider.Piece),
+		Y:          slider.Y,
+		Width:      width,
+		Height:     height,
+	}, nil
+}
+
+// VerifyCaptcha 校验图形/滑块验证码, 通过后签发一次性凭证
+func (s *CaptchaService) VerifyCaptcha(req *model.VerifyCaptchaReq, ctx *gin.Context) (*model.CaptchaTicket, error) {
+	if !s.store.Verify(ctx, req.CaptchaId, req.Answer) {
+		return nil, errors.New("验证码错误或已失效")
+	}
+	ticket, err := s.store.IssueTicket(ctx)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "签发验证码凭证", "err", err.Error())
+		return nil, errors.New("验证码校验失败")
+	}
+	return &model.CaptchaTicket{Ticket: ticket}, nil
+}
+
+func (s *CaptchaService) SendMobileCaptcha(mobile *model.Mobile, ctx *gin.Context) error {
+	mobile.Mobile = strings.TrimSpace(mobile.Mobile)
+
+	if err := s.allowSend(ctx, ctx.ClientIP()); err != nil {
+		return err
 	}
 
 	captcha := randx.RandomInt64(config.GetConfig().System.CaptchaLength)
 
-	err = s.rdb.SetInt(fmt.Sprintf("captcha:%s:%d", ctx.ClientIP(), captcha), captcha, 300)
+	err := s.rdb.Set(ctx, fmt.Sprintf("captcha:%s:%d", ctx.ClientIP(), captcha), captcha, captchaExpire)
 	if err != nil {
 		return errors.New("获取验证码失败")
 	}
-	xlog.Info(captcha)
-	//调用第三方接口发送 手机验证码
-	//以后在实现
-	return nil
+	return s.sms.SendCaptcha(mobile.Mobile, captcha, ctx)
 }
 
 func (s *CaptchaService) SendUserEmailCaptcha(ctx *gin.Context) error {
@@ -70,17 +146,13 @@ func (s *CaptchaService) SendUserEmailCaptcha(ctx *gin.Context) error {
 		return err
 	}
 
-	i, err := s.rdb.GetInt(fmt.Sprintf("captchaCount:%s", ctx.GetString("uid")))
-	if err != nil {
-		return errors.New("获取验证码失败 服务器内部错误")
-	}
-	if i >= 5 {
-		return errors.New("频繁请求")
+	if err := s.allowSend(ctx, ctx.GetString("uid")); err != nil {
+		return err
 	}
 
 	captcha := randx.RandomInt64(config.GetConfig().System.CaptchaLength)
 
-	err = s.rdb.SetInt(fmt.Sprintf("captcha:%s:%d", ctx.GetString("uid"), captcha), captcha, 300)
+	err = s.rdb.Set(ctx, fmt.Sprintf("captcha:%s:%d", ctx.GetString("uid"), captcha), captcha, captchaExpire)
 	if err != nil {
 		return errors.New("获取验证码失败")
 	}
@@ -98,41 +170,30 @@ func (s *CaptchaService) SendUserMobileCaptcha(ctx *gin.Context) error {
 		return err
 	}
 
-	i, err := s.rdb.GetInt(fmt.Sprintf("captchaCount:%s", ctx.GetString("uid")))
-	if err != nil {
-		return errors.New("获取验证码失败 服务器内部错误")
-	}
-	if i >= 5 {
-		return errors.New("频繁请求")
+	if err := s.allowSend(ctx, ctx.GetString("uid")); err != nil {
+		return err
 	}
 
 	captcha := randx.RandomInt64(config.GetConfig().System.CaptchaLength)
 
-	err = s.rdb.SetInt(fmt.Sprintf("captcha:%s:%d", ctx.GetString("uid"), captcha), captcha, 300)
+	err = s.rdb.Set(ctx, fmt.Sprintf("captcha:%s:%d", ctx.GetString("uid"), captcha), captcha, captchaExpire)
 	if err != nil {
 		return errors.New("获取验证码失败")
 	}
 
-	xlog.Info(captcha, mobile.Mobile)
-	//调用第三方接口发送 手机验证码
-	//以后在实现
-	return nil
+	return s.sms.SendCaptcha(mobile.Mobile, captcha, ctx)
 }
 
 func (s *CaptchaService) SendEmailCaptcha(req *model.Email, ctx *gin.Context) error {
 	req.Email = strings.TrimSpace(req.Email)
 
-	i, err := s.rdb.GetInt(fmt.Sprintf("captchaCount:%s", ctx.ClientIP()))
-	if err != nil {
-		return errors.New("获取验证码失败 服务器内部错误")
-	}
-	if i >= 5 {
-		return errors.New("频繁请求")
+	if err := s.allowSend(ctx, ctx.ClientIP()); err != nil {
+		return err
 	}
 
 	captcha := randx.RandomInt64(config.GetConfig().System.CaptchaLength)
 
-	err = s.rdb.SetInt(fmt.Sprintf("captcha:%s:%d", ctx.ClientIP(), captcha), captcha, 300)
+	err := s.rdb.Set(ctx, fmt.Sprintf("captcha:%s:%d", ctx.ClientIP(), captcha), captcha, captchaExpire)
 	if err != nil {
 		return errors.New("获取验证码失败")
 	}
@@ -145,68 +206,27 @@ func (s *CaptchaService) SendEmailCaptcha(req *model.Email, ctx *gin.Context) er
 }
 
 func (s *CaptchaService) Send(xemail string, captcha int64, ctx *gin.Context) error {
-	e := email.NewEmail()
-	//设置发送方的邮箱
-	e.From = config.GetConfig().System.SiteName + "<" + s.conf.SysEmail.EmailUsername + ">"
-	// 设置接收方的邮箱
-	e.To = []string{xemail}
-	//设置主题
-	e.Subject = "邮箱验证码:5分钟内有效"
-	//设置文件发送的内容
-	e.HTML = []byte(fmt.Sprintf("<html><body><h4>你的验证码是: <br>%d</h4></body></html>", captcha))
-
-	emailServer, err := emailx.NewMailServer(s.conf.SysEmail.EmailUsername, s.conf.SysEmail.EmailPassword, s.conf.SysEmail.EmailHost, s.conf.SysEmail.EmailHost, convert.Int2String(s.conf.SysEmail.EmailPort))
+	err := s.mail.SendTemplate(xemail, MailTemplateCaptcha, map[string]any{"Code": emailx.Secret(fmt.Sprint(captcha))}, ctx)
 	if err != nil {
-		xlog.Error("初始化Email服务失败", emailServer)
-		return errors.New("获取验证码失败 请检查邮箱服务配置")
-	}
-
-	err = emailServer.SendEmail(e)
-	if err != nil {
-		xlog.Error(err)
 		return errors.New("获取验证码失败")
 	}
 
-	c := ctx.GetString("uid")
-	if c == "" {
-		c = ctx.ClientIP()
-	}
-
-	_, err = s.rdb.IncrInt(fmt.Sprintf("captchaCount:%s", c), 1)
-	if err != nil {
-		return err
-	}
-	s.rdb.SetEx(fmt.Sprintf("captchaCount:%s", ctx.GetString("uid")), 1800)
-
 	// debug 模式 打印在控制台 方便查看
 	if s.conf.Gin.Model == "debug" {
-		xlog.Info(captcha)
+		s.log.WithContext(ctx).Debugw("email", xemail, "captcha", captcha)
 	}
 	return nil
 }
 
-func (s *CaptchaService) CustomEmail(req *model.Email, subject, HTML string) error {
-	req.Email = strings.TrimSpace(req.Email)
-	e := email.NewEmail()
-	//设置发送方的邮箱
-	e.From = config.GetConfig().System.SiteName + "<" + s.conf.SysEmail.EmailUsername + ">"
-	// 设置接收方的邮箱
-	e.To = []string{req.Email}
-	//设置主题
-	e.Subject = subject
-	//设置文件发送的内容
-	e.HTML = []byte(HTML)
-
-	emailServer, err := emailx.NewMailServer(s.conf.SysEmail.EmailUsername, s.conf.SysEmail.EmailPassword, s.conf.SysEmail.EmailHost, s.conf.SysEmail.EmailHost, convert.Int2String(s.conf.SysEmail.EmailPort))
+// allowSend 同一个 IP 或用户 30 分钟内最多获取 5 次验证码
+func (s *CaptchaService) allowSend(ctx context.Context, key string) error {
+	result, err := redisx.NewSlidingWindow(s.rdb, 5, 30*time.Minute).Allow(ctx, fmt.Sprintf("captchaLimit:%s", key))
 	if err != nil {
-		xlog.Error("初始化Email服务失败", emailServer)
-		return errors.New("请检查邮箱服务配置")
+		s.log.WithContext(ctx).Errorw("errMsg", "验证码限流", "err", err.Error())
+		return errors.New("获取验证码失败 服务器内部错误")
 	}
-
-	err = emailServer.SendEmail(e)
-	if err != nil {
-		return errors.New("发送邮箱信息失败")
+	if !result.Allowed {
+		return errors.New("频繁请求")
 	}
-
 	return nil
 }
@@ -15,16 +15,18 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"github.com/casbin/casbin/v2"
 	casbinModel "github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist/cache"
 	gormadapter "github.com/casbin/gorm-adapter/v3"
 	"github.com/gin-gonic/gin"
 	"github.com/go-grain/grain/config"
 	"github.com/go-grain/grain/internal/repo/system/query"
 	"github.com/go-grain/grain/log"
 	"github.com/go-grain/grain/model/system"
-	"github.com/go-pay/gopay/pkg/xlog"
+	metricsx "github.com/go-grain/grain/pkg/metrics"
 	"gorm.io/gorm"
 )
 
@@ -46,7 +48,7 @@ m = g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act
 `
 
 type ICasbinRepo interface {
-	Update(roles []*model.CasbinRule) error
+	Update(ctx context.Context, roles []*model.CasbinRule) error
 	AuthApiList(role string) ([]*model.CasbinRule, error)
 }
 
@@ -129,6 +131,80 @@ func (s *CasbinService) InitCasbinRoleRule() error {
 		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysLog", V2: "DELETE"},
 		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysLog/list", V2: "GET"},
 
+		// 审计日志
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysAudit/list", V2: "GET"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysAudit/actor", V2: "GET"},
+
+		// 系统状态
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysStatus", V2: "GET"},
+
+		// 即时消息
+		{Ptype: "p", V0: defaultRole, V1: "/api/v1/ws", V2: "GET"},
+		{Ptype: "p", V0: defaultRole, V1: "/api/v1/sysMessage/list", V2: "GET"},
+		{Ptype: "p", V0: defaultRole, V1: "/api/v1/sysMessage/unread", V2: "GET"},
+		{Ptype: "p", V0: defaultRole, V1: "/api/v1/sysMessage/read", V2: "PUT"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/ws", V2: "GET"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysMessage/list", V2: "GET"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysMessage/unread", V2: "GET"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysMessage/read", V2: "PUT"},
+
+		// 站内通知
+		{Ptype: "p", V0: defaultRole, V1: "/api/v1/sysNotification/list", V2: "GET"},
+		{Ptype: "p", V0: defaultRole, V1: "/api/v1/sysNotification/unread", V2: "GET"},
+		{Ptype: "p", V0: defaultRole, V1: "/api/v1/sysNotification/read", V2: "PUT"},
+		{Ptype: "p", V0: defaultRole, V1: "/api/v1/sysNotification/archive", V2: "PUT"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysNotification/list", V2: "GET"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysNotification/unread", V2: "GET"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysNotification/read", V2: "PUT"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysNotification/archive", V2: "PUT"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysNotification/announcement", V2: "POST"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysNotification/announcement/list", V2: "GET"},
+
+		// 运行监控
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysMonitor", V2: "GET"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysMonitor/stream", V2: "GET"},
+
+		// 定时任务
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysJob/list", V2: "GET"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysJob/enable", V2: "PUT"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysJob/disable", V2: "PUT"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysJob/run", V2: "POST"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysJob/log/list", V2: "GET"},
+
+		// 后台任务
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysTask/queues", V2: "GET"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysTask/list", V2: "GET"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysTask/retry", V2: "PUT"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysTask/taskByIds", V2: "DELETE"},
+
+		// 短信
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sms/list", V2: "GET"},
+
+		// 邮件
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysMail/list", V2: "GET"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysMail/deadLetter", V2: "GET"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/sysMail/retry", V2: "POST"},
+
+		// 分片上传
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/upload/session", V2: "POST"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/upload/session", V2: "GET"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/upload/session", V2: "DELETE"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/upload/session/chunk", V2: "POST"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/upload/session/complete", V2: "POST"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/upload/session/instant", V2: "POST"},
+
+		// 存储用量
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/upload/usage", V2: "GET"},
+
+		// 文件访问控制
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/upload/visibility", V2: "PUT"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/upload/sign", V2: "POST"},
+
+		// 存储配额
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/upload/quota/list", V2: "GET"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/upload/quota", V2: "PUT"},
+		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/upload/quota", V2: "DELETE"},
+
 		//组织管理
 		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/organize", V2: "PUT"},
 		{Ptype: "p", V0: defaultAdminRole, V1: "/api/v1/organize", V2: "POST"},
@@ -163,26 +239,44 @@ func NewCasbin(db *gorm.DB) *casbin.CachedEnforcer {
 	a, _ := gormadapter.NewAdapterByDB(db)
 	newModelFromString, err := casbinModel.NewModelFromString(modelText)
 	if err != nil {
-		xlog.Info(err)
+		log.Error(err)
 		return nil
 	}
 
 	enforcer, _ := casbin.NewCachedEnforcer(newModelFromString, a)
+	if c, err := cache.NewDefaultCache(); err == nil {
+		enforcer.SetCache(&metricsCache{Cache: c})
+	}
 
 	// 将策略规则从数据库加载到 Casbin 中
 	if err := enforcer.LoadPolicy(); err != nil {
-		xlog.Info(err)
+		log.Error(err)
 		return nil
 	}
 
 	return enforcer
 }
 
+// metricsCache 包装 casbin 决策缓存, 统计命中率
+type metricsCache struct {
+	cache.Cache
+}
+
+func (c *metricsCache) Get(key string) (bool, error) {
+	res, err := c.Cache.Get(key)
+	if err != nil {
+		metricsx.CasbinCache.WithLabelValues("miss").Inc()
+	} else {
+		metricsx.CasbinCache.WithLabelValues("hit").Inc()
+	}
+	return res, err
+}
+
 // ReLoadPolicy 重新加载权限数据
 func (s *CasbinService) ReLoadPolicy() error {
 	// 将策略规则从数据库加载到 Casbin 中
 	if err := s.enforcer.LoadPolicy(); err != nil {
-		xlog.Info(err)
+		s.log.Errorw("errMsg", "重新加载权限失败", "err", err.Error())
 		return err
 	}
 	return nil
@@ -223,9 +317,9 @@ func (s *CasbinService) Update(roles *model.CasbinReq, ctx *gin.Context) error {
 		return err
 	}
 
-	if err := s.repo.Update(c); err != nil {
-		if err = s.repo.Update(oldList); err != nil {
-			s.log.Errorw("errMsg", "更新角色权限失败", "err", err.Error())
+	if err := s.repo.Update(ctx, c); err != nil {
+		if err = s.repo.Update(ctx, oldList); err != nil {
+			s.log.WithContext(ctx).Errorw("errMsg", "更新角色权限失败", "err", err.Error())
 			return errors.New("更新失败,完犊子了,我一点补救的办法都没有 我能怎么办 你说我能怎么办 ^*^*^")
 		}
 	}
@@ -233,7 +327,7 @@ func (s *CasbinService) Update(roles *model.CasbinReq, ctx *gin.Context) error {
 	if err := s.ReLoadPolicy(); err != nil {
 		return err
 	}
-	s.log.Infow("errMsg", "更新角色权限")
+	s.log.WithContext(ctx).Infow("errMsg", "更新角色权限")
 	return nil
 }
 
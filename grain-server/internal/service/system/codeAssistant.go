@@ -27,7 +27,6 @@ import (
 	redisx "github.com/go-grain/grain/pkg/redis"
 	stringsx "github.com/go-grain/grain/pkg/strings"
 	"github.com/go-grain/grain/stencil"
-	"github.com/go-pay/gopay/pkg/xlog"
 	"go/ast"
 	"go/parser"
 	"go/token"
@@ -78,55 +77,55 @@ func NewCodeAssistantService(repo ICodeAssistantRepo, rdb redisx.IRedis, conf *c
 func (s *CodeAssistantService) CreateProject(p *model.Project, ctx *gin.Context) error {
 	p.Model = model.Model{}
 	if err := s.repo.CreateProject(p); err != nil {
-		s.log.Errorw("errMsg", "创建项目", "err", err.Error())
+		s.log.WithContext(ctx).Errorw("errMsg", "创建项目", "err", err.Error())
 		return err
 	}
-	s.log.Infow("创建项目")
+	s.log.WithContext(ctx).Infow("创建项目")
 	return nil
 }
 
 func (s *CodeAssistantService) UpdateProject(p *model.Project, ctx *gin.Context) error {
 	if err := s.repo.UpdateProject(p); err != nil {
-		s.log.Errorw("errMsg", "更新项目失败", "err", err.Error())
+		s.log.WithContext(ctx).Errorw("errMsg", "更新项目失败", "err", err.Error())
 		return err
 	}
-	s.log.Infow("更新项目成功")
+	s.log.WithContext(ctx).Infow("更新项目成功")
 	return nil
 }
 
 func (s *CodeAssistantService) CreateModel(m *model.Models, ctx *gin.Context) error {
 	if err := s.repo.CreateModel(m); err != nil {
-		s.log.Errorw("errMsg", "创建模块", "err", err.Error())
+		s.log.WithContext(ctx).Errorw("errMsg", "创建模块", "err", err.Error())
 		return err
 	}
-	s.log.Infow("创建模块")
+	s.log.WithContext(ctx).Infow("创建模块")
 	return nil
 }
 
 func (s *CodeAssistantService) UpdateModel(m *model.Models, ctx *gin.Context) error {
 	if err := s.repo.UpdateModel(m); err != nil {
-		s.log.Errorw("errMsg", "更新模块", "err", err.Error())
+		s.log.WithContext(ctx).Errorw("errMsg", "更新模块", "err", err.Error())
 		return err
 	}
-	s.log.Infow("更新模块")
+	s.log.WithContext(ctx).Infow("更新模块")
 	return nil
 }
 
 func (s *CodeAssistantService) CreateField(f *model.Fields, ctx *gin.Context) error {
 	if err := s.repo.CreateField(f); err != nil {
-		s.log.Errorw("errMsg", "创建字段", "err", err.Error())
+		s.log.WithContext(ctx).Errorw("errMsg", "创建字段", "err", err.Error())
 		return err
 	}
-	s.log.Infow("创建字段")
+	s.log.WithContext(ctx).Infow("创建字段")
 	return nil
 }
 
 func (s *CodeAssistantService) UpdateField(f *model.Fields, ctx *gin.Context) error {
 	if err := s.repo.UpdateField(f); err != nil {
-		s.log.Errorw("errMsg", "更新字段", "err", err.Error())
+		s.log.WithContext(ctx).Errorw("errMsg", "更新字段", "err", err.Error())
 		return err
 	}
-	s.log.Infow("更新字段")
+	s.log.WithContext(ctx).Infow("更新字段")
 	return nil
 }
 
@@ -181,28 +180,28 @@ func (s *CodeAssistantService) GetFieldList(parentId uint, ctx *gin.Context) ([]
 
 func (s *CodeAssistantService) DeleteProjectByIds(pid uint, ctx *gin.Context) error {
 	if err := s.repo.DeleteProjectById(pid); err != nil {
-		s.log.Errorw("errMsg", "删除项目", "err", err.Error())
+		s.log.WithContext(ctx).Errorw("errMsg", "删除项目", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "删除项目")
+	s.log.WithContext(ctx).Infow("errMsg", "删除项目")
 	return nil
 }
 
 func (s *CodeAssistantService) DeleteModelById(mid uint, ctx *gin.Context) error {
 	if err := s.repo.DeleteModelById(mid); err != nil {
-		s.log.Errorw("errMsg", "删除模型", "err", err.Error())
+		s.log.WithContext(ctx).Errorw("errMsg", "删除模型", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "删除模型")
+	s.log.WithContext(ctx).Infow("errMsg", "删除模型")
 	return nil
 }
 
 func (s *CodeAssistantService) DeleteFieldById(fid uint, ctx *gin.Context) error {
 	if err := s.repo.DeleteFieldById(fid); err != nil {
-		s.log.Errorw("errMsg", "删除字段", "err", err.Error())
+		s.log.WithContext(ctx).Errorw("errMsg", "删除字段", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "删除字段")
+	s.log.WithContext(ctx).Infow("errMsg", "删除字段")
 	return nil
 }
 
@@ -407,7 +406,7 @@ g.Execute()`
 
 	open, err := os.OpenFile(filename, os.O_CREATE, 0666)
 	if err != nil {
-		xlog.Info(err)
+		log.Error(err)
 		return err
 	}
 	defer open.Close()
@@ -429,7 +428,7 @@ func InjectGenBuild(model *model.Models) error {
 	fset := token.NewFileSet()
 	node, err := parser.ParseFile(fset, filename, nil, parser.AllErrors)
 	if err != nil {
-		fmt.Println(err)
+		log.Error(err)
 		return err
 	}
 
@@ -444,7 +443,7 @@ func InjectGenBuild(model *model.Models) error {
 	_ = os.Remove(filename)
 	open, err := os.OpenFile(filename, os.O_CREATE, 0666)
 	if err != nil {
-		xlog.Info(err)
+		log.Error(err)
 		return err
 	}
 	old, _ := io.ReadAll(open)
@@ -495,7 +494,7 @@ func (s *CodeAssistantService) generateCode(m model.Models, p model.CodePath) (e
 	if exists {
 		err = os.MkdirAll(dir, os.ModePerm)
 		if err != nil {
-			xlog.Error(err)
+			s.log.Error(err)
 			return err
 		}
 	}
@@ -504,7 +503,7 @@ func (s *CodeAssistantService) generateCode(m model.Models, p model.CodePath) (e
 	var b []byte
 	b, err = p.FS.ReadFile(p.TemplatePath)
 	if err != nil {
-		xlog.Error(err)
+		s.log.Error(err)
 		return err
 	}
 	rt := string(b)
@@ -531,7 +530,7 @@ func (s *CodeAssistantService) generateCode(m model.Models, p model.CodePath) (e
 
 	temp, err := template.New(stringsx.ToLower(p.Type)).Parse(rt)
 	if err != nil {
-		xlog.Error(err)
+		s.log.Error(err)
 		return err
 	}
 
@@ -549,7 +548,7 @@ func (s *CodeAssistantService) generateCode(m model.Models, p model.CodePath) (e
 
 	open, err := os.OpenFile(filename, os.O_RDONLY|os.O_CREATE, 0644)
 	if err != nil {
-		xlog.Info(err)
+		s.log.Error(err)
 		return err
 	}
 	defer open.Close()
@@ -557,7 +556,7 @@ func (s *CodeAssistantService) generateCode(m model.Models, p model.CodePath) (e
 	//渲染模板文件
 	err = temp.Execute(open, m)
 	if err != nil {
-		xlog.Error(err)
+		s.log.Error(err)
 		return err
 	}
 	//格式化代码
@@ -713,14 +712,14 @@ func (s *CodeAssistantService) WebGeneratedCode(m model.Models, web *model.CodeP
 	//检查目录是否存在
 	exists := filex.PathIsNotExist(web.FilePath)
 	if err != nil {
-		xlog.Error(err)
+		s.log.Error(err)
 		return err
 	}
 
 	if exists {
 		err = os.MkdirAll(web.FilePath, os.ModePerm)
 		if err != nil {
-			xlog.Error(err)
+			s.log.Error(err)
 			return err
 		}
 	}
@@ -728,7 +727,7 @@ func (s *CodeAssistantService) WebGeneratedCode(m model.Models, web *model.CodeP
 	//读取模板文件
 	b, err := web.FS.ReadFile(web.TemplatePath)
 	if err != nil {
-		xlog.Error(err)
+		s.log.Error(err)
 		return err
 	}
 	rt := string(b)
@@ -739,7 +738,7 @@ func (s *CodeAssistantService) WebGeneratedCode(m model.Models, web *model.CodeP
 
 	temp, err := template.New(stringsx.ToLower(m.Type)).Parse(rt)
 	if err != nil {
-		xlog.Info(err, "New模版失败", web.TemplatePath)
+		s.log.Errorw("errMsg", "New模版失败", "path", web.TemplatePath, "err", err.Error())
 		return err
 	}
 
@@ -750,21 +749,21 @@ func (s *CodeAssistantService) WebGeneratedCode(m model.Models, web *model.CodeP
 		_ = os.Remove(web.Filename)
 	} else {
 		if !exists {
-			xlog.Info("文件已存在", fmt.Sprintf("%s.go", m.Type))
+			s.log.Infof("文件已存在: %s.go", m.Type)
 			return errors.New("文件已存在: " + fmt.Sprintf("%s/%s.go", m.Type, m.Name))
 		}
 	}
 
 	open, err := os.OpenFile(web.Filename, os.O_RDONLY|os.O_CREATE, 0644)
 	if err != nil {
-		xlog.Info(err)
+		s.log.Error(err)
 		return err
 	}
 	defer open.Close()
 	//渲染模板文件
 	err = temp.Execute(open, m)
 	if err != nil {
-		xlog.Error(err)
+		s.log.Error(err)
 		return err
 	}
 	return nil
@@ -810,14 +809,14 @@ func (s *CodeAssistantService) FlutterGeneratedCode(m model.Models, flutter *mod
 	//检查目录是否存在
 	exists := filex.PathIsNotExist(flutter.FilePath)
 	if err != nil {
-		xlog.Error(err)
+		s.log.Error(err)
 		return err
 	}
 
 	if exists {
 		err = os.MkdirAll(flutter.FilePath, os.ModePerm)
 		if err != nil {
-			xlog.Error(err)
+			s.log.Error(err)
 			return err
 		}
 	}
@@ -825,14 +824,14 @@ func (s *CodeAssistantService) FlutterGeneratedCode(m model.Models, flutter *mod
 	//读取模板文件
 	b, err := flutter.FS.ReadFile(flutter.TemplatePath)
 	if err != nil {
-		xlog.Error(err)
+		s.log.Error(err)
 		return err
 	}
 	rt := string(b)
 
 	temp, err := template.New(stringsx.ToLower(m.Type)).Parse(rt)
 	if err != nil {
-		xlog.Info(err, "New模版失败", flutter.TemplatePath)
+		s.log.Errorw("errMsg", "New模版失败", "path", flutter.TemplatePath, "err", err.Error())
 		return err
 	}
 
@@ -849,7 +848,7 @@ func (s *CodeAssistantService) FlutterGeneratedCode(m model.Models, flutter *mod
 
 	open, err := os.OpenFile(flutter.Filename, os.O_RDONLY|os.O_CREATE, 0644)
 	if err != nil {
-		xlog.Info(err)
+		s.log.Error(err)
 		return err
 	}
 	defer open.Close()
@@ -874,7 +873,7 @@ func (s *CodeAssistantService) FlutterGeneratedCode(m model.Models, flutter *mod
 	//渲染模板文件
 	err = temp.Execute(open, m)
 	if err != nil {
-		xlog.Error(err)
+		s.log.Error(err)
 		return err
 	}
 	return nil
@@ -1,23 +1,23 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/go-grain/grain/config"
 	"github.com/go-grain/grain/log"
 	model "github.com/go-grain/grain/model/system"
 	redisx "github.com/go-grain/grain/pkg/redis"
-	"github.com/go-pay/gopay/pkg/xlog"
 )
 
 type IOrganizeRepo interface {
-	CreateOrganize(organize *model.Organize) error
-	GetOrganizeById(id uint) (u *model.Organize, err error)
+	CreateOrganize(ctx context.Context, organize *model.Organize) error
+	GetOrganizeById(ctx context.Context, id uint) (u *model.Organize, err error)
 	GetOrganizeList(req *model.OrganizeQuery) ([]*model.Organize, error)
 	//GetOrganizeListGroup(req *model.OrganizeQuery) ([]*model.Organize, error)
-	UpdateOrganize(organize *model.Organize) error
-	DeleteOrganizeById(organizeId uint) error
-	DeleteOrganizeByIds(organizeIds []uint) error
+	UpdateOrganize(ctx context.Context, organize *model.Organize) error
+	DeleteOrganizeById(ctx context.Context, organizeId uint) error
+	DeleteOrganizeByIds(ctx context.Context, organizeIds []uint) error
 }
 
 type OrganizeService struct {
@@ -37,16 +37,16 @@ func NewOrganizeService(repo IOrganizeRepo, rdb redisx.IRedis, conf *config.Conf
 }
 
 func (s *OrganizeService) CreateOrganize(organize *model.Organize, ctx *gin.Context) error {
-	if err := s.repo.CreateOrganize(organize); err != nil {
-		s.log.Errorw("errMsg", "创建项目", "err", err.Error())
+	if err := s.repo.CreateOrganize(ctx, organize); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "创建项目", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "创建组织管理")
+	s.log.WithContext(ctx).Infow("errMsg", "创建组织管理")
 	return nil
 }
 
 func (s *OrganizeService) GetOrganizeById(organizeId uint, ctx *gin.Context) (*model.Organize, error) {
-	return s.repo.GetOrganizeById(organizeId)
+	return s.repo.GetOrganizeById(ctx, organizeId)
 }
 
 func (s *OrganizeService) GetOrganizeList(req *model.OrganizeQuery, ctx *gin.Context) ([]*model.Organize, error) {
@@ -84,7 +84,7 @@ func (s *OrganizeService) GetOrganizeListGroup(req *model.OrganizeQuery, ctx *gi
 	var o []*oe
 
 	//遍历组织
-	xlog.Info(len(list))
+	s.log.WithContext(ctx).Debugw("organizes", len(list))
 	for _, organize := range list {
 		//查询xx组织下的部门
 		req.QType = "2"
@@ -137,28 +137,28 @@ func (s *OrganizeService) GetOrganizeListGroup(req *model.OrganizeQuery, ctx *gi
 }
 
 func (s *OrganizeService) UpdateOrganize(organize *model.Organize, ctx *gin.Context) error {
-	if err := s.repo.UpdateOrganize(organize); err != nil {
-		s.log.Errorw("errMsg", "更新组织管理", "err", err.Error())
+	if err := s.repo.UpdateOrganize(ctx, organize); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "更新组织管理", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "更新组织管理")
+	s.log.WithContext(ctx).Infow("errMsg", "更新组织管理")
 	return nil
 }
 
 func (s *OrganizeService) DeleteOrganizeById(organizeId uint, ctx *gin.Context) error {
-	if err := s.repo.DeleteOrganizeById(organizeId); err != nil {
-		s.log.Errorw("errMsg", "删除组织管理", "err", err.Error())
+	if err := s.repo.DeleteOrganizeById(ctx, organizeId); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "删除组织管理", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "删除组织管理")
+	s.log.WithContext(ctx).Infow("errMsg", "删除组织管理")
 	return nil
 }
 
 func (s *OrganizeService) DeleteOrganizeByIds(organizeIds []uint, ctx *gin.Context) error {
-	if err := s.repo.DeleteOrganizeByIds(organizeIds); err != nil {
-		s.log.Errorw("errMsg", "批量删除组织管理", "err", err.Error())
+	if err := s.repo.DeleteOrganizeByIds(ctx, organizeIds); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "批量删除组织管理", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "批量删除组织管理")
+	s.log.WithContext(ctx).Infow("errMsg", "批量删除组织管理")
 	return nil
 }
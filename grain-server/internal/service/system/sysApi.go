@@ -15,6 +15,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -29,12 +30,12 @@ import (
 )
 
 type IApiRepo interface {
-	CreateApi(api *model.SysApi) error
+	CreateApi(ctx context.Context, api *model.SysApi) error
 	GetApiList(req *model.SysApiReq) ([]*model.SysApi, error)
 	GetAllApi() ([]*model.SysApi, error)
-	UpdateApi(api *model.SysApi) error
-	DeleteApiByIds(ids []uint) error
-	DeleteApiById(id uint) error
+	UpdateApi(ctx context.Context, api *model.SysApi) error
+	DeleteApiByIds(ctx context.Context, ids []uint) error
+	DeleteApiById(ctx context.Context, id uint) error
 	AuthApiList(role string) (list []*model.CasbinRule, err error)
 }
 
@@ -116,6 +117,52 @@ func (s *ApiService) InitApi() error {
 		{Path: "/api/v1/sysLog/list", Description: "获取系统操作日志列表", ApiGroup: "系统菜单", Method: "GET"},
 		{Path: "/api/v1/sysLog", Description: "删除系统操作日志", ApiGroup: "系统菜单", Method: "DELETE"},
 
+		// 审计日志
+		{Path: "/api/v1/sysAudit/list", Description: "按实体获取审计记录", ApiGroup: "审计日志", Method: "GET"},
+		{Path: "/api/v1/sysAudit/actor", Description: "按操作人获取审计记录", ApiGroup: "审计日志", Method: "GET"},
+
+		// 系统状态
+		{Path: "/api/v1/sysStatus", Description: "获取系统状态", ApiGroup: "系统状态", Method: "GET"},
+
+		// 即时消息
+		{Path: "/api/v1/ws", Description: "建立 WebSocket 连接", ApiGroup: "即时消息", Method: "GET"},
+		{Path: "/api/v1/sysMessage/list", Description: "获取聊天记录", ApiGroup: "即时消息", Method: "GET"},
+		{Path: "/api/v1/sysMessage/unread", Description: "获取未读消息数", ApiGroup: "即时消息", Method: "GET"},
+		{Path: "/api/v1/sysMessage/read", Description: "标记会话已读", ApiGroup: "即时消息", Method: "PUT"},
+
+		// 站内通知
+		{Path: "/api/v1/sysNotification/list", Description: "获取通知列表", ApiGroup: "站内通知", Method: "GET"},
+		{Path: "/api/v1/sysNotification/unread", Description: "获取未读通知数", ApiGroup: "站内通知", Method: "GET"},
+		{Path: "/api/v1/sysNotification/read", Description: "标记通知已读", ApiGroup: "站内通知", Method: "PUT"},
+		{Path: "/api/v1/sysNotification/archive", Description: "归档通知", ApiGroup: "站内通知", Method: "PUT"},
+		{Path: "/api/v1/sysNotification/announcement", Description: "发布公告", ApiGroup: "站内通知", Method: "POST"},
+		{Path: "/api/v1/sysNotification/announcement/list", Description: "获取公告列表", ApiGroup: "站内通知", Method: "GET"},
+
+		// 运行监控
+		{Path: "/api/v1/sysMonitor", Description: "获取运行监控", ApiGroup: "运行监控", Method: "GET"},
+		{Path: "/api/v1/sysMonitor/stream", Description: "实时运行监控", ApiGroup: "运行监控", Method: "GET"},
+
+		// 定时任务
+		{Path: "/api/v1/sysJob/list", Description: "获取定时任务列表", ApiGroup: "定时任务", Method: "GET"},
+		{Path: "/api/v1/sysJob/enable", Description: "启用定时任务", ApiGroup: "定时任务", Method: "PUT"},
+		{Path: "/api/v1/sysJob/disable", Description: "停用定时任务", ApiGroup: "定时任务", Method: "PUT"},
+		{Path: "/api/v1/sysJob/run", Description: "立即执行定时任务", ApiGroup: "定时任务", Method: "POST"},
+		{Path: "/api/v1/sysJob/log/list", Description: "获取定时任务执行记录", ApiGroup: "定时任务", Method: "GET"},
+
+		// 后台任务
+		{Path: "/api/v1/sysTask/queues", Description: "获取任务队列", ApiGroup: "后台任务", Method: "GET"},
+		{Path: "/api/v1/sysTask/list", Description: "获取后台任务列表", ApiGroup: "后台任务", Method: "GET"},
+		{Path: "/api/v1/sysTask/retry", Description: "重试后台任务", ApiGroup: "后台任务", Method: "PUT"},
+		{Path: "/api/v1/sysTask/taskByIds", Description: "删除后台任务", ApiGroup: "后台任务", Method: "DELETE"},
+
+		// 短信
+		{Path: "/api/v1/sms/list", Description: "获取短信投递记录", ApiGroup: "短信管理", Method: "GET"},
+
+		// 邮件
+		{Path: "/api/v1/sysMail/list", Description: "获取邮件发送历史", ApiGroup: "邮件管理", Method: "GET"},
+		{Path: "/api/v1/sysMail/deadLetter", Description: "获取邮件死信列表", ApiGroup: "邮件管理", Method: "GET"},
+		{Path: "/api/v1/sysMail/retry", Description: "重发死信邮件", ApiGroup: "邮件管理", Method: "POST"},
+
 		//系统组织
 		{Path: "/api/v1/organize", Description: "编辑组织", ApiGroup: "组织管理", Method: "PUT"},
 		{Path: "/api/v1/organize", Description: "创建组织", ApiGroup: "组织管理", Method: "POST"},
@@ -129,6 +176,18 @@ func (s *ApiService) InitApi() error {
 		{Path: "/api/v1/upload", Description: "创建文件", ApiGroup: "附件管理", Method: "POST"},
 		{Path: "/api/v1/upload/list", Description: "获取文件列表", ApiGroup: "附件管理", Method: "GET"},
 		{Path: "/api/v1/sysRole/deleteUploadByIds", Description: "批量删除文件", ApiGroup: "附件管理", Method: "DELETE"},
+		{Path: "/api/v1/upload/session", Description: "创建分片上传会话", ApiGroup: "附件管理", Method: "POST"},
+		{Path: "/api/v1/upload/session", Description: "查询分片上传会话", ApiGroup: "附件管理", Method: "GET"},
+		{Path: "/api/v1/upload/session", Description: "取消分片上传", ApiGroup: "附件管理", Method: "DELETE"},
+		{Path: "/api/v1/upload/session/chunk", Description: "上传分片", ApiGroup: "附件管理", Method: "POST"},
+		{Path: "/api/v1/upload/session/complete", Description: "完成分片上传", ApiGroup: "附件管理", Method: "POST"},
+		{Path: "/api/v1/upload/session/instant", Description: "秒传", ApiGroup: "附件管理", Method: "POST"},
+		{Path: "/api/v1/upload/usage", Description: "存储用量报表", ApiGroup: "附件管理", Method: "GET"},
+		{Path: "/api/v1/upload/visibility", Description: "修改文件可见范围", ApiGroup: "附件管理", Method: "PUT"},
+		{Path: "/api/v1/upload/sign", Description: "生成临时下载地址", ApiGroup: "附件管理", Method: "POST"},
+		{Path: "/api/v1/upload/quota/list", Description: "存储配额列表", ApiGroup: "附件管理", Method: "GET"},
+		{Path: "/api/v1/upload/quota", Description: "设置存储配额", ApiGroup: "附件管理", Method: "PUT"},
+		{Path: "/api/v1/upload/quota", Description: "删除存储配额", ApiGroup: "附件管理", Method: "DELETE"},
 	}
 	q := query.Q.SysApi
 
@@ -166,14 +225,14 @@ func (s *ApiService) CreateApi(api *model.SysApi, ctx *gin.Context) error {
 		api.Description = strings.ReplaceAll(api.Description, fmt.Sprintf("[%s]", api.ApiGroup), "")
 	}
 
-	if err := s.repo.CreateApi(api); err != nil {
-		s.log.Errorw("errMsg", "创建Api", "err", err.Error())
+	if err := s.repo.CreateApi(ctx, api); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "创建Api", "err", err.Error())
 		if strings.Contains(err.Error(), "duplicated key not allowed") {
 			return errors.New("提交的参数重复")
 		}
 		return err
 	}
-	s.log.Infow("errMsg", "创建Api")
+	s.log.WithContext(ctx).Infow("errMsg", "创建Api")
 	return nil
 }
 
@@ -286,33 +345,33 @@ func (s *ApiService) UpdateApi(api *model.SysApi, ctx *gin.Context) error {
 		api.ApiGroup = matches[0][1]
 		api.Description = strings.ReplaceAll(api.Description, fmt.Sprintf("[%s]", api.ApiGroup), "")
 	}
-	err := s.repo.UpdateApi(api)
+	err := s.repo.UpdateApi(ctx, api)
 	if err != nil {
-		s.log.Errorw("errMsg", "更新Api", "err", err.Error())
+		s.log.WithContext(ctx).Errorw("errMsg", "更新Api", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "更新Api")
+	s.log.WithContext(ctx).Infow("errMsg", "更新Api")
 	return nil
 }
 
 func (s *ApiService) DeleteApiById(id uint, ctx *gin.Context) error {
-	err := s.repo.DeleteApiById(id)
+	err := s.repo.DeleteApiById(ctx, id)
 	if err != nil {
-		s.log.Errorw("errMsg", "删除Api", "err", err.Error())
+		s.log.WithContext(ctx).Errorw("errMsg", "删除Api", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "删除Api")
+	s.log.WithContext(ctx).Infow("errMsg", "删除Api")
 	return nil
 
 }
 
 func (s *ApiService) DeleteApiByIds(ids []uint, ctx *gin.Context) error {
-	err := s.repo.DeleteApiByIds(ids)
+	err := s.repo.DeleteApiByIds(ctx, ids)
 	if err != nil {
-		s.log.Errorw("errMsg", "批量删除Api", "err", err.Error())
+		s.log.WithContext(ctx).Errorw("errMsg", "批量删除Api", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "批量删除Api")
+	s.log.WithContext(ctx).Infow("errMsg", "批量删除Api")
 	return nil
 
 }
@@ -0,0 +1,73 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-grain/grain/config"
+	"github.com/go-grain/grain/log"
+	model "github.com/go-grain/grain/model/system"
+	redisx "github.com/go-grain/grain/pkg/redis"
+)
+
+type ISysAuditRepo interface {
+	GetAuditList(req *model.SysAuditReq) ([]*model.SysAudit, error)
+}
+
+type SysAuditService struct {
+	repo ISysAuditRepo
+	rdb  redisx.IRedis
+	conf *config.Config
+	log  *log.Helper
+}
+
+func NewSysAuditService(repo ISysAuditRepo, rdb redisx.IRedis, conf *config.Config, logger log.Logger) *SysAuditService {
+	return &SysAuditService{
+		repo: repo,
+		rdb:  rdb,
+		conf: conf,
+		log:  log.NewHelper(logger),
+	}
+}
+
+// GetAuditList 按实体(数据表+记录主键)查询审计记录
+func (s *SysAuditService) GetAuditList(req *model.SysAuditReq, ctx *gin.Context) ([]*model.SysAudit, error) {
+	if req.Entity == "" {
+		return nil, errors.New("实体名称不能为空")
+	}
+	return s.getAuditList(req)
+}
+
+// GetAuditListByActor 按操作人查询审计记录
+func (s *SysAuditService) GetAuditListByActor(req *model.SysAuditReq, ctx *gin.Context) ([]*model.SysAudit, error) {
+	if req.Actor == "" {
+		return nil, errors.New("操作人不能为空")
+	}
+	return s.getAuditList(req)
+}
+
+func (s *SysAuditService) getAuditList(req *model.SysAuditReq) ([]*model.SysAudit, error) {
+	list, err := s.repo.GetAuditList(req)
+	if err != nil {
+		s.log.Errorw("errMsg", "获取审计记录", "err", err.Error())
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.New("暂无更多数据")
+	}
+	return list, nil
+}
@@ -0,0 +1,255 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-grain/grain/config"
+	"github.com/go-grain/grain/log"
+	model "github.com/go-grain/grain/model/system"
+	cronx "github.com/go-grain/grain/pkg/cron"
+	redisx "github.com/go-grain/grain/pkg/redis"
+	"gorm.io/gorm"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type ISysJobRepo interface {
+	SyncJob(ctx context.Context, job *model.SysJob) error
+	GetJob(ctx context.Context, name string) (*model.SysJob, error)
+	GetJobs(ctx context.Context) ([]*model.SysJob, error)
+	SetEnabled(ctx context.Context, name string, enabled bool) error
+	CreateJobLog(ctx context.Context, jobLog *model.SysJobLog) error
+	GetLastJobLog(ctx context.Context, name string) (*model.SysJobLog, error)
+	GetJobLogList(req *model.SysJobLogReq) ([]*model.SysJobLog, error)
+	PurgeJobLogs(ctx context.Context, before time.Time) (int64, error)
+	PurgeDeleted(ctx context.Context, before time.Time) (map[string]int64, error)
+}
+
+// 定时任务分布式锁的 key 前缀
+const sysJobLockPrefix = "sysJob"
+
+type SysJobService struct {
+	repo      ISysJobRepo
+	scheduler *cronx.Scheduler
+	rdb       redisx.IRedis
+	conf      *config.Config
+	log       *log.Helper
+	host      string
+}
+
+func NewSysJobService(repo ISysJobRepo, rdb redisx.IRedis, conf *config.Config, logger log.Logger) *SysJobService {
+	host, _ := os.Hostname()
+	s := &SysJobService{
+		repo: repo,
+		rdb:  rdb,
+		conf: conf,
+		log:  log.NewHelper(logger),
+		host: host,
+	}
+	s.scheduler = cronx.New(cronx.Options{
+		Timeout: conf.Cron.Timeout,
+		Prefix:  sysJobLockPrefix,
+		Locker:  jobLocker{rdb: rdb},
+		Enabled: s.enabled,
+		Record:  s.record,
+	})
+	return s
+}
+
+// Register 注册任务, 配置文件 cron.jobs 中同名任务的表达式以及超时时间覆盖代码中的默认值
+func (s *SysJobService) Register(jobs ...cronx.Job) error {
+	for i := range jobs {
+		if c, ok := s.conf.Cron.Jobs[jobs[i].Name]; ok {
+			if c.Spec != "" {
+				jobs[i].Spec = c.Spec
+			}
+			if c.Timeout > 0 {
+				jobs[i].Timeout = c.Timeout
+			}
+		}
+	}
+	return s.scheduler.Register(jobs...)
+}
+
+// Start 把注册的任务同步到数据库后开始调度
+func (s *SysJobService) Start(ctx context.Context) error {
+	if !s.conf.Cron.Enable {
+		return nil
+	}
+	for _, e := range s.scheduler.Entries() {
+		job := &model.SysJob{Name: e.Name, Spec: e.Spec, Description: e.Description}
+		if err := s.repo.SyncJob(ctx, job); err != nil {
+			s.log.WithContext(ctx).Errorw("errMsg", "同步定时任务", "job", e.Name, "err", err.Error())
+			return err
+		}
+	}
+	s.scheduler.Start(ctx)
+	return nil
+}
+
+// Stop 停止调度, 正在执行的任务会收到取消信号, 最多等到 ctx 超时
+func (s *SysJobService) Stop(ctx context.Context) error {
+	return s.scheduler.Stop(ctx)
+}
+
+func (s *SysJobService) GetJobList(ctx *gin.Context) ([]*model.SysJobInfo, error) {
+	rows, err := s.repo.GetJobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	enabled := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		enabled[row.Name] = row.Enabled
+	}
+
+	var list []*model.SysJobInfo
+	for _, e := range s.scheduler.Entries() {
+		info := &model.SysJobInfo{
+			Name:        e.Name,
+			Spec:        e.Spec,
+			Description: e.Description,
+			Enabled:     enabled[e.Name],
+			Timeout:     int64(e.Timeout.Seconds()),
+			Running:     e.Running,
+			Next:        e.Next,
+		}
+		if info.LastRun, err = s.repo.GetLastJobLog(ctx, e.Name); err != nil {
+			return nil, err
+		}
+		list = append(list, info)
+	}
+	if len(list) == 0 {
+		return nil, errors.New("暂无更多数据")
+	}
+	return list, nil
+}
+
+func (s *SysJobService) SetEnabled(name string, enabled bool, ctx *gin.Context) error {
+	if _, ok := s.scheduler.Entry(name); !ok {
+		return cronx.ErrJobNotFound
+	}
+	if err := s.repo.SetEnabled(ctx, name, enabled); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "修改定时任务状态", "job", name, "err", err.Error())
+		return err
+	}
+	s.log.WithContext(ctx).Infow("errMsg", "修改定时任务状态", "job", name, "enabled", enabled)
+	return nil
+}
+
+// RunJob 立即在后台执行一次, 执行结果在执行记录中查看
+func (s *SysJobService) RunJob(name string, ctx *gin.Context) error {
+	if !s.conf.Cron.Enable {
+		return errors.New("定时任务未开启")
+	}
+	if err := s.scheduler.RunNow(name); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "手动执行定时任务", "job", name, "err", err.Error())
+		return err
+	}
+	s.log.WithContext(ctx).Infow("errMsg", "手动执行定时任务", "job", name)
+	return nil
+}
+
+func (s *SysJobService) GetJobLogList(req *model.SysJobLogReq, ctx *gin.Context) ([]*model.SysJobLog, error) {
+	list, err := s.repo.GetJobLogList(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.New("暂无更多数据")
+	}
+	return list, nil
+}
+
+// PurgeJobLogs 删除超过保留天数的执行记录, days 小于等于 0 时不清理
+func (s *SysJobService) PurgeJobLogs(ctx context.Context, days int) (int64, error) {
+	if days <= 0 {
+		return 0, nil
+	}
+	return s.repo.PurgeJobLogs(ctx, time.Now().AddDate(0, 0, -days))
+}
+
+// PurgeDeleted 彻底删除回收站中超过保留天数的数据, days 小于等于 0 时不清理
+func (s *SysJobService) PurgeDeleted(ctx context.Context, days int) (string, error) {
+	if days <= 0 {
+		return "未设置保留天数, 不清理", nil
+	}
+	counts, err := s.repo.PurgeDeleted(ctx, time.Now().AddDate(0, 0, -days))
+	tables := make([]string, 0, len(counts))
+	for table, n := range counts {
+		tables = append(tables, fmt.Sprintf("%s %d", table, n))
+	}
+	sort.Strings(tables)
+	output := strings.Join(tables, ", ")
+	if output == "" {
+		output = "没有需要清理的数据"
+	}
+	return output, err
+}
+
+// enabled 每次定时触发前读取数据库中的启用状态, 多个实例之间共享
+func (s *SysJobService) enabled(ctx context.Context, name string) bool {
+	job, err := s.repo.GetJob(ctx, name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true
+	}
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "读取定时任务状态", "job", name, "err", err.Error())
+		return false
+	}
+	return job.Enabled
+}
+
+func (s *SysJobService) record(run *cronx.Run) {
+	jobLog := &model.SysJobLog{
+		JobName:  run.Job,
+		Trigger:  run.Trigger,
+		Host:     s.host,
+		StartAt:  run.StartAt,
+		EndAt:    run.EndAt,
+		Duration: run.EndAt.Sub(run.StartAt).Milliseconds(),
+		Status:   run.Status,
+		Output:   run.Output,
+	}
+	if run.Err != nil {
+		jobLog.Error = run.Err.Error()
+		s.log.Errorw("errMsg", "定时任务执行失败", "job", run.Job, "status", run.Status, "err", jobLog.Error)
+	} else {
+		s.log.Infow("errMsg", "定时任务执行完成", "job", run.Job, "duration", jobLog.Duration, "output", run.Output)
+	}
+	// 程序退出时任务的 ctx 已经取消, 执行记录使用新的 ctx 保存
+	if err := s.repo.CreateJobLog(context.Background(), jobLog); err != nil {
+		s.log.Errorw("errMsg", "保存定时任务执行记录", "job", run.Job, "err", err.Error())
+	}
+}
+
+// jobLocker 基于 SetNX 的分布式锁, 锁的有效期比任务超时时间长 1 分钟, 不需要续租
+type jobLocker struct {
+	rdb redisx.IRedis
+}
+
+func (l jobLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return l.rdb.SetNX(ctx, key, 1, ttl)
+}
+
+func (l jobLocker) Unlock(ctx context.Context, key string) error {
+	_, err := l.rdb.Del(ctx, key)
+	return err
+}
@@ -15,6 +15,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/go-grain/grain/config"
@@ -22,15 +23,20 @@ import (
 	model "github.com/go-grain/grain/model/system"
 	redisx "github.com/go-grain/grain/pkg/redis"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
 )
 
 type ISysLogRepo interface {
-	CreateSysLog(operationLog *model.SysLog) error
+	CreateSysLog(ctx context.Context, operationLog *model.SysLog) error
 	GetSysLogList(req *model.SysLogReq) ([]*model.SysLog, error)
 	DeleteSysLogById(id primitive.ObjectID, uid string) error
 	DeleteSysLogByIds(ids []primitive.ObjectID, uid string) error
+	PurgeSysLogs(ctx context.Context, before time.Time) (int64, error)
 }
 
+// sysLogWriteTimeout 写入一条操作日志的超时时间
+const sysLogWriteTimeout = 5 * time.Second
+
 type SysLogService struct {
 	repo ISysLogRepo
 	rdb  redisx.IRedis
@@ -47,6 +53,18 @@ func NewSysLogService(repo ISysLogRepo, rdb redisx.IRedis, conf *config.Config,
 	}
 }
 
+// Record 异步写入操作日志, 不影响接口耗时, 写入失败只记录日志
+func (s *SysLogService) Record(sysLog *model.SysLog) {
+	sysLog.BeforeSave()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), sysLogWriteTimeout)
+		defer cancel()
+		if err := s.repo.CreateSysLog(ctx, sysLog); err != nil {
+			s.log.Errorw("errMsg", "写入操作日志", "requestId", sysLog.RequestID, "err", err.Error())
+		}
+	}()
+}
+
 func (s *SysLogService) GetSysLogList(req *model.SysLogReq, ctx *gin.Context) ([]*model.SysLog, error) {
 	list, err := s.repo.GetSysLogList(req)
 	if err != nil {
@@ -66,19 +84,32 @@ func (s *SysLogService) DeleteSysLogById(operationLogId string, ctx *gin.Context
 	}
 
 	if err = s.repo.DeleteSysLogById(objectID, uid); err != nil {
-		s.log.Errorw("errMsg", "删除日志", "err", err.Error())
+		s.log.WithContext(ctx).Errorw("errMsg", "删除日志", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "删除日志")
+	s.log.WithContext(ctx).Infow("errMsg", "删除日志")
 	return nil
 }
 
 func (s *SysLogService) DeleteSysLogByIds(operationLogIds []primitive.ObjectID, ctx *gin.Context) error {
 	uid := ctx.GetString("uid")
 	if err := s.repo.DeleteSysLogByIds(operationLogIds, uid); err != nil {
-		s.log.Errorw("errMsg", "批量删除日志", "err", err.Error())
+		s.log.WithContext(ctx).Errorw("errMsg", "批量删除日志", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "批量删除日志")
+	s.log.WithContext(ctx).Infow("errMsg", "批量删除日志")
 	return nil
 }
+
+// PurgeSysLogs 删除超过保留天数的操作日志, 供定时任务调用, days 小于等于 0 时不清理
+func (s *SysLogService) PurgeSysLogs(ctx context.Context, days int) (int64, error) {
+	if days <= 0 {
+		return 0, nil
+	}
+	n, err := s.repo.PurgeSysLogs(ctx, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "清理操作日志", "err", err.Error())
+		return n, err
+	}
+	return n, nil
+}
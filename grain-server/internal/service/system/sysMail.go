@@ -0,0 +1,331 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-grain/grain/config"
+	"github.com/go-grain/grain/log"
+	model "github.com/go-grain/grain/model/system"
+	"github.com/go-grain/grain/pkg/convert"
+	emailx "github.com/go-grain/grain/pkg/email"
+	metricsx "github.com/go-grain/grain/pkg/metrics"
+	queuex "github.com/go-grain/grain/pkg/queue"
+	redisx "github.com/go-grain/grain/pkg/redis"
+	uuidx "github.com/go-grain/grain/pkg/uuid"
+	"github.com/jordan-wright/email"
+)
+
+const (
+	MailTemplateCaptcha      = "captcha"
+	MailTemplateConfirmEmail = "confirm_email"
+
+	// MailQueue 发信任务所在的队列, 并发数为 email.workers
+	MailQueue = "mail"
+	// TaskMailDeliver 发送发件箱中的一封邮件
+	TaskMailDeliver = "mail:deliver"
+	// mailStaleAfter 发送中的邮件超过该时间没有更新视为 worker 异常退出
+	mailStaleAfter = 10 * time.Minute
+	// mailMaxBackoff 重试间隔上限
+	mailMaxBackoff = 6 * time.Hour
+	// mailSecretKey 含敏感值的邮件的完整主题和正文, 过期后邮件不再发送
+	mailSecretKey    = "mailSecret:%s"
+	mailSecretExpire = 24 * time.Hour
+)
+
+var errMailSecretExpired = errors.New("邮件完整内容已过期")
+
+// mailSecret 含敏感值的邮件的完整内容
+type mailSecret struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+type IMailRepo interface {
+	CreateMail(ctx context.Context, mail *model.SysMail) error
+	ClaimMail(id uint, staleBefore time.Time) (*model.SysMail, error)
+	UpdateMailStatus(mail *model.SysMail) error
+	GetDueMails(now, staleBefore time.Time, limit int) ([]*model.SysMail, error)
+	ResetDeadMails(ids []uint) ([]uint, error)
+	GetMailList(req *model.SysMailReq) ([]*model.SysMail, error)
+}
+
+// MailTask 发信任务参数
+type MailTask struct {
+	ID uint `json:"id"`
+}
+
+type MailService struct {
+	repo      IMailRepo
+	queue     *queuex.Client
+	rdb       redisx.IRedis
+	conf      *config.Config
+	log       *log.Helper
+	templates *emailx.Templates
+
+	mu     sync.Mutex
+	mailer emailx.Mailer
+}
+
+func NewMailService(repo IMailRepo, queue *queuex.Client, rdb redisx.IRedis, conf *config.Config, logger log.Logger) *MailService {
+	s := &MailService{
+		repo:  repo,
+		queue: queue,
+		rdb:   rdb,
+		conf:  conf,
+		log:   log.NewHelper(logger),
+	}
+	templates, err := emailx.NewTemplates(conf.SysEmail.TemplateDir)
+	if err != nil {
+		s.log.Errorw("errMsg", "加载自定义邮件模板失败, 使用内置模板", "err", err.Error())
+		templates, _ = emailx.NewTemplates("")
+	}
+	s.templates = templates
+	return s
+}
+
+// SetMailer 替换发信器, 默认使用 SysEmail 配置的 SMTP 服务
+func (s *MailService) SetMailer(mailer emailx.Mailer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mailer = mailer
+}
+
+// SendTemplate 渲染模板并写入发件箱, 邮件由 mail 队列异步发送,
+// 模板语言取自请求头 Accept-Language, data 中 emailx.Secret 类型的值不会写入发件箱
+func (s *MailService) SendTemplate(to, name string, data map[string]any, ctx *gin.Context) error {
+	if data == nil {
+		data = map[string]any{}
+	}
+	if _, ok := data["SiteName"]; !ok {
+		data["SiteName"] = s.conf.System.SiteName
+	}
+
+	lang := mailLang(ctx.GetHeader("Accept-Language"))
+	subject, body, err := s.templates.Render(name, lang, data)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "渲染邮件模板", "err", err.Error())
+		return errors.New("发送邮件失败")
+	}
+
+	mail := &model.SysMail{
+		UID:      ctx.GetString("uid"),
+		To:       strings.TrimSpace(to),
+		Template: name,
+		Lang:     lang,
+		Subject:  subject,
+		Body:     body,
+		Status:   model.MailStatusPending,
+	}
+	// 发件箱中保存打码后的内容, 完整内容先写入 Redis 再写发件箱, worker 领取时一定能读到
+	if redacted, ok := emailx.Redact(data); ok {
+		if mail.Subject, mail.Body, err = s.templates.Render(name, lang, redacted); err != nil {
+			s.log.WithContext(ctx).Errorw("errMsg", "渲染邮件模板", "err", err.Error())
+			return errors.New("发送邮件失败")
+		}
+		mail.SecretKey = uuidx.UID()
+		err = s.rdb.SetObject(ctx, fmt.Sprintf(mailSecretKey, mail.SecretKey), &mailSecret{Subject: subject, Body: body}, mailSecretExpire)
+		if err != nil {
+			s.log.WithContext(ctx).Errorw("errMsg", "保存邮件内容", "err", err.Error())
+			return errors.New("发送邮件失败")
+		}
+	}
+	if err = s.repo.CreateMail(ctx, mail); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "写入发件箱", "err", err.Error())
+		return errors.New("发送邮件失败")
+	}
+	// 入队失败也没关系, 定时任务会把长时间未发送的邮件重新入队
+	if err = s.enqueue(ctx, mail.ID); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "邮件入队", "err", err.Error())
+	}
+	return nil
+}
+
+// Deliver mail 队列的任务处理函数, 失败时按 email.retry_interval 退避重试,
+// 超过 email.max_attempts 次后进入死信列表
+func (s *MailService) Deliver(ctx context.Context, task MailTask) error {
+	mail, err := s.repo.ClaimMail(task.ID, time.Now().Add(-mailStaleAfter))
+	if err != nil {
+		return err
+	}
+	// 已经被其他 worker 领取或者已发送
+	if mail == nil {
+		return nil
+	}
+
+	err = s.send(ctx, mail)
+	now := time.Now()
+	mail.Attempts++
+	var res error
+	switch {
+	case err == nil:
+		mail.Status = model.MailStatusSent
+		mail.SentAt = &now
+		mail.NextRetryAt = nil
+		mail.Error = ""
+		if mail.SecretKey != "" {
+			_, _ = s.rdb.Del(ctx, fmt.Sprintf(mailSecretKey, mail.SecretKey))
+		}
+	case mail.Attempts >= s.maxAttempts() || errors.Is(err, errMailSecretExpired):
+		mail.Status = model.MailStatusDead
+		mail.NextRetryAt = nil
+		mail.Error = err.Error()
+		s.log.WithContext(ctx).Errorw("errMsg", "邮件发送失败进入死信列表", "to", mail.To, "err", err.Error())
+		res = fmt.Errorf("%v: %w", err, queuex.SkipRetry)
+	default:
+		delay := s.backoff(mail.Attempts)
+		next := now.Add(delay)
+		mail.Status = model.MailStatusRetry
+		mail.NextRetryAt = &next
+		mail.Error = err.Error()
+		s.log.WithContext(ctx).Errorw("errMsg", "发送邮件失败等待重试", "to", mail.To, "err", err.Error())
+		res = queuex.RetryIn(err, delay)
+	}
+	metricsx.MailSends.WithLabelValues(mail.Status).Inc()
+	if err = s.repo.UpdateMailStatus(mail); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "更新邮件状态", "err", err.Error())
+	}
+	return res
+}
+
+// RecoverOutbox 定时任务, 把入队失败以及 worker 异常退出遗留的邮件重新入队
+func (s *MailService) RecoverOutbox(ctx context.Context) (string, error) {
+	now := time.Now()
+	list, err := s.repo.GetDueMails(now, now.Add(-mailStaleAfter), 100)
+	if err != nil {
+		return "", err
+	}
+	n := 0
+	for _, mail := range list {
+		if err = s.enqueue(ctx, mail.ID); err == nil {
+			n++
+		}
+	}
+	return fmt.Sprintf("重新入队 %d 封邮件", n), nil
+}
+
+// enqueue 同一封邮件在队列中只会有一个任务, 已经在队列中时返回 queuex.ErrTaskExists
+func (s *MailService) enqueue(ctx context.Context, id uint) error {
+	_, err := s.queue.Enqueue(ctx, TaskMailDeliver, MailTask{ID: id},
+		queuex.Queue(MailQueue),
+		queuex.TaskID(fmt.Sprintf("mail:%d", id)),
+		queuex.MaxRetry(s.maxAttempts()-1),
+	)
+	return err
+}
+
+func (s *MailService) send(ctx context.Context, mail *model.SysMail) error {
+	content := mailSecret{Subject: mail.Subject, Body: mail.Body}
+	if mail.SecretKey != "" {
+		err := s.rdb.GetObject(ctx, fmt.Sprintf(mailSecretKey, mail.SecretKey), &content)
+		if errors.Is(err, redisx.Nil) {
+			return errMailSecretExpired
+		}
+		if err != nil {
+			return err
+		}
+	}
+	mailer, err := s.getMailer()
+	if err != nil {
+		return err
+	}
+	e := email.NewEmail()
+	e.From = s.conf.System.SiteName + "<" + s.conf.SysEmail.EmailUsername + ">"
+	e.To = []string{mail.To}
+	e.Subject = content.Subject
+	e.HTML = []byte(content.Body)
+	return mailer.SendEmail(e)
+}
+
+// getMailer 整个进程复用同一个 SMTP 连接池
+func (s *MailService) getMailer() (emailx.Mailer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.mailer != nil {
+		return s.mailer, nil
+	}
+	c := s.conf.SysEmail
+	mailer, err := emailx.NewMailServer(c.EmailUsername, c.EmailPassword, c.EmailHost, c.EmailHost, convert.Int2String(c.EmailPort))
+	if err != nil {
+		return nil, err
+	}
+	s.mailer = mailer
+	return mailer, nil
+}
+
+func (s *MailService) maxAttempts() int {
+	if s.conf.SysEmail.MaxAttempts <= 0 {
+		return 5
+	}
+	return s.conf.SysEmail.MaxAttempts
+}
+
+// backoff 第 n 次失败后的重试间隔 interval * 2^(n-1)
+func (s *MailService) backoff(attempts int) time.Duration {
+	interval := time.Duration(s.conf.SysEmail.RetryInterval) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	d := interval << (attempts - 1)
+	if d <= 0 || d > mailMaxBackoff {
+		return mailMaxBackoff
+	}
+	return d
+}
+
+func (s *MailService) GetMailList(req *model.SysMailReq, ctx *gin.Context) ([]*model.SysMail, error) {
+	list, err := s.repo.GetMailList(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.New("暂无更多数据")
+	}
+	return list, nil
+}
+
+// RetryDeadMails 把死信重新放回发件箱
+func (s *MailService) RetryDeadMails(ids []uint, ctx *gin.Context) error {
+	if len(ids) == 0 {
+		return errors.New("ID不能为空")
+	}
+	reset, err := s.repo.ResetDeadMails(ids)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "重发死信邮件", "err", err.Error())
+		return err
+	}
+	if len(reset) == 0 {
+		return errors.New("没有可重发的死信邮件")
+	}
+	for _, id := range reset {
+		_ = s.enqueue(ctx, id)
+	}
+	s.log.WithContext(ctx).Infow("errMsg", "重发死信邮件")
+	return nil
+}
+
+// mailLang 取 Accept-Language 中优先级最高的语言, 例如 "en-US,en;q=0.9" 返回 en-US
+func mailLang(acceptLanguage string) string {
+	lang, _, _ := strings.Cut(acceptLanguage, ",")
+	lang, _, _ = strings.Cut(lang, ";")
+	return strings.TrimSpace(lang)
+}
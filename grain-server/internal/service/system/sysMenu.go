@@ -15,8 +15,8 @@
 package service
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/go-grain/grain/config"
 	"github.com/go-grain/grain/internal/repo/system/query"
@@ -26,7 +26,7 @@ import (
 )
 
 type IMenuRepo interface {
-	CreateMenu(menu *model.SysMenu) error
+	CreateMenu(ctx context.Context, menu *model.SysMenu) error
 	CreateUserMenu(menu []*model.SysUserMenu) error
 	GetMenuById(id uint) (*model.SysMenu, error)
 	GetUserMenu(role string, parentId uint) (u []*model.SysMenu, err error)
@@ -34,10 +34,10 @@ type IMenuRepo interface {
 	GetMenuListByParentId(req *model.SysMenuReq, parentId uint) ([]*model.SysMenu, error)
 	GetUserMenuByRoleAndID(role string, pid uint) (list []*model.SysUserMenu, err error)
 	GetUserMenuByRole(role string) (list []*model.SysUserMenu, err error)
-	UpdateMenu(menu *model.SysMenu) error
-	UpdateMenus(menu []*model.SysMenu) error
-	DeleteMenuById(menuId uint) error
-	DeleteMenuByIds(ids []uint) error
+	UpdateMenu(ctx context.Context, menu *model.SysMenu) error
+	UpdateMenus(ctx context.Context, menu []*model.SysMenu) error
+	DeleteMenuById(ctx context.Context, menuId uint) error
+	DeleteMenuByIds(ctx context.Context, ids []uint) error
 	DeleteUserMenuByRole(role string) error
 }
 
@@ -293,11 +293,11 @@ func (s *MenuService) InitMenu() error {
 }
 
 func (s *MenuService) CreateMenu(menu *model.SysMenu, ctx *gin.Context) error {
-	if err := s.repo.CreateMenu(menu); err != nil {
-		s.log.Errorw("errMsg", "创建菜单", "err", err.Error())
+	if err := s.repo.CreateMenu(ctx, menu); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "创建菜单", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "创建菜单")
+	s.log.WithContext(ctx).Infow("errMsg", "创建菜单")
 	return nil
 }
 
@@ -407,7 +407,7 @@ func (s *MenuService) GetMenuList(req *model.SysMenuReq, ctx *gin.Context) ([]*m
 }
 
 func (s *MenuService) SetMenuAndPermission(keys []uint, role string) error {
-	fmt.Println(keys)
+	s.log.Debugw("role", role, "keys", keys)
 	if len(keys) == 0 {
 		return errors.New("参数不能为空")
 	}
@@ -453,28 +453,28 @@ func (s *MenuService) UpdateMenu(menu *model.SysMenu, ctx *gin.Context) error {
 		}
 	}
 
-	if err := s.repo.UpdateMenu(menu); err != nil {
-		s.log.Errorw("errMsg", "更新菜单", "err", err.Error())
+	if err := s.repo.UpdateMenu(ctx, menu); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "更新菜单", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "更新菜单")
+	s.log.WithContext(ctx).Infow("errMsg", "更新菜单")
 	return nil
 }
 
 func (s *MenuService) DeleteMenuById(id uint, ctx *gin.Context) error {
-	if err := s.repo.DeleteMenuById(id); err != nil {
-		s.log.Errorw("errMsg", "删除菜单", "err", err.Error())
+	if err := s.repo.DeleteMenuById(ctx, id); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "删除菜单", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "删除菜单")
+	s.log.WithContext(ctx).Infow("errMsg", "删除菜单")
 	return nil
 }
 
 func (s *MenuService) DeleteMenuByIds(ids []uint, ctx *gin.Context) error {
-	if err := s.repo.DeleteMenuByIds(ids); err != nil {
-		s.log.Errorw("errMsg", "批量删除菜单", "err", err.Error())
+	if err := s.repo.DeleteMenuByIds(ctx, ids); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "批量删除菜单", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "批量删除菜单")
+	s.log.WithContext(ctx).Infow("errMsg", "批量删除菜单")
 	return nil
 }
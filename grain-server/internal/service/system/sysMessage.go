@@ -0,0 +1,208 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-grain/grain/config"
+	"github.com/go-grain/grain/log"
+	model "github.com/go-grain/grain/model/system"
+	redisx "github.com/go-grain/grain/pkg/redis"
+	wsx "github.com/go-grain/grain/pkg/websocket"
+	"strings"
+)
+
+type ISysMessageRepo interface {
+	CreateMessages(ctx context.Context, messages []*model.SysMessage) error
+	GetMessageList(req *model.SysMessageReq) ([]*model.SysMessage, error)
+	GetUnreadRows(ctx context.Context, uid string) ([]*model.UnreadRow, error)
+	ReadMessages(ctx context.Context, uid string, chatType int, peer string) (int64, error)
+	GetOrganize(ctx context.Context, uid string) (string, error)
+	GetOrganizeMembers(ctx context.Context, organize string) ([]string, error)
+	UserExists(ctx context.Context, uid string) (bool, error)
+}
+
+type SysMessageService struct {
+	repo ISysMessageRepo
+	hub  *wsx.Hub
+	rdb  redisx.IRedis
+	conf *config.Config
+	log  *log.Helper
+}
+
+func NewSysMessageService(repo ISysMessageRepo, hub *wsx.Hub, rdb redisx.IRedis, conf *config.Config, logger log.Logger) *SysMessageService {
+	return &SysMessageService{
+		repo: repo,
+		hub:  hub,
+		rdb:  rdb,
+		conf: conf,
+		log:  log.NewHelper(logger),
+	}
+}
+
+// OnConnect 连接建立后推送离线期间的未读数, 消息内容由客户端按会话拉取
+func (s *SysMessageService) OnConnect(c *wsx.Client) {
+	counts, err := s.unreadCount(c.Context(), c.UID())
+	if err != nil {
+		s.log.Errorw("errMsg", "获取未读消息数", "err", err.Error())
+		return
+	}
+	c.SendJSON(model.WsFrame{Type: model.WsFrameUnread, Data: counts})
+}
+
+// HandleMessage 处理客户端发送的聊天消息, 保存到各接收者的收件箱后推送给在线的接收者
+func (s *SysMessageService) HandleMessage(c *wsx.Client, data []byte) {
+	msg := model.Message{}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		c.SendJSON(model.WsFrame{Type: model.WsFrameError, Data: "消息格式错误"})
+		return
+	}
+	msg.Sender = c.UID()
+	if err := s.Send(c.Context(), &msg); err != nil {
+		c.SendJSON(model.WsFrame{Type: model.WsFrameError, Data: err.Error()})
+	}
+}
+
+// Send 发送聊天消息, 私聊发给接收者, 群聊发给组织内的所有成员, 发送者自己也保留一条已读记录
+func (s *SysMessageService) Send(ctx context.Context, msg *model.Message) error {
+	if strings.TrimSpace(msg.Message) == "" {
+		return errors.New("消息内容不能为空")
+	}
+	if msg.Recipient == "" {
+		return errors.New("接收者不能为空")
+	}
+	if msg.MsgType == 0 {
+		msg.MsgType = model.MsgTypeText
+	}
+
+	var owners []string
+	switch msg.ChatType {
+	case model.ChatTypePrivate:
+		if msg.Recipient == msg.Sender {
+			return errors.New("不能给自己发送消息")
+		}
+		exists, err := s.repo.UserExists(ctx, msg.Recipient)
+		if err != nil {
+			s.log.WithContext(ctx).Errorw("errMsg", "查询消息接收者", "err", err.Error())
+			return errors.New("发送消息失败")
+		}
+		if !exists {
+			return errors.New("接收者不存在")
+		}
+		owners = []string{msg.Recipient, msg.Sender}
+	case model.ChatTypeGroup:
+		organize, err := s.repo.GetOrganize(ctx, msg.Sender)
+		if err != nil {
+			s.log.WithContext(ctx).Errorw("errMsg", "查询发送者组织", "err", err.Error())
+			return errors.New("发送消息失败")
+		}
+		if organize == "" || organize != msg.Recipient {
+			return errors.New("只能在所属组织的群聊中发送消息")
+		}
+		if owners, err = s.repo.GetOrganizeMembers(ctx, organize); err != nil {
+			s.log.WithContext(ctx).Errorw("errMsg", "查询组织成员", "err", err.Error())
+			return errors.New("发送消息失败")
+		}
+	default:
+		return errors.New("不支持的聊天类型")
+	}
+
+	messages := make([]*model.SysMessage, 0, len(owners))
+	for _, owner := range owners {
+		messages = append(messages, &model.SysMessage{
+			Owner:     owner,
+			Sender:    msg.Sender,
+			Recipient: msg.Recipient,
+			ChatType:  msg.ChatType,
+			MsgType:   msg.MsgType,
+			Message:   msg.Message,
+			IsRead:    owner == msg.Sender,
+		})
+	}
+	if err := s.repo.CreateMessages(ctx, messages); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "保存聊天消息", "err", err.Error())
+		return errors.New("发送消息失败")
+	}
+
+	// 发送者的其他终端也需要同步这条消息
+	for _, m := range messages {
+		if err := s.hub.SendJSON(m.Owner, model.WsFrame{Type: model.WsFrameMessage, Data: m.ToMessage()}); err != nil {
+			s.log.WithContext(ctx).Errorw("errMsg", "推送聊天消息", "uid", m.Owner, "err", err.Error())
+		}
+	}
+	return nil
+}
+
+func (s *SysMessageService) GetMessageList(req *model.SysMessageReq, ctx *gin.Context) ([]*model.SysMessage, error) {
+	req.UID = ctx.GetString("uid")
+	list, err := s.repo.GetMessageList(req)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "获取聊天记录", "err", err.Error())
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.New("暂无更多数据")
+	}
+	return list, nil
+}
+
+func (s *SysMessageService) GetUnreadCount(ctx *gin.Context) ([]*model.UnreadCount, error) {
+	counts, err := s.unreadCount(ctx, ctx.GetString("uid"))
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "获取未读消息数", "err", err.Error())
+		return nil, err
+	}
+	return counts, nil
+}
+
+// ReadMessage 标记会话已读, 并把最新的未读数同步到该用户的所有终端
+func (s *SysMessageService) ReadMessage(req *model.ReadMessageReq, ctx *gin.Context) error {
+	uid := ctx.GetString("uid")
+	if _, err := s.repo.ReadMessages(ctx, uid, req.ChatType, req.Peer); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "标记消息已读", "err", err.Error())
+		return err
+	}
+	if counts, err := s.unreadCount(ctx, uid); err == nil {
+		_ = s.hub.SendJSON(uid, model.WsFrame{Type: model.WsFrameUnread, Data: counts})
+	}
+	return nil
+}
+
+// unreadCount 按会话汇总未读数, 私聊按发送者, 群聊按组织
+func (s *SysMessageService) unreadCount(ctx context.Context, uid string) ([]*model.UnreadCount, error) {
+	rows, err := s.repo.GetUnreadRows(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	counts := make([]*model.UnreadCount, 0, len(rows))
+	index := make(map[model.UnreadCount]*model.UnreadCount)
+	for _, row := range rows {
+		key := model.UnreadCount{ChatType: row.ChatType, Peer: row.Sender}
+		if row.ChatType == model.ChatTypeGroup {
+			key.Peer = row.Recipient
+		}
+		if c, ok := index[key]; ok {
+			c.Count += row.Count
+			continue
+		}
+		c := &model.UnreadCount{ChatType: key.ChatType, Peer: key.Peer, Count: row.Count}
+		index[key] = c
+		counts = append(counts, c)
+	}
+	return counts, nil
+}
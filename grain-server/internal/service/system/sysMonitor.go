@@ -0,0 +1,55 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-grain/grain/log"
+	model "github.com/go-grain/grain/model/system"
+	monitorx "github.com/go-grain/grain/pkg/monitor"
+)
+
+type SysMonitorService struct {
+	monitor *monitorx.Monitor
+	log     *log.Helper
+}
+
+func NewSysMonitorService(monitor *monitorx.Monitor, logger log.Logger) *SysMonitorService {
+	return &SysMonitorService{
+		monitor: monitor,
+		log:     log.NewHelper(logger),
+	}
+}
+
+// GetMonitor 获取最新采样以及内存中保留的历史采样
+func (s *SysMonitorService) GetMonitor(ctx *gin.Context) (*model.SysMonitorRes, error) {
+	latest, ok := s.monitor.Latest()
+	if !ok {
+		return nil, errors.New("暂无监控数据")
+	}
+	return &model.SysMonitorRes{Latest: latest, History: s.monitor.History()}, nil
+}
+
+// Subscribe 订阅实时采样, 返回的 cancel 需要在连接断开后调用
+func (s *SysMonitorService) Subscribe(ctx *gin.Context) (<-chan monitorx.Sample, func()) {
+	s.log.WithContext(ctx).Infow("errMsg", "订阅运行监控")
+	return s.monitor.Subscribe()
+}
+
+// Latest 最新一条采样
+func (s *SysMonitorService) Latest() (monitorx.Sample, bool) {
+	return s.monitor.Latest()
+}
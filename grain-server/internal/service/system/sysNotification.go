@@ -0,0 +1,232 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-grain/grain/config"
+	"github.com/go-grain/grain/log"
+	model "github.com/go-grain/grain/model/system"
+	redisx "github.com/go-grain/grain/pkg/redis"
+	wsx "github.com/go-grain/grain/pkg/websocket"
+	"strconv"
+)
+
+type INotificationRepo interface {
+	CreateNotifications(ctx context.Context, notifications []*model.SysNotification) error
+	GetNotificationList(req *model.SysNotificationReq) ([]*model.SysNotification, error)
+	CountUnread(ctx context.Context, uid string) (int64, error)
+	ReadNotifications(ctx context.Context, uid string, ids []uint) (int64, error)
+	ArchiveNotifications(ctx context.Context, uid string, ids []uint) (int64, error)
+	CreateAnnouncement(ctx context.Context, announcement *model.SysAnnouncement, notifications []*model.SysNotification) error
+	GetAnnouncementList(req *model.SysAnnouncementReq) ([]*model.SysAnnouncement, error)
+	GetAllUIDs(ctx context.Context) ([]string, error)
+	GetUIDsByRole(ctx context.Context, role string) ([]string, error)
+	GetUIDsByOrganize(ctx context.Context, organizeIds []string) ([]string, error)
+	GetOrganizeNodes(ctx context.Context) ([]*model.Organize, error)
+}
+
+type NotificationService struct {
+	repo INotificationRepo
+	hub  *wsx.Hub
+	rdb  redisx.IRedis
+	conf *config.Config
+	log  *log.Helper
+}
+
+func NewNotificationService(repo INotificationRepo, hub *wsx.Hub, rdb redisx.IRedis, conf *config.Config, logger log.Logger) *NotificationService {
+	return &NotificationService{
+		repo: repo,
+		hub:  hub,
+		rdb:  rdb,
+		conf: conf,
+		log:  log.NewHelper(logger),
+	}
+}
+
+// Notify 给用户发送一条系统事件通知, 失败只记录日志, 不影响触发事件的业务
+func (s *NotificationService) Notify(ctx context.Context, uid, event, title, content string) {
+	notification := &model.SysNotification{
+		UID:      uid,
+		Category: model.NotificationCategorySystem,
+		Event:    event,
+		Title:    title,
+		Content:  content,
+		Status:   model.NotificationStatusUnread,
+	}
+	if err := s.repo.CreateNotifications(ctx, []*model.SysNotification{notification}); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "保存系统通知", "event", event, "err", err.Error())
+		return
+	}
+	s.push(ctx, notification)
+}
+
+// Announce 发布公告, 公告和展开到每个用户的通知在同一个事务中保存, 再用一帧推送给在线用户
+func (s *NotificationService) Announce(req *model.CreateAnnouncement, ctx *gin.Context) (*model.SysAnnouncement, error) {
+	uids, err := s.targetUIDs(ctx, req.TargetType, req.Target)
+	if err != nil {
+		return nil, err
+	}
+	if len(uids) == 0 {
+		return nil, errors.New("没有符合条件的用户")
+	}
+
+	announcement := &model.SysAnnouncement{
+		Title:      req.Title,
+		Content:    req.Content,
+		TargetType: req.TargetType,
+		Target:     req.Target,
+		Sender:     ctx.GetString("uid"),
+		Recipients: int64(len(uids)),
+	}
+	notifications := make([]*model.SysNotification, 0, len(uids))
+	for _, uid := range uids {
+		notifications = append(notifications, &model.SysNotification{
+			UID:      uid,
+			Category: model.NotificationCategoryAnnouncement,
+			Title:    req.Title,
+			Content:  req.Content,
+			Status:   model.NotificationStatusUnread,
+		})
+	}
+	if err = s.repo.CreateAnnouncement(ctx, announcement, notifications); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "发布公告", "err", err.Error())
+		return nil, err
+	}
+	s.pushAnnouncement(ctx, announcement, uids)
+	s.log.WithContext(ctx).Infow("errMsg", "发布公告", "targetType", req.TargetType, "target", req.Target, "recipients", announcement.Recipients)
+	return announcement, nil
+}
+
+func (s *NotificationService) GetAnnouncementList(req *model.SysAnnouncementReq, ctx *gin.Context) ([]*model.SysAnnouncement, error) {
+	list, err := s.repo.GetAnnouncementList(req)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "获取公告列表", "err", err.Error())
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.New("暂无更多数据")
+	}
+	return list, nil
+}
+
+func (s *NotificationService) GetNotificationList(req *model.SysNotificationReq, ctx *gin.Context) ([]*model.SysNotification, error) {
+	req.UID = ctx.GetString("uid")
+	list, err := s.repo.GetNotificationList(req)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "获取通知列表", "err", err.Error())
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.New("暂无更多数据")
+	}
+	return list, nil
+}
+
+func (s *NotificationService) CountUnread(ctx *gin.Context) (int64, error) {
+	return s.repo.CountUnread(ctx, ctx.GetString("uid"))
+}
+
+func (s *NotificationService) ReadNotifications(ids []uint, ctx *gin.Context) error {
+	if _, err := s.repo.ReadNotifications(ctx, ctx.GetString("uid"), ids); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "标记通知已读", "err", err.Error())
+		return err
+	}
+	return nil
+}
+
+func (s *NotificationService) ArchiveNotifications(ids []uint, ctx *gin.Context) error {
+	if _, err := s.repo.ArchiveNotifications(ctx, ctx.GetString("uid"), ids); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "归档通知", "err", err.Error())
+		return err
+	}
+	return nil
+}
+
+func (s *NotificationService) push(ctx context.Context, notification *model.SysNotification) {
+	if s.hub == nil {
+		return
+	}
+	if err := s.hub.SendJSON(notification.UID, model.WsFrame{Type: model.WsFrameNotification, Data: notification}); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "推送通知", "uid", notification.UID, "err", err.Error())
+	}
+}
+
+// pushAnnouncement 公告只发布一帧, 所有用户时整体广播, 其余按用户列表组播, 客户端收到后刷新通知列表
+func (s *NotificationService) pushAnnouncement(ctx context.Context, announcement *model.SysAnnouncement, uids []string) {
+	if s.hub == nil {
+		return
+	}
+	frame := model.WsFrame{Type: model.WsFrameAnnouncement, Data: announcement}
+	var err error
+	if announcement.TargetType == model.AnnouncementTargetAll {
+		err = s.hub.Broadcast(frame)
+	} else {
+		err = s.hub.Multicast(uids, frame)
+	}
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "推送公告", "announcementId", announcement.ID, "err", err.Error())
+	}
+}
+
+func (s *NotificationService) targetUIDs(ctx context.Context, targetType, target string) ([]string, error) {
+	switch targetType {
+	case model.AnnouncementTargetAll:
+		return s.repo.GetAllUIDs(ctx)
+	case model.AnnouncementTargetRole:
+		if target == "" {
+			return nil, errors.New("角色不能为空")
+		}
+		return s.repo.GetUIDsByRole(ctx, target)
+	case model.AnnouncementTargetOrganize:
+		id, err := strconv.ParseUint(target, 10, 64)
+		if err != nil {
+			return nil, errors.New("组织节点不正确")
+		}
+		nodes, err := s.repo.GetOrganizeNodes(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return s.repo.GetUIDsByOrganize(ctx, organizeSubtree(nodes, uint(id)))
+	default:
+		return nil, errors.New("不支持的公告目标")
+	}
+}
+
+// organizeSubtree 组织节点及其所有下级节点的ID
+func organizeSubtree(nodes []*model.Organize, root uint) []string {
+	children := make(map[uint][]uint, len(nodes))
+	for _, node := range nodes {
+		children[node.ParentId] = append(children[node.ParentId], node.ID)
+	}
+	ids := []string{strconv.FormatUint(uint64(root), 10)}
+	visited := map[uint]bool{root: true}
+	queue := []uint{root}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, child := range children[id] {
+			if visited[child] {
+				continue
+			}
+			visited[child] = true
+			ids = append(ids, strconv.FormatUint(uint64(child), 10))
+			queue = append(queue, child)
+		}
+	}
+	return ids
+}
@@ -15,6 +15,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/go-grain/grain/config"
@@ -27,11 +28,11 @@ import (
 )
 
 type IRoleRepo interface {
-	CreateRole(user *model.SysRole) error
+	CreateRole(ctx context.Context, user *model.SysRole) error
 	GetRoleList(req *model.SysRoleQueryPage) ([]*model.SysRole, error)
-	UpdateRole(user *model.SysRole) error
-	DeleteRoleById(roleId uint) error
-	DeleteRoleByIds(userIds []uint) error
+	UpdateRole(ctx context.Context, user *model.SysRole) error
+	DeleteRoleById(ctx context.Context, roleId uint) error
+	DeleteRoleByIds(ctx context.Context, userIds []uint) error
 }
 
 type RoleService struct {
@@ -82,14 +83,14 @@ func (s *RoleService) CreateRole(role *model.CreateSysRole, ctx *gin.Context) er
 		RoleName: role.RoleName,
 	}
 
-	if err := s.repo.CreateRole(&_role); err != nil {
-		s.log.Errorw("errMsg", "批量删除菜单", "err", err.Error())
+	if err := s.repo.CreateRole(ctx, &_role); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "批量删除菜单", "err", err.Error())
 		if strings.Contains(err.Error(), "duplicated key not allowed") {
 			return errors.New("提交的参数重复")
 		}
 		return err
 	}
-	s.log.Errorw("errMsg", "批量删除菜单")
+	s.log.WithContext(ctx).Errorw("errMsg", "批量删除菜单")
 	return nil
 }
 
@@ -105,28 +106,28 @@ func (s *RoleService) GetRoleList(req *model.SysRoleQueryPage, ctx *gin.Context)
 }
 
 func (s *RoleService) UpdateRole(role *model.SysRole, ctx *gin.Context) error {
-	if err := s.repo.UpdateRole(role); err != nil {
-		s.log.Errorw("errMsg", "更新角色", "err", err.Error())
+	if err := s.repo.UpdateRole(ctx, role); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "更新角色", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "更新角色")
+	s.log.WithContext(ctx).Infow("errMsg", "更新角色")
 	return nil
 }
 
 func (s *RoleService) DeleteRoleByIds(roles []uint, ctx *gin.Context) error {
-	if err := s.repo.DeleteRoleByIds(roles); err != nil {
-		s.log.Errorw("errMsg", "删除角色", "err", err.Error())
+	if err := s.repo.DeleteRoleByIds(ctx, roles); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "删除角色", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "删除角色")
+	s.log.WithContext(ctx).Infow("errMsg", "删除角色")
 	return nil
 }
 
 func (s *RoleService) DeleteRoleById(roleId uint, ctx *gin.Context) error {
-	if err := s.repo.DeleteRoleById(roleId); err != nil {
-		s.log.Errorw("errMsg", "删除角色", "err", err.Error())
+	if err := s.repo.DeleteRoleById(ctx, roleId); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "删除角色", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "删除角色")
+	s.log.WithContext(ctx).Infow("errMsg", "删除角色")
 	return nil
 }
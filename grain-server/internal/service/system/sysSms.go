@@ -0,0 +1,316 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-grain/grain/config"
+	"github.com/go-grain/grain/log"
+	model "github.com/go-grain/grain/model/system"
+	metricsx "github.com/go-grain/grain/pkg/metrics"
+	queuex "github.com/go-grain/grain/pkg/queue"
+	redisx "github.com/go-grain/grain/pkg/redis"
+	smsx "github.com/go-grain/grain/pkg/sms"
+	timex "github.com/go-grain/grain/pkg/time"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// SmsTemplateCaptcha 验证码短信模板
+	SmsTemplateCaptcha = "captcha"
+
+	defaultCaptchaSmsContent = "您的验证码是{{.code}}, 5分钟内有效, 请勿泄露给他人"
+
+	// SmsQueue 短信任务所在的队列
+	SmsQueue = "sms"
+	// TaskSmsDeliver 发送一条短信
+	TaskSmsDeliver = "sms:deliver"
+
+	// smsParamsKey 短信模板参数, 含验证码, 不写入任务和投递记录, 过期后短信不再发送
+	smsParamsKey    = "smsParams:%d"
+	smsParamsExpire = 10 * time.Minute
+)
+
+var errSmsParamsExpired = errors.New("短信参数已过期")
+
+// smsQuotaRefund 退还一次配额, 计数已经过期时不再扣减, 避免留下没有过期时间的负数
+var smsQuotaRefund = redisx.RegisterScript("sms_quota_refund", `
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return redis.call('DECR', KEYS[1])
+end
+return 0
+`)
+
+// SmsTask 短信任务参数, 投递记录在入队前创建, 发送时按记录和 Redis 中的参数重新生成短信
+type SmsTask struct {
+	RecordID uint `json:"recordId"`
+	// 发送时计数的配额 key, 发送失败时退还到同一天的计数, 未限制次数时为空
+	QuotaKey string `json:"quotaKey,omitempty"`
+}
+
+type ISmsRepo interface {
+	CreateSms(ctx context.Context, sms *model.SysSms) error
+	UpdateSms(ctx context.Context, sms *model.SysSms) error
+	GetSmsById(ctx context.Context, id uint) (*model.SysSms, error)
+	GetSmsList(req *model.SysSmsReq) ([]*model.SysSms, error)
+}
+
+type SmsService struct {
+	repo     ISmsRepo
+	queue    *queuex.Client
+	rdb      redisx.IRedis
+	conf     *config.Config
+	log      *log.Helper
+	sender   smsx.SmsSender
+	registry *smsx.Registry
+}
+
+func NewSmsService(repo ISmsRepo, queue *queuex.Client, rdb redisx.IRedis, conf *config.Config, logger log.Logger) *SmsService {
+	s := &SmsService{
+		repo:     repo,
+		queue:    queue,
+		rdb:      rdb,
+		conf:     conf,
+		log:      log.NewHelper(logger),
+		registry: smsx.NewRegistry(),
+	}
+
+	sender, err := NewSmsSender(conf)
+	if err != nil {
+		s.log.Errorw("errMsg", "初始化短信渠道失败, 回退到控制台输出", "err", err.Error())
+		sender = smsx.NewConsoleSender()
+	}
+	s.sender = sender
+
+	for name, tpl := range conf.Sms.Templates {
+		if err = s.registry.Register(name, tpl.Code, tpl.Content); err != nil {
+			s.log.Errorw("errMsg", "注册短信模板", "err", err.Error())
+		}
+	}
+	// 没有配置验证码模板时使用内置模板
+	if !s.registry.Exists(SmsTemplateCaptcha) {
+		_ = s.registry.Register(SmsTemplateCaptcha, "", defaultCaptchaSmsContent)
+	}
+	return s
+}
+
+// Close 关闭短信渠道打开的文件等资源
+func (s *SmsService) Close() error {
+	if c, ok := s.sender.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// NewSmsSender 根据配置选择短信渠道
+func NewSmsSender(conf *config.Config) (smsx.SmsSender, error) {
+	switch conf.Sms.Driver {
+	case "", "console":
+		return smsx.NewConsoleSender(), nil
+	case "file":
+		path := conf.Sms.File.Path
+		if path == "" {
+			path = "log/sms.log"
+		}
+		return smsx.NewFileSender(path)
+	case "http":
+		if conf.Sms.Http.URL == "" {
+			return nil, errors.New("短信网关地址不能为空")
+		}
+		return smsx.NewHttpSender(conf.Sms.Http.URL, conf.Sms.Http.Token, conf.Sms.Http.Timeout), nil
+	default:
+		return nil, fmt.Errorf("不支持的短信渠道: %s", conf.Sms.Driver)
+	}
+}
+
+// Send 使用指定模板向手机号发送短信, 每条短信都会留下投递记录, 短信由 sms 队列异步发送
+func (s *SmsService) Send(mobile, template string, params map[string]string, ctx *gin.Context) error {
+	quotaKey, err := s.checkQuota(ctx, mobile)
+	if err != nil {
+		return err
+	}
+
+	// 投递记录中保存参数打码后的正文, 管理员查看发送记录时看不到验证码
+	masked, err := s.registry.Build(template, mobile, smsx.MaskParams(params))
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "生成短信内容", "err", err.Error())
+		return err
+	}
+
+	record := &model.SysSms{
+		UID:      ctx.GetString("uid"),
+		Mobile:   mobile,
+		Provider: s.sender.Name(),
+		Template: template,
+		Content:  masked.Content,
+		Status:   model.SmsStatusPending,
+	}
+	if err = s.repo.CreateSms(ctx, record); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "创建短信投递记录", "err", err.Error())
+		return errors.New("发送短信失败")
+	}
+
+	// 参数先写入 Redis 再入队, worker 领取任务时一定能读到
+	if err = s.rdb.SetObject(ctx, fmt.Sprintf(smsParamsKey, record.ID), params, smsParamsExpire); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "保存短信参数", "err", err.Error())
+		s.fail(ctx, record.ID, quotaKey, err)
+		return errors.New("发送短信失败")
+	}
+	_, err = s.queue.Enqueue(ctx, TaskSmsDeliver, SmsTask{RecordID: record.ID, QuotaKey: quotaKey},
+		queuex.Queue(SmsQueue),
+		queuex.MaxRetry(2),
+		queuex.Timeout(time.Minute),
+	)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "短信入队", "err", err.Error())
+		s.fail(ctx, record.ID, quotaKey, err)
+		return errors.New("发送短信失败")
+	}
+	return nil
+}
+
+// Deliver sms 队列的任务处理函数, 重试次数用完或者参数过期后记录为发送失败
+func (s *SmsService) Deliver(ctx context.Context, task *queuex.Task) error {
+	var payload SmsTask
+	if err := task.Bind(&payload); err != nil || payload.RecordID == 0 {
+		return fmt.Errorf("短信任务参数错误: %w", queuex.SkipRetry)
+	}
+	record, err := s.repo.GetSmsById(ctx, payload.RecordID)
+	if err != nil {
+		return err
+	}
+	paramsKey := fmt.Sprintf(smsParamsKey, record.ID)
+	quotaKey := payload.QuotaKey
+	if quotaKey == "" && s.conf.Sms.DailyLimit > 0 {
+		// 旧版本入队的任务没有配额 key, 按投递记录的创建日期退还
+		quotaKey = smsQuotaKey(record.Mobile, record.CreatedAt)
+	}
+	msg, err := s.message(ctx, record)
+	if err != nil {
+		// 参数过期或者模板出错时重试也无法发送
+		if errors.Is(err, queuex.SkipRetry) {
+			s.fail(ctx, record.ID, quotaKey, err)
+			_, _ = s.rdb.Del(ctx, paramsKey)
+		}
+		return err
+	}
+	res, err := s.sender.Send(ctx, msg)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "发送短信", "err", err.Error())
+		if task.Retried >= task.MaxRetry {
+			s.fail(ctx, record.ID, quotaKey, err)
+			_, _ = s.rdb.Del(ctx, paramsKey)
+		}
+		return err
+	}
+	_, _ = s.rdb.Del(ctx, paramsKey)
+	sent := &model.SysSms{Status: model.SmsStatusSent, MessageID: res.MessageID}
+	sent.ID = record.ID
+	metricsx.SmsSends.WithLabelValues(s.sender.Name(), sent.Status).Inc()
+	if err = s.repo.UpdateSms(ctx, sent); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "更新短信投递状态", "err", err.Error())
+	}
+	return nil
+}
+
+// message 按投递记录的模板和 Redis 中的参数重新生成短信
+func (s *SmsService) message(ctx context.Context, record *model.SysSms) (*smsx.Message, error) {
+	params := map[string]string{}
+	err := s.rdb.GetObject(ctx, fmt.Sprintf(smsParamsKey, record.ID), &params)
+	if errors.Is(err, redisx.Nil) {
+		return nil, fmt.Errorf("%v: %w", errSmsParamsExpired, queuex.SkipRetry)
+	}
+	if err != nil {
+		return nil, err
+	}
+	msg, err := s.registry.Build(record.Template, record.Mobile, params)
+	if err != nil {
+		return nil, fmt.Errorf("生成短信内容: %v: %w", err, queuex.SkipRetry)
+	}
+	msg.SignName = s.conf.Sms.SignName
+	return msg, nil
+}
+
+// fail 记录发送失败, 发送失败的不计入配额, 退还到发送时计数的那一天
+func (s *SmsService) fail(ctx context.Context, id uint, quotaKey string, err error) {
+	record := &model.SysSms{Status: model.SmsStatusFailed, Error: err.Error()}
+	record.ID = id
+	metricsx.SmsSends.WithLabelValues(s.sender.Name(), record.Status).Inc()
+	if uErr := s.repo.UpdateSms(ctx, record); uErr != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "更新短信投递状态", "err", uErr.Error())
+	}
+	s.refundQuota(ctx, quotaKey)
+}
+
+// refundQuota 退还 checkQuota 计入的一次发送, 重试后跨天失败时也只扣减当初计数的 key
+func (s *SmsService) refundQuota(ctx context.Context, quotaKey string) {
+	if quotaKey == "" {
+		return
+	}
+	if _, err := s.rdb.RunScript(ctx, smsQuotaRefund, []string{quotaKey}); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "退还短信配额", "err", err.Error())
+	}
+}
+
+// SendCaptcha 发送验证码短信
+func (s *SmsService) SendCaptcha(mobile string, captcha int64, ctx *gin.Context) error {
+	return s.Send(mobile, SmsTemplateCaptcha, map[string]string{"code": fmt.Sprint(captcha)}, ctx)
+}
+
+// checkQuota 每个手机号每天的发送次数限制, 返回计数的 key, 发送失败时按这个 key 退还, 未限制时为空
+func (s *SmsService) checkQuota(ctx context.Context, mobile string) (string, error) {
+	limit := s.conf.Sms.DailyLimit
+	if limit <= 0 {
+		return "", nil
+	}
+	key := smsQuotaKey(mobile, time.Now())
+	var incr *redis.IntCmd
+	// 计数和过期时间在同一个事务中设置, 不会留下没有过期时间的计数
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.IncrBy(ctx, key, 1)
+		pipe.Expire(ctx, key, time.Duration(timex.GetSecondsLeftInDay()+1)*time.Second)
+		return nil
+	})
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "短信配额计数", "err", err.Error())
+		return "", errors.New("发送短信失败 服务器内部错误")
+	}
+	if incr.Val() > int64(limit) {
+		return "", errors.New("该手机号今日短信发送次数已达上限")
+	}
+	return key, nil
+}
+
+// smsQuotaKey 手机号在 day 这一天的发送次数
+func smsQuotaKey(mobile string, day time.Time) string {
+	return fmt.Sprintf("smsQuota:%s:%s", day.Format("20060102"), mobile)
+}
+
+func (s *SmsService) GetSmsList(req *model.SysSmsReq, ctx *gin.Context) ([]*model.SysSms, error) {
+	list, err := s.repo.GetSmsList(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.New("暂无更多数据")
+	}
+	return list, nil
+}
@@ -0,0 +1,139 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-grain/grain/config"
+	"github.com/go-grain/grain/internal/repo/data"
+	"github.com/go-grain/grain/log"
+	model "github.com/go-grain/grain/model/system"
+	queuex "github.com/go-grain/grain/pkg/queue"
+	smsx "github.com/go-grain/grain/pkg/sms"
+	"github.com/redis/go-redis/v9"
+)
+
+type fakeSmsRepo struct {
+	ISmsRepo
+	records map[uint]*model.SysSms
+}
+
+func (r *fakeSmsRepo) GetSmsById(ctx context.Context, id uint) (*model.SysSms, error) {
+	return r.records[id], nil
+}
+
+func (r *fakeSmsRepo) UpdateSms(ctx context.Context, sms *model.SysSms) error {
+	r.records[sms.ID].Status = sms.Status
+	return nil
+}
+
+// failSender 每次发送都失败的渠道
+type failSender struct{}
+
+func (failSender) Name() string { return "fail" }
+
+func (failSender) Send(ctx context.Context, msg *smsx.Message) (*smsx.Result, error) {
+	return nil, errors.New("gateway down")
+}
+
+func newTestSmsService(t *testing.T) (*SmsService, *fakeSmsRepo, *miniredis.Miniredis) {
+	t.Helper()
+	m := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: m.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+	conf := &config.Config{}
+	conf.Sms.DailyLimit = 5
+	repo := &fakeSmsRepo{records: map[uint]*model.SysSms{}}
+	s := NewSmsService(repo, nil, &data.Redis{Client: client}, conf, log.DefaultLogger)
+	s.sender = failSender{}
+	return s, repo, m
+}
+
+// deliverLastAttempt 最后一次重试仍然发送失败
+func deliverLastAttempt(t *testing.T, s *SmsService, repo *fakeSmsRepo, record *model.SysSms, task SmsTask) {
+	t.Helper()
+	repo.records[record.ID] = record
+	ctx := context.Background()
+	if err := s.rdb.SetObject(ctx, fmt.Sprintf(smsParamsKey, record.ID), map[string]string{"code": "1234"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := json.Marshal(task)
+	if err := s.Deliver(ctx, &queuex.Task{Payload: payload, Retried: 2, MaxRetry: 2}); err == nil {
+		t.Fatal("发送失败时 Deliver 应该返回错误")
+	}
+	if record.Status != model.SmsStatusFailed {
+		t.Errorf("投递状态 = %s, 期望 failed", record.Status)
+	}
+}
+
+func TestSmsRefundSameDay(t *testing.T) {
+	s, repo, m := newTestSmsService(t)
+	mobile := "13800000000"
+	quotaKey, err := s.checkQuota(context.Background(), mobile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 重试跨过零点后失败, 退还到计数的那一天, 不能扣减第二天的计数
+	tomorrow := smsQuotaKey(mobile, time.Now().AddDate(0, 0, 1))
+	record := &model.SysSms{Mobile: mobile, Template: SmsTemplateCaptcha}
+	record.ID = 1
+	deliverLastAttempt(t, s, repo, record, SmsTask{RecordID: 1, QuotaKey: quotaKey})
+
+	if v, _ := m.Get(quotaKey); v != "0" {
+		t.Errorf("%s = %q, 期望 0", quotaKey, v)
+	}
+	if m.Exists(tomorrow) {
+		t.Errorf("不应该创建第二天的计数 %s", tomorrow)
+	}
+}
+
+func TestSmsRefundExpiredQuota(t *testing.T) {
+	s, repo, m := newTestSmsService(t)
+	mobile := "13800000000"
+	quotaKey := smsQuotaKey(mobile, time.Now().AddDate(0, 0, -1))
+
+	// 计数已经过期时不扣减, 不会留下没有过期时间的 -1
+	record := &model.SysSms{Mobile: mobile, Template: SmsTemplateCaptcha}
+	record.ID = 1
+	deliverLastAttempt(t, s, repo, record, SmsTask{RecordID: 1, QuotaKey: quotaKey})
+	if m.Exists(quotaKey) {
+		t.Errorf("过期的计数不应该重新创建 %s", quotaKey)
+	}
+}
+
+func TestSmsRefundLegacyTask(t *testing.T) {
+	s, repo, m := newTestSmsService(t)
+	mobile := "13800000000"
+	yesterday := time.Now().AddDate(0, 0, -1)
+	quotaKey := smsQuotaKey(mobile, yesterday)
+	_ = m.Set(quotaKey, "2")
+
+	// 旧版本入队的任务没有配额 key, 按投递记录的创建日期退还
+	record := &model.SysSms{Mobile: mobile, Template: SmsTemplateCaptcha}
+	record.ID = 1
+	record.CreatedAt = yesterday
+	deliverLastAttempt(t, s, repo, record, SmsTask{RecordID: 1})
+	if v, _ := m.Get(quotaKey); v != "1" {
+		t.Errorf("%s = %q, 期望 1", quotaKey, v)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-grain/grain/log"
+	model "github.com/go-grain/grain/model/system"
+	healthx "github.com/go-grain/grain/pkg/health"
+	"os"
+	"runtime"
+	"time"
+)
+
+type SysStatusService struct {
+	checker   *healthx.Checker
+	name      string
+	version   string
+	startedAt time.Time
+	log       *log.Helper
+}
+
+func NewSysStatusService(checker *healthx.Checker, name, version string, logger log.Logger) *SysStatusService {
+	return &SysStatusService{
+		checker:   checker,
+		name:      name,
+		version:   version,
+		startedAt: time.Now(),
+		log:       log.NewHelper(logger),
+	}
+}
+
+// Ready 检查所有依赖
+func (s *SysStatusService) Ready(ctx *gin.Context) healthx.Report {
+	return s.checker.Check(ctx)
+}
+
+// GetStatus 获取编译信息、运行时长以及依赖检查结果
+func (s *SysStatusService) GetStatus(ctx *gin.Context) *model.SysStatus {
+	report := s.checker.Check(ctx)
+	if !report.Ready() {
+		s.log.WithContext(ctx).Warnw("errMsg", "依赖检查未通过", "status", report.Status)
+	}
+	hostname, _ := os.Hostname()
+	return &model.SysStatus{
+		Name:      s.name,
+		Version:   s.version,
+		GoVersion: runtime.Version(),
+		Hostname:  hostname,
+		StartedAt: s.startedAt,
+		Uptime:    int64(time.Since(s.startedAt).Seconds()),
+		Health:    report,
+	}
+}
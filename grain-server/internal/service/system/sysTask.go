@@ -0,0 +1,102 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-grain/grain/config"
+	"github.com/go-grain/grain/log"
+	model "github.com/go-grain/grain/model/system"
+	queuex "github.com/go-grain/grain/pkg/queue"
+)
+
+// SysTaskService 查看以及管理后台任务队列
+type SysTaskService struct {
+	inspector *queuex.Inspector
+	conf      *config.Config
+	log       *log.Helper
+}
+
+func NewSysTaskService(inspector *queuex.Inspector, conf *config.Config, logger log.Logger) *SysTaskService {
+	return &SysTaskService{
+		inspector: inspector,
+		conf:      conf,
+		log:       log.NewHelper(logger),
+	}
+}
+
+func (s *SysTaskService) GetQueueList(ctx *gin.Context) ([]*queuex.QueueInfo, error) {
+	list, err := s.inspector.Queues(ctx)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "获取任务队列", "err", err.Error())
+		return nil, errors.New("获取任务队列失败")
+	}
+	if len(list) == 0 {
+		return nil, errors.New("暂无更多数据")
+	}
+	return list, nil
+}
+
+func (s *SysTaskService) GetTaskList(req *model.SysTaskReq, ctx *gin.Context) ([]*queuex.TaskInfo, error) {
+	if req.PageSize <= 0 || req.PageSize >= 100 {
+		req.PageSize = 20
+	}
+	list, total, err := s.inspector.ListTasks(ctx, req.Queue, req.State, req.Page, req.PageSize)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "获取任务列表", "err", err.Error())
+		return nil, err
+	}
+	req.Total = total
+	if len(list) == 0 {
+		return nil, errors.New("暂无更多数据")
+	}
+	return list, nil
+}
+
+// RunTasks 立即执行延迟 重试中或者死信任务
+func (s *SysTaskService) RunTasks(req *model.SysTaskIdsReq, ctx *gin.Context) error {
+	return s.each(req, "重试任务", func(id string) error {
+		return s.inspector.RunTask(ctx, req.Queue, id)
+	}, ctx)
+}
+
+// DeleteTasks 删除没有在执行的任务
+func (s *SysTaskService) DeleteTasks(req *model.SysTaskIdsReq, ctx *gin.Context) error {
+	return s.each(req, "删除任务", func(id string) error {
+		return s.inspector.DeleteTask(ctx, req.Queue, id)
+	}, ctx)
+}
+
+// each 逐个处理, 返回第一个失败的任务
+func (s *SysTaskService) each(req *model.SysTaskIdsReq, action string, fn func(id string) error, ctx *gin.Context) error {
+	if len(req.IDs) == 0 {
+		return errors.New("ID不能为空")
+	}
+	for _, id := range req.IDs {
+		err := fn(id)
+		switch {
+		case err == nil:
+		case errors.Is(err, queuex.ErrTaskNotFound), errors.Is(err, queuex.ErrTaskActive):
+			return fmt.Errorf("%s: %v", id, err)
+		default:
+			s.log.WithContext(ctx).Errorw("errMsg", action, "err", err.Error())
+			return fmt.Errorf("%s失败", action)
+		}
+	}
+	s.log.WithContext(ctx).Infow("errMsg", action, "queue", req.Queue, "ids", req.IDs)
+	return nil
+}
@@ -15,6 +15,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -22,8 +23,10 @@ import (
 	"github.com/go-grain/grain/internal/repo/system/query"
 	"github.com/go-grain/grain/log"
 	"github.com/go-grain/grain/model/system"
+	emailx "github.com/go-grain/grain/pkg/email"
 	"github.com/go-grain/grain/pkg/encrypt"
 	jwtx "github.com/go-grain/grain/pkg/jwt"
+	metricsx "github.com/go-grain/grain/pkg/metrics"
 	redisx "github.com/go-grain/grain/pkg/redis"
 	uuidx "github.com/go-grain/grain/pkg/uuid"
 	"github.com/go-grain/grain/utils/const"
@@ -34,16 +37,16 @@ import (
 
 type ISysUserRepo interface {
 	Login(user *model.LoginReq) (*model.SysUser, error)
-	CreateSysUser(user *model.SysUser) error
+	CreateSysUser(ctx context.Context, user *model.SysUser) error
 	GetSysUserById(id uint) (u *model.SysUser, err error)
 	GetSysUserByUId(uid string) (u *model.SysUser, err error)
 	GetSysUserList(req *model.SysUserReq) ([]*model.SysUser, error)
-	UpdateSysUser(user *model.UpdateUserInfo) error
-	EditSysUser(user *model.SysUser) error
-	SetDefaultRole(user *model.SysUser) error
-	DeleteSysUserById(userId uint) error
-	DeleteSysUserByIds(userIds []uint) error
-	UploadAvatar(avatar *model.Upload, uid string) error
+	UpdateSysUser(ctx context.Context, user *model.UpdateUserInfo) error
+	EditSysUser(ctx context.Context, user *model.SysUser) error
+	SetDefaultRole(ctx context.Context, user *model.SysUser) error
+	DeleteSysUserById(ctx context.Context, userId uint) error
+	DeleteSysUserByIds(ctx context.Context, userIds []uint) error
+	UploadAvatar(ctx context.Context, avatar *model.Upload, avatarUrl, uid string, quota int64) error
 }
 
 type SysUserService struct {
@@ -52,15 +55,19 @@ type SysUserService struct {
 	conf    *config.Config
 	log     *log.Helper
 	captcha *CaptchaService
+	mail    *MailService
+	notify  *NotificationService
 }
 
-func NewSysUserService(repo ISysUserRepo, rdb redisx.IRedis, conf *config.Config, logger log.Logger) *SysUserService {
+func NewSysUserService(repo ISysUserRepo, captcha *CaptchaService, mail *MailService, notify *NotificationService, rdb redisx.IRedis, conf *config.Config, logger log.Logger) *SysUserService {
 	return &SysUserService{
 		repo:    repo,
 		rdb:     rdb,
 		conf:    conf,
 		log:     log.NewHelper(logger),
-		captcha: NewCaptcha(rdb, conf, logger),
+		captcha: captcha,
+		mail:    mail,
+		notify:  notify,
 	}
 }
 
@@ -87,28 +94,37 @@ func (s *SysUserService) InitSysUser() error {
 func (s *SysUserService) Login(login *model.LoginReq, ctx *gin.Context) (string, error) {
 	user, err := s.repo.Login(login)
 	if err != nil {
+		metricsx.Logins.WithLabelValues("failure", "user").Inc()
 		return "", err
 	}
 
+	// 登录请求还没有 Token, 操作日志中的用户信息从这里获取
 	ctx.Set("LogType", "login")
+	ctx.Set("uid", user.UID)
+	ctx.Set("username", user.Username)
+	ctx.Set("nickname", user.Nickname)
 
 	if !encrypt.ComparePasswords(user.Password, login.Password) {
-		s.log.Errorw("errMsg", "用户登录", "err")
+		s.log.WithContext(ctx).Errorw("errMsg", "用户登录", "err")
+		metricsx.Logins.WithLabelValues("failure", "password").Inc()
 		return "", errors.New("账号或密码不正确")
 	}
 
 	if user.Status == "no" {
-		s.log.Errorw("errMsg", "用户登录")
+		s.log.WithContext(ctx).Errorw("errMsg", "用户登录")
+		metricsx.Logins.WithLabelValues("failure", "frozen").Inc()
 		return "", errors.New("账号已被冻结,无法正常登录")
 	}
 
 	jwt := jwtx.Jwt{}
 	token, err := jwt.GenerateToken(user.UID, user.Role, s.conf.JWT.SecretKey, s.conf.JWT.ExpirationSeconds)
 	if err != nil {
-		s.log.Errorw("errMsg", "用户登录", "err", err.Error())
+		s.log.WithContext(ctx).Errorw("errMsg", "用户登录", "err", err.Error())
+		metricsx.Logins.WithLabelValues("failure", "token").Inc()
 		return "", err
 	}
-	s.log.Infow("errMsg", "用户登录")
+	s.log.WithContext(ctx).Infow("errMsg", "用户登录")
+	metricsx.Logins.WithLabelValues("success", "").Inc()
 	return token, err
 }
 
@@ -118,7 +134,7 @@ func (s *SysUserService) GetLoginUserInfo(ctx *gin.Context) (*model.SysUser, err
 		return nil, err
 	}
 	for _, s2 := range *info.Roles {
-		find, err := query.SysRole.Where(query.SysRole.Role.Eq(s2)).First()
+		find, err := query.SysRole.WithContext(ctx).Where(query.SysRole.Role.Eq(s2)).First()
 		if err != nil {
 			continue
 		}
@@ -129,20 +145,23 @@ func (s *SysUserService) GetLoginUserInfo(ctx *gin.Context) (*model.SysUser, err
 	}
 	info.Password = ""
 	info.Role = ctx.GetString("role")
-	if info.Avatar == "" {
-		info.Avatar = ""
-	} else {
+	// 头像保存的是存储驱动返回的完整地址, 旧数据是 uploads 下的相对路径
+	if info.Avatar != "" && !strings.HasPrefix(info.Avatar, "http://") && !strings.HasPrefix(info.Avatar, "https://") {
 		info.Avatar = s.conf.Server.FileDomain + "/" + info.Avatar
 	}
 	return info, err
 }
 
 func (s *SysUserService) LogOut(ctx *gin.Context) error {
-	s.rdb.Set(
+	err := s.rdb.Set(ctx,
 		fmt.Sprintf("%s%s",
 			consts.TokenBlack,
 			ctx.GetString("token")),
-		100, time.Duration(ctx.GetInt64("expTokenAt")))
+		100, time.Duration(ctx.GetInt64("expTokenAt"))*time.Second)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "退出登录", "err", err.Error())
+		return errors.New("退出登录失败")
+	}
 	return nil
 }
 
@@ -151,14 +170,14 @@ func (s *SysUserService) CreateSysUser(sysUser *model.SysUser, ctx *gin.Context)
 	sysUser.ID = 0
 	sysUser.Password = encrypt.EncryptPassword(sysUser.Password)
 
-	if err := s.repo.CreateSysUser(sysUser); err != nil {
-		s.log.Errorw("errMsg", "创建系统用户", "err", err.Error())
+	if err := s.repo.CreateSysUser(ctx, sysUser); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "创建系统用户", "err", err.Error())
 		if strings.Contains(err.Error(), " for key") {
 			return errors.New("提交的参数重复")
 		}
 		return err
 	}
-	s.log.Infow("errMsg", "创建系统用户")
+	s.log.WithContext(ctx).Infow("errMsg", "创建系统用户")
 	return nil
 }
 
@@ -179,12 +198,12 @@ func (s *SysUserService) GetSysUserList(req *model.SysUserReq, ctx *gin.Context)
 
 func (s *SysUserService) UpdateSysUser(sysUser *model.UpdateUserInfo, ctx *gin.Context) error {
 	sysUser.UID = ctx.GetString("uid")
-	err := s.repo.UpdateSysUser(sysUser)
+	err := s.repo.UpdateSysUser(ctx, sysUser)
 	if err != nil {
-		s.log.Errorw("errMsg", "更新系统用户信息", "err", err.Error())
+		s.log.WithContext(ctx).Errorw("errMsg", "更新系统用户信息", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "更新系统用户信息")
+	s.log.WithContext(ctx).Infow("errMsg", "更新系统用户信息")
 	return nil
 }
 
@@ -203,11 +222,12 @@ func (s *SysUserService) ModifyPassword(sysUser *model.ModifyPassword, ctx *gin.
 		Password: encrypt.EncryptPassword(sysUser.NewPassword),
 	}
 
-	if err = s.repo.EditSysUser(&newUserInfo); err != nil {
-		s.log.Errorw("errMsg", "修改密码", "err", err.Error())
+	if err = s.repo.EditSysUser(ctx, &newUserInfo); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "修改密码", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "修改密码")
+	s.log.WithContext(ctx).Infow("errMsg", "修改密码")
+	s.notify.Notify(ctx, user.UID, model.NotifyPasswordChanged, "密码已修改", "您的登录密码已修改, 如非本人操作请及时联系管理员")
 	return nil
 }
 
@@ -217,21 +237,22 @@ func (s *SysUserService) ConfirmModifyEmail(key string, ctx *gin.Context) error
 	//aes 解密key
 	encrypt, err := encrypt.AesDecrypt(key, []byte("b06d734d53dc73c7"), []byte("0000000000000000"))
 	if err != nil {
-		s.log.Errorw("errMsg", "确认修改邮箱", "err", err.Error())
+		s.log.WithContext(ctx).Errorw("errMsg", "确认修改邮箱", "err", err.Error())
 		return err
 	}
 	key = fmt.Sprintf("%s:%s", "confirmEmail", encrypt)
-	if err = s.rdb.GetObject(key, &newUserInfo); err != nil {
-		s.log.Infow("errMsg", "确认修改邮箱", "err", err.Error())
+	if err = s.rdb.GetObject(ctx, key, &newUserInfo); err != nil {
+		s.log.WithContext(ctx).Infow("errMsg", "确认修改邮箱", "err", err.Error())
 		return err
 	}
 
-	if err = s.repo.EditSysUser(&newUserInfo); err != nil {
-		s.log.Errorw("errMsg", "确认修改邮箱", "err", err.Error())
+	if err = s.repo.EditSysUser(ctx, &newUserInfo); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "确认修改邮箱", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "确认修改邮箱")
-	s.rdb.Del(key)
+	s.log.WithContext(ctx).Infow("errMsg", "确认修改邮箱")
+	_, _ = s.rdb.Del(ctx, key)
+	s.notify.Notify(ctx, string(encrypt), model.NotifyEmailChanged, "邮箱已修改", fmt.Sprintf("您的绑定邮箱已修改为 %s", newUserInfo.Email))
 	return nil
 }
 
@@ -248,8 +269,8 @@ func (s *SysUserService) ModifyEmail(email *model.ModifyEmail, ctx *gin.Context)
 		if email.Captcha == "" {
 			return errors.New("验证码不能为空")
 		}
-		captcha := s.rdb.Get(rdbKey)
-		if captcha != email.Captcha {
+		captcha, err := s.rdb.Get(ctx, rdbKey)
+		if err != nil || captcha != email.Captcha {
 			return errors.New("验证码不正确")
 		}
 	}
@@ -259,14 +280,14 @@ func (s *SysUserService) ModifyEmail(email *model.ModifyEmail, ctx *gin.Context)
 		Email: email.Email,
 	}
 
-	err = s.rdb.SetObject(fmt.Sprintf("%s:%s", "confirmEmail", uid), &newUserInfo, 86400)
+	err = s.rdb.SetObject(ctx, fmt.Sprintf("%s:%s", "confirmEmail", uid), &newUserInfo, 24*time.Hour)
 	if err != nil {
-		s.log.Errorw("errMsg", "提交修改邮箱待确认", "err", err.Error())
+		s.log.WithContext(ctx).Errorw("errMsg", "提交修改邮箱待确认", "err", err.Error())
 		return err
 	}
 
-	s.log.Infow("errMsg", "提交修改邮箱待确认")
-	s.rdb.Del(rdbKey)
+	s.log.WithContext(ctx).Infow("errMsg", "提交修改邮箱待确认")
+	_, _ = s.rdb.Del(ctx, rdbKey)
 
 	aesEncrypt, err := encrypt.AesEncrypt([]byte(uid), []byte("b06d734d53dc73c7"), []byte("0000000000000000"))
 	if err != nil {
@@ -274,21 +295,8 @@ func (s *SysUserService) ModifyEmail(email *model.ModifyEmail, ctx *gin.Context)
 	}
 	aesEncrypt = url.QueryEscape(aesEncrypt)
 
-	html := `<!DOCTYPE html>
-<html>
-  <head>
-    <meta charset="UTF-8" />
-    <title>邮箱确认链接</title>
-  </head>
-  <body>
-    <p>请点击以下链接以确认修改您的邮箱地址：</p>
-    <p>
-      <a href="` + s.conf.Server.FileDomain + "/confirmModifyEmail?key=" + aesEncrypt + `">` + s.conf.Server.FileDomain + "/confirmModifyEmail?key=" + aesEncrypt + `</a>
-    </p>
-  </body>
-</html>`
-
-	err = s.captcha.CustomEmail(&model.Email{Email: email.Email}, "确认修改邮箱", html)
+	link := s.conf.Server.FileDomain + "/confirmModifyEmail?key=" + aesEncrypt
+	err = s.mail.SendTemplate(email.Email, MailTemplateConfirmEmail, map[string]any{"Link": emailx.Secret(link)}, ctx)
 	if err != nil {
 		return err
 	}
@@ -300,8 +308,8 @@ func (s *SysUserService) ModifyMobile(mobile *model.ModifyMobile, ctx *gin.Conte
 	uid := ctx.GetString("uid")
 	ip := ctx.ClientIP()
 	rdbKey := fmt.Sprintf("%s:%s:%s", "captcha", ip, mobile.Captcha)
-	captcha := s.rdb.Get(rdbKey)
-	if captcha != mobile.Captcha {
+	captcha, err := s.rdb.Get(ctx, rdbKey)
+	if err != nil || captcha != mobile.Captcha {
 		return errors.New("验证码不正确")
 	}
 
@@ -314,16 +322,21 @@ func (s *SysUserService) ModifyMobile(mobile *model.ModifyMobile, ctx *gin.Conte
 		Mobile: mobile.Mobile,
 	}
 
-	if err = s.repo.EditSysUser(&newUserInfo); err != nil {
-		s.log.Errorw("errMsg", "修改手机号", "err", err.Error())
+	if err = s.repo.EditSysUser(ctx, &newUserInfo); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "修改手机号", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "修改手机号")
-	s.rdb.Del(rdbKey)
+	s.log.WithContext(ctx).Infow("errMsg", "修改手机号")
+	_, _ = s.rdb.Del(ctx, rdbKey)
 	return nil
 }
 
 func (s *SysUserService) EditUserInfo(sysUser *model.SysUser, ctx *gin.Context) error {
+	old, err := s.repo.GetSysUserById(sysUser.ID)
+	if err != nil {
+		return err
+	}
+
 	have := false
 	role := s.conf.System.DefaultRole
 	for i, s2 := range *sysUser.Roles {
@@ -344,46 +357,133 @@ func (s *SysUserService) EditUserInfo(sysUser *model.SysUser, ctx *gin.Context)
 		sysUser.Password = encrypt.EncryptPassword(sysUser.Password)
 	}
 
-	if err := s.repo.EditSysUser(sysUser); err != nil {
-		s.log.Errorw("errMsg", "更新系统用户信息", "err", err.Error())
+	if err = s.repo.EditSysUser(ctx, sysUser); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "更新系统用户信息", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "更新系统用户信息")
+	s.log.WithContext(ctx).Infow("errMsg", "更新系统用户信息")
+
+	if sysUser.Role != old.Role || !sameRoles(sysUser.Roles, old.Roles) {
+		s.notify.Notify(ctx, old.UID, model.NotifyRoleChanged, "角色已变更", fmt.Sprintf("管理员调整了您的角色, 当前角色为 %s", sysUser.Role))
+	}
+	if sysUser.Password != "" {
+		s.notify.Notify(ctx, old.UID, model.NotifyPasswordChanged, "密码已重置", "管理员重置了您的登录密码")
+	}
+	if sysUser.Status == "no" && old.Status != "no" {
+		s.notify.Notify(ctx, old.UID, model.NotifyAccountLocked, "账号已锁定", "您的账号已被管理员锁定, 如有疑问请联系管理员")
+	}
 	return nil
 }
 
 func (s *SysUserService) SetDefaultRole(user *model.SysUser, ctx *gin.Context) error {
-	if err := s.repo.SetDefaultRole(user); err != nil {
-		s.log.Errorw("errMsg", "设置默认角色", "err", err.Error())
+	if err := s.repo.SetDefaultRole(ctx, user); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "设置默认角色", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "设置默认角色")
+	s.log.WithContext(ctx).Infow("errMsg", "设置默认角色")
+	uid := user.UID
+	if uid == "" {
+		if u, err := s.repo.GetSysUserById(user.ID); err == nil {
+			uid = u.UID
+		}
+	}
+	if uid != "" {
+		s.notify.Notify(ctx, uid, model.NotifyRoleChanged, "默认角色已变更", fmt.Sprintf("您的默认角色已设置为 %s", user.Role))
+	}
 	return nil
 }
 
+// SwitchRole 切换当前登录角色, 目标角色必须是用户拥有的角色之一, 成功后签发新的令牌
+func (s *SysUserService) SwitchRole(role string, ctx *gin.Context) (string, error) {
+	if role == "" {
+		return "", errors.New("角色ID不能为空")
+	}
+	if role == ctx.GetString("role") {
+		return "", errors.New("当前已是该角色,无须切换")
+	}
+	uid := ctx.GetString("uid")
+	user, err := s.repo.GetSysUserByUId(uid)
+	if err != nil {
+		return "", err
+	}
+	have := false
+	if user.Roles != nil {
+		for _, r := range *user.Roles {
+			if r == role {
+				have = true
+				break
+			}
+		}
+	}
+	if !have {
+		return "", errors.New("没有该角色,无法切换")
+	}
+
+	jwt := jwtx.Jwt{}
+	token, err := jwt.GenerateToken(uid, role, s.conf.JWT.SecretKey, s.conf.JWT.ExpirationSeconds)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "切换角色", "err", err.Error())
+		return "", err
+	}
+	s.log.WithContext(ctx).Infow("errMsg", "切换角色", "role", role)
+	s.notify.Notify(ctx, uid, model.NotifyRoleChanged, "角色已切换", fmt.Sprintf("您已切换到角色 %s", role))
+	return token, nil
+}
+
 func (s *SysUserService) DeleteSysUserById(id uint, ctx *gin.Context) error {
-	if err := s.repo.DeleteSysUserById(id); err != nil {
-		s.log.Errorw("errMsg", "删除用户", "err", err.Error())
+	if err := s.repo.DeleteSysUserById(ctx, id); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "删除用户", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "删除用户")
+	s.log.WithContext(ctx).Infow("errMsg", "删除用户")
 	return nil
 }
 
 func (s *SysUserService) DeleteSysUserByIds(ids []uint, ctx *gin.Context) error {
-	if err := s.repo.DeleteSysUserByIds(ids); err != nil {
-		s.log.Errorw("errMsg", "删除用户", "err", err.Error())
+	if err := s.repo.DeleteSysUserByIds(ctx, ids); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "删除用户", "err", err.Error())
 		return err
 	}
-	s.log.Infow("errMsg", "删除用户")
+	s.log.WithContext(ctx).Infow("errMsg", "删除用户")
 	return nil
 }
 
-func (s *SysUserService) UploadAvatar(avatar *model.Upload, ctx *gin.Context) error {
-	if err := s.repo.UploadAvatar(avatar, ctx.GetString("uid")); err != nil {
-		s.log.Errorw("errMsg", "更新系统用户头像", "err", err.Error())
+// UploadAvatar 保存头像的上传记录, 用户头像设置为 avatarUrl, 一般是缩小后的图片规格,
+// 头像同样计入存储用量, 超出 quota 时返回 ErrQuotaExceeded
+func (s *SysUserService) UploadAvatar(avatar *model.Upload, avatarUrl string, quota int64, ctx *gin.Context) error {
+	err := s.repo.UploadAvatar(ctx, avatar, avatarUrl, ctx.GetString("uid"), quota)
+	if errors.Is(err, ErrQuotaExceeded) {
 		return err
 	}
-	s.log.Infow("errMsg", "更新系统用户头像")
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "更新系统用户头像", "err", err.Error())
+		return err
+	}
+	s.log.WithContext(ctx).Infow("errMsg", "更新系统用户头像")
 	return nil
 }
+
+// sameRoles 比较两组角色是否一致, 不考虑顺序
+func sameRoles(a, b *model.Roles) bool {
+	var x, y model.Roles
+	if a != nil {
+		x = *a
+	}
+	if b != nil {
+		y = *b
+	}
+	if len(x) != len(y) {
+		return false
+	}
+	seen := make(map[string]int, len(x))
+	for _, r := range x {
+		seen[r]++
+	}
+	for _, r := range y {
+		if seen[r] == 0 {
+			return false
+		}
+		seen[r]--
+	}
+	return true
+}
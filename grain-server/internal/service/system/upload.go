@@ -15,44 +15,267 @@
 package service
 
 import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"github.com/casbin/casbin/v2"
 	"github.com/gin-gonic/gin"
 	"github.com/go-grain/grain/config"
 	"github.com/go-grain/grain/log"
 	model "github.com/go-grain/grain/model/system"
+	jsonx "github.com/go-grain/grain/pkg/encoding/json"
 	redisx "github.com/go-grain/grain/pkg/redis"
+	storagex "github.com/go-grain/grain/pkg/storage"
+	uuidx "github.com/go-grain/grain/pkg/uuid"
+	"github.com/go-grain/grain/utils/upload"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"io"
+	"math/big"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
+const (
+	// 分片上传会话 以及已收到的分片序号集合, 使用 hash tag 保证集群模式下在同一个槽位
+	uploadSessionKey       = "uploadSession:{%s}"
+	uploadSessionChunksKey = "uploadSession:{%s}:chunks"
+	uploadSessionLockKey   = "uploadSession:{%s}:lock"
+	// 秒传校验挑战, 提交一次后删除
+	uploadSessionChallengeKey = "uploadSession:{%s}:challenge"
+	// 所有会话的创建时间, 用于清理过期会话留在存储中的分片
+	uploadSessionsKey = "uploadSessions"
+	// 没有 hash tag 的旧版本会话 key, 滚动升级期间仍可能存在, 读到时迁移到新 key, 下个版本删除
+	legacyUploadSessionKey       = "uploadSession:%s"
+	legacyUploadSessionChunksKey = "uploadSession:%s:chunks"
+
+	// 一次性下载地址的随机数, 第一次使用时删除
+	uploadSignOnceKey = "uploadSignOnce:%s"
+	// 有这个接口权限的角色可以下载所有文件
+	uploadManageApi = "/api/v1/upload/list"
+	// 生成图片规格时加锁, 同一个规格同时只有一个请求在解码原图
+	uploadVariantLockKey = "uploadVariant:%s:%s"
+	// 同一个内容的文件写入 引用和删除时加锁, 避免引用数归零删除文件时另一个请求正好引用了它
+	uploadBlobLockKey  = "uploadBlob:%s:lock"
+	uploadBlobLockWait = 30 * time.Second
+	// 超过这个大小的原图不生成图片规格
+	maxVariantSource = 50 << 20
+
+	// 秒传校验读取的内容长度
+	instantChallengeSize = 64 << 10
+
+	defaultChunkSize     = 5 << 20
+	defaultChunkExpire   = 24 * time.Hour
+	defaultPresignExpire = 15 * time.Minute
+)
+
+var (
+	ErrUploadNotFound     = errors.New("文件不存在")
+	ErrUploadForbidden    = errors.New("无权访问该文件")
+	ErrVariantUnsupported = errors.New("不支持的图片规格")
+	ErrVariantUnavailable = errors.New("图片正在处理, 请稍后再试")
+	ErrQuotaExceeded      = errors.New("存储空间不足")
+
+	errInstantExpired = errors.New("秒传校验已失效, 请上传分片")
+	errInstantFailed  = errors.New("秒传校验失败, 请上传分片")
+)
+
+// popExpiredSessions 取出并删除创建时间早于 ARGV[1] 的会话, 多实例同时清理时不会重复处理
+var popExpiredSessions = redisx.RegisterScript("upload_pop_expired_sessions", `
+local members = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, m in ipairs(members) do
+	redis.call('ZREM', KEYS[1], m)
+end
+return members
+`)
+
 type IUploadRepo interface {
-	CreateUpload(upload *model.Upload) error
+	CreateUpload(upload *model.Upload, quota int64) error
 	GetUploadList(req *model.UploadReq) ([]*model.Upload, error)
-	DeleteUploadById(uploadId uint, uid string) error
-	DeleteUploadByIds(uploadIds []uint, uid string) error
+	GetUploadByIds(uploadIds []uint, uid string) ([]*model.Upload, error)
+	GetUploadById(uploadId uint) (*model.Upload, error)
+	UpdateVisibility(req *model.UploadVisibilityReq, uid string) error
+	PublicObject(key string) (public, found bool, err error)
+	GetPublicUploadByKey(key string) (*model.Upload, error)
+	GetBlobByHash(hash string) (*model.UploadBlob, error)
+	GetVariant(hash, preset string) (*model.UploadVariant, error)
+	SaveVariant(variant *model.UploadVariant) (*model.UploadVariant, error)
+	DeleteUploadById(uploadId uint, uid string) ([]*model.UploadBlob, error)
+	DeleteUploadByIds(uploadIds []uint, uid string) ([]*model.UploadBlob, error)
+	GetUploadUsage() (*model.UploadUsageRes, error)
+	GetUserUsage(uid string) (*model.UploadUserUsage, error)
+	GetQuota(uid string) (quota int64, found bool, err error)
+	GetQuotaList() ([]*model.UploadQuota, error)
+	SetQuota(quota *model.UploadQuota) error
+	DeleteQuotaById(id uint) error
+	ReconcileUsage(ctx context.Context) (int, error)
 }
 
 type UploadService struct {
-	repo IUploadRepo
-	rdb  redisx.IRedis
-	conf *config.Config
-	log  *log.Helper
+	repo     IUploadRepo
+	store    storagex.Storage
+	rdb      redisx.IRedis
+	conf     *config.Config
+	log      *log.Helper
+	enforcer *casbin.CachedEnforcer
 }
 
-func NewUploadService(repo IUploadRepo, rdb redisx.IRedis, conf *config.Config, logger log.Logger) *UploadService {
+func NewUploadService(repo IUploadRepo, store storagex.Storage, rdb redisx.IRedis, conf *config.Config, logger log.Logger, enforcer *casbin.CachedEnforcer) *UploadService {
 	return &UploadService{
-		repo: repo,
-		rdb:  rdb,
-		conf: conf,
-		log:  log.NewHelper(logger),
+		repo:     repo,
+		store:    store,
+		rdb:      rdb,
+		conf:     conf,
+		log:      log.NewHelper(logger),
+		enforcer: enforcer,
+	}
+}
+
+// NewStorage 按名称创建存储驱动, driver 为空时使用本地磁盘
+func NewStorage(conf *config.Config, driver string) (storagex.Storage, error) {
+	c := conf.Storage
+	switch driver {
+	case "", "local":
+		root, baseURL := c.Local.Root, c.Local.BaseURL
+		if root == "" {
+			root = "uploads"
+		}
+		if baseURL == "" {
+			baseURL = conf.Server.FileDomain + "/uploads"
+		}
+		return storagex.NewLocal(root, baseURL, signSecret(conf)), nil
+	case "s3":
+		store, err := storagex.NewS3(storagex.S3Options{
+			Endpoint:  c.S3.Endpoint,
+			Region:    c.S3.Region,
+			Bucket:    c.S3.Bucket,
+			AccessKey: c.S3.AccessKey,
+			SecretKey: c.S3.SecretKey,
+			PathStyle: c.S3.PathStyle,
+			BaseURL:   c.S3.BaseURL,
+			Timeout:   c.S3.Timeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("不支持的存储驱动: %s", driver)
+	}
+}
+
+// storageOf 文件所在的存储驱动, 切换驱动之后旧文件仍然从原来的驱动访问
+func (s *UploadService) storageOf(driver string) (storagex.Storage, error) {
+	if driver == s.store.Name() {
+		return s.store, nil
+	}
+	return NewStorage(s.conf, driver)
+}
+
+// FileURL 文件的访问地址, 没有对象键的旧数据仍然使用 server.file_domain 拼接
+func (s *UploadService) FileURL(upload *model.Upload) string {
+	// 非公开的文件只能通过下载接口访问
+	if upload.ID != 0 && upload.Visibility != "" && upload.Visibility != model.VisibilityPublic {
+		return fmt.Sprintf("%s/api/v1/upload/download?id=%d", s.conf.Server.FileDomain, upload.ID)
+	}
+	if upload.FileKey == "" {
+		if strings.HasPrefix(upload.FileUrl, "http://") || strings.HasPrefix(upload.FileUrl, "https://") {
+			return upload.FileUrl
+		}
+		return s.conf.Server.FileDomain + "/" + upload.FileUrl
+	}
+	store, err := s.storageOf(upload.Storage)
+	if err != nil {
+		s.log.Errorw("errMsg", "获取文件存储驱动", "err", err.Error())
+		return ""
 	}
+	return store.URL(upload.FileKey)
 }
 
-func (s *UploadService) CreateUpload(upload *model.Upload, ctx *gin.Context) error {
+// SaveUpload 把通过校验的文件写入存储并保存上传记录, 超出存储配额时返回 ErrQuotaExceeded
+func (s *UploadService) SaveUpload(f *upload.File, ctx *gin.Context) error {
+	return s.SaveFile(f, ctx, func(file *model.Upload) error {
+		return s.createUpload(file, ctx)
+	})
+}
+
+// SaveFile 持有文件内容的锁把文件写入存储, 再由 create 写入引用这个文件的记录,
+// create 失败时删除没有被其它记录引用的文件
+func (s *UploadService) SaveFile(f *upload.File, ctx *gin.Context, create func(file *model.Upload) error) error {
+	unlock, err := s.lockBlobs(ctx, f.Upload.Hash)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err = f.Save(ctx, s.store); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "保存文件", "err", err.Error())
+		return errors.New("保存文件失败")
+	}
+	if err = create(f.Upload); err != nil {
+		s.discardObject(f.Upload, ctx)
+		return err
+	}
+	return nil
+}
+
+// lockBlobs 按 Hash 排序后依次获取文件内容的锁, 返回释放所有锁的函数.
+// 写入存储 引用已有的文件以及删除引用数归零的文件都需要持有对应的锁
+func (s *UploadService) lockBlobs(ctx context.Context, hashes ...string) (func(), error) {
+	sorted := make([]string, 0, len(hashes))
+	for _, hash := range hashes {
+		if hash != "" {
+			sorted = append(sorted, hash)
+		}
+	}
+	sort.Strings(sorted)
+
+	var locks []*redisx.Lock
+	unlock := func() {
+		for _, l := range locks {
+			_ = l.Release(context.Background())
+		}
+	}
+	for i, hash := range sorted {
+		if i > 0 && hash == sorted[i-1] {
+			continue
+		}
+		l, err := redisx.ObtainWait(ctx, s.rdb, fmt.Sprintf(uploadBlobLockKey, hash), time.Minute, uploadBlobLockWait)
+		if err != nil {
+			unlock()
+			s.log.WithContext(ctx).Errorw("errMsg", "获取文件锁", "err", err.Error())
+			return nil, errors.New("文件正在处理, 请稍后再试")
+		}
+		locks = append(locks, l)
+	}
+	return unlock, nil
+}
+
+// createUpload 保存上传记录, 超出存储配额时返回 ErrQuotaExceeded, 有 Hash 的记录需要持有对应的锁
+func (s *UploadService) createUpload(upload *model.Upload, ctx *gin.Context) error {
 	upload.UID = ctx.GetString("uid")
-	if err := s.repo.CreateUpload(upload); err != nil {
-		s.log.Errorw("errMsg", "上传文件", "err", err.Error())
+	quota, err := s.QuotaOf(upload.UID)
+	if err != nil {
 		return err
 	}
-	s.log.Infow("errMsg", "上传文件")
+	err = s.repo.CreateUpload(upload, quota)
+	if errors.Is(err, ErrQuotaExceeded) {
+		return err
+	}
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "上传文件", "err", err.Error())
+		return err
+	}
+	s.log.WithContext(ctx).Infow("errMsg", "上传文件")
 	return nil
 }
 
@@ -65,27 +288,825 @@ func (s *UploadService) GetUploadList(req *model.UploadReq, ctx *gin.Context) ([
 		return nil, errors.New("暂无更多数据")
 	}
 	for _, i2 := range list {
-		i2.FileUrl = s.conf.Server.FileDomain + "/" + i2.FileUrl
+		i2.FileUrl = s.FileURL(i2)
 	}
 	return list, err
 }
 
 func (s *UploadService) DeleteUploadById(uploadId uint, ctx *gin.Context) error {
 	uid := ctx.GetString("uid")
-	if err := s.repo.DeleteUploadById(uploadId, uid); err != nil {
-		s.log.Errorw("errMsg", "删除上传文件", "err", err.Error())
+	list, err := s.repo.GetUploadByIds([]uint{uploadId}, uid)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "查询上传文件", "err", err.Error())
+		return err
+	}
+	unlock, err := s.lockBlobs(ctx, uploadHashes(list)...)
+	if err != nil {
 		return err
 	}
-	s.log.Infow("errMsg", "删除上传文件")
+	defer unlock()
+	released, err := s.repo.DeleteUploadById(uploadId, uid)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "删除上传文件", "err", err.Error())
+		return err
+	}
+	s.removeObjects(list, released, ctx)
+	s.log.WithContext(ctx).Infow("errMsg", "删除上传文件")
 	return nil
 }
 
 func (s *UploadService) DeleteUploadByIds(uploadIds []uint, ctx *gin.Context) error {
 	uid := ctx.GetString("uid")
-	if err := s.repo.DeleteUploadByIds(uploadIds, uid); err != nil {
-		s.log.Errorw("errMsg", "删除上传文件", "err", err.Error())
+	list, err := s.repo.GetUploadByIds(uploadIds, uid)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "查询上传文件", "err", err.Error())
+		return err
+	}
+	unlock, err := s.lockBlobs(ctx, uploadHashes(list)...)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	released, err := s.repo.DeleteUploadByIds(uploadIds, uid)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "删除上传文件", "err", err.Error())
+		return err
+	}
+	s.removeObjects(list, released, ctx)
+	s.log.WithContext(ctx).Infow("errMsg", "删除上传文件")
+	return nil
+}
+
+func uploadHashes(list []*model.Upload) []string {
+	hashes := make([]string, 0, len(list))
+	for _, upload := range list {
+		hashes = append(hashes, upload.Hash)
+	}
+	return hashes
+}
+
+// removeObjects 记录删除之后再删除存储中的文件, 删除失败只记录日志, 不影响接口返回.
+// 去重之后的文件只有引用数归零才会出现在 released 中, 没有 Hash 的旧记录直接删除
+func (s *UploadService) removeObjects(list []*model.Upload, released []*model.UploadBlob, ctx *gin.Context) {
+	for _, upload := range list {
+		if upload.Hash == "" && upload.FileKey != "" {
+			s.removeObject(upload.Storage, upload.FileKey, ctx)
+		}
+	}
+	for _, blob := range released {
+		s.removeObject(blob.Storage, blob.FileKey, ctx)
+		for _, variant := range blob.Variants {
+			s.removeObject(variant.Storage, variant.FileKey, ctx)
+		}
+	}
+}
+
+func (s *UploadService) removeObject(driver, key string, ctx *gin.Context) {
+	store, err := s.storageOf(driver)
+	if err == nil {
+		err = store.Delete(ctx, key)
+	}
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "删除存储中的文件", "key", key, "err", err.Error())
+	}
+}
+
+// signSecret 签名下载地址的密钥, 没有单独配置时使用 jwt.secret_key
+func signSecret(conf *config.Config) string {
+	if conf.Storage.Local.Secret != "" {
+		return conf.Storage.Local.Secret
+	}
+	return conf.JWT.SecretKey
+}
+
+func (s *UploadService) presignExpire() time.Duration {
+	if s.conf.Storage.PresignExpire > 0 {
+		return s.conf.Storage.PresignExpire
+	}
+	return defaultPresignExpire
+}
+
+// canAccess 公开的文件所有人可以访问, 其它文件只有上传者 共享的角色以及有附件管理权限的角色可以访问
+func (s *UploadService) canAccess(upload *model.Upload, uid, role string) bool {
+	if upload.Visibility == "" || upload.Visibility == model.VisibilityPublic || upload.UID == uid {
+		return true
+	}
+	if upload.Visibility == model.VisibilityRoles && upload.SharedRoles != nil {
+		for _, r := range *upload.SharedRoles {
+			if r == role {
+				return true
+			}
+		}
+	}
+	if s.enforcer == nil || role == "" {
+		return false
+	}
+	ok, err := s.enforcer.Enforce(role, uploadManageApi, "GET")
+	if err != nil {
+		s.log.Errorw("errMsg", "校验附件管理权限", "err", err.Error())
+	}
+	return ok
+}
+
+func (s *UploadService) getUpload(uploadId uint) (*model.Upload, error) {
+	upload, err := s.repo.GetUploadById(uploadId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		s.log.Errorw("errMsg", "查询上传文件", "err", err.Error())
+		return nil, err
+	}
+	return upload, nil
+}
+
+// GetDownload 查询当前用户有权下载的文件
+func (s *UploadService) GetDownload(uploadId uint, ctx *gin.Context) (*model.Upload, error) {
+	upload, err := s.getUpload(uploadId)
+	if err != nil {
+		return nil, err
+	}
+	if !s.canAccess(upload, ctx.GetString("uid"), ctx.GetString("role")) {
+		return nil, ErrUploadForbidden
+	}
+	return upload, nil
+}
+
+// LocalKey 文件在本地根目录下的路径, 不是本地驱动保存的文件返回 false
+func (s *UploadService) LocalKey(upload *model.Upload) (string, bool) {
+	switch {
+	case upload.FileKey == "":
+		return strings.TrimPrefix(upload.FileUrl, "uploads/"), true
+	case upload.Storage == "" || upload.Storage == "local":
+		return upload.FileKey, true
+	}
+	return "", false
+}
+
+// PresignedURL 对象存储中的文件生成临时访问地址, 由对象存储直接处理 Range 请求
+func (s *UploadService) PresignedURL(driver, key string, ctx *gin.Context) (string, error) {
+	store, err := s.storageOf(driver)
+	if err != nil {
+		return "", err
+	}
+	return store.PresignedURL(ctx, key, s.presignExpire())
+}
+
+// OpenObject 读取存储中的对象, 用于不能交给对象存储直接处理的下载, 例如一次性地址
+func (s *UploadService) OpenObject(driver, key string, ctx *gin.Context) (io.ReadCloser, *storagex.Object, error) {
+	store, err := s.storageOf(driver)
+	if err != nil {
+		return nil, nil, err
+	}
+	return store.Get(ctx, key)
+}
+
+// ObjectURL 存储中的对象的访问地址
+func (s *UploadService) ObjectURL(driver, key string) string {
+	store, err := s.storageOf(driver)
+	if err != nil {
+		s.log.Errorw("errMsg", "获取文件存储驱动", "err", err.Error())
+		return ""
+	}
+	return store.URL(key)
+}
+
+// Variant 获取原图的图片规格, 没有生成过时读取原图按规格生成并保存到当前存储驱动,
+// 之后直接返回保存的结果. 只有带 Hash 的文件支持图片规格
+func (s *UploadService) Variant(ctx context.Context, source *model.Upload, preset string) (*model.UploadVariant, error) {
+	// viper 读取配置时 map 的键会转成小写
+	preset = strings.ToLower(preset)
+	p, ok := s.conf.Upload.Presets[preset]
+	if !ok || source.Hash == "" {
+		return nil, ErrVariantUnsupported
+	}
+	variant, err := s.repo.GetVariant(source.Hash, preset)
+	if err == nil {
+		return variant, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		s.log.WithContext(ctx).Errorw("errMsg", "查询图片规格", "err", err.Error())
+		return nil, err
+	}
+
+	lock, err := redisx.Obtain(ctx, s.rdb, fmt.Sprintf(uploadVariantLockKey, source.Hash, preset), time.Minute)
+	if err != nil {
+		// 其它请求正在生成, 等它生成完成
+		for i := 0; i < 50; i++ {
+			time.Sleep(200 * time.Millisecond)
+			if variant, err = s.repo.GetVariant(source.Hash, preset); err == nil {
+				return variant, nil
+			}
+		}
+		return nil, ErrVariantUnavailable
+	}
+	defer lock.Release(context.Background())
+
+	store, err := s.storageOf(source.Storage)
+	if err != nil {
+		return nil, err
+	}
+	rc, _, err := store.Get(ctx, source.FileKey)
+	if errors.Is(err, storagex.ErrNotExist) {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "读取原图", "err", err.Error())
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(rc, maxVariantSource+1))
+	rc.Close()
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "读取原图", "err", err.Error())
+		return nil, err
+	}
+	if len(data) > maxVariantSource {
+		return nil, ErrVariantUnsupported
+	}
+
+	img, err := upload.Resize(data, p)
+	var rejected *upload.PolicyError
+	if errors.As(err, &rejected) {
+		return nil, ErrVariantUnsupported
+	}
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "生成图片规格", "err", err.Error())
+		return nil, err
+	}
+	key := upload.VariantKey(source.Hash, preset, img.Ext)
+	if err = s.store.Put(ctx, key, bytes.NewReader(img.Data), int64(len(img.Data)), img.MimeType); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "保存图片规格", "err", err.Error())
+		return nil, err
+	}
+	variant, err = s.repo.SaveVariant(&model.UploadVariant{
+		Hash:     source.Hash,
+		Preset:   preset,
+		Storage:  s.store.Name(),
+		FileKey:  key,
+		MimeType: img.MimeType,
+		Width:    img.Width,
+		Height:   img.Height,
+		Size:     int64(len(img.Data)),
+	})
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "保存图片规格", "err", err.Error())
+		return nil, err
+	}
+	return variant, nil
+}
+
+// PublicObject 本地文件是否可以通过 uploads 路径直接访问. 没有记录引用的文件中,
+// 上传服务管理的目录下的是已经删除或者还没有完成上传的文件, 不允许访问, 其它的是上传记录之外放进来的, 保持原来的行为允许访问
+func (s *UploadService) PublicObject(key string) bool {
+	public, found, err := s.repo.PublicObject(key)
+	if err != nil {
+		s.log.Errorw("errMsg", "查询文件可见范围", "err", err.Error())
+		return false
+	}
+	if !found {
+		return !upload.Managed(key)
+	}
+	return public
+}
+
+// PublicUpload 引用这个对象键的公开上传记录
+func (s *UploadService) PublicUpload(key string) (*model.Upload, bool) {
+	file, err := s.repo.GetPublicUploadByKey(key)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			s.log.Errorw("errMsg", "查询公开文件", "err", err.Error())
+		}
+		return nil, false
+	}
+	return file, true
+}
+
+// UpdateVisibility 修改自己上传的文件的可见范围
+func (s *UploadService) UpdateVisibility(req *model.UploadVisibilityReq, ctx *gin.Context) error {
+	err := s.repo.UpdateVisibility(req, ctx.GetString("uid"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrUploadNotFound
+	}
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "修改文件可见范围", "err", err.Error())
+		return err
+	}
+	s.log.WithContext(ctx).Infow("errMsg", "修改文件可见范围")
+	return nil
+}
+
+// SignURL 生成带签名的临时下载地址, 拿到地址的人不需要登录即可下载,
+// once 为 true 时地址第一次使用后失效
+func (s *UploadService) SignURL(req *model.UploadSignReq, ctx *gin.Context) (*model.UploadSignRes, error) {
+	if _, err := s.GetDownload(req.ID, ctx); err != nil {
+		return nil, err
+	}
+	expire := time.Duration(req.Expire) * time.Second
+	if expire == 0 {
+		expire = s.presignExpire()
+	}
+	expiresAt := time.Now().Add(expire)
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+
+	q := url.Values{}
+	q.Set("expires", expires)
+	nonce := ""
+	if req.Once {
+		nonce = uuidx.UID()
+		if err := s.rdb.Set(ctx, fmt.Sprintf(uploadSignOnceKey, nonce), 1, expire); err != nil {
+			s.log.WithContext(ctx).Errorw("errMsg", "生成一次性下载地址", "err", err.Error())
+			return nil, errors.New("生成下载地址失败")
+		}
+		q.Set("nonce", nonce)
+	}
+	q.Set("signature", s.sign(req.ID, expires, nonce))
+	return &model.UploadSignRes{
+		Url:       fmt.Sprintf("%s/api/v1/upload/file/%d?%s", s.conf.Server.FileDomain, req.ID, q.Encode()),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// GetSignedDownload 校验签名下载地址, 通过后返回对应的文件.
+// 一次性地址只在 GET 请求时失效, HEAD 请求只检查地址是否还可以使用
+func (s *UploadService) GetSignedDownload(uploadId uint, expires, nonce, signature string, ctx *gin.Context) (*model.Upload, error) {
+	t, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > t {
+		return nil, ErrUploadForbidden
+	}
+	if !hmac.Equal([]byte(s.sign(uploadId, expires, nonce)), []byte(signature)) {
+		return nil, ErrUploadForbidden
+	}
+	if nonce != "" {
+		key := fmt.Sprintf(uploadSignOnceKey, nonce)
+		if ctx.Request.Method == http.MethodHead {
+			if ok, err := s.rdb.Exists(ctx, key); err != nil || !ok {
+				return nil, ErrUploadForbidden
+			}
+		} else if n, err := s.rdb.Del(ctx, key); err != nil || n == 0 {
+			return nil, ErrUploadForbidden
+		}
+	}
+	return s.getUpload(uploadId)
+}
+
+func (s *UploadService) sign(uploadId uint, expires, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(signSecret(s.conf)))
+	mac.Write([]byte(fmt.Sprintf("%d\n%s\n%s", uploadId, expires, nonce)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GetUploadUsage 按用户以及文件用途统计存储用量
+func (s *UploadService) GetUploadUsage(ctx *gin.Context) (*model.UploadUsageRes, error) {
+	res, err := s.repo.GetUploadUsage()
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "统计存储用量", "err", err.Error())
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *UploadService) chunkSize() int64 {
+	if s.conf.Storage.ChunkSize > 0 {
+		return s.conf.Storage.ChunkSize
+	}
+	return defaultChunkSize
+}
+
+func (s *UploadService) chunkExpire() time.Duration {
+	if s.conf.Storage.ChunkExpire > 0 {
+		return s.conf.Storage.ChunkExpire
+	}
+	return defaultChunkExpire
+}
+
+// InitUploadSession 创建分片上传会话, 分片和文件一样写入当前存储驱动, 多实例部署时任意实例都可以接收分片
+func (s *UploadService) InitUploadSession(req *model.UploadSessionReq, ctx *gin.Context) (*model.UploadSession, error) {
+	if err := upload.CheckFile(upload.PolicyOf(s.conf.Upload, "file"), req.FileName, req.Size); err != nil {
+		return nil, err
+	}
+	if err := s.CheckQuota(req.Size, ctx); err != nil {
+		return nil, err
+	}
+	chunkSize := s.chunkSize()
+	expire := s.chunkExpire()
+	session := &model.UploadSession{
+		UploadId:    uuidx.UID(),
+		UID:         ctx.GetString("uid"),
+		FileName:    req.FileName,
+		Size:        req.Size,
+		Hash:        strings.ToLower(req.Hash),
+		ChunkSize:   chunkSize,
+		TotalChunks: int((req.Size + chunkSize - 1) / chunkSize),
+		Storage:     s.store.Name(),
+		ExpiresAt:   time.Now().Add(expire),
+		Received:    []int{},
+	}
+
+	// 相同内容的文件已经存在时下发秒传校验挑战, 只知道摘要和大小不能拿到别人的文件
+	if blob, err := s.repo.GetBlobByHash(session.Hash); err == nil && blob.Size == req.Size {
+		if session.Challenge, err = newUploadChallenge(blob.Size); err != nil {
+			return nil, err
+		}
+	}
+
+	err := s.rdb.SetObject(ctx, fmt.Sprintf(uploadSessionKey, session.UploadId), session, expire)
+	if err == nil && session.Challenge != nil {
+		err = s.rdb.Set(ctx, fmt.Sprintf(uploadSessionChallengeKey, session.UploadId), session.Challenge.Nonce, expire)
+	}
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "创建分片上传会话", "err", err.Error())
+		return nil, errors.New("创建上传会话失败")
+	}
+	_ = s.rdb.ZAdd(ctx, uploadSessionsKey, redis.Z{
+		Score:  float64(time.Now().Unix()),
+		Member: fmt.Sprintf("%s/%d/%s", session.UploadId, session.TotalChunks, session.Storage),
+	})
+	return session, nil
+}
+
+// newUploadChallenge 在文件中随机选择一段内容作为秒传校验挑战
+func newUploadChallenge(size int64) (*model.UploadChallenge, error) {
+	length := int64(instantChallengeSize)
+	if size < length {
+		length = size
+	}
+	offset, err := rand.Int(rand.Reader, big.NewInt(size-length+1))
+	if err != nil {
+		return nil, err
+	}
+	return &model.UploadChallenge{Offset: offset.Int64(), Length: length, Nonce: uuidx.UID()}, nil
+}
+
+// InstantUpload 校验客户端对秒传挑战的回答, 通过后直接引用已有的文件创建上传记录.
+// 挑战只能提交一次, 校验失败后仍然可以通过上传分片完成这个会话
+func (s *UploadService) InstantUpload(req *model.UploadInstantReq, ctx *gin.Context) (*model.Upload, error) {
+	session, err := s.getUploadSession(req.UploadId, ctx)
+	if err != nil {
+		return nil, err
+	}
+	challenge := session.Challenge
+	if challenge == nil {
+		return nil, errInstantExpired
+	}
+	if n, err := s.rdb.Del(ctx, fmt.Sprintf(uploadSessionChallengeKey, session.UploadId)); err != nil || n == 0 {
+		return nil, errInstantExpired
+	}
+	unlock, err := s.lockBlobs(ctx, session.Hash)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	blob, err := s.repo.GetBlobByHash(session.Hash)
+	if err != nil || blob.Size != session.Size {
+		return nil, errInstantExpired
+	}
+
+	store, err := NewStorage(s.conf, blob.Storage)
+	if err != nil {
+		return nil, err
+	}
+	data, err := storagex.ReadRange(ctx, store, blob.FileKey, challenge.Offset, challenge.Length)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "读取秒传校验内容", "err", err.Error())
+		return nil, errInstantFailed
+	}
+	sum := sha256.Sum256(append([]byte(challenge.Nonce), data...))
+	if !hmac.Equal([]byte(hex.EncodeToString(sum[:])), []byte(strings.ToLower(req.Proof))) {
+		return nil, errInstantFailed
+	}
+
+	file := &model.Upload{
+		FileName:    session.FileName,
+		FileType:    upload.FileType(session.FileName, ""),
+		FilePurpose: "普通文件",
+		Visibility:  model.VisibilityPrivate,
+		Storage:     blob.Storage,
+		FileKey:     blob.FileKey,
+		Hash:        blob.Hash,
+		FileSize:    blob.Size,
+	}
+	if err = s.createUpload(file, ctx); err != nil {
+		return nil, err
+	}
+	if store, err = NewStorage(s.conf, session.Storage); err == nil {
+		s.removeUploadSession(ctx, store, session)
+	}
+	return file, nil
+}
+
+// getUploadSession 获取当前用户的上传会话以及已收到的分片
+func (s *UploadService) getUploadSession(uploadId string, ctx *gin.Context) (*model.UploadSession, error) {
+	session := &model.UploadSession{}
+	err := s.rdb.GetObject(ctx, fmt.Sprintf(uploadSessionKey, uploadId), session)
+	if errors.Is(err, redisx.Nil) {
+		err = s.migrateLegacyUploadSession(ctx, uploadId, session)
+	}
+	if err != nil {
+		return nil, errors.New("上传会话不存在或已过期")
+	}
+	if session.UID != ctx.GetString("uid") {
+		return nil, errors.New("上传会话不存在或已过期")
+	}
+	if session.Challenge != nil {
+		// 挑战已经提交过
+		if ok, err := s.rdb.Exists(ctx, fmt.Sprintf(uploadSessionChallengeKey, uploadId)); err != nil || !ok {
+			session.Challenge = nil
+		}
+	}
+
+	members, err := s.rdb.SMembers(ctx, fmt.Sprintf(uploadSessionChunksKey, uploadId))
+	if err != nil {
+		return nil, err
+	}
+	session.Received = make([]int, 0, len(members))
+	for _, m := range members {
+		if i, err := strconv.Atoi(m); err == nil {
+			session.Received = append(session.Received, i)
+		}
+	}
+	sort.Ints(session.Received)
+	return session, nil
+}
+
+// migrateLegacyUploadSession 把旧版本 key 中的会话和已收到的分片复制到新 key 后删除旧 key
+func (s *UploadService) migrateLegacyUploadSession(ctx context.Context, uploadId string, session *model.UploadSession) error {
+	legacyKey := fmt.Sprintf(legacyUploadSessionKey, uploadId)
+	legacyChunksKey := fmt.Sprintf(legacyUploadSessionChunksKey, uploadId)
+	if err := s.rdb.GetObject(ctx, legacyKey, session); err != nil {
+		return err
+	}
+	members, err := s.rdb.SMembers(ctx, legacyChunksKey)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf(uploadSessionKey, uploadId)
+	chunksKey := fmt.Sprintf(uploadSessionChunksKey, uploadId)
+	// 新旧 key 不一定在同一个槽位, 不能放在一个事务中
+	_, err = s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, jsonx.Marshal(session), 0)
+		pipe.ExpireAt(ctx, key, session.ExpiresAt)
+		if len(members) > 0 {
+			chunks := make([]interface{}, 0, len(members))
+			for _, m := range members {
+				chunks = append(chunks, m)
+			}
+			pipe.SAdd(ctx, chunksKey, chunks...)
+			pipe.ExpireAt(ctx, chunksKey, session.ExpiresAt.Add(time.Second))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_, _ = s.rdb.Del(ctx, legacyKey)
+	_, _ = s.rdb.Del(ctx, legacyChunksKey)
+	return nil
+}
+
+func (s *UploadService) GetUploadSession(uploadId string, ctx *gin.Context) (*model.UploadSession, error) {
+	return s.getUploadSession(uploadId, ctx)
+}
+
+// UploadChunk 上传一个分片, 重复上传同一个分片会覆盖之前的内容
+func (s *UploadService) UploadChunk(req *model.UploadChunkReq, file *multipart.FileHeader, ctx *gin.Context) (*model.UploadSession, error) {
+	session, err := s.getUploadSession(req.UploadId, ctx)
+	if err != nil {
+		return nil, err
+	}
+	index := *req.Index
+	if index >= session.TotalChunks {
+		return nil, errors.New("分片序号超出范围")
+	}
+	size := session.ChunkSize
+	if index == session.TotalChunks-1 {
+		size = session.Size - int64(index)*session.ChunkSize
+	}
+	if file.Size != size {
+		return nil, fmt.Errorf("分片大小不正确, 应为 %d 字节", size)
+	}
+	// 正在合并时不再接收分片
+	if merging, err := s.rdb.Exists(ctx, fmt.Sprintf(uploadSessionLockKey, session.UploadId)); err != nil || merging {
+		return nil, errors.New("文件正在合并, 不能再上传分片")
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	store, err := NewStorage(s.conf, session.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if err = store.Put(ctx, upload.ChunkKey(session.UploadId, index), src, size, "application/octet-stream"); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "保存分片", "err", err.Error())
+		return nil, errors.New("保存分片失败")
+	}
+
+	key := fmt.Sprintf(uploadSessionChunksKey, session.UploadId)
+	_, err = s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, key, index)
+		pipe.ExpireAt(ctx, key, session.ExpiresAt.Add(time.Second))
+		return nil
+	})
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "记录分片", "err", err.Error())
+		return nil, errors.New("保存分片失败")
+	}
+
+	if !containsInt(session.Received, index) {
+		session.Received = append(session.Received, index)
+		sort.Ints(session.Received)
+	}
+	return session, nil
+}
+
+// CompleteUploadSession 按顺序合并分片写入临时对象, 边写边计算 SHA-256 并与创建会话时的摘要比对,
+// 校验通过后才移动到按内容寻址的对象键, 分片只读取一次, 合并期间替换分片不会影响写入的内容
+func (s *UploadService) CompleteUploadSession(uploadId string, ctx *gin.Context) (*model.Upload, error) {
+	session, err := s.getUploadSession(uploadId, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if missing := session.TotalChunks - len(session.Received); missing > 0 {
+		return nil, fmt.Errorf("还有 %d 个分片未上传", missing)
+	}
+
+	// 合并大文件耗时较长, 锁在合并期间自动续租, 持有锁时不再接收分片
+	lock, err := redisx.Obtain(ctx, s.rdb, fmt.Sprintf(uploadSessionLockKey, uploadId), time.Minute)
+	if err != nil {
+		return nil, errors.New("文件正在合并, 请稍后")
+	}
+	defer lock.Release(context.Background())
+
+	store, err := NewStorage(s.conf, session.Storage)
+	if err != nil {
+		return nil, err
+	}
+	tmpKey := upload.MergedKey(uploadId)
+	pr, pw := io.Pipe()
+	defer pr.CloseWithError(io.ErrClosedPipe)
+	go func() {
+		pw.CloseWithError(s.concatChunks(ctx, store, session, pw))
+	}()
+
+	// 分片上传的文件同样按内容识别类型, 从写入的同一个数据流中读取开头, 不符合上传策略的直接丢弃
+	head := make([]byte, 512)
+	n, err := io.ReadFull(pr, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		s.log.WithContext(ctx).Errorw("errMsg", "读取分片", "err", err.Error())
+		return nil, errors.New("合并文件失败")
+	}
+	head = head[:n]
+	mimeType, err := upload.CheckContent(upload.PolicyOf(s.conf.Upload, "file"), head)
+	if err != nil {
+		s.removeUploadSession(ctx, store, session)
+		return nil, err
+	}
+
+	hash := sha256.New()
+	err = store.Put(ctx, tmpKey, io.TeeReader(io.MultiReader(bytes.NewReader(head), pr), hash), session.Size, mimeType)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "合并分片", "err", err.Error())
+		s.removeObject(store.Name(), tmpKey, ctx)
+		return nil, errors.New("合并文件失败")
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != session.Hash {
+		s.removeUploadSession(ctx, store, session)
+		return nil, errors.New("文件校验失败, 请重新上传")
+	}
+
+	unlock, err := s.lockBlobs(ctx, session.Hash)
+	if err != nil {
+		s.removeObject(store.Name(), tmpKey, ctx)
+		return nil, err
+	}
+	defer unlock()
+	key := upload.BlobKey(session.Hash)
+	_, err = store.Stat(ctx, key)
+	if errors.Is(err, storagex.ErrNotExist) {
+		err = storagex.Move(ctx, store, tmpKey, key, mimeType)
+	} else {
+		// 内容已经存在, 临时对象直接丢弃
+		s.removeObject(store.Name(), tmpKey, ctx)
+	}
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "合并分片", "err", err.Error())
+		s.removeObject(store.Name(), tmpKey, ctx)
+		return nil, errors.New("合并文件失败")
+	}
+
+	file := &model.Upload{
+		FileName:    session.FileName,
+		FileUrl:     store.URL(key),
+		FileType:    upload.FileType(session.FileName, mimeType),
+		FilePurpose: "普通文件",
+		Visibility:  model.VisibilityPrivate,
+		Storage:     store.Name(),
+		FileKey:     key,
+		Hash:        session.Hash,
+		FileSize:    session.Size,
+	}
+	if err = s.createUpload(file, ctx); err != nil {
+		s.discardObject(file, ctx)
+		return nil, err
+	}
+	s.removeUploadSession(ctx, store, session)
+	return file, nil
+}
+
+func (s *UploadService) concatChunks(ctx context.Context, store storagex.Storage, session *model.UploadSession, w io.Writer) error {
+	for i := 0; i < session.TotalChunks; i++ {
+		rc, _, err := store.Get(ctx, upload.ChunkKey(session.UploadId, i))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AbortUploadSession 取消上传, 删除已上传的分片
+func (s *UploadService) AbortUploadSession(uploadId string, ctx *gin.Context) error {
+	session, err := s.getUploadSession(uploadId, ctx)
+	if err != nil {
+		return err
+	}
+	store, err := NewStorage(s.conf, session.Storage)
+	if err != nil {
 		return err
 	}
-	s.log.Infow("errMsg", "删除上传文件")
+	s.removeUploadSession(ctx, store, session)
 	return nil
 }
+
+func (s *UploadService) removeUploadSession(ctx context.Context, store storagex.Storage, session *model.UploadSession) {
+	_, _ = s.rdb.Del(ctx, fmt.Sprintf(uploadSessionKey, session.UploadId), fmt.Sprintf(uploadSessionChunksKey, session.UploadId),
+		fmt.Sprintf(uploadSessionChallengeKey, session.UploadId))
+	// 旧版本实例可能仍在写旧 key
+	_, _ = s.rdb.Del(ctx, fmt.Sprintf(legacyUploadSessionKey, session.UploadId))
+	_, _ = s.rdb.Del(ctx, fmt.Sprintf(legacyUploadSessionChunksKey, session.UploadId))
+	s.removeChunks(ctx, store, session.UploadId, session.TotalChunks)
+}
+
+func (s *UploadService) removeChunks(ctx context.Context, store storagex.Storage, uploadId string, total int) {
+	for i := 0; i < total; i++ {
+		if err := store.Delete(ctx, upload.ChunkKey(uploadId, i)); err != nil {
+			s.log.WithContext(ctx).Errorw("errMsg", "删除分片", "key", upload.ChunkKey(uploadId, i), "err", err.Error())
+		}
+	}
+	// 合并中途退出时留下的临时对象
+	if err := store.Delete(ctx, upload.MergedKey(uploadId)); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "删除分片", "key", upload.MergedKey(uploadId), "err", err.Error())
+	}
+}
+
+// SweepUploadSessions 清理过期会话留在存储中的分片, 由定时任务 upload_session_sweep 调用
+func (s *UploadService) SweepUploadSessions(ctx context.Context) (string, error) {
+	deadline := time.Now().Add(-s.chunkExpire()).Unix()
+	res, err := s.rdb.RunScript(ctx, popExpiredSessions, []string{uploadSessionsKey}, deadline)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "清理过期上传会话", "err", err.Error())
+		return "", err
+	}
+	members, _ := res.([]interface{})
+	swept := 0
+	for _, m := range members {
+		// "uploadId/分片数/存储驱动", 旧版本写入的是 JSON 编码后的字符串
+		member, _ := m.(string)
+		if strings.HasPrefix(member, `"`) {
+			if err = jsonx.Unmarshal([]byte(member), &member); err != nil {
+				continue
+			}
+		}
+		parts := strings.SplitN(member, "/", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		n, err := strconv.Atoi(parts[1])
+		if err != nil {
+			continue
+		}
+		store, err := NewStorage(s.conf, parts[2])
+		if err != nil {
+			continue
+		}
+		s.removeChunks(ctx, store, parts[0], n)
+		swept++
+	}
+	return fmt.Sprintf("清理过期上传会话 %d 个", swept), nil
+}
+
+func containsInt(list []int, v int) bool {
+	for _, i := range list {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
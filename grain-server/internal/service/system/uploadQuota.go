@@ -0,0 +1,124 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	model "github.com/go-grain/grain/model/system"
+	"gorm.io/gorm"
+)
+
+// QuotaOf 用户的存储配额, 用户配额 角色配额 默认配额依次生效, 0 表示不限制
+func (s *UploadService) QuotaOf(uid string) (int64, error) {
+	quota, found, err := s.repo.GetQuota(uid)
+	if err != nil {
+		s.log.Errorw("errMsg", "查询存储配额", "err", err.Error())
+		return 0, err
+	}
+	if !found {
+		return s.conf.Upload.Quota.Default, nil
+	}
+	return quota, nil
+}
+
+// CheckQuota 写入存储之前预先检查配额, 避免大文件写入存储后才发现超出配额,
+// 最终以写入上传记录时事务中的检查为准
+func (s *UploadService) CheckQuota(size int64, ctx *gin.Context) error {
+	uid := ctx.GetString("uid")
+	quota, err := s.QuotaOf(uid)
+	if err != nil || quota == 0 {
+		return err
+	}
+	usage, err := s.repo.GetUserUsage(uid)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "查询存储用量", "err", err.Error())
+		return err
+	}
+	if usage.Used+size > quota {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// discardObject 上传记录没有写入时删除刚写入存储的文件, 内容已经被其它记录引用的不删除,
+// 调用方需要持有文件内容的锁
+func (s *UploadService) discardObject(upload *model.Upload, ctx *gin.Context) {
+	if upload.Hash == "" || upload.FileKey == "" {
+		return
+	}
+	if _, err := s.repo.GetBlobByHash(upload.Hash); errors.Is(err, gorm.ErrRecordNotFound) {
+		s.removeObject(upload.Storage, upload.FileKey, ctx)
+	}
+}
+
+// GetUserQuota 当前用户的存储用量以及配额
+func (s *UploadService) GetUserQuota(ctx *gin.Context) (*model.UploadQuotaRes, error) {
+	uid := ctx.GetString("uid")
+	quota, err := s.QuotaOf(uid)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := s.repo.GetUserUsage(uid)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "查询存储用量", "err", err.Error())
+		return nil, err
+	}
+	return &model.UploadQuotaRes{Files: usage.Files, Used: usage.Used, Quota: quota}, nil
+}
+
+func (s *UploadService) GetQuotaList(ctx *gin.Context) ([]*model.UploadQuota, error) {
+	list, err := s.repo.GetQuotaList()
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "查询存储配额列表", "err", err.Error())
+		return nil, err
+	}
+	return list, nil
+}
+
+// SetQuota 设置角色或者用户的存储配额
+func (s *UploadService) SetQuota(req *model.UploadQuotaReq, ctx *gin.Context) error {
+	if (req.Role == "") == (req.UID == "") {
+		return errors.New("角色和用户只能设置一个")
+	}
+	if err := s.repo.SetQuota(&model.UploadQuota{Role: req.Role, UID: req.UID, Quota: req.Quota}); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "设置存储配额", "err", err.Error())
+		return err
+	}
+	s.log.WithContext(ctx).Infow("errMsg", "设置存储配额")
+	return nil
+}
+
+func (s *UploadService) DeleteQuotaById(id uint, ctx *gin.Context) error {
+	if err := s.repo.DeleteQuotaById(id); err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "删除存储配额", "err", err.Error())
+		return err
+	}
+	s.log.WithContext(ctx).Infow("errMsg", "删除存储配额")
+	return nil
+}
+
+// ReconcileUsage 按 uploads 表重新统计用量, 修正异常中断等原因造成的偏差,
+// 由定时任务 upload_quota_reconcile 调用
+func (s *UploadService) ReconcileUsage(ctx context.Context) (string, error) {
+	changed, err := s.repo.ReconcileUsage(ctx)
+	if err != nil {
+		s.log.WithContext(ctx).Errorw("errMsg", "重新统计存储用量", "err", err.Error())
+		return "", err
+	}
+	return fmt.Sprintf("用量有变化的用户 %d 个", changed), nil
+}
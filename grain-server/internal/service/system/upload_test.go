@@ -0,0 +1,365 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-grain/grain/config"
+	"github.com/go-grain/grain/internal/repo/data"
+	"github.com/go-grain/grain/log"
+	model "github.com/go-grain/grain/model/system"
+	storagex "github.com/go-grain/grain/pkg/storage"
+	"github.com/go-grain/grain/utils/upload"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// fakeUploadRepo 只实现上传流程用到的方法, 其余方法调用时 panic
+type fakeUploadRepo struct {
+	IUploadRepo
+	mu      sync.Mutex
+	uploads []*model.Upload
+}
+
+func (r *fakeUploadRepo) CreateUpload(upload *model.Upload, quota int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	upload.ID = uint(len(r.uploads) + 1)
+	r.uploads = append(r.uploads, upload)
+	return nil
+}
+
+func (r *fakeUploadRepo) GetUploadById(id uint) (*model.Upload, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.uploads {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeUploadRepo) GetBlobByHash(hash string) (*model.UploadBlob, error) {
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeUploadRepo) GetQuota(uid string) (int64, bool, error) {
+	return 0, false, nil
+}
+
+func newTestUploadService(t *testing.T) (*UploadService, *fakeUploadRepo, *miniredis.Miniredis) {
+	t.Helper()
+	m := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: m.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+
+	conf := &config.Config{}
+	conf.Storage.Local.Root = t.TempDir()
+	conf.Storage.Local.Secret = "secret"
+	conf.Storage.ChunkSize = 4
+	store, err := NewStorage(conf, "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &fakeUploadRepo{}
+	return NewUploadService(repo, store, &data.Redis{Client: client}, conf, log.DefaultLogger, nil), repo, m
+}
+
+func newTestContext(uid string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	ctx.Set("uid", uid)
+	return ctx
+}
+
+// chunkFile 构造分片上传接口收到的文件
+func chunkFile(t *testing.T, content []byte) *multipart.FileHeader {
+	t.Helper()
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	part, err := w.CreateFormFile("file", "blob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = part.Write(content)
+	_ = w.Close()
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	if err = req.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	return req.MultipartForm.File["file"][0]
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// uploadChunks 创建会话并按 ChunkSize 上传 content, 会话声明的摘要为 hash
+func uploadChunks(t *testing.T, s *UploadService, ctx *gin.Context, hash string, content []byte) *model.UploadSession {
+	t.Helper()
+	session, err := s.InitUploadSession(&model.UploadSessionReq{FileName: "a.txt", Size: int64(len(content)), Hash: hash}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < session.TotalChunks; i++ {
+		end := int64(i+1) * session.ChunkSize
+		if end > session.Size {
+			end = session.Size
+		}
+		index := i
+		req := &model.UploadChunkReq{UploadId: session.UploadId, Index: &index}
+		if _, err = s.UploadChunk(req, chunkFile(t, content[int64(i)*session.ChunkSize:end]), ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return session
+}
+
+func assertNotExist(t *testing.T, store storagex.Storage, key string) {
+	t.Helper()
+	if _, err := store.Stat(context.Background(), key); !errors.Is(err, storagex.ErrNotExist) {
+		t.Errorf("%s 应该不存在, err = %v", key, err)
+	}
+}
+
+func TestCompleteUploadSession(t *testing.T) {
+	s, repo, _ := newTestUploadService(t)
+	ctx := newTestContext("u1")
+	content := []byte("hello, chunked world")
+	session := uploadChunks(t, s, ctx, sha256Hex(content), content)
+
+	file, err := s.CompleteUploadSession(session.UploadId, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.FileKey != upload.BlobKey(session.Hash) || len(repo.uploads) != 1 {
+		t.Fatalf("上传记录 FileKey = %s, 记录数 %d", file.FileKey, len(repo.uploads))
+	}
+	data, err := storagex.ReadRange(ctx, s.store, file.FileKey, 0, int64(len(content)))
+	if err != nil || !bytes.Equal(data, content) {
+		t.Errorf("合并后的内容 = %q err = %v", data, err)
+	}
+	// 临时对象和分片都已经删除
+	assertNotExist(t, s.store, upload.MergedKey(session.UploadId))
+	for i := 0; i < session.TotalChunks; i++ {
+		assertNotExist(t, s.store, upload.ChunkKey(session.UploadId, i))
+	}
+}
+
+func TestCompleteUploadSessionHashMismatch(t *testing.T) {
+	s, repo, _ := newTestUploadService(t)
+	ctx := newTestContext("u1")
+	victim := []byte("the real file content")
+	forged := []byte("something else entire")
+	session := uploadChunks(t, s, ctx, sha256Hex(victim), forged)
+
+	if _, err := s.CompleteUploadSession(session.UploadId, ctx); err == nil {
+		t.Fatal("摘要不一致时应该失败")
+	}
+	// 错误的内容不能写入被冒用摘要的对象键
+	assertNotExist(t, s.store, upload.BlobKey(session.Hash))
+	assertNotExist(t, s.store, upload.MergedKey(session.UploadId))
+	if len(repo.uploads) != 0 {
+		t.Errorf("不应该写入上传记录, 记录数 %d", len(repo.uploads))
+	}
+}
+
+func TestUploadChunkWhileMerging(t *testing.T) {
+	s, _, m := newTestUploadService(t)
+	ctx := newTestContext("u1")
+	content := []byte("abcdefgh")
+	session := uploadChunks(t, s, ctx, sha256Hex(content), content)
+
+	// 合并期间持有会话锁, 不能再替换分片
+	m.Set(fmt.Sprintf(uploadSessionLockKey, session.UploadId), "token")
+	index := 0
+	req := &model.UploadChunkReq{UploadId: session.UploadId, Index: &index}
+	if _, err := s.UploadChunk(req, chunkFile(t, []byte("ABCD")), ctx); err == nil || !strings.Contains(err.Error(), "正在合并") {
+		t.Fatalf("合并期间上传分片 err = %v", err)
+	}
+	m.Del(fmt.Sprintf(uploadSessionLockKey, session.UploadId))
+
+	file, err := s.CompleteUploadSession(session.UploadId, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := storagex.ReadRange(ctx, s.store, file.FileKey, 0, int64(len(content)))
+	if !bytes.Equal(data, content) {
+		t.Errorf("合并后的内容 = %q, 期望 %q", data, content)
+	}
+}
+
+func TestCompleteUploadSessionPolicy(t *testing.T) {
+	s, repo, _ := newTestUploadService(t)
+	s.conf.Upload.Policies = map[string]config.UploadPolicy{"file": {AllowedMimes: []string{"text/plain"}}}
+	ctx := newTestContext("u1")
+	content := []byte("<html><script>alert(1)</script></html>")
+	session := uploadChunks(t, s, ctx, sha256Hex(content), content)
+
+	var rejected *upload.PolicyError
+	if _, err := s.CompleteUploadSession(session.UploadId, ctx); !errors.As(err, &rejected) {
+		t.Fatalf("不允许的类型 err = %v", err)
+	}
+	assertNotExist(t, s.store, upload.BlobKey(session.Hash))
+	assertNotExist(t, s.store, upload.MergedKey(session.UploadId))
+	assertNotExist(t, s.store, upload.ChunkKey(session.UploadId, 0))
+	if len(repo.uploads) != 0 {
+		t.Errorf("不应该写入上传记录, 记录数 %d", len(repo.uploads))
+	}
+
+	// 类型由写入的内容决定
+	content = []byte("plain text file")
+	session = uploadChunks(t, s, ctx, sha256Hex(content), content)
+	file, err := s.CompleteUploadSession(session.UploadId, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj, err := s.store.Stat(ctx, file.FileKey); err != nil || obj.Size != int64(len(content)) {
+		t.Errorf("写入的文件 %v err = %v", obj, err)
+	}
+}
+
+// signedQuery 取出签名下载地址中的参数
+func signedQuery(t *testing.T, res *model.UploadSignRes) (id uint, expires, nonce, signature string) {
+	t.Helper()
+	u, err := url.Parse(res.Url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := strconv.Atoi(u.Path[strings.LastIndex(u.Path, "/")+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	return uint(n), q.Get("expires"), q.Get("nonce"), q.Get("signature")
+}
+
+func newPrivateUpload(repo *fakeUploadRepo) uint {
+	_ = repo.CreateUpload(&model.Upload{UID: "u1", FileName: "a.txt", Visibility: model.VisibilityPrivate}, 0)
+	return uint(len(repo.uploads))
+}
+
+func TestSignedDownload(t *testing.T) {
+	s, repo, _ := newTestUploadService(t)
+	id := newPrivateUpload(repo)
+	other := newPrivateUpload(repo)
+
+	// 只能给自己有权下载的文件签名
+	if _, err := s.SignURL(&model.UploadSignReq{ID: id}, newTestContext("u2")); !errors.Is(err, ErrUploadForbidden) {
+		t.Fatalf("给别人的私有文件签名 err = %v", err)
+	}
+	res, err := s.SignURL(&model.UploadSignReq{ID: id, Expire: 60}, newTestContext("u1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sid, expires, nonce, signature := signedQuery(t, res)
+	if sid != id || nonce != "" {
+		t.Fatalf("签名地址 id = %d nonce = %q", sid, nonce)
+	}
+
+	// 不需要登录
+	file, err := s.GetSignedDownload(id, expires, "", signature, newTestContext(""))
+	if err != nil || file.ID != id {
+		t.Fatalf("签名下载 file = %v err = %v", file, err)
+	}
+	// 普通地址有效期内可以重复使用
+	if _, err = s.GetSignedDownload(id, expires, "", signature, newTestContext("")); err != nil {
+		t.Fatalf("重复使用 err = %v", err)
+	}
+
+	later := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	past := strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10)
+	tests := []struct {
+		name      string
+		id        uint
+		expires   string
+		nonce     string
+		signature string
+	}{
+		{"篡改文件ID", other, expires, "", signature},
+		{"延长有效期", id, later, "", signature},
+		{"有效期不是数字", id, "abc", "", signature},
+		{"签名错误", id, expires, "", strings.Repeat("0", len(signature))},
+		{"空签名", id, expires, "", ""},
+		{"添加随机数", id, expires, "x", signature},
+		// 签名正确但已经过期
+		{"已过期", id, past, "", s.sign(id, past, "")},
+	}
+	for _, tt := range tests {
+		if _, err = s.GetSignedDownload(tt.id, tt.expires, tt.nonce, tt.signature, newTestContext("")); !errors.Is(err, ErrUploadForbidden) {
+			t.Errorf("%s: err = %v, 期望 ErrUploadForbidden", tt.name, err)
+		}
+	}
+}
+
+func TestSignedDownloadOnce(t *testing.T) {
+	s, repo, _ := newTestUploadService(t)
+	id := newPrivateUpload(repo)
+	res, err := s.SignURL(&model.UploadSignReq{ID: id, Once: true}, newTestContext("u1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, expires, nonce, signature := signedQuery(t, res)
+	if nonce == "" {
+		t.Fatal("一次性地址缺少 nonce")
+	}
+	head := func() *gin.Context {
+		ctx := newTestContext("")
+		ctx.Request.Method = http.MethodHead
+		return ctx
+	}
+
+	// 去掉 nonce 当作普通地址使用时签名不匹配
+	if _, err = s.GetSignedDownload(id, expires, "", signature, newTestContext("")); !errors.Is(err, ErrUploadForbidden) {
+		t.Errorf("去掉 nonce err = %v", err)
+	}
+	// HEAD 请求不消耗随机数
+	for i := 0; i < 2; i++ {
+		if _, err = s.GetSignedDownload(id, expires, nonce, signature, head()); err != nil {
+			t.Fatalf("HEAD 第 %d 次 err = %v", i+1, err)
+		}
+	}
+	if _, err = s.GetSignedDownload(id, expires, nonce, signature, newTestContext("")); err != nil {
+		t.Fatalf("第一次下载 err = %v", err)
+	}
+	// 使用过之后 GET 和 HEAD 都失效
+	if _, err = s.GetSignedDownload(id, expires, nonce, signature, newTestContext("")); !errors.Is(err, ErrUploadForbidden) {
+		t.Errorf("第二次下载 err = %v", err)
+	}
+	if _, err = s.GetSignedDownload(id, expires, nonce, signature, head()); !errors.Is(err, ErrUploadForbidden) {
+		t.Errorf("使用后 HEAD err = %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package log
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var _ Logger = (*jsonLogger)(nil)
+
+// jsonLogger writes one JSON object per line. Keys keep the order in which
+// they were passed, with the level always first.
+type jsonLogger struct {
+	w    io.Writer
+	mu   sync.Mutex
+	pool *sync.Pool
+}
+
+// NewJSONLogger new a logger that writes JSON lines to w.
+func NewJSONLogger(w io.Writer) Logger {
+	return &jsonLogger{
+		w: w,
+		pool: &sync.Pool{
+			New: func() interface{} {
+				return new(bytes.Buffer)
+			},
+		},
+	}
+}
+
+// Log print the kv pairs log as a JSON object.
+func (l *jsonLogger) Log(level Level, keyvals ...interface{}) error {
+	if len(keyvals) == 0 {
+		return nil
+	}
+	if (len(keyvals) & 1) == 1 {
+		keyvals = append(keyvals, "KEYVALS UNPAIRED")
+	}
+
+	buf := l.pool.Get().(*bytes.Buffer)
+	defer l.pool.Put(buf)
+	defer buf.Reset()
+
+	buf.WriteString(`{"level":`)
+	writeJSONValue(buf, level.String())
+	for i := 0; i < len(keyvals); i += 2 {
+		buf.WriteByte(',')
+		writeJSONValue(buf, fmt.Sprint(keyvals[i]))
+		buf.WriteByte(':')
+		writeJSONValue(buf, jsonValue(keyvals[i+1]))
+	}
+	buf.WriteString("}\n")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := l.w.Write(buf.Bytes())
+	return err
+}
+
+func (l *jsonLogger) Close() error {
+	return nil
+}
+
+// jsonValue converts values that would otherwise marshal to an empty object,
+// such as errors, into their text form.
+func jsonValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case json.Marshaler:
+		return t
+	case encoding.TextMarshaler:
+		return t
+	case error:
+		return t.Error()
+	case fmt.Stringer:
+		return t.String()
+	}
+	return v
+}
+
+func writeJSONValue(buf *bytes.Buffer, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprintf("%+v", v))
+	}
+	buf.Write(b)
+}
@@ -0,0 +1,33 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestJSONLogger(t *testing.T) {
+	var b bytes.Buffer
+	logger := NewJSONLogger(&b)
+
+	_ = logger.Log(LevelInfo, "msg", "a", "k", 1, "err", errors.New("boom"), "nil", nil)
+	_ = logger.Log(LevelWarn, "msg", `quote " and
+newline`)
+	_ = logger.Log(LevelDebug, "singular")
+	_ = logger.Log(LevelDebug)
+
+	want := `{"level":"INFO","msg":"a","k":1,"err":"boom","nil":null}
+{"level":"WARN","msg":"quote \" and\nnewline"}
+{"level":"DEBUG","singular":"KEYVALS UNPAIRED"}
+`
+	if s := b.String(); s != want {
+		t.Fatalf("log not match: %q", s)
+	}
+
+	for _, line := range bytes.Split(bytes.TrimSpace(b.Bytes()), []byte("\n")) {
+		if !json.Valid(line) {
+			t.Errorf("invalid json line: %s", line)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package log
 
 import (
 	"context"
+	"path"
 	"runtime"
 	"strconv"
 	"strings"
@@ -10,7 +11,7 @@ import (
 
 var (
 	// DefaultCaller is a Valuer that returns the file and line.
-	DefaultCaller = Caller(4)
+	DefaultCaller = Caller(3)
 
 	// DefaultTimestamp is a Valuer that returns the current wallclock time.
 	DefaultTimestamp = Timestamp(time.RFC3339)
@@ -27,10 +28,19 @@ func Value(ctx context.Context, v interface{}) interface{} {
 	return v
 }
 
+// logDir is the directory of this package's source files.
+var logDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return path.Dir(file)
+}()
+
 // Caller returns a Valuer that returns a pkg/file:line description of the caller.
+// Starting at depth, frames inside this package (Helper, Filter, the global
+// functions and so on) are skipped, so the result is the same however the
+// logger is wrapped.
 func Caller(depth int) Valuer {
 	return func(context.Context) interface{} {
-		_, file, line, _ := runtime.Caller(depth)
+		file, line := callerFrame(depth + 1)
 		idx := strings.LastIndexByte(file, '/')
 		if idx == -1 {
 			return file[idx+1:] + ":" + strconv.Itoa(line)
@@ -40,6 +50,20 @@ func Caller(depth int) Valuer {
 	}
 }
 
+func callerFrame(skip int) (string, int) {
+	pcs := make([]uintptr, 16)
+	n := runtime.Callers(skip+1, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var frame runtime.Frame
+	for more := n > 0; more; {
+		frame, more = frames.Next()
+		if path.Dir(frame.File) != logDir || strings.HasSuffix(frame.File, "_test.go") {
+			break
+		}
+	}
+	return frame.File, frame.Line
+}
+
 // Timestamp returns a timestamp Valuer with a custom time format.
 func Timestamp(layout string) Valuer {
 	return func(context.Context) interface{} {
@@ -1,7 +1,11 @@
 package log
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -28,3 +32,24 @@ func TestValue(t *testing.T) {
 		t.Errorf("Value() = %v, want %v", res, 3)
 	}
 }
+
+func TestDefaultCaller(t *testing.T) {
+	var b bytes.Buffer
+	logger := With(NewStdLogger(&b), "caller", DefaultCaller)
+
+	_, _, line, _ := runtime.Caller(0)
+	_ = logger.Log(LevelInfo, "msg", "direct")
+	NewHelper(logger).Info("helper")
+	NewHelper(NewFilter(logger, FilterLevel(LevelInfo))).Info("filter")
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("unexpected output: %q", b.String())
+	}
+	for i, l := range lines {
+		want := fmt.Sprintf("caller=log/value_test.go:%d ", line+i+1)
+		if !strings.Contains(l, want) {
+			t.Errorf("line %d = %q, want %q", i, l, want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package log
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var _ Logger = (*zapLogger)(nil)
+
+// zapLogger adapts a *zap.Logger to Logger. The value of DefaultMessageKey
+// becomes the zap message, the remaining pairs become fields.
+type zapLogger struct {
+	log    *zap.Logger
+	msgKey string
+}
+
+// NewZapLogger new a logger backed by zap.
+func NewZapLogger(zl *zap.Logger) Logger {
+	return &zapLogger{log: zl, msgKey: DefaultMessageKey}
+}
+
+// ZapLevel converts a Level to the matching zapcore.Level.
+func ZapLevel(level Level) zapcore.Level {
+	switch level {
+	case LevelDebug:
+		return zapcore.DebugLevel
+	case LevelInfo:
+		return zapcore.InfoLevel
+	case LevelWarn:
+		return zapcore.WarnLevel
+	case LevelError:
+		return zapcore.ErrorLevel
+	case LevelFatal:
+		return zapcore.FatalLevel
+	}
+	return zapcore.InfoLevel
+}
+
+// Log print the kv pairs log through zap.
+func (l *zapLogger) Log(level Level, keyvals ...interface{}) error {
+	if len(keyvals) == 0 {
+		return nil
+	}
+	if (len(keyvals) & 1) == 1 {
+		keyvals = append(keyvals, "KEYVALS UNPAIRED")
+	}
+
+	var msg string
+	fields := make([]zap.Field, 0, len(keyvals)/2)
+	for i := 0; i < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		if key == l.msgKey {
+			msg = fmt.Sprint(keyvals[i+1])
+			continue
+		}
+		fields = append(fields, zap.Any(key, keyvals[i+1]))
+	}
+
+	if ce := l.log.Check(ZapLevel(level), msg); ce != nil {
+		ce.Write(fields...)
+	}
+	return nil
+}
+
+// Sync flushes any buffered log entries.
+func (l *zapLogger) Sync() error {
+	return l.log.Sync()
+}
+
+func (l *zapLogger) Close() error {
+	return l.Sync()
+}
@@ -0,0 +1,46 @@
+package log
+
+import (
+	"bytes"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestZapLogger(t *testing.T) {
+	var b bytes.Buffer
+	encoder := zap.NewProductionEncoderConfig()
+	encoder.TimeKey = ""
+	zl := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(encoder), zapcore.AddSync(&b), zapcore.InfoLevel))
+	logger := NewZapLogger(zl)
+
+	_ = logger.Log(LevelDebug, "msg", "skipped")
+	_ = logger.Log(LevelInfo, "msg", "hello", "k", "v")
+	_ = logger.Log(LevelError, "k", 1)
+
+	want := `{"level":"info","msg":"hello","k":"v"}
+{"level":"error","msg":"","k":1}
+`
+	if s := b.String(); s != want {
+		t.Fatalf("log not match: %q", s)
+	}
+}
+
+func TestZapLevel(t *testing.T) {
+	tests := []struct {
+		level Level
+		want  zapcore.Level
+	}{
+		{LevelDebug, zapcore.DebugLevel},
+		{LevelInfo, zapcore.InfoLevel},
+		{LevelWarn, zapcore.WarnLevel},
+		{LevelError, zapcore.ErrorLevel},
+		{LevelFatal, zapcore.FatalLevel},
+	}
+	for _, tt := range tests {
+		if got := ZapLevel(tt.level); got != tt.want {
+			t.Errorf("ZapLevel(%v) = %v, want %v", tt.level, got, tt.want)
+		}
+	}
+}
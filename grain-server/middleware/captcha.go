@@ -0,0 +1,74 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-grain/grain/config"
+	captchax "github.com/go-grain/grain/pkg/captcha"
+	redisx "github.com/go-grain/grain/pkg/redis"
+	"github.com/go-grain/grain/pkg/response"
+	consts "github.com/go-grain/grain/utils/const"
+)
+
+// Captcha 对 config.Captcha.Routes 中配置的接口强制校验图形/滑块验证码,
+// 可以携带 /captcha/verify 签发的一次性凭证 X-Captcha-Ticket,
+// 也可以直接携带验证码ID和答案 X-Captcha-Id X-Captcha-Answer
+func Captcha(rdb redisx.IRedis) gin.HandlerFunc {
+	conf := config.GetConfig()
+	store := captchax.NewStore(rdb, conf.Captcha.Expire, conf.Captcha.Slider.Tolerance)
+	return func(ctx *gin.Context) {
+		if !conf.Captcha.Enable || !routeMatched(conf.Captcha.Routes, ctx.Request.Method, ctx.FullPath()) {
+			ctx.Next()
+			return
+		}
+
+		if store.ConsumeTicket(ctx, captchaParam(ctx, "X-Captcha-Ticket", "captchaTicket")) ||
+			store.Verify(ctx, captchaParam(ctx, "X-Captcha-Id", "captchaId"), captchaParam(ctx, "X-Captcha-Answer", "captchaAnswer")) {
+			ctx.Next()
+			return
+		}
+
+		reply := response.Response{}
+		reply.WithCode(consts.VerifyCaptchaFail).WithMessage("请先完成人机验证").Fail(ctx)
+		ctx.Abort()
+	}
+}
+
+func routeMatched(routes []string, method, path string) bool {
+	if path == "" {
+		return false
+	}
+	for _, route := range routes {
+		m, p, ok := strings.Cut(strings.TrimSpace(route), " ")
+		if !ok {
+			// 没有写请求方法的视为所有方法都需要校验
+			m, p = "", m
+		}
+		if (m == "" || strings.EqualFold(m, method)) && strings.TrimSpace(p) == path {
+			return true
+		}
+	}
+	return false
+}
+
+func captchaParam(ctx *gin.Context, header, query string) string {
+	if v := ctx.GetHeader(header); v != "" {
+		return v
+	}
+	return ctx.Query(query)
+}
@@ -17,15 +17,19 @@ package middleware
 import (
 	"github.com/casbin/casbin/v2"
 	"github.com/gin-gonic/gin"
+	metricsx "github.com/go-grain/grain/pkg/metrics"
 	"github.com/go-grain/grain/pkg/response"
 	"net/http"
+	"time"
 )
 
 func Casbin(enforcer *casbin.CachedEnforcer) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		reply := response.Response{}
 		// 权限验证
+		start := time.Now()
 		enforce, err := enforcer.Enforce(ctx.GetString("role"), ctx.Request.URL.Path, ctx.Request.Method)
+		metricsx.CasbinEnforceDuration.WithLabelValues(enforceResult(enforce, err)).Observe(time.Since(start).Seconds())
 		if err != nil {
 			reply.WithCode(http.StatusInternalServerError).WithMessage(err.Error()).Fail(ctx)
 			ctx.Abort()
@@ -39,3 +43,14 @@ func Casbin(enforcer *casbin.CachedEnforcer) gin.HandlerFunc {
 		ctx.Next()
 	}
 }
+
+func enforceResult(allow bool, err error) string {
+	switch {
+	case err != nil:
+		return "error"
+	case allow:
+		return "allow"
+	default:
+		return "deny"
+	}
+}
@@ -24,17 +24,41 @@ import (
 	jwtx "github.com/go-grain/grain/pkg/jwt"
 	redisx "github.com/go-grain/grain/pkg/redis"
 	"github.com/go-grain/grain/pkg/response"
+	wsx "github.com/go-grain/grain/pkg/websocket"
 	consts "github.com/go-grain/grain/utils/const"
+	"github.com/gorilla/websocket"
 	"net/http"
 	"time"
 )
 
 func JwtAuth(rdb redisx.IRedis) gin.HandlerFunc {
+	return jwtAuth(rdb, func(ctx *gin.Context) string {
+		return ctx.GetHeader("G-Token")
+	})
+}
+
+// WsJwtAuth WebSocket 握手鉴权, 浏览器无法设置请求头,
+// 令牌放在 query 参数 token 中, 或者作为子协议跟在 wsx.Protocol 之后
+func WsJwtAuth(rdb redisx.IRedis) gin.HandlerFunc {
+	return jwtAuth(rdb, func(ctx *gin.Context) string {
+		if token := ctx.Query("token"); token != "" {
+			return token
+		}
+		for _, protocol := range websocket.Subprotocols(ctx.Request) {
+			if protocol != wsx.Protocol {
+				return protocol
+			}
+		}
+		return ""
+	})
+}
+
+func jwtAuth(rdb redisx.IRedis, getToken func(ctx *gin.Context) string) gin.HandlerFunc {
 	conf := config.GetConfig()
 	return func(ctx *gin.Context) {
 		reply := response.Response{}
 		jwt := jwtx.Jwt{}
-		tokenString := ctx.GetHeader("G-Token")
+		tokenString := getToken(ctx)
 		tokenClaims, err := jwt.ParseToken(tokenString, conf.JWT.SecretKey)
 		if err != nil {
 			reply.WithCode(http.StatusUnauthorized).WithMessage(err.Error()).Fail(ctx)
@@ -42,7 +66,7 @@ func JwtAuth(rdb redisx.IRedis) gin.HandlerFunc {
 			return
 		}
 
-		black, _ := rdb.GetInt(fmt.Sprintf("%s%s", consts.TokenBlack, encrypt.MD5(tokenString)))
+		black, _ := rdb.GetInt(ctx, fmt.Sprintf("%s%s", consts.TokenBlack, encrypt.MD5(tokenString)))
 		switch black {
 		case 120:
 			reply.WithCode(http.StatusUnauthorized).WithMessage("账号进入黑名单列表,无法在继续为您服务").Fail(ctx)
@@ -59,9 +83,9 @@ func JwtAuth(rdb redisx.IRedis) gin.HandlerFunc {
 		}
 		//获取用户信息
 		sysUser := &model.SysUser{}
-		if err = rdb.GetObject(consts.UserInfo+tokenClaims.Uid, sysUser); err != nil {
+		if err = rdb.GetObject(ctx, consts.UserInfo+tokenClaims.Uid, sysUser); err != nil {
 			sysUser, err = query.Q.SysUser.Where(query.SysUser.UID.Eq(tokenClaims.Uid)).First()
-			_ = rdb.SetObject(consts.UserInfo+tokenClaims.Uid, sysUser, 180)
+			_ = rdb.SetObject(ctx, consts.UserInfo+tokenClaims.Uid, sysUser, 3*time.Minute)
 		}
 
 		//把用户相关信息都塞到ctx去,方便下游使用
@@ -79,37 +103,3 @@ func JwtAuth(rdb redisx.IRedis) gin.HandlerFunc {
 		ctx.Next()
 	}
 }
-
-func SwitchRole(rdb redisx.IRedis) gin.HandlerFunc {
-	conf := config.GetConfig()
-	return func(ctx *gin.Context) {
-		reply := response.Response{}
-		role := ctx.Query("role")
-		if role == "" {
-			reply.WithCode(500).WithMessage("角色ID不能为空").Fail(ctx)
-			ctx.Abort()
-			return
-		}
-		if role == ctx.GetString("role") {
-			reply.WithCode(500).WithMessage("当前已是该角色,无须切换").Fail(ctx)
-			ctx.Abort()
-			return
-		}
-		sysUser := &model.SysUser{}
-		if err := rdb.GetObject(ctx.GetString("uid"), sysUser); err != nil {
-			sysUser, err = query.Q.SysUser.Where(query.SysUser.UID.Eq(ctx.GetString("uid"))).First()
-			_ = rdb.SetObject(ctx.GetString("uid"), sysUser, 180)
-		}
-		for _, s := range *sysUser.Roles {
-			if s == role {
-				jwt := jwtx.Jwt{}
-				token, _ := jwt.GenerateToken(ctx.GetString("uid"), role, conf.JWT.SecretKey, conf.JWT.ExpirationSeconds)
-				reply.WithMessage("切换角色成功").WithData(gin.H{"token": token}).Success(ctx)
-				ctx.Abort()
-				break
-			}
-		}
-		ctx.Abort()
-		return
-	}
-}
@@ -0,0 +1,50 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	metricsx "github.com/go-grain/grain/pkg/metrics"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Metrics 按路由模板统计请求数和耗时, 未匹配到路由的请求统一记为 unmatched, 避免路径参数撑爆标签
+func Metrics() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := metricsMethod(ctx.Request.Method)
+		status := strconv.Itoa(ctx.Writer.Status())
+		metricsx.HTTPRequests.WithLabelValues(method, route, status).Inc()
+		metricsx.HTTPDuration.WithLabelValues(method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// metricsMethod 请求方法由客户端任意填写, 标准方法以外的统一记为 other, 和 promhttp 的处理一致
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
@@ -0,0 +1,94 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-grain/grain/config"
+	redisx "github.com/go-grain/grain/pkg/redis"
+	"github.com/go-grain/grain/pkg/response"
+	consts "github.com/go-grain/grain/utils/const"
+)
+
+// RateLimit 按 config.RateLimit.Groups[group] 的规则对路由分组限流,
+// 响应头中返回 RateLimit-Limit RateLimit-Remaining RateLimit-Reset,
+// 被拒绝时额外返回 Retry-After, Redis 不可用时直接放行
+func RateLimit(rdb redisx.IRedis, group string) gin.HandlerFunc {
+	conf := config.GetConfig()
+	return func(ctx *gin.Context) {
+		rule, ok := conf.RateLimit.Groups[group]
+		if !conf.RateLimit.Enable || !ok || rule.Limit <= 0 || rule.Window <= 0 {
+			ctx.Next()
+			return
+		}
+		if len(rule.Routes) > 0 && !routeMatched(rule.Routes, ctx.Request.Method, ctx.FullPath()) {
+			ctx.Next()
+			return
+		}
+
+		var limiter redisx.Limiter
+		if rule.Algorithm == "token_bucket" {
+			limiter = redisx.NewTokenBucket(rdb, rule.Limit, rule.Window)
+		} else {
+			limiter = redisx.NewSlidingWindow(rdb, rule.Limit, rule.Window)
+		}
+
+		result, err := limiter.Allow(ctx, rateLimitKey(ctx, group, rule.KeyBy, conf.RateLimit.ApiKeyHeader))
+		if err != nil {
+			ctx.Next()
+			return
+		}
+
+		ctx.Header("RateLimit-Limit", strconv.FormatInt(result.Limit, 10))
+		ctx.Header("RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+		ctx.Header("RateLimit-Reset", ceilSeconds(result.ResetAfter))
+		if result.Allowed {
+			ctx.Next()
+			return
+		}
+
+		ctx.Header("Retry-After", ceilSeconds(result.RetryAfter))
+		reply := response.Response{}
+		reply.WithCode(consts.TooManyRequests).WithMessage("请求过于频繁, 请稍后再试").Fail(ctx)
+		ctx.Abort()
+	}
+}
+
+func rateLimitKey(ctx *gin.Context, group, keyBy, apiKeyHeader string) string {
+	switch keyBy {
+	case "uid", "role":
+		// uid role 由 JwtAuth 写入, 需要把限流中间件放在 JwtAuth 之后
+		if v := ctx.GetString(keyBy); v != "" {
+			return fmt.Sprintf("rateLimit:%s:%s:%s", group, keyBy, v)
+		}
+	case "api_key":
+		if apiKeyHeader == "" {
+			apiKeyHeader = "X-Api-Key"
+		}
+		if v := ctx.GetHeader(apiKeyHeader); v != "" {
+			return fmt.Sprintf("rateLimit:%s:%s:%s", group, keyBy, v)
+		}
+	}
+	return fmt.Sprintf("rateLimit:%s:ip:%s", group, ctx.ClientIP())
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
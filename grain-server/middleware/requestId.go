@@ -0,0 +1,37 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	tracex "github.com/go-grain/grain/pkg/trace"
+)
+
+// RequestID 沿用或生成 X-Request-ID 和 W3C traceparent, 同时放进 gin.Context 和 Request.Context,
+// 并通过响应头回传给调用方, 需要挂在所有中间件的最前面
+func RequestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		t := tracex.New(ctx.GetHeader(tracex.HeaderRequestID), ctx.GetHeader(tracex.HeaderTraceparent))
+
+		ctx.Set(tracex.RequestIDKey, t.RequestID)
+		ctx.Set(tracex.TraceIDKey, t.TraceID)
+		ctx.Set(tracex.SpanIDKey, t.SpanID)
+		ctx.Request = ctx.Request.WithContext(tracex.NewContext(ctx.Request.Context(), t))
+
+		ctx.Header(tracex.HeaderRequestID, t.RequestID)
+		ctx.Header(tracex.HeaderTraceparent, t.Traceparent())
+		ctx.Next()
+	}
+}
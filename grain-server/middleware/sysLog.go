@@ -0,0 +1,72 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	model "github.com/go-grain/grain/model/system"
+	"github.com/go-grain/grain/pkg/response"
+	tracex "github.com/go-grain/grain/pkg/trace"
+	"net/http"
+	"time"
+)
+
+// SysLogRecorder 保存操作日志
+type SysLogRecorder interface {
+	Record(sysLog *model.SysLog)
+}
+
+// SysLog 记录操作日志, 登录以及登录之后修改数据的请求都会记录, 查询类请求不记录.
+// 请求和响应内容中可能有密码等敏感信息, 只记录请求路径和响应 code, 通过请求ID关联访问日志和业务日志
+func SysLog(recorder SysLogRecorder) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		requestAt := time.Now()
+		ctx.Next()
+
+		logType := ctx.GetString("LogType")
+		uid := ctx.GetString("uid")
+		switch ctx.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			if logType == "" {
+				return
+			}
+		}
+		if logType == "" && uid == "" {
+			return
+		}
+
+		responseAt := time.Now()
+		recorder.Record(&model.SysLog{
+			UID:          uid,
+			Name:         ctx.FullPath(),
+			Role:         ctx.GetString("role"),
+			Username:     ctx.GetString("username"),
+			Nickname:     ctx.GetString("nickname"),
+			Method:       ctx.Request.Method,
+			Path:         ctx.Request.URL.Path,
+			ResCode:      ctx.GetInt(response.CodeKey),
+			ClientIP:     ctx.ClientIP(),
+			RequestAt:    requestAt,
+			ResponseAt:   responseAt,
+			Latency:      responseAt.Sub(requestAt).Milliseconds(),
+			ErrorMessage: ctx.Errors.String(),
+			StatusCode:   ctx.Writer.Status(),
+			BodySize:     ctx.Writer.Size(),
+			RequestID:    tracex.RequestID(ctx),
+			TraceID:      tracex.TraceID(ctx),
+			LogType:      logType,
+		})
+	}
+}
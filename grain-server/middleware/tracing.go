@@ -0,0 +1,91 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	telemetryx "github.com/go-grain/grain/pkg/telemetry"
+	tracex "github.com/go-grain/grain/pkg/trace"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+// Tracing 为每个请求创建 OpenTelemetry server span, 需要挂在 RequestID 之后
+//
+// span 有效时用它的 trace ID、span ID 覆盖 RequestID 中间件生成的值, 保证响应、日志和导出的链路一致;
+// 未启用链路追踪时 span 是 no-op, 保留 RequestID 中间件的结果
+func Tracing() gin.HandlerFunc {
+	tracer := telemetryx.Tracer()
+	return func(ctx *gin.Context) {
+		parent := otel.GetTextMapPropagator().Extract(ctx.Request.Context(), propagation.HeaderCarrier(ctx.Request.Header))
+
+		route := ctx.FullPath()
+		name := ctx.Request.Method
+		if route != "" {
+			name += " " + route
+		}
+		spanCtx, span := tracer.Start(parent, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(ctx.Request.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(ctx.Request.URL.Path),
+				semconv.ClientAddress(ctx.ClientIP()),
+				semconv.UserAgentOriginal(ctx.Request.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		if sc := span.SpanContext(); sc.IsValid() {
+			t, _ := tracex.FromContext(ctx.Request.Context())
+			// 客户端没有传 X-Request-ID 时请求ID取的是 trace ID, 跟着一起替换
+			if t.RequestID == "" || t.RequestID == t.TraceID {
+				t.RequestID = sc.TraceID().String()
+			}
+			t.TraceID = sc.TraceID().String()
+			t.SpanID = sc.SpanID().String()
+			t.Sampled = sc.IsSampled()
+			if psc := trace.SpanContextFromContext(parent); psc.IsValid() {
+				t.ParentID = psc.SpanID().String()
+			}
+			spanCtx = tracex.NewContext(spanCtx, t)
+
+			ctx.Set(tracex.RequestIDKey, t.RequestID)
+			ctx.Set(tracex.TraceIDKey, t.TraceID)
+			ctx.Set(tracex.SpanIDKey, t.SpanID)
+			ctx.Header(tracex.HeaderRequestID, t.RequestID)
+			ctx.Header(tracex.HeaderTraceparent, t.Traceparent())
+		}
+		ctx.Request = ctx.Request.WithContext(spanCtx)
+
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if uid := ctx.GetString(tracex.UIDKey); uid != "" {
+			span.SetAttributes(semconv.EnduserID(uid), semconv.EnduserRole(ctx.GetString(tracex.RoleKey)))
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		if len(ctx.Errors) > 0 {
+			span.SetStatus(codes.Error, ctx.Errors.String())
+		}
+	}
+}
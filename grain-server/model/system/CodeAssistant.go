@@ -58,6 +58,7 @@ type Models struct {
 	Nickname          string    `form:"nickname" json:"nickname"`
 	QueryTime         string    `json:"queryTime"  gorm:"comment:时间范围查询"`
 	IsInit            string    `json:"isInit" gorm:"default:no;comment:是否已初始化"`
+	Audit             string    `json:"audit" gorm:"default:no;comment:是否开启字段级审计"`
 	DatabaseName      string    `json:"databaseName"  gorm:"comment:用什么数据库 MySQL MongoDB?"`
 	ToLowerStructName string    `json:"toLowerStructName"  gorm:"-"`
 	ProjectName       string    `json:"projectName" gorm:"-"`
@@ -79,6 +80,7 @@ type CreateModels struct {
 	DatabaseName string `json:"databaseName"  gorm:"comment:用什么数据库 MySQL MongoDB?"`
 	Description  string `json:"description" gorm:"description:描述"`
 	QueryTime    string `json:"queryTime"  gorm:"comment:时间范围查询"`
+	Audit        string `json:"audit" gorm:"comment:是否开启字段级审计"`
 }
 
 type Fields struct {
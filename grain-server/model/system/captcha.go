@@ -23,3 +23,31 @@ type Email struct {
 type Mobile struct {
 	Mobile string `json:"mobile"`
 }
+
+// ImageCaptcha 数字图形验证码
+type ImageCaptcha struct {
+	CaptchaId string `json:"captchaId"`
+	// base64 格式的图片
+	Image string `json:"image"`
+}
+
+// SliderCaptcha 滑块验证码, 前端按 Y 坐标放置拼图块, 用户拖动后提交 X 坐标
+type SliderCaptcha struct {
+	CaptchaId  string `json:"captchaId"`
+	Background string `json:"background"`
+	Piece      string `json:"piece"`
+	Y          int    `json:"y"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+}
+
+// VerifyCaptchaReq 校验图形/滑块验证码, 滑块验证码的 Answer 为拼图块的 X 坐标
+type VerifyCaptchaReq struct {
+	CaptchaId string `json:"captchaId" binding:"required"`
+	Answer    string `json:"answer" binding:"required"`
+}
+
+// CaptchaTicket 校验通过后签发的一次性凭证
+type CaptchaTicket struct {
+	Ticket string `json:"ticket"`
+}
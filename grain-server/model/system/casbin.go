@@ -34,6 +34,11 @@ func (CasbinRule) TableName() string {
 	return "casbin_rule"
 }
 
+// Audited 开启字段级变更审计
+func (CasbinRule) Audited() bool {
+	return true
+}
+
 // CasbinReq 用于返回xx角色能操作的的所有资源
 type CasbinReq struct {
 	Role string `json:"role"`
@@ -13,6 +13,11 @@ func (Organize) TableName() string {
 	return "organize"
 }
 
+// Audited 开启字段级变更审计
+func (Organize) Audited() bool {
+	return true
+}
+
 type CreateOrganize struct {
 	ParentId uint   `form:"parentId" json:"parentId" gorm:"comment:父ID"`
 	Name     string `form:"name" json:"name" binding:"required" gorm:"comment:组织或部门名称"`
@@ -34,6 +34,11 @@ func (SysApi) TableName() string {
 	return "sys_apis"
 }
 
+// Audited 开启字段级变更审计
+func (SysApi) Audited() bool {
+	return true
+}
+
 // ApiGroup 用户返回给前端使用的结构体
 // 一般只在设置casbin权限时候才使用该结构体组装数据提供给前端使用
 type ApiGroup struct {
@@ -0,0 +1,76 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+// Auditable 实现了该接口的模型在创建、更新、删除时会被记录字段级审计日志
+type Auditable interface {
+	Audited() bool
+}
+
+// AuditRedactor 模型除默认的密码、密钥、令牌之外还需要脱敏的字段(数据库列名),
+// 这些字段只记录是否发生了变化, 快照中保存为 AuditRedacted
+type AuditRedactor interface {
+	AuditRedact() []string
+}
+
+// AuditRedacted 脱敏字段在审计快照中的值
+const AuditRedacted = "***"
+
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// SysAudit 字段级变更审计记录
+type SysAudit struct {
+	Model
+	// 实体对应的数据表名称
+	Entity string `json:"entity" gorm:"index:idx_audit_record;comment:数据表"`
+	// 被修改记录的主键
+	RecordID string `json:"recordId" gorm:"index:idx_audit_record;comment:记录主键"`
+	// 操作类型 create update delete
+	Action string `json:"action" gorm:"comment:操作类型"`
+	// 操作人UID
+	UID string `json:"uid" gorm:"index;comment:操作人"`
+	// 请求ID
+	RequestID string `json:"requestId" gorm:"index;comment:请求ID"`
+	// 修改前快照
+	Before string `json:"before" gorm:"type:text;comment:修改前"`
+	// 修改后快照
+	After string `json:"after" gorm:"type:text;comment:修改后"`
+	// 发生变化的字段
+	Diff string `json:"diff" gorm:"type:text;comment:变更字段"`
+}
+
+func (SysAudit) TableName() string {
+	return "sys_audits"
+}
+
+// AuditDiff 单个字段的变更
+type AuditDiff struct {
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+type SysAuditReq struct {
+	PageReq
+	Entity    string `form:"entity" json:"entity"`
+	RecordID  string `form:"recordId" json:"recordId"`
+	Actor     string `form:"actor" json:"actor"`
+	Action    string `form:"action" json:"action"`
+	QueryTime string `form:"queryTime" json:"queryTime"`
+}
@@ -0,0 +1,78 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "time"
+
+// SysJob 定时任务, 任务本身在代码中注册, 这里只保存启用状态, 启动时同步表达式以及说明
+type SysJob struct {
+	Model
+	Name        string `json:"name" gorm:"uniqueIndex;size:64;comment:任务名称"`
+	Spec        string `json:"spec" gorm:"comment:cron 表达式"`
+	Description string `json:"description" gorm:"comment:任务说明"`
+	Enabled     bool   `json:"enabled" gorm:"comment:是否启用"`
+}
+
+func (SysJob) TableName() string {
+	return "sys_job"
+}
+
+// SysJobLog 定时任务执行记录
+type SysJobLog struct {
+	Model
+	JobName string `json:"jobName" gorm:"index;size:64;comment:任务名称"`
+	// schedule 定时触发, manual 手动执行
+	Trigger string `json:"trigger" gorm:"comment:触发方式"`
+	// 执行任务的实例
+	Host    string    `json:"host" gorm:"comment:实例"`
+	StartAt time.Time `json:"startAt" gorm:"index;comment:开始时间"`
+	EndAt   time.Time `json:"endAt" gorm:"comment:结束时间"`
+	// 耗时, 单位毫秒
+	Duration int64 `json:"duration" gorm:"comment:耗时"`
+	// success 成功, failed 失败, timeout 超时, canceled 程序退出时被取消
+	Status string `json:"status" gorm:"comment:执行结果"`
+	Output string `json:"output" gorm:"type:text;comment:输出"`
+	Error  string `json:"error" gorm:"type:text;comment:错误信息"`
+}
+
+func (SysJobLog) TableName() string {
+	return "sys_job_log"
+}
+
+// SysJobInfo 任务列表, 包含本实例上的调度状态
+type SysJobInfo struct {
+	Name        string `json:"name"`
+	Spec        string `json:"spec"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+	// 超时时间, 单位秒
+	Timeout int64 `json:"timeout"`
+	// 是否正在本实例上执行
+	Running bool      `json:"running"`
+	Next    time.Time `json:"next"`
+	// 最近一次执行记录, 来自执行记录表, 没有执行过时为空
+	LastRun *SysJobLog `json:"lastRun"`
+}
+
+type SysJobReq struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type SysJobLogReq struct {
+	PageReq
+	JobName string `form:"jobName" json:"jobName"`
+	Status  string `form:"status" json:"status"`
+	Trigger string `form:"trigger" json:"trigger"`
+}
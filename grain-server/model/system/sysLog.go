@@ -63,6 +63,10 @@ type SysLog struct {
 	StatusCode int `form:"statusCode" json:"statusCode" xml:"statusCode" gorm:"comment:状态码"`
 	// 数据大小
 	BodySize int `form:"bodySize" json:"bodySize" xml:"bodySize" gorm:"comment:bodySize"`
+	// 请求ID
+	RequestID string `form:"requestId" json:"requestId" xml:"requestId" bson:"request_id"`
+	// 链路追踪ID
+	TraceID string `form:"traceId" json:"traceId" xml:"traceId" bson:"trace_id"`
 	// 日志类型 目前主要区分登录日志
 	LogType string `form:"logType" json:"logType"`
 }
@@ -87,4 +91,5 @@ type SysLogReq struct {
 	Method    string `form:"method" json:"method"`
 	Username  string `form:"username" json:"username" xml:"username" gorm:"column:username;comment:用户名"`
 	QueryTime string ` form:"queryTime" json:"queryTime"`
+	RequestID string `form:"requestId" json:"requestId"`
 }
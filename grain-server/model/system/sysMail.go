@@ -0,0 +1,64 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "time"
+
+const (
+	MailStatusPending = "pending"
+	MailStatusSending = "sending"
+	MailStatusSent    = "sent"
+	MailStatusRetry   = "retry"
+	MailStatusDead    = "dead"
+)
+
+// SysMail 邮件发件箱, 同时作为发送历史和死信列表
+type SysMail struct {
+	Model
+	// 触发发送的用户, 未登录时为空
+	UID string `json:"uid" gorm:"index;comment:用户唯一标识符"`
+	// 收件人
+	To string `json:"to" gorm:"index;comment:收件人"`
+	// 模板名称
+	Template string `json:"template" gorm:"comment:邮件模板"`
+	// 模板语言
+	Lang string `json:"lang" gorm:"comment:模板语言"`
+	// 模板数据中有敏感值时, 主题和正文中的敏感值已打码, 完整内容临时保存在 Redis 中
+	Subject string `json:"subject" gorm:"comment:邮件主题"`
+	Body    string `json:"body" gorm:"type:text;comment:邮件正文"`
+	// 完整内容在 Redis 中的随机 key, 为空表示正文没有打码
+	SecretKey string `json:"-" gorm:"comment:完整内容key"`
+	// 状态 pending sending sent retry dead
+	Status string `json:"status" gorm:"index;comment:发送状态"`
+	// 已尝试次数
+	Attempts int `json:"attempts" gorm:"comment:已尝试次数"`
+	// 下次重试时间
+	NextRetryAt *time.Time `json:"nextRetryAt" gorm:"index;comment:下次重试时间"`
+	SentAt      *time.Time `json:"sentAt" gorm:"comment:发送时间"`
+	// 最后一次失败原因
+	Error string `json:"error" gorm:"type:text;comment:失败原因"`
+}
+
+func (SysMail) TableName() string {
+	return "sys_mails"
+}
+
+type SysMailReq struct {
+	PageReq
+	To        string `form:"to" json:"to"`
+	Template  string `form:"template" json:"template"`
+	Status    string `form:"status" json:"status"`
+	QueryTime string `form:"queryTime" json:"queryTime"`
+}
@@ -61,6 +61,11 @@ func (SysMenu) TableName() string {
 	return "sys_menus"
 }
 
+// Audited 开启字段级变更审计
+func (SysMenu) Audited() bool {
+	return true
+}
+
 type SysMenuReq struct {
 	PageReq
 }
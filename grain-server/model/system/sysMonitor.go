@@ -0,0 +1,25 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import monitorx "github.com/go-grain/grain/pkg/monitor"
+
+// SysMonitorRes 运行监控数据
+type SysMonitorRes struct {
+	// 最新一条采样
+	Latest monitorx.Sample `json:"latest"`
+	// 内存中保留的历史采样, 按时间升序
+	History []monitorx.Sample `json:"history"`
+}
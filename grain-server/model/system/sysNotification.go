@@ -0,0 +1,104 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "time"
+
+// SysNotification 用户站内通知, 每个接收者一条记录
+type SysNotification struct {
+	Model
+	// 接收者UID
+	UID string `json:"uid" gorm:"index:idx_sys_notification_uid;comment:接收者UID"`
+	// system 系统事件, announcement 公告
+	Category string `json:"category" gorm:"comment:通知分类"`
+	// 系统事件类型, 公告为空
+	Event   string `json:"event" gorm:"comment:事件类型"`
+	Title   string `json:"title" gorm:"comment:标题"`
+	Content string `json:"content" gorm:"type:text;comment:内容"`
+	// unread 未读, read 已读, archived 已归档
+	Status string     `json:"status" gorm:"index:idx_sys_notification_uid;comment:状态"`
+	ReadAt *time.Time `json:"readAt" gorm:"comment:阅读时间"`
+	// 来源公告ID
+	AnnouncementID uint `json:"announcementId" gorm:"index;comment:公告ID"`
+}
+
+func (SysNotification) TableName() string {
+	return "sys_notification"
+}
+
+const (
+	NotificationCategorySystem       = "system"
+	NotificationCategoryAnnouncement = "announcement"
+)
+
+const (
+	NotificationStatusUnread   = "unread"
+	NotificationStatusRead     = "read"
+	NotificationStatusArchived = "archived"
+)
+
+// 系统事件
+const (
+	NotifyRoleChanged     = "role_changed"
+	NotifyEmailChanged    = "email_changed"
+	NotifyPasswordChanged = "password_changed"
+	NotifyAccountLocked   = "account_locked"
+)
+
+// SysAnnouncement 管理员发布的公告, 发布时按目标展开到每个用户的通知
+type SysAnnouncement struct {
+	Model
+	Title   string `json:"title" gorm:"comment:标题"`
+	Content string `json:"content" gorm:"type:text;comment:内容"`
+	// all 全部用户, role 按角色, organize 按组织节点(包含下级节点)
+	TargetType string `json:"targetType" gorm:"comment:目标类型"`
+	Target     string `json:"target" gorm:"comment:目标"`
+	// 发布者UID
+	Sender string `json:"sender" gorm:"index;comment:发布者UID"`
+	// 实际送达的用户数
+	Recipients int64 `json:"recipients" gorm:"comment:接收人数"`
+}
+
+func (SysAnnouncement) TableName() string {
+	return "sys_announcement"
+}
+
+const (
+	AnnouncementTargetAll      = "all"
+	AnnouncementTargetRole     = "role"
+	AnnouncementTargetOrganize = "organize"
+)
+
+type SysNotificationReq struct {
+	PageReq
+	Status   string `form:"status" json:"status"`
+	Category string `form:"category" json:"category"`
+}
+
+// NotificationIdsReq 为空时表示当前用户的全部通知
+type NotificationIdsReq struct {
+	IDs []uint `json:"ids"`
+}
+
+type CreateAnnouncement struct {
+	Title      string `json:"title" binding:"required"`
+	Content    string `json:"content" binding:"required"`
+	TargetType string `json:"targetType" binding:"required,oneof=all role organize"`
+	Target     string `json:"target"`
+}
+
+type SysAnnouncementReq struct {
+	PageReq
+}
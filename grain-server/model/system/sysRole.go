@@ -25,6 +25,11 @@ func (SysRole) TableName() string {
 	return "sys_roles"
 }
 
+// Audited 开启字段级变更审计
+func (SysRole) Audited() bool {
+	return true
+}
+
 type CreateSysRole struct {
 	Role     string `json:"role" binding:"required"`
 	RoleName string `json:"roleName" binding:"required"`
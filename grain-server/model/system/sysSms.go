@@ -0,0 +1,53 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+// SysSms 短信投递记录
+type SysSms struct {
+	Model
+	// 触发发送的用户, 未登录时为空
+	UID string `json:"uid" gorm:"index;comment:用户唯一标识符"`
+	// 接收手机号
+	Mobile string `json:"mobile" gorm:"index;comment:手机号"`
+	// 发送渠道
+	Provider string `json:"provider" gorm:"comment:发送渠道"`
+	// 本地模板名称
+	Template string `json:"template" gorm:"comment:短信模板"`
+	// 渲染后的短信内容
+	Content string `json:"content" gorm:"type:text;comment:短信内容"`
+	// 服务商返回的消息ID
+	MessageID string `json:"messageId" gorm:"comment:消息ID"`
+	// 投递状态 pending sent failed
+	Status string `json:"status" gorm:"index;comment:投递状态"`
+	// 失败原因
+	Error string `json:"error" gorm:"type:text;comment:失败原因"`
+}
+
+func (SysSms) TableName() string {
+	return "sys_sms"
+}
+
+const (
+	SmsStatusPending = "pending"
+	SmsStatusSent    = "sent"
+	SmsStatusFailed  = "failed"
+)
+
+type SysSmsReq struct {
+	PageReq
+	Mobile    string `form:"mobile" json:"mobile"`
+	Status    string `form:"status" json:"status"`
+	QueryTime string `form:"queryTime" json:"queryTime"`
+}
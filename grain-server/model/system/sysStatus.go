@@ -0,0 +1,37 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	healthx "github.com/go-grain/grain/pkg/health"
+	"time"
+)
+
+// SysStatus 系统运行状态, 仅管理员可见
+type SysStatus struct {
+	// 编译时注入的程序名称和版本
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// 编译使用的 Go 版本
+	GoVersion string `json:"goVersion"`
+	// 主机名
+	Hostname string `json:"hostname"`
+	// 启动时间
+	StartedAt time.Time `json:"startedAt"`
+	// 已运行时长, 单位秒
+	Uptime int64 `json:"uptime"`
+	// 依赖检查结果
+	Health healthx.Report `json:"health"`
+}
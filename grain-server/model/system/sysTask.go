@@ -0,0 +1,28 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+type SysTaskReq struct {
+	PageReq
+	// 队列名称
+	Queue string `form:"queue" json:"queue" binding:"required"`
+	// 任务状态 pending active scheduled dead, scheduled 包含等待重试的任务
+	State string `form:"state" json:"state" binding:"required"`
+}
+
+type SysTaskIdsReq struct {
+	Queue string   `json:"queue" binding:"required"`
+	IDs   []string `json:"ids" binding:"required"`
+}
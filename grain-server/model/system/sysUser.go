@@ -17,6 +17,7 @@ package model
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"fmt"
 )
 
 type RoleStr struct {
@@ -148,6 +149,11 @@ func (SysUser) TableName() string {
 	return "sys_users"
 }
 
+// Audited 开启字段级变更审计
+func (SysUser) Audited() bool {
+	return true
+}
+
 // Value 实现gorm value, scan接口,对roles解析支持
 func (i *Roles) Value() (driver.Value, error) {
 	b, err := json.Marshal(i)
@@ -155,5 +161,13 @@ func (i *Roles) Value() (driver.Value, error) {
 }
 
 func (i *Roles) Scan(input interface{}) error {
-	return json.Unmarshal(input.([]byte), i)
+	switch v := input.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), i)
+	case []byte:
+		return json.Unmarshal(v, i)
+	}
+	return fmt.Errorf("roles: unsupported type %T", input)
 }
@@ -14,6 +14,18 @@
 
 package model
 
+import "time"
+
+// 文件的可见范围
+const (
+	// VisibilityPublic 所有人都可以通过文件链接访问
+	VisibilityPublic = "public"
+	// VisibilityPrivate 只有上传者以及有附件管理权限的角色可以下载
+	VisibilityPrivate = "private"
+	// VisibilityRoles 在 private 的基础上共享给 SharedRoles 中的角色
+	VisibilityRoles = "roles"
+)
+
 // Upload 文件附件结构体
 type Upload struct {
 	Model
@@ -27,12 +39,185 @@ type Upload struct {
 	FilePurpose string `form:"filePurpose" json:"filePurpose" xml:"filePurpose" gorm:"comment:文件用途"`
 	// 文件的类型
 	FileType string `form:"fileType" json:"fileType"`
+	// 保存文件的存储驱动 local s3, 为空表示旧数据 文件在本地 uploads 目录
+	Storage string `json:"storage" xml:"storage" gorm:"size:20;comment:存储驱动"`
+	// 文件在存储驱动中的对象键
+	FileKey string `json:"fileKey" xml:"fileKey" gorm:"size:255;comment:对象键"`
+	// 文件内容的 SHA-256, 相同内容的文件共享同一个 UploadBlob
+	Hash string `json:"hash" xml:"hash" gorm:"size:64;index;comment:文件SHA-256"`
+	// 文件大小 字节
+	FileSize int64 `json:"fileSize" xml:"fileSize" gorm:"comment:文件大小"`
+	// 可见范围 public private roles, 旧数据默认公开
+	Visibility string `form:"visibility" json:"visibility" xml:"visibility" gorm:"size:10;default:public;comment:可见范围"`
+	// Visibility 为 roles 时可以下载的角色
+	SharedRoles *Roles `json:"sharedRoles" xml:"sharedRoles" gorm:"comment:共享角色"`
 }
 
 func (Upload) TableName() string {
 	return "uploads"
 }
 
+// UploadBlob 按内容去重后实际保存在存储驱动中的文件, RefCount 为引用它的 Upload 记录数,
+// 引用数归零时才会删除存储中的文件
+type UploadBlob struct {
+	Model
+	Hash     string `json:"hash" xml:"hash" gorm:"size:64;uniqueIndex;comment:文件SHA-256"`
+	Size     int64  `json:"size" xml:"size" gorm:"comment:文件大小"`
+	Storage  string `json:"storage" xml:"storage" gorm:"size:20;comment:存储驱动"`
+	FileKey  string `json:"fileKey" xml:"fileKey" gorm:"size:255;comment:对象键"`
+	RefCount int64  `json:"refCount" xml:"refCount" gorm:"comment:引用数"`
+	// 引用数归零删除时一起删除的图片规格
+	Variants []*UploadVariant `json:"-" gorm:"-"`
+}
+
+func (UploadBlob) TableName() string {
+	return "upload_blobs"
+}
+
+// UploadVariant 按规格生成的图片, 和 UploadBlob 一样按原图内容的 Hash 关联,
+// 引用原图的上传记录全部删除后随 UploadBlob 一起删除
+type UploadVariant struct {
+	Model
+	Hash     string `json:"hash" xml:"hash" gorm:"size:64;uniqueIndex:idx_upload_variant;comment:原图SHA-256"`
+	Preset   string `json:"preset" xml:"preset" gorm:"size:32;uniqueIndex:idx_upload_variant;comment:图片规格"`
+	Storage  string `json:"storage" xml:"storage" gorm:"size:20;comment:存储驱动"`
+	FileKey  string `json:"fileKey" xml:"fileKey" gorm:"size:255;index;comment:对象键"`
+	MimeType string `json:"mimeType" xml:"mimeType" gorm:"size:50;comment:MIME类型"`
+	Width    int    `json:"width" xml:"width" gorm:"comment:宽度"`
+	Height   int    `json:"height" xml:"height" gorm:"comment:高度"`
+	Size     int64  `json:"size" xml:"size" gorm:"comment:文件大小"`
+}
+
+func (UploadVariant) TableName() string {
+	return "upload_variants"
+}
+
+// UploadQuota 存储配额, Role 不为空时是角色的配额, UID 不为空时是单个用户的配额,
+// 用户配额优先于角色配额, 都没有配置时使用 upload.quota.default
+type UploadQuota struct {
+	Model
+	Role string `json:"role" xml:"role" gorm:"size:64;uniqueIndex:idx_upload_quota;comment:角色"`
+	UID  string `json:"uid" xml:"uid" gorm:"size:64;uniqueIndex:idx_upload_quota;comment:用户唯一标识符"`
+	// 配额 字节, 0 表示不限制
+	Quota int64 `json:"quota" xml:"quota" gorm:"comment:配额"`
+}
+
+func (UploadQuota) TableName() string {
+	return "upload_quotas"
+}
+
+// UploadUserUsage 用户已用的存储空间, 上传和删除文件时在同一个事务中更新,
+// 每天按 uploads 表重新统计一次
+type UploadUserUsage struct {
+	Model
+	UID   string `json:"uid" xml:"uid" gorm:"size:64;uniqueIndex;comment:用户唯一标识符"`
+	Files int64  `json:"files" xml:"files" gorm:"comment:文件数"`
+	Used  int64  `json:"used" xml:"used" gorm:"comment:已用空间"`
+}
+
+func (UploadUserUsage) TableName() string {
+	return "upload_user_usages"
+}
+
+// UploadQuotaReq 设置角色或者用户的存储配额, role 和 uid 只能填一个
+type UploadQuotaReq struct {
+	Role  string `json:"role"`
+	UID   string `json:"uid"`
+	Quota int64  `json:"quota" binding:"gte=0"`
+}
+
+// UploadQuotaRes 当前用户的存储用量以及配额, Quota 为 0 表示不限制
+type UploadQuotaRes struct {
+	Files int64 `json:"files"`
+	Used  int64 `json:"used"`
+	Quota int64 `json:"quota"`
+}
+
+// UploadUsage 存储用量统计的一行, 按用户统计时 Name 为用户UID, 按用途统计时 Name 为 FilePurpose
+type UploadUsage struct {
+	Name     string `json:"name"`
+	Username string `json:"username,omitempty"`
+	Files    int64  `json:"files"`
+	Size     int64  `json:"size"`
+}
+
+// UploadUsageRes 存储用量报表, Size 为逻辑用量 重复上传的文件会重复计算,
+// BlobSize 为去重后实际占用的存储空间
+type UploadUsageRes struct {
+	ByUser    []*UploadUsage `json:"byUser"`
+	ByPurpose []*UploadUsage `json:"byPurpose"`
+	Blobs     int64          `json:"blobs"`
+	BlobSize  int64          `json:"blobSize"`
+}
+
+// UploadSession 分片上传会话, 保存在 Redis 中
+type UploadSession struct {
+	UploadId    string    `json:"uploadId"`
+	UID         string    `json:"uid"`
+	FileName    string    `json:"fileName"`
+	Size        int64     `json:"size"`
+	Hash        string    `json:"hash"`
+	ChunkSize   int64     `json:"chunkSize"`
+	TotalChunks int       `json:"totalChunks"`
+	Storage     string    `json:"storage"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	// 已收到的分片序号 从 0 开始
+	Received []int `json:"received"`
+	// 相同内容的文件已经存在时返回校验挑战, 客户端证明持有文件内容后秒传, 不需要再上传分片
+	Challenge *UploadChallenge `json:"challenge,omitempty"`
+}
+
+// UploadChallenge 秒传校验挑战, 由服务端随机选择文件中的一段内容,
+// 客户端需要提交 hex(SHA-256(Nonce + 文件[Offset, Offset+Length))), 只能使用一次
+type UploadChallenge struct {
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+	Nonce  string `json:"nonce"`
+}
+
+// UploadSessionReq 创建分片上传会话
+type UploadSessionReq struct {
+	FileName string `json:"fileName" binding:"required"`
+	// 文件大小 字节
+	Size int64 `json:"size" binding:"required,gt=0"`
+	// 整个文件的 SHA-256 十六进制
+	Hash string `json:"hash" binding:"required,len=64,hexadecimal"`
+}
+
+// UploadInstantReq 提交秒传校验结果
+type UploadInstantReq struct {
+	UploadId string `json:"uploadId" binding:"required"`
+	Proof    string `json:"proof" binding:"required,len=64,hexadecimal"`
+}
+
+// UploadChunkReq 上传分片, 分片内容放在 multipart 的 file 字段中
+type UploadChunkReq struct {
+	UploadId string `form:"uploadId" binding:"required"`
+	Index    *int   `form:"index" binding:"required,gte=0"`
+}
+
+// UploadVisibilityReq 修改文件的可见范围
+type UploadVisibilityReq struct {
+	ID          uint   `json:"id" binding:"required"`
+	Visibility  string `json:"visibility" binding:"required,oneof=public private roles"`
+	SharedRoles Roles  `json:"sharedRoles"`
+}
+
+// UploadSignReq 生成带签名的临时下载地址
+type UploadSignReq struct {
+	ID uint `json:"id" binding:"required"`
+	// 有效期 秒, 为 0 时使用 storage.presign_expire
+	Expire int64 `json:"expire" binding:"gte=0,lte=604800"`
+	// 只能使用一次, 视频播放这类需要多次 Range 请求的场景不要开启
+	Once bool `json:"once"`
+}
+
+// UploadSignRes 带签名的临时下载地址
+type UploadSignRes struct {
+	Url       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
 // UploadReq 一般用于查询数据
 type UploadReq struct {
 	PageReq
@@ -16,9 +16,95 @@ package model
 
 // Message 结构体定义
 type Message struct {
-	Message   string `json:"message"`   //元数据
-	Recipient string `json:"recipient"` //接受者
-	Sender    string `json:"sender"`    //发送者
-	MsgType   int    `json:"msgType"`   //消息类型
-	ChatType  int    `json:"chatType"`  //聊天类型 1 私聊,2 群聊
+	ID        uint   `json:"id,omitempty"` //消息ID, 服务端保存后生成
+	Message   string `json:"message"`      //元数据
+	Recipient string `json:"recipient"`    //接受者, 私聊为用户UID, 群聊为组织
+	Sender    string `json:"sender"`       //发送者
+	MsgType   int    `json:"msgType"`      //消息类型
+	ChatType  int    `json:"chatType"`     //聊天类型 1 私聊,2 群聊
+	Time      int64  `json:"time,omitempty"`
+}
+
+const (
+	ChatTypePrivate = 1
+	ChatTypeGroup   = 2
+)
+
+const (
+	MsgTypeText  = 1
+	MsgTypeImage = 2
+	MsgTypeFile  = 3
+)
+
+// SysMessage 消息收件箱, 每个接收者一条记录, 发送者自己也保留一条已读记录
+type SysMessage struct {
+	Model
+	// 收件箱所属用户
+	Owner string `json:"owner" gorm:"index:idx_sys_message_owner;comment:收件人UID"`
+	// 发送者UID
+	Sender string `json:"sender" gorm:"index;comment:发送者UID"`
+	// 私聊为接收者UID, 群聊为组织
+	Recipient string `json:"recipient" gorm:"index;comment:接收者"`
+	ChatType  int    `json:"chatType" gorm:"index:idx_sys_message_owner;comment:聊天类型"`
+	MsgType   int    `json:"msgType" gorm:"comment:消息类型"`
+	Message   string `json:"message" gorm:"type:text;comment:消息内容"`
+	IsRead    bool   `json:"read" gorm:"index:idx_sys_message_owner;comment:是否已读"`
+}
+
+func (SysMessage) TableName() string {
+	return "sys_message"
+}
+
+// ToMessage 转换为下发给客户端的消息
+func (m *SysMessage) ToMessage() *Message {
+	return &Message{
+		ID:        m.ID,
+		Message:   m.Message,
+		Recipient: m.Recipient,
+		Sender:    m.Sender,
+		MsgType:   m.MsgType,
+		ChatType:  m.ChatType,
+		Time:      m.CreatedAt.UnixMilli(),
+	}
+}
+
+// WsFrame WebSocket 下发的数据帧
+type WsFrame struct {
+	// message 聊天消息, unread 未读数, notification 站内通知, announcement 公告, error 错误提示
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+const (
+	WsFrameMessage      = "message"
+	WsFrameUnread       = "unread"
+	WsFrameNotification = "notification"
+	WsFrameAnnouncement = "announcement"
+	WsFrameError        = "error"
+)
+
+// UnreadCount 按会话统计的未读数, 私聊的 Peer 为对方UID, 群聊为组织
+type UnreadCount struct {
+	ChatType int    `json:"chatType"`
+	Peer     string `json:"peer"`
+	Count    int64  `json:"count"`
+}
+
+// UnreadRow 未读消息分组统计结果
+type UnreadRow struct {
+	ChatType  int
+	Sender    string
+	Recipient string
+	Count     int64
+}
+
+type SysMessageReq struct {
+	PageReq
+	ChatType int    `form:"chatType" json:"chatType" binding:"required,oneof=1 2"`
+	Peer     string `form:"peer" json:"peer" binding:"required"`
+}
+
+type ReadMessageReq struct {
+	ChatType int    `form:"chatType" json:"chatType" binding:"required,oneof=1 2"`
+	Peer     string `form:"peer" json:"peer" binding:"required"`
 }
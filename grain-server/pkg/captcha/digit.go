@@ -0,0 +1,152 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package captchax
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"math/rand"
+)
+
+// digitFont 5x7 点阵数字字体
+var digitFont = [10][7]string{
+	{"01110", "10001", "10011", "10101", "11001", "10001", "01110"},
+	{"00100", "01100", "00100", "00100", "00100", "00100", "01110"},
+	{"01110", "10001", "00001", "00010", "00100", "01000", "11111"},
+	{"11111", "00010", "00100", "00010", "00001", "10001", "01110"},
+	{"00010", "00110", "01010", "10010", "11111", "00010", "00010"},
+	{"11111", "10000", "11110", "00001", "00001", "10001", "01110"},
+	{"00110", "01000", "10000", "11110", "10001", "10001", "01110"},
+	{"11111", "00001", "00010", "00100", "01000", "01000", "01000"},
+	{"01110", "10001", "10001", "01110", "10001", "10001", "01110"},
+	{"01110", "10001", "10001", "01111", "00001", "00010", "01100"},
+}
+
+// RandomDigits 生成指定长度的数字答案, 允许以0开头
+func RandomDigits(length int) string {
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = byte('0' + rand.Intn(10))
+	}
+	return string(b)
+}
+
+// NewDigitImage 把数字答案绘制成扭曲后的 PNG 图片
+func NewDigitImage(answer string, width, height int) ([]byte, error) {
+	bg := color.RGBA{R: uint8(220 + rand.Intn(35)), G: uint8(220 + rand.Intn(35)), B: uint8(220 + rand.Intn(35)), A: 255}
+	src := image.NewRGBA(image.Rect(0, 0, width, height))
+	fill(src, bg)
+
+	cell := float64(width) / float64(len(answer))
+	for i, c := range answer {
+		if c < '0' || c > '9' {
+			continue
+		}
+		glyph := digitFont[c-'0']
+		px := float64(height) * (0.65 + rand.Float64()*0.1) / 7
+		ox := float64(i)*cell + (cell-px*5)/2 + (rand.Float64()-0.5)*cell*0.2
+		oy := (float64(height)-px*7)/2 + (rand.Float64()-0.5)*float64(height)*0.15
+		shear := (rand.Float64() - 0.5) * 0.6
+		col := darkColor()
+		for row := 0; row < 7; row++ {
+			for bit := 0; bit < 5; bit++ {
+				if glyph[row][bit] != '1' {
+					continue
+				}
+				for dy := 0.0; dy < px; dy++ {
+					for dx := 0.0; dx < px; dx++ {
+						y := oy + float64(row)*px + dy
+						x := ox + float64(bit)*px + dx + shear*(y-float64(height)/2)
+						src.SetRGBA(int(x), int(y), col)
+					}
+				}
+			}
+		}
+	}
+
+	dst := wave(src, bg, float64(height)/20, float64(width)/(1.5+rand.Float64()))
+	noise(dst)
+	return encodePNG(dst)
+}
+
+// wave 正弦波扭曲
+func wave(src *image.RGBA, bg color.RGBA, amp, period float64) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(b)
+	phase := rand.Float64() * 2 * math.Pi
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			sx := x + int(amp*math.Sin(2*math.Pi*float64(y)/period+phase))
+			sy := y + int(amp*math.Cos(2*math.Pi*float64(x)/period+phase))
+			if image.Pt(sx, sy).In(b) {
+				dst.SetRGBA(x, y, src.RGBAAt(sx, sy))
+			} else {
+				dst.SetRGBA(x, y, bg)
+			}
+		}
+	}
+	return dst
+}
+
+// noise 干扰曲线和噪点
+func noise(img *image.RGBA) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	for i := 0; i < 2+rand.Intn(2); i++ {
+		col := darkColor()
+		amp := float64(h) * (0.1 + rand.Float64()*0.2)
+		period := float64(w) * (0.5 + rand.Float64())
+		phase := rand.Float64() * 2 * math.Pi
+		base := float64(h) * (0.3 + rand.Float64()*0.4)
+		for x := 0; x < w; x++ {
+			y := int(base + amp*math.Sin(2*math.Pi*float64(x)/period+phase))
+			img.SetRGBA(x, y, col)
+			img.SetRGBA(x, y+1, col)
+		}
+	}
+	for i := 0; i < w*h/40; i++ {
+		img.SetRGBA(rand.Intn(w), rand.Intn(h), darkColor())
+	}
+}
+
+func darkColor() color.RGBA {
+	return color.RGBA{R: uint8(rand.Intn(150)), G: uint8(rand.Intn(150)), B: uint8(rand.Intn(150)), A: 255}
+}
+
+func fill(img *image.RGBA, c color.RGBA) {
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DataURI 把 PNG 数据转成前端可以直接使用的 base64 地址
+func DataURI(data []byte) string {
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(data)
+}
@@ -0,0 +1,135 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package captchax
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+)
+
+// Slider 滑块验证码, X 为答案不返回给前端
+type Slider struct {
+	Background []byte
+	Piece      []byte
+	X          int
+	Y          int
+}
+
+// NewSlider 生成滑块验证码, size 为拼图块的边长
+func NewSlider(width, height, size int) (*Slider, error) {
+	bg := sliderBackground(width, height)
+	x := size + 10 + rand.Intn(maxInt(1, width-2*size-20))
+	y := 5 + rand.Intn(maxInt(1, height-size-10))
+
+	r := size / 5
+	piece := image.NewRGBA(image.Rect(0, 0, size, size))
+	hole := image.NewRGBA(bg.Bounds())
+	copy(hole.Pix, bg.Pix)
+
+	for py := 0; py < size; py++ {
+		for px := 0; px < size; px++ {
+			if !insidePiece(px, py, size, r) {
+				continue
+			}
+			edge := !insidePiece(px-1, py, size, r) || !insidePiece(px+1, py, size, r) ||
+				!insidePiece(px, py-1, size, r) || !insidePiece(px, py+1, size, r)
+
+			c := bg.RGBAAt(x+px, y+py)
+			if edge {
+				piece.SetRGBA(px, py, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+				hole.SetRGBA(x+px, y+py, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+				continue
+			}
+			piece.SetRGBA(px, py, c)
+			hole.SetRGBA(x+px, y+py, color.RGBA{R: c.R / 3, G: c.G / 3, B: c.B / 3, A: 255})
+		}
+	}
+
+	bgData, err := encodePNG(hole)
+	if err != nil {
+		return nil, err
+	}
+	pieceData, err := encodePNG(piece)
+	if err != nil {
+		return nil, err
+	}
+	return &Slider{Background: bgData, Piece: pieceData, X: x, Y: y}, nil
+}
+
+// insidePiece 拼图块形状, 正方形主体加上方和右侧两个半圆凸起
+func insidePiece(x, y, size, r int) bool {
+	if x < 0 || y < 0 || x >= size || y >= size {
+		return false
+	}
+	s := size - r
+	if x < s && y >= r && y < r+s {
+		return true
+	}
+	if math.Hypot(float64(x-s/2), float64(y-r)) < float64(r) {
+		return true
+	}
+	return math.Hypot(float64(x-s), float64(y-r-s/2)) < float64(r)
+}
+
+// sliderBackground 随机渐变加色块的背景图
+func sliderBackground(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	from, to := lightColor(), darkColor()
+	for x := 0; x < width; x++ {
+		t := float64(x) / float64(width)
+		c := color.RGBA{
+			R: uint8(float64(from.R)*(1-t) + float64(to.R)*t),
+			G: uint8(float64(from.G)*(1-t) + float64(to.G)*t),
+			B: uint8(float64(from.B)*(1-t) + float64(to.B)*t),
+			A: 255,
+		}
+		for y := 0; y < height; y++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	for i := 0; i < 12; i++ {
+		cx, cy := rand.Intn(width), rand.Intn(height)
+		radius := height/8 + rand.Intn(height/4+1)
+		c := lightColor()
+		if rand.Intn(2) == 0 {
+			c = darkColor()
+		}
+		for y := cy - radius; y <= cy+radius; y++ {
+			for x := cx - radius; x <= cx+radius; x++ {
+				if !image.Pt(x, y).In(img.Bounds()) || (x-cx)*(x-cx)+(y-cy)*(y-cy) > radius*radius {
+					continue
+				}
+				o := img.RGBAAt(x, y)
+				img.SetRGBA(x, y, color.RGBA{R: (o.R + c.R) / 2, G: (o.G + c.G) / 2, B: (o.B + c.B) / 2, A: 255})
+			}
+		}
+	}
+	noise(img)
+	return img
+}
+
+func lightColor() color.RGBA {
+	return color.RGBA{R: uint8(120 + rand.Intn(136)), G: uint8(120 + rand.Intn(136)), B: uint8(120 + rand.Intn(136)), A: 255}
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,117 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package captchax
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	redisx "github.com/go-grain/grain/pkg/redis"
+	uuidx "github.com/go-grain/grain/pkg/uuid"
+)
+
+const (
+	TypeDigit  = "digit"
+	TypeSlider = "slider"
+
+	challengeKey = "visualCaptcha:%s"
+	ticketKey    = "visualCaptchaTicket:%s"
+)
+
+type challenge struct {
+	Type   string `json:"type"`
+	Answer string `json:"answer"`
+}
+
+// Store 基于 Redis 保存验证码挑战, 每个挑战和凭证都只能使用一次
+type Store struct {
+	rdb redisx.IRedis
+	// 挑战有效期
+	expire time.Duration
+	// 滑块允许的误差像素
+	tolerance int
+}
+
+func NewStore(rdb redisx.IRedis, expire, tolerance int) *Store {
+	if expire <= 0 {
+		expire = 120
+	}
+	if tolerance <= 0 {
+		tolerance = 5
+	}
+	return &Store{rdb: rdb, expire: time.Duration(expire) * time.Second, tolerance: tolerance}
+}
+
+// Save 保存挑战答案 返回挑战ID
+func (s *Store) Save(ctx context.Context, kind, answer string) (string, error) {
+	id := uuidx.UID()
+	err := s.rdb.SetObject(ctx, fmt.Sprintf(challengeKey, id), &challenge{Type: kind, Answer: answer}, s.expire)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Verify 校验挑战答案, 无论对错挑战都会被删除
+func (s *Store) Verify(ctx context.Context, id, answer string) bool {
+	if id == "" || answer == "" {
+		return false
+	}
+	key := fmt.Sprintf(challengeKey, id)
+	c := challenge{}
+	if err := s.rdb.GetObject(ctx, key, &c); err != nil {
+		return false
+	}
+	// 并发请求时只有成功删除挑战的那一次才算数
+	if n, err := s.rdb.Del(ctx, key); err != nil || n == 0 {
+		return false
+	}
+
+	answer = strings.TrimSpace(answer)
+	switch c.Type {
+	case TypeSlider:
+		want, err1 := strconv.Atoi(c.Answer)
+		got, err2 := strconv.ParseFloat(answer, 64)
+		if err1 != nil || err2 != nil {
+			return false
+		}
+		diff := int(got+0.5) - want
+		return diff >= -s.tolerance && diff <= s.tolerance
+	default:
+		return c.Answer == answer
+	}
+}
+
+// IssueTicket 挑战校验通过后签发一次性凭证, 供后续受保护的接口使用
+func (s *Store) IssueTicket(ctx context.Context) (string, error) {
+	ticket := uuidx.UID()
+	err := s.rdb.Set(ctx, fmt.Sprintf(ticketKey, ticket), 1, s.expire)
+	if err != nil {
+		return "", err
+	}
+	return ticket, nil
+}
+
+// ConsumeTicket 使用一次性凭证
+func (s *Store) ConsumeTicket(ctx context.Context, ticket string) bool {
+	if ticket == "" {
+		return false
+	}
+	n, err := s.rdb.Del(ctx, fmt.Sprintf(ticketKey, ticket))
+	return err == nil && n > 0
+}
@@ -0,0 +1,400 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cronx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/robfig/cron/v3"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 触发方式
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// 执行结果
+const (
+	StatusSuccess  = "success"
+	StatusFailed   = "failed"
+	StatusTimeout  = "timeout"
+	StatusCanceled = "canceled"
+)
+
+var (
+	ErrJobExists   = errors.New("任务名称重复")
+	ErrJobNotFound = errors.New("任务不存在")
+	ErrJobRunning  = errors.New("任务正在运行")
+	ErrJobLocked   = errors.New("任务正在其他实例上运行")
+	ErrStopped     = errors.New("调度器已停止")
+)
+
+// 支持可选的秒字段以及 @daily @every 1h 等描述符
+var parser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Func 任务函数, 返回的字符串作为执行输出记录下来, ctx 在超时或者程序退出时取消
+type Func func(ctx context.Context) (string, error)
+
+// Job 一个定时任务
+type Job struct {
+	// 任务名称, 全局唯一, 同时作为分布式锁的 key
+	Name string
+	// cron 表达式, 支持 5 位或者带秒的 6 位, 以及 @daily @every 1h 等描述符
+	Spec string
+	// 任务说明
+	Description string
+	// 单次执行的超时时间, 为 0 时使用 Options.Timeout
+	Timeout time.Duration
+	Run     Func
+}
+
+// Run 一次执行记录
+type Run struct {
+	Job     string
+	Trigger string
+	StartAt time.Time
+	EndAt   time.Time
+	Status  string
+	Output  string
+	Err     error
+}
+
+// Entry 任务当前的调度状态
+type Entry struct {
+	Name        string
+	Spec        string
+	Description string
+	Timeout     time.Duration
+	Running     bool
+	// 本实例上一次执行的开始时间以及结果, 没有执行过时为零值
+	Prev       time.Time
+	PrevStatus string
+	// 下一次调度时间
+	Next time.Time
+}
+
+// Locker 分布式锁, 多实例部署时保证同一个任务同一时间只有一个实例在执行
+type Locker interface {
+	// TryLock 加锁成功返回 true, 锁在 ttl 后自动释放
+	TryLock(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	Unlock(ctx context.Context, key string) error
+}
+
+type Options struct {
+	// 计算调度时间使用的时区, 默认本地时区
+	Location *time.Location
+	// 没有设置超时时间的任务的默认超时, 默认 10 分钟
+	Timeout time.Duration
+	// 分布式锁的 key 前缀, 默认 cron
+	Prefix string
+	// 为空时不加锁, 只适合单实例部署
+	Locker Locker
+	// 每次定时触发前调用, 返回 false 时跳过本次执行, 手动执行不受影响
+	Enabled func(ctx context.Context, name string) bool
+	// 每次执行结束后调用, 用于保存执行记录
+	Record func(run *Run)
+}
+
+type job struct {
+	Job
+	schedule cron.Schedule
+	running  atomic.Bool
+
+	mu   sync.Mutex
+	prev *Run
+	next time.Time
+}
+
+type Scheduler struct {
+	opts Options
+
+	mu      sync.RWMutex
+	jobs    map[string]*job
+	ctx     context.Context
+	cancel  context.CancelFunc
+	started bool
+	stopped bool
+	// 正在执行的任务
+	wg sync.WaitGroup
+}
+
+// Parse 解析 cron 表达式
+func Parse(spec string) (cron.Schedule, error) {
+	return parser.Parse(spec)
+}
+
+func New(opts Options) *Scheduler {
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Minute
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = "cron"
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		opts:   opts,
+		jobs:   map[string]*job{},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Register 注册任务, 调度器启动后注册的任务立即开始调度
+func (s *Scheduler) Register(jobs ...Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range jobs {
+		if j.Name == "" || j.Run == nil {
+			return fmt.Errorf("任务 %q 缺少名称或者执行函数", j.Name)
+		}
+		if _, ok := s.jobs[j.Name]; ok {
+			return fmt.Errorf("%w: %s", ErrJobExists, j.Name)
+		}
+		schedule, err := Parse(j.Spec)
+		if err != nil {
+			return fmt.Errorf("任务 %s 的 cron 表达式 %q 不正确: %w", j.Name, j.Spec, err)
+		}
+		if j.Timeout <= 0 {
+			j.Timeout = s.opts.Timeout
+		}
+		item := &job{Job: j, schedule: schedule}
+		s.jobs[j.Name] = item
+		if s.started && !s.stopped {
+			go s.loop(item)
+		}
+	}
+	return nil
+}
+
+// Start 开始调度, ctx 取消或者调用 Stop 后停止
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+	for _, j := range s.jobs {
+		go s.loop(j)
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.cancel()
+		case <-s.ctx.Done():
+		}
+	}()
+}
+
+// Stop 停止调度并取消正在执行的任务, 等待任务退出或者 ctx 超时
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RunNow 立即在后台执行一次, 不受启用状态影响
+func (s *Scheduler) RunNow(name string) error {
+	s.mu.RLock()
+	j, ok := s.jobs[name]
+	s.mu.RUnlock()
+	if !ok {
+		return ErrJobNotFound
+	}
+	return s.exec(j, TriggerManual, time.Time{})
+}
+
+// Entries 全部任务的调度状态, 按名称排序
+func (s *Scheduler) Entries() []Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]Entry, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		list = append(list, j.entry(s.opts.Location))
+	}
+	sort.Slice(list, func(i, k int) bool { return list[i].Name < list[k].Name })
+	return list
+}
+
+// Entry 单个任务的调度状态
+func (s *Scheduler) Entry(name string) (Entry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	j, ok := s.jobs[name]
+	if !ok {
+		return Entry{}, false
+	}
+	return j.entry(s.opts.Location), true
+}
+
+func (s *Scheduler) loop(j *job) {
+	for {
+		next := j.schedule.Next(time.Now().In(s.opts.Location))
+		j.mu.Lock()
+		j.next = next
+		j.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if s.opts.Enabled != nil && !s.opts.Enabled(s.ctx, j.Name) {
+			continue
+		}
+		// 上一次还没执行完, 或者其他实例已经执行了本次调度
+		_ = s.exec(j, TriggerSchedule, next)
+	}
+}
+
+// exec 加锁成功后在后台执行, tick 为定时触发的调度时间
+func (s *Scheduler) exec(j *job, trigger string, tick time.Time) error {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return ErrStopped
+	}
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	if !j.running.CompareAndSwap(false, true) {
+		s.wg.Done()
+		return ErrJobRunning
+	}
+	unlock, err := s.lock(j, trigger, tick)
+	if err != nil {
+		j.running.Store(false)
+		s.wg.Done()
+		return err
+	}
+
+	go func() {
+		defer s.wg.Done()
+		defer j.running.Store(false)
+		defer unlock()
+		s.run(j, trigger)
+	}()
+	return nil
+}
+
+// lock 定时触发时先抢本次调度的 key, 保证每次调度只有一个实例执行,
+// 然后和手动执行一样抢任务的运行锁, 避免同一个任务在多个实例上同时执行
+func (s *Scheduler) lock(j *job, trigger string, tick time.Time) (func(), error) {
+	if s.opts.Locker == nil {
+		return func() {}, nil
+	}
+	ttl := j.Timeout + time.Minute
+	if trigger == TriggerSchedule {
+		ok, err := s.opts.Locker.TryLock(s.ctx, fmt.Sprintf("%s:%s:%d", s.opts.Prefix, j.Name, tick.Unix()), ttl)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrJobLocked
+		}
+	}
+	key := fmt.Sprintf("%s:%s", s.opts.Prefix, j.Name)
+	ok, err := s.opts.Locker.TryLock(s.ctx, key, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrJobLocked
+	}
+	return func() {
+		_ = s.opts.Locker.Unlock(context.Background(), key)
+	}, nil
+}
+
+func (s *Scheduler) run(j *job, trigger string) {
+	ctx, cancel := context.WithTimeout(s.ctx, j.Timeout)
+	defer cancel()
+
+	run := &Run{Job: j.Name, Trigger: trigger, StartAt: time.Now()}
+	run.Output, run.Err = call(ctx, j.Run)
+	run.EndAt = time.Now()
+	switch {
+	case run.Err == nil:
+		run.Status = StatusSuccess
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		run.Status = StatusTimeout
+	case s.ctx.Err() != nil:
+		run.Status = StatusCanceled
+	default:
+		run.Status = StatusFailed
+	}
+
+	j.mu.Lock()
+	j.prev = run
+	j.mu.Unlock()
+	if s.opts.Record != nil {
+		s.opts.Record(run)
+	}
+}
+
+// call 执行任务函数, 任务 panic 时按失败处理
+func call(ctx context.Context, fn Func) (output string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
+
+func (j *job) entry(loc *time.Location) Entry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	e := Entry{
+		Name:        j.Name,
+		Spec:        j.Spec,
+		Description: j.Description,
+		Timeout:     j.Timeout,
+		Running:     j.running.Load(),
+		Next:        j.next,
+	}
+	if e.Next.IsZero() {
+		e.Next = j.schedule.Next(time.Now().In(loc))
+	}
+	if j.prev != nil {
+		e.Prev = j.prev.StartAt
+		e.PrevStatus = j.prev.Status
+	}
+	return e
+}
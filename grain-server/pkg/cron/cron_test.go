@@ -0,0 +1,295 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cronx
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memLocker 进程内的 Locker, 模拟多个实例共享的 Redis 锁
+type memLocker struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+func (l *memLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.keys[key] {
+		return false, nil
+	}
+	l.keys[key] = true
+	return true, nil
+}
+
+func (l *memLocker) Unlock(ctx context.Context, key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.keys, key)
+	return nil
+}
+
+func (l *memLocker) held(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.keys[key]
+}
+
+// recorder 收集执行记录
+type recorder struct {
+	ch chan *Run
+}
+
+func newRecorder() *recorder {
+	return &recorder{ch: make(chan *Run, 16)}
+}
+
+func (r *recorder) record(run *Run) {
+	r.ch <- run
+}
+
+func (r *recorder) wait(t *testing.T) *Run {
+	t.Helper()
+	select {
+	case run := <-r.ch:
+		return run
+	case <-time.After(3 * time.Second):
+		t.Fatal("no run recorded")
+		return nil
+	}
+}
+
+func stopScheduler(t *testing.T, s *Scheduler) {
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = s.Stop(ctx)
+	})
+}
+
+func TestRegister(t *testing.T) {
+	s := New(Options{Timeout: time.Minute})
+	noop := func(ctx context.Context) (string, error) { return "", nil }
+	if err := s.Register(Job{Name: "a", Spec: "0 3 * * *", Run: noop}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register(Job{Name: "a", Spec: "@daily", Run: noop}); !errors.Is(err, ErrJobExists) {
+		t.Errorf("duplicate = %v, want ErrJobExists", err)
+	}
+	if err := s.Register(Job{Name: "b", Spec: "61 * * * *", Run: noop}); err == nil {
+		t.Error("invalid spec registered")
+	}
+	if err := s.Register(Job{Name: "c", Spec: "@daily"}); err == nil {
+		t.Error("job without Run registered")
+	}
+
+	e, ok := s.Entry("a")
+	if !ok || e.Timeout != time.Minute || e.Running || !e.Prev.IsZero() {
+		t.Fatalf("entry = %+v", e)
+	}
+	if e.Next.Hour() != 3 || e.Next.Minute() != 0 || !e.Next.After(time.Now()) {
+		t.Errorf("next = %v, want the next 03:00", e.Next)
+	}
+	for _, spec := range []string{"*/5 * * * * *", "@every 1h", "0 0 * * 1"} {
+		if _, err := Parse(spec); err != nil {
+			t.Errorf("Parse(%q) = %v", spec, err)
+		}
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	rec := newRecorder()
+	s := New(Options{Record: rec.record})
+	stopScheduler(t, s)
+	err := s.Register(Job{Name: "tick", Spec: "* * * * * *", Run: func(ctx context.Context) (string, error) {
+		return "done", nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Start(context.Background())
+
+	run := rec.wait(t)
+	if run.Job != "tick" || run.Trigger != TriggerSchedule || run.Status != StatusSuccess || run.Output != "done" {
+		t.Errorf("run = %+v", run)
+	}
+	e, _ := s.Entry("tick")
+	if e.PrevStatus != StatusSuccess || e.Prev.IsZero() {
+		t.Errorf("entry = %+v", e)
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	rec := newRecorder()
+	s := New(Options{
+		Record:  rec.record,
+		Enabled: func(ctx context.Context, name string) bool { return false },
+	})
+	stopScheduler(t, s)
+	if err := s.Register(Job{Name: "off", Spec: "* * * * * *", Run: func(ctx context.Context) (string, error) {
+		return "", nil
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	s.Start(context.Background())
+
+	select {
+	case run := <-rec.ch:
+		t.Fatalf("disabled job ran: %+v", run)
+	case <-time.After(1500 * time.Millisecond):
+	}
+	// 手动执行不受启用状态影响
+	if err := s.RunNow("off"); err != nil {
+		t.Fatal(err)
+	}
+	if run := rec.wait(t); run.Trigger != TriggerManual {
+		t.Errorf("run = %+v", run)
+	}
+}
+
+func TestRunNowStatus(t *testing.T) {
+	rec := newRecorder()
+	s := New(Options{Record: rec.record})
+	stopScheduler(t, s)
+	release := make(chan struct{})
+	jobs := []Job{
+		{Name: "block", Spec: "@yearly", Run: func(ctx context.Context) (string, error) {
+			<-release
+			return "", nil
+		}},
+		{Name: "fail", Spec: "@yearly", Run: func(ctx context.Context) (string, error) {
+			return "partial", errors.New("boom")
+		}},
+		{Name: "panic", Spec: "@yearly", Run: func(ctx context.Context) (string, error) {
+			panic("oops")
+		}},
+		{Name: "slow", Spec: "@yearly", Timeout: 20 * time.Millisecond, Run: func(ctx context.Context) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		}},
+	}
+	if err := s.Register(jobs...); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.RunNow("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("RunNow missing = %v", err)
+	}
+	if err := s.RunNow("block"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RunNow("block"); !errors.Is(err, ErrJobRunning) {
+		t.Errorf("RunNow while running = %v, want ErrJobRunning", err)
+	}
+	if e, _ := s.Entry("block"); !e.Running {
+		t.Error("entry not running")
+	}
+	close(release)
+	if run := rec.wait(t); run.Status != StatusSuccess {
+		t.Errorf("block = %+v", run)
+	}
+
+	want := map[string]string{"fail": StatusFailed, "panic": StatusFailed, "slow": StatusTimeout}
+	for name, status := range want {
+		if err := s.RunNow(name); err != nil {
+			t.Fatal(err)
+		}
+		run := rec.wait(t)
+		if run.Job != name || run.Status != status || run.Err == nil {
+			t.Errorf("%s = %+v, want %s", name, run, status)
+		}
+	}
+}
+
+func TestLocker(t *testing.T) {
+	locker := &memLocker{keys: map[string]bool{}}
+	rec := newRecorder()
+	a := New(Options{Locker: locker, Record: rec.record})
+	b := New(Options{Locker: locker, Record: rec.record})
+	stopScheduler(t, a)
+	stopScheduler(t, b)
+	release := make(chan struct{})
+	for _, s := range []*Scheduler{a, b} {
+		err := s.Register(Job{Name: "job", Spec: "@yearly", Run: func(ctx context.Context) (string, error) {
+			<-release
+			return "", nil
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 同一个任务同一时间只在一个实例上执行
+	if err := a.RunNow("job"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.RunNow("job"); !errors.Is(err, ErrJobLocked) {
+		t.Errorf("RunNow on another instance = %v, want ErrJobLocked", err)
+	}
+	close(release)
+	rec.wait(t)
+
+	// 同一次调度只有一个实例执行, 即使前一个实例已经执行完
+	tick := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := a.exec(a.jobs["job"], TriggerSchedule, tick); err != nil {
+		t.Fatal(err)
+	}
+	rec.wait(t)
+	if err := b.exec(b.jobs["job"], TriggerSchedule, tick); !errors.Is(err, ErrJobLocked) {
+		t.Errorf("same tick on another instance = %v, want ErrJobLocked", err)
+	}
+	// 执行记录在释放锁之前写入
+	deadline := time.Now().Add(time.Second)
+	for locker.held("cron:job") {
+		if time.Now().After(deadline) {
+			t.Fatal("job lock not released after the run")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStop(t *testing.T) {
+	rec := newRecorder()
+	s := New(Options{Record: rec.record})
+	started := make(chan struct{})
+	err := s.Register(Job{Name: "long", Spec: "@yearly", Run: func(ctx context.Context) (string, error) {
+		close(started)
+		<-ctx.Done()
+		return "", ctx.Err()
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.RunNow("long"); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err = s.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if run := rec.wait(t); run.Status != StatusCanceled {
+		t.Errorf("run = %+v, want canceled", run)
+	}
+	if err = s.RunNow("long"); !errors.Is(err, ErrStopped) {
+		t.Errorf("RunNow after Stop = %v, want ErrStopped", err)
+	}
+}
@@ -7,6 +7,11 @@ import (
 	"time"
 )
 
+// Mailer 邮件发送器, 方便测试时替换
+type Mailer interface {
+	SendEmail(se *email.Email) error
+}
+
 type MailServer struct {
 	p        *email.Pool
 	userName string
@@ -0,0 +1,162 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emailx
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"sync"
+)
+
+// SinkMessage SMTP 桩收到的邮件
+type SinkMessage struct {
+	From string
+	To   []string
+	Data []byte
+}
+
+// SinkServer 本地 SMTP 桩, 只实现了投递邮件需要的最小命令集,
+// 把配置中的 email_host 和 email_port 指向它即可在不依赖真实邮箱的情况下测试发信
+type SinkServer struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	messages []*SinkMessage
+	// 设置后 DATA 命令会返回该错误码, 用于模拟发送失败
+	failCode string
+}
+
+// NewSinkServer 在 addr 上启动 SMTP 桩, addr 为 "127.0.0.1:0" 时随机端口
+func NewSinkServer(addr string) (*SinkServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &SinkServer{ln: ln}
+	go s.serve()
+	return s, nil
+}
+
+func (s *SinkServer) Addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *SinkServer) Close() error {
+	return s.ln.Close()
+}
+
+// SetFail 传入类似 "451" 的错误码模拟服务器临时故障, 传空字符串恢复正常
+func (s *SinkServer) SetFail(code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failCode = code
+}
+
+// Messages 返回已收到的邮件
+func (s *SinkServer) Messages() []*SinkMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*SinkMessage(nil), s.messages...)
+}
+
+func (s *SinkServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *SinkServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	reply := func(line string) {
+		_, _ = w.WriteString(line + "\r\n")
+		_ = w.Flush()
+	}
+
+	msg := &SinkMessage{}
+	reply("220 grain smtp sink")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(cmd) {
+		case "EHLO", "HELO":
+			reply("250 grain")
+		case "MAIL":
+			msg = &SinkMessage{From: sinkAddress(arg)}
+			reply("250 OK")
+		case "RCPT":
+			msg.To = append(msg.To, sinkAddress(arg))
+			reply("250 OK")
+		case "DATA":
+			s.mu.Lock()
+			failCode := s.failCode
+			s.mu.Unlock()
+			if failCode != "" {
+				reply(failCode + " sink: simulated failure")
+				continue
+			}
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data bytes.Buffer
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" || l == ".\n" {
+					break
+				}
+				// 去掉 dot-stuffing
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			msg.Data = data.Bytes()
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			reply("250 OK")
+		case "RSET":
+			msg = &SinkMessage{}
+			reply("250 OK")
+		case "NOOP":
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// sinkAddress 从 "FROM:<a@b.com>" 这样的参数中取出邮箱地址
+func sinkAddress(arg string) string {
+	if _, v, ok := strings.Cut(arg, ":"); ok {
+		arg = v
+	}
+	arg = strings.TrimSpace(arg)
+	if i := strings.IndexByte(arg, ' '); i > 0 {
+		arg = arg[:i]
+	}
+	return strings.Trim(arg, "<>")
+}
@@ -0,0 +1,70 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emailx
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/jordan-wright/email"
+)
+
+func TestMailServerWithSink(t *testing.T) {
+	sink, err := NewSinkServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	host, port, _ := net.SplitHostPort(sink.Addr())
+	mailer, err := NewMailServer("noreply@grain.dev", "", host, host, port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := email.NewEmail()
+	e.From = "Grain<noreply@grain.dev>"
+	e.To = []string{"user@grain.dev"}
+	e.Subject = "hello"
+	e.HTML = []byte("<p>123456</p>")
+	if err = mailer.SendEmail(e); err != nil {
+		t.Fatal(err)
+	}
+
+	got := sink.Messages()
+	if len(got) != 1 {
+		t.Fatalf("sink received %d messages, want 1", len(got))
+	}
+	if got[0].From != "noreply@grain.dev" || len(got[0].To) != 1 || got[0].To[0] != "user@grain.dev" {
+		t.Errorf("envelope = %+v", got[0])
+	}
+	if !strings.Contains(string(got[0].Data), "Subject: hello") {
+		t.Errorf("data = %q", got[0].Data)
+	}
+
+	// 模拟服务器临时故障
+	sink.SetFail("451")
+	if err = mailer.SendEmail(e); err == nil {
+		t.Error("SendEmail() should fail when the server rejects DATA")
+	}
+	sink.SetFail("")
+	if err = mailer.SendEmail(e); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(sink.Messages()); n != 2 {
+		t.Errorf("sink received %d messages, want 2", n)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emailx
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+//go:embed templates/*.html
+var defaultTemplates embed.FS
+
+// Secret 模板数据中的验证码、确认链接等敏感值, 写入发件箱的正文中会被替换为 RedactedText
+type Secret string
+
+const RedactedText = "******"
+
+// Redact 返回一份 Secret 类型的值被替换为 RedactedText 的模板数据, 没有敏感值时 ok 为 false
+func Redact(data map[string]any) (res map[string]any, ok bool) {
+	res = make(map[string]any, len(data))
+	for k, v := range data {
+		if _, secret := v.(Secret); secret {
+			v, ok = Secret(RedactedText), true
+		}
+		res[k] = v
+	}
+	return res, ok
+}
+
+// Templates 邮件模板, 文件名格式为 name.html 或者带语言的 name.lang.html,
+// 例如 captcha.html captcha.en.html, 模板中通过 {{define "subject"}} 定义邮件主题
+type Templates struct {
+	mu   sync.RWMutex
+	tpls map[string]*template.Template
+}
+
+// NewTemplates 加载内置模板, dir 不为空时用目录中的同名模板覆盖内置模板
+func NewTemplates(dir string) (*Templates, error) {
+	t := &Templates{tpls: make(map[string]*template.Template)}
+	if err := t.load(defaultTemplates, "templates"); err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return t, nil
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return t, nil
+	}
+	if err := t.load(os.DirFS(dir), "."); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *Templates) load(fsys fs.FS, root string) error {
+	entries, err := fs.ReadDir(fsys, root)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".html" {
+			continue
+		}
+		content, err := fs.ReadFile(fsys, filepath.ToSlash(filepath.Join(root, entry.Name())))
+		if err != nil {
+			return err
+		}
+		key := strings.TrimSuffix(entry.Name(), ".html")
+		if err = t.Register(key, string(content)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Register 注册模板, key 为 name 或者 name.lang
+func (t *Templates) Register(key, content string) error {
+	tpl, err := template.New(key).Parse(content)
+	if err != nil {
+		return fmt.Errorf("解析邮件模板 %s 失败: %w", key, err)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tpls[key] = tpl
+	return nil
+}
+
+// Render 渲染邮件主题和正文, 按 name.lang -> name.主语言 -> name 的顺序查找模板,
+// 例如 lang 为 en-US 时依次查找 name.en-US name.en name
+func (t *Templates) Render(name, lang string, data any) (subject, body string, err error) {
+	tpl := t.lookup(name, lang)
+	if tpl == nil {
+		return "", "", fmt.Errorf("邮件模板 %s 不存在", name)
+	}
+
+	var buf bytes.Buffer
+	if err = tpl.Execute(&buf, data); err != nil {
+		return "", "", err
+	}
+	body = buf.String()
+
+	if tpl.Lookup("subject") != nil {
+		buf.Reset()
+		if err = tpl.ExecuteTemplate(&buf, "subject", data); err != nil {
+			return "", "", err
+		}
+		// 主题不是 HTML, 还原被转义的字符
+		subject = strings.TrimSpace(html.UnescapeString(buf.String()))
+	}
+	return subject, body, nil
+}
+
+func (t *Templates) lookup(name, lang string) *template.Template {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	keys := []string{name}
+	if lang != "" {
+		keys = []string{name + "." + lang}
+		if base, _, ok := strings.Cut(lang, "-"); ok {
+			keys = append(keys, name+"."+base)
+		}
+		keys = append(keys, name)
+	}
+	for _, key := range keys {
+		if tpl, ok := t.tpls[key]; ok {
+			return tpl
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emailx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTemplatesRender(t *testing.T) {
+	dir := t.TempDir()
+	// 目录中的同名模板覆盖内置模板
+	custom := `{{define "subject"}}{{.SiteName}} & code{{end}}<p>{{.Code}}</p>`
+	if err := os.WriteFile(filepath.Join(dir, "captcha.en.html"), []byte(custom), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tpls, err := NewTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := map[string]any{"SiteName": "Grain", "Code": "<123456>"}
+	subject, body, err := tpls.Render("captcha", "en-US", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 主题中被转义的字符会被还原, 正文保持转义
+	if subject != "Grain & code" {
+		t.Errorf("subject = %q", subject)
+	}
+	if body != "<p>&lt;123456&gt;</p>" {
+		t.Errorf("body = %q", body)
+	}
+
+	// 没有对应语言的模板时回退到内置模板
+	subject, body, err = tpls.Render("captcha", "fr", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject == "" || !strings.Contains(body, "&lt;123456&gt;") {
+		t.Errorf("fallback subject = %q body = %q", subject, body)
+	}
+
+	if _, _, err = tpls.Render("missing", "", data); err == nil {
+		t.Error("Render() should fail for missing template")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	data := map[string]any{"SiteName": "Grain", "Code": Secret("123456")}
+	redacted, ok := Redact(data)
+	if !ok {
+		t.Fatal("Redact() should report secret values")
+	}
+	if redacted["Code"] != Secret(RedactedText) || redacted["SiteName"] != "Grain" {
+		t.Errorf("Redact() = %v", redacted)
+	}
+	if data["Code"] != Secret("123456") {
+		t.Error("Redact() must not modify data")
+	}
+	if _, ok = Redact(map[string]any{"SiteName": "Grain"}); ok {
+		t.Error("Redact() should report no secret values")
+	}
+
+	tpls, err := NewTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, body, err := tpls.Render("captcha", "", redacted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(body, "123456") || !strings.Contains(body, RedactedText) {
+		t.Errorf("redacted body = %q", body)
+	}
+}
@@ -17,13 +17,13 @@ package jsonx
 
 import (
 	"encoding/json"
-	"log"
+	"github.com/go-grain/grain/log"
 )
 
 func Marshal(data interface{}) []byte {
 	marshal, err := json.Marshal(data)
 	if err != nil {
-		log.Print(err)
+		log.Error(err)
 		return nil
 	}
 	return marshal
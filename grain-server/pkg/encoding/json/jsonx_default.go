@@ -19,7 +19,7 @@ package jsonx
 import (
 	"errors"
 	"github.com/bytedance/sonic"
-	"log"
+	"github.com/go-grain/grain/log"
 )
 
 type G map[string]interface{}
@@ -27,7 +27,7 @@ type G map[string]interface{}
 func Marshal(data interface{}) []byte {
 	marshal, err := sonic.Marshal(data)
 	if err != nil {
-		log.Print(err)
+		log.Error(err)
 		return nil
 	}
 	return marshal
@@ -1,14 +1,14 @@
 package encrypt
 
 import (
-	"github.com/go-pay/gopay/pkg/xlog"
+	"github.com/go-grain/grain/log"
 	"golang.org/x/crypto/bcrypt"
 )
 
 func EncryptPassword(pwd string) string {
 	hash, err := bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.MinCost)
 	if err != nil {
-		xlog.Info(err)
+		log.Error(err)
 	}
 
 	return string(hash)
@@ -17,7 +17,7 @@ func EncryptPassword(pwd string) string {
 func ComparePasswords(hashedPwd string, plainPwd string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPwd), []byte(plainPwd))
 	if err != nil {
-		xlog.Info(err)
+		log.Debug(err)
 		return false
 	}
 
@@ -0,0 +1,135 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package healthx
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp       = "up"
+	StatusDown     = "down"
+	StatusDegraded = "degraded"
+)
+
+// Check 依赖检查项, Optional 为 true 时检查失败不影响就绪状态
+type Check struct {
+	Name     string
+	Optional bool
+	Probe    func(ctx context.Context) error
+}
+
+// Result 单个依赖的检查结果
+type Result struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Optional bool   `json:"optional"`
+	// 检查耗时, 单位毫秒
+	Latency float64 `json:"latency"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// Report 一次检查的汇总结果
+type Report struct {
+	// up 全部正常, degraded 仅可选依赖异常, down 必需依赖异常
+	Status    string    `json:"status"`
+	Checks    []Result  `json:"checks"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// Ready 必需依赖全部正常
+func (r Report) Ready() bool {
+	return r.Status != StatusDown
+}
+
+type Checker struct {
+	mu      sync.RWMutex
+	checks  []Check
+	timeout time.Duration
+}
+
+// New 创建检查器, timeout 为单个检查项的超时时间
+func New(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	return &Checker{timeout: timeout}
+}
+
+// Add 注册检查项
+func (c *Checker) Add(checks ...Check) *Checker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, checks...)
+	return c
+}
+
+// Check 并发执行所有检查项, 结果顺序与注册顺序一致
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := c.checks
+	c.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = c.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: results, CheckedAt: time.Now()}
+	for _, res := range results {
+		if res.Status == StatusUp {
+			continue
+		}
+		if !res.Optional {
+			report.Status = StatusDown
+			break
+		}
+		report.Status = StatusDegraded
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	res := Result{Name: check.Name, Status: StatusUp, Optional: check.Optional}
+	start := time.Now()
+	// 部分客户端不响应 ctx 取消, 超时后不再等待结果
+	done := make(chan error, 1)
+	go func() {
+		done <- check.Probe(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	res.Latency = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		res.Status = StatusDown
+		res.Error = err.Error()
+	}
+	return res
+}
@@ -0,0 +1,110 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package healthx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func up(ctx context.Context) error { return nil }
+
+func down(ctx context.Context) error { return errors.New("connection refused") }
+
+func TestCheckStatus(t *testing.T) {
+	cases := []struct {
+		name   string
+		checks []Check
+		status string
+		ready  bool
+	}{
+		{"empty", nil, StatusUp, true},
+		{"all up", []Check{{Name: "db", Probe: up}, {Name: "redis", Probe: up}}, StatusUp, true},
+		{"optional down", []Check{{Name: "db", Probe: up}, {Name: "mongo", Optional: true, Probe: down}}, StatusDegraded, true},
+		{"required down", []Check{{Name: "db", Probe: down}, {Name: "redis", Probe: up}}, StatusDown, false},
+		{"required down after optional", []Check{{Name: "mongo", Optional: true, Probe: down}, {Name: "db", Probe: down}}, StatusDown, false},
+	}
+	for _, c := range cases {
+		report := New(time.Second).Add(c.checks...).Check(context.Background())
+		if report.Status != c.status || report.Ready() != c.ready {
+			t.Errorf("%s: status = %s ready = %v, want %s %v", c.name, report.Status, report.Ready(), c.status, c.ready)
+		}
+		if len(report.Checks) != len(c.checks) || report.CheckedAt.IsZero() {
+			t.Errorf("%s: report = %+v", c.name, report)
+		}
+	}
+}
+
+func TestCheckResults(t *testing.T) {
+	report := New(time.Second).
+		Add(Check{Name: "db", Probe: down}).
+		Add(Check{Name: "mongo", Optional: true, Probe: up}).
+		Check(context.Background())
+
+	db, mongo := report.Checks[0], report.Checks[1]
+	if db.Name != "db" || db.Status != StatusDown || db.Error != "connection refused" || db.Optional {
+		t.Errorf("db = %+v", db)
+	}
+	if mongo.Name != "mongo" || mongo.Status != StatusUp || mongo.Error != "" || !mongo.Optional {
+		t.Errorf("mongo = %+v", mongo)
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	slow := func(ctx context.Context) error {
+		// 不响应 ctx 的客户端
+		<-block
+		return nil
+	}
+	checker := New(50*time.Millisecond).Add(
+		Check{Name: "a", Probe: slow},
+		Check{Name: "b", Probe: slow},
+		Check{Name: "c", Probe: up},
+	)
+
+	start := time.Now()
+	report := checker.Check(context.Background())
+	// 检查项并发执行, 总耗时接近单个检查项的超时时间
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Check took %v", elapsed)
+	}
+	if report.Status != StatusDown {
+		t.Errorf("status = %s, want down", report.Status)
+	}
+	for _, res := range report.Checks[:2] {
+		if res.Status != StatusDown || res.Error != context.DeadlineExceeded.Error() || res.Latency < 50 {
+			t.Errorf("%s = %+v, want a timeout after 50ms", res.Name, res)
+		}
+	}
+	if report.Checks[2].Status != StatusUp {
+		t.Errorf("c = %+v", report.Checks[2])
+	}
+}
+
+func TestCheckCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report := New(time.Second).Add(Check{Name: "db", Probe: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}).Check(ctx)
+	if report.Status != StatusDown || report.Checks[0].Error != context.Canceled.Error() {
+		t.Errorf("report = %+v", report)
+	}
+}
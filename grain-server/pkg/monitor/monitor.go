@@ -0,0 +1,354 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitorx
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sample 一次采样结果
+type Sample struct {
+	Time    time.Time `json:"time"`
+	Host    Host      `json:"host"`
+	Process Process   `json:"process"`
+	Runtime Runtime   `json:"runtime"`
+	Disks   []Disk    `json:"disks"`
+	DB      DB        `json:"db"`
+}
+
+// Host 主机指标, 读取自 /proc, 非 Linux 系统为 0
+type Host struct {
+	CPUCount int `json:"cpuCount"`
+	// 整机 CPU 使用率 0-100
+	CPUPercent float64 `json:"cpuPercent"`
+	Load1      float64 `json:"load1"`
+	Load5      float64 `json:"load5"`
+	Load15     float64 `json:"load15"`
+	// 内存, 单位字节
+	MemTotal     uint64  `json:"memTotal"`
+	MemUsed      uint64  `json:"memUsed"`
+	MemAvailable uint64  `json:"memAvailable"`
+	MemPercent   float64 `json:"memPercent"`
+}
+
+// Process 当前进程指标
+type Process struct {
+	PID int `json:"pid"`
+	// 进程 CPU 使用率, 按全部核心折算 0-100
+	CPUPercent float64 `json:"cpuPercent"`
+	// 常驻内存, 单位字节
+	RSS uint64 `json:"rss"`
+	// 已运行时长, 单位秒
+	Uptime int64 `json:"uptime"`
+}
+
+// Runtime Go 运行时指标
+type Runtime struct {
+	Goroutines int    `json:"goroutines"`
+	HeapAlloc  uint64 `json:"heapAlloc"`
+	HeapInuse  uint64 `json:"heapInuse"`
+	Sys        uint64 `json:"sys"`
+	NumGC      uint32 `json:"numGC"`
+	// 距离上次采样新增的 GC 次数以及其中最长的停顿, 单位毫秒
+	GCCount    uint32  `json:"gcCount"`
+	GCPauseMax float64 `json:"gcPauseMax"`
+	// 累计 GC 停顿, 单位毫秒
+	GCPauseTotal float64 `json:"gcPauseTotal"`
+}
+
+// Disk 目录所在分区的使用情况以及目录本身的大小
+type Disk struct {
+	Name    string  `json:"name"`
+	Path    string  `json:"path"`
+	Total   uint64  `json:"total"`
+	Used    uint64  `json:"used"`
+	Free    uint64  `json:"free"`
+	Percent float64 `json:"percent"`
+	// 目录占用, 按 DirSizeInterval 周期刷新
+	Size  uint64 `json:"size"`
+	Error string `json:"error,omitempty"`
+}
+
+// DB 数据库连接池
+type DB struct {
+	MaxOpen   int   `json:"maxOpen"`
+	Open      int   `json:"open"`
+	InUse     int   `json:"inUse"`
+	Idle      int   `json:"idle"`
+	WaitCount int64 `json:"waitCount"`
+}
+
+type Options struct {
+	// 采样间隔
+	Interval time.Duration
+	// 内存中保留的采样条数
+	Size int
+	// 目录大小的刷新间隔, 遍历目录开销较大, 不跟随采样间隔
+	DirSizeInterval time.Duration
+	// 需要统计的目录, 名称 => 路径
+	Dirs map[string]string
+	// 数据库连接池状态
+	DBStats func() sql.DBStats
+}
+
+type Monitor struct {
+	opts      Options
+	startedAt time.Time
+
+	mu      sync.RWMutex
+	samples []Sample
+	next    int
+	full    bool
+	subs    map[chan Sample]struct{}
+
+	// 以下字段只在采样 goroutine 中访问
+	prevAt     time.Time
+	prevCPU    cpuTimes
+	prevTicks  uint64
+	prevNumGC  uint32
+	dirSizes   map[string]uint64
+	dirSizedAt time.Time
+}
+
+func New(opts Options) *Monitor {
+	if opts.Interval <= 0 {
+		opts.Interval = 5 * time.Second
+	}
+	if opts.Size <= 0 {
+		opts.Size = 120
+	}
+	if opts.DirSizeInterval <= 0 {
+		opts.DirSizeInterval = time.Minute
+	}
+	return &Monitor{
+		opts:      opts,
+		startedAt: time.Now(),
+		samples:   make([]Sample, opts.Size),
+		subs:      make(map[chan Sample]struct{}),
+		dirSizes:  make(map[string]uint64),
+	}
+}
+
+// Start 立即采样一次, 之后按 Interval 周期采样直到 ctx 结束
+func (m *Monitor) Start(ctx context.Context) {
+	m.collect()
+	go func() {
+		ticker := time.NewTicker(m.opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.collect()
+			}
+		}
+	}()
+}
+
+// Latest 最新一条采样
+func (m *Monitor) Latest() (Sample, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if !m.full && m.next == 0 {
+		return Sample{}, false
+	}
+	return m.samples[(m.next+len(m.samples)-1)%len(m.samples)], true
+}
+
+// History 保留的全部采样, 按时间升序
+func (m *Monitor) History() []Sample {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if !m.full {
+		return append([]Sample(nil), m.samples[:m.next]...)
+	}
+	history := make([]Sample, 0, len(m.samples))
+	history = append(history, m.samples[m.next:]...)
+	return append(history, m.samples[:m.next]...)
+}
+
+// Subscribe 订阅新的采样, 消费不及时的订阅者会丢弃中间的采样; 用完需要调用 cancel
+func (m *Monitor) Subscribe() (<-chan Sample, func()) {
+	ch := make(chan Sample, 1)
+	m.mu.Lock()
+	m.subs[ch] = struct{}{}
+	m.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			m.mu.Lock()
+			delete(m.subs, ch)
+			m.mu.Unlock()
+		})
+	}
+}
+
+func (m *Monitor) collect() {
+	now := time.Now()
+	sample := Sample{
+		Time:    now,
+		Host:    m.host(),
+		Process: m.process(now),
+		Runtime: m.runtime(),
+		Disks:   m.disks(now),
+	}
+	if m.opts.DBStats != nil {
+		stats := m.opts.DBStats()
+		sample.DB = DB{
+			MaxOpen:   stats.MaxOpenConnections,
+			Open:      stats.OpenConnections,
+			InUse:     stats.InUse,
+			Idle:      stats.Idle,
+			WaitCount: stats.WaitCount,
+		}
+	}
+	m.prevAt = now
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.samples[m.next] = sample
+	m.next = (m.next + 1) % len(m.samples)
+	if m.next == 0 {
+		m.full = true
+	}
+	for ch := range m.subs {
+		select {
+		case ch <- sample:
+		default:
+		}
+	}
+}
+
+func (m *Monitor) host() Host {
+	host := Host{CPUCount: runtime.NumCPU()}
+	if cpu, err := readCPUTimes(); err == nil {
+		if total := cpu.total - m.prevCPU.total; m.prevCPU.total > 0 && total > 0 {
+			host.CPUPercent = percent(total-(cpu.idle-m.prevCPU.idle), total)
+		}
+		m.prevCPU = cpu
+	}
+	if load, err := readLoadAvg(); err == nil {
+		host.Load1, host.Load5, host.Load15 = load[0], load[1], load[2]
+	}
+	if total, available, err := readMemInfo(); err == nil {
+		host.MemTotal = total
+		host.MemAvailable = available
+		host.MemUsed = total - available
+		host.MemPercent = percent(host.MemUsed, total)
+	}
+	return host
+}
+
+func (m *Monitor) process(now time.Time) Process {
+	proc := Process{PID: os.Getpid(), Uptime: int64(now.Sub(m.startedAt).Seconds())}
+	if ticks, err := readProcessTicks(); err == nil {
+		if !m.prevAt.IsZero() {
+			elapsed := now.Sub(m.prevAt).Seconds() * clockTicks * float64(runtime.NumCPU())
+			if elapsed > 0 {
+				proc.CPUPercent = float64(ticks-m.prevTicks) / elapsed * 100
+			}
+		}
+		m.prevTicks = ticks
+	}
+	if rss, err := readRSS(); err == nil {
+		proc.RSS = rss
+	}
+	return proc
+}
+
+func (m *Monitor) runtime() Runtime {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	rt := Runtime{
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAlloc:    ms.HeapAlloc,
+		HeapInuse:    ms.HeapInuse,
+		Sys:          ms.Sys,
+		NumGC:        ms.NumGC,
+		GCPauseTotal: float64(ms.PauseTotalNs) / 1e6,
+	}
+	rt.GCCount = ms.NumGC - m.prevNumGC
+	// PauseNs 是长度 256 的环形缓冲, 第 n 次 GC 的停顿在 PauseNs[(n+255)%256]
+	for n := ms.NumGC; n > m.prevNumGC && ms.NumGC-n < uint32(len(ms.PauseNs)); n-- {
+		if pause := float64(ms.PauseNs[(n+255)%256]) / 1e6; pause > rt.GCPauseMax {
+			rt.GCPauseMax = pause
+		}
+	}
+	m.prevNumGC = ms.NumGC
+	return rt
+}
+
+func (m *Monitor) disks(now time.Time) []Disk {
+	refresh := now.Sub(m.dirSizedAt) >= m.opts.DirSizeInterval
+	if refresh {
+		m.dirSizedAt = now
+	}
+	names := make([]string, 0, len(m.opts.Dirs))
+	for name := range m.opts.Dirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	disks := make([]Disk, 0, len(names))
+	for _, name := range names {
+		path := m.opts.Dirs[name]
+		disk := Disk{Name: name, Path: path}
+		total, free, err := diskUsage(path)
+		if err != nil {
+			disk.Error = err.Error()
+			disks = append(disks, disk)
+			continue
+		}
+		disk.Total, disk.Free, disk.Used = total, free, total-free
+		disk.Percent = percent(disk.Used, total)
+		if refresh {
+			m.dirSizes[name] = dirSize(path)
+		}
+		disk.Size = m.dirSizes[name]
+		disks = append(disks, disk)
+	}
+	return disks
+}
+
+func dirSize(root string) uint64 {
+	var size uint64
+	_ = filepath.WalkDir(root, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += uint64(info.Size())
+		}
+		return nil
+	})
+	return size
+}
+
+func percent(part, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total) * 100
+}
@@ -0,0 +1,173 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package monitorx
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// clockTicks /proc 中 CPU 时间的单位, Linux 上 USER_HZ 固定为 100
+const clockTicks = 100
+
+type cpuTimes struct {
+	total uint64
+	idle  uint64
+}
+
+// readCPUTimes 读取 /proc/stat 第一行的整机 CPU 时间, idle 包含 iowait
+func readCPUTimes() (cpuTimes, error) {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return cpuTimes{}, err
+	}
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	fields := strings.Fields(string(line))
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return cpuTimes{}, errors.New("unexpected /proc/stat format")
+	}
+	var times cpuTimes
+	for i, field := range fields[1:] {
+		v, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return cpuTimes{}, err
+		}
+		// guest 和 guest_nice 已经计入 user 和 nice
+		if i >= 8 {
+			break
+		}
+		times.total += v
+		if i == 3 || i == 4 {
+			times.idle += v
+		}
+	}
+	return times, nil
+}
+
+// readProcessTicks 读取当前进程的 utime+stime
+func readProcessTicks() (uint64, error) {
+	data, err := os.ReadFile("/proc/self/stat")
+	if err != nil {
+		return 0, err
+	}
+	// 第二列是带括号的进程名, 可能包含空格, 从最后一个右括号之后开始解析
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return 0, errors.New("unexpected /proc/self/stat format")
+	}
+	fields := strings.Fields(string(data[i+1:]))
+	// fields[0] 是第 3 列 state, utime 和 stime 是第 14、15 列
+	if len(fields) < 13 {
+		return 0, errors.New("unexpected /proc/self/stat format")
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return utime + stime, nil
+}
+
+// readMemInfo 读取整机内存总量和可用量, 单位字节
+func readMemInfo() (total, available uint64, err error) {
+	values, err := readKBFields("/proc/meminfo", "MemTotal:", "MemAvailable:")
+	if err != nil {
+		return 0, 0, err
+	}
+	return values[0], values[1], nil
+}
+
+// readRSS 读取当前进程常驻内存, 单位字节
+func readRSS() (uint64, error) {
+	values, err := readKBFields("/proc/self/status", "VmRSS:")
+	if err != nil {
+		return 0, err
+	}
+	return values[0], nil
+}
+
+func readLoadAvg() ([3]float64, error) {
+	var load [3]float64
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return load, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return load, errors.New("unexpected /proc/loadavg format")
+	}
+	for i := range load {
+		if load[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return load, err
+		}
+	}
+	return load, nil
+}
+
+// diskUsage 目录所在分区的总量和非 root 用户可用量, 单位字节
+func diskUsage(path string) (total, free uint64, err error) {
+	var st syscall.Statfs_t
+	if err = syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return st.Blocks * uint64(st.Bsize), st.Bavail * uint64(st.Bsize), nil
+}
+
+// readKBFields 按顺序读取 "Key:  123 kB" 形式的字段并换算为字节
+func readKBFields(name string, keys ...string) ([]uint64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make([]uint64, len(keys))
+	found := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() && found < len(keys) {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		for i, key := range keys {
+			if fields[0] != key {
+				continue
+			}
+			v, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v * 1024
+			found++
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if found < len(keys) {
+		return nil, errors.New("missing fields in " + name)
+	}
+	return values, nil
+}
@@ -0,0 +1,54 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+
+package monitorx
+
+import "errors"
+
+// 非 Linux 系统没有 /proc, 主机和进程指标为 0, 只保留 Go 运行时和连接池指标
+
+const clockTicks = 100
+
+var errUnsupported = errors.New("not supported on this platform")
+
+type cpuTimes struct {
+	total uint64
+	idle  uint64
+}
+
+func readCPUTimes() (cpuTimes, error) {
+	return cpuTimes{}, errUnsupported
+}
+
+func readProcessTicks() (uint64, error) {
+	return 0, errUnsupported
+}
+
+func readMemInfo() (total, available uint64, err error) {
+	return 0, 0, errUnsupported
+}
+
+func readRSS() (uint64, error) {
+	return 0, errUnsupported
+}
+
+func readLoadAvg() ([3]float64, error) {
+	return [3]float64{}, errUnsupported
+}
+
+func diskUsage(path string) (total, free uint64, err error) {
+	return 0, 0, errUnsupported
+}
@@ -0,0 +1,180 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queuex
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"sort"
+)
+
+// QueueInfo 队列中各个状态的任务数量, Scheduled 包含等待重试的任务
+type QueueInfo struct {
+	Name      string `json:"name"`
+	Pending   int64  `json:"pending"`
+	Active    int64  `json:"active"`
+	Scheduled int64  `json:"scheduled"`
+	Dead      int64  `json:"dead"`
+}
+
+// Inspector 查看以及管理任务
+type Inspector struct {
+	rdb redis.UniversalClient
+}
+
+func NewInspector(rdb redis.UniversalClient) *Inspector {
+	return &Inspector{rdb: rdb}
+}
+
+// Queues 全部队列以及任务数量
+func (i *Inspector) Queues(ctx context.Context) ([]*QueueInfo, error) {
+	names, err := i.rdb.SMembers(ctx, queuesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	list := make([]*QueueInfo, 0, len(names))
+	for _, name := range names {
+		k := newKeys(name)
+		pipe := i.rdb.Pipeline()
+		pending := pipe.LLen(ctx, k.pending)
+		active := pipe.ZCard(ctx, k.active)
+		scheduled := pipe.ZCard(ctx, k.scheduled)
+		dead := pipe.ZCard(ctx, k.dead)
+		if _, err = pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+		list = append(list, &QueueInfo{
+			Name:      name,
+			Pending:   pending.Val(),
+			Active:    active.Val(),
+			Scheduled: scheduled.Val(),
+			Dead:      dead.Val(),
+		})
+	}
+	return list, nil
+}
+
+// ListTasks 分页查看指定状态的任务, state 为 scheduled 时包含等待重试的任务.
+// pending 按入队先后排序, 其他状态按时间排序, 死信最近的在前
+func (i *Inspector) ListTasks(ctx context.Context, queue, state string, page, pageSize int) ([]*TaskInfo, int64, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	start := int64((page - 1) * pageSize)
+	stop := start + int64(pageSize) - 1
+
+	k := newKeys(queue)
+	var ids []string
+	var total int64
+	var err error
+	switch state {
+	case StatePending:
+		// LPUSH 入队 RPOP 出队, 列表尾部最先执行
+		if total, err = i.rdb.LLen(ctx, k.pending).Result(); err != nil {
+			return nil, 0, err
+		}
+		ids, err = i.rdb.LRange(ctx, k.pending, -stop-1, -start-1).Result()
+		for l, r := 0, len(ids)-1; l < r; l, r = l+1, r-1 {
+			ids[l], ids[r] = ids[r], ids[l]
+		}
+	case StateActive, StateScheduled, StateRetry, StateDead:
+		key := map[string]string{
+			StateActive:    k.active,
+			StateScheduled: k.scheduled,
+			StateRetry:     k.scheduled,
+			StateDead:      k.dead,
+		}[state]
+		if total, err = i.rdb.ZCard(ctx, key).Result(); err != nil {
+			return nil, 0, err
+		}
+		if state == StateDead {
+			ids, err = i.rdb.ZRevRange(ctx, key, start, stop).Result()
+		} else {
+			ids, err = i.rdb.ZRange(ctx, key, start, stop).Result()
+		}
+	default:
+		return nil, 0, fmt.Errorf("未知的任务状态: %s", state)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	pipe := i.rdb.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, 0, len(ids))
+	for _, id := range ids {
+		cmds = append(cmds, pipe.HGetAll(ctx, k.task(id)))
+	}
+	if len(cmds) > 0 {
+		if _, err = pipe.Exec(ctx); err != nil {
+			return nil, 0, err
+		}
+	}
+	list := make([]*TaskInfo, 0, len(cmds))
+	for _, cmd := range cmds {
+		// 列出的同时任务可能已经执行完成
+		if len(cmd.Val()) == 0 {
+			continue
+		}
+		list = append(list, parseTask(cmd.Val()))
+	}
+	return list, total, nil
+}
+
+// GetTask 任务详情
+func (i *Inspector) GetTask(ctx context.Context, queue, id string) (*TaskInfo, error) {
+	m, err := i.rdb.HGetAll(ctx, newKeys(queue).task(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(m) == 0 {
+		return nil, ErrTaskNotFound
+	}
+	return parseTask(m), nil
+}
+
+// RunTask 立即执行延迟 重试中或者死信任务, 死信的失败次数清零
+func (i *Inspector) RunTask(ctx context.Context, queue, id string) error {
+	k := newKeys(queue)
+	res, err := runScript.Run(ctx, i.rdb, []string{k.scheduled, k.dead, k.pending, k.task(id)}, id).Int()
+	if err != nil {
+		return err
+	}
+	return stateErr(res)
+}
+
+// DeleteTask 删除没有在执行的任务
+func (i *Inspector) DeleteTask(ctx context.Context, queue, id string) error {
+	k := newKeys(queue)
+	res, err := deleteScript.Run(ctx, i.rdb, []string{k.pending, k.scheduled, k.dead, k.task(id)}, id).Int()
+	if err != nil {
+		return err
+	}
+	return stateErr(res)
+}
+
+func stateErr(res int) error {
+	switch res {
+	case -1:
+		return ErrTaskNotFound
+	case -2:
+		return ErrTaskActive
+	}
+	return nil
+}
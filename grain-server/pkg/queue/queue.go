@@ -0,0 +1,252 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queuex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	uuidx "github.com/go-grain/grain/pkg/uuid"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+// DefaultQueue 没有指定队列时使用的队列
+const DefaultQueue = "default"
+
+// 任务状态
+const (
+	StatePending   = "pending"
+	StateActive    = "active"
+	StateScheduled = "scheduled"
+	StateRetry     = "retry"
+	StateDead      = "dead"
+)
+
+var (
+	ErrTaskExists   = errors.New("任务已存在")
+	ErrTaskNotFound = errors.New("任务不存在")
+	ErrTaskActive   = errors.New("任务正在执行")
+	// SkipRetry 处理函数返回包装了 SkipRetry 的错误时不再重试, 直接进入死信队列
+	SkipRetry = errors.New("skip retry")
+)
+
+// Task 交给处理函数的任务
+type Task struct {
+	ID      string
+	Type    string
+	Queue   string
+	Payload []byte
+	// 已经失败的次数
+	Retried  int
+	MaxRetry int
+	Timeout  time.Duration
+}
+
+// Bind 把任务参数解析到 v
+func (t *Task) Bind(v any) error {
+	return json.Unmarshal(t.Payload, v)
+}
+
+// TaskInfo 任务详情, 供管理接口查看
+type TaskInfo struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Queue   string          `json:"queue"`
+	State   string          `json:"state"`
+	Payload json.RawMessage `json:"payload"`
+	Retried int             `json:"retried"`
+	// 最大重试次数
+	MaxRetry int `json:"maxRetry"`
+	// 超时时间, 单位秒, 0 表示使用 worker 的默认值
+	Timeout   int64     `json:"timeout"`
+	CreatedAt time.Time `json:"createdAt"`
+	// 计划执行时间, 重试中的任务为下一次重试时间, 死信为进入死信队列的时间
+	ProcessAt time.Time `json:"processAt"`
+	// 最后一次失败的时间以及原因
+	LastFailedAt *time.Time `json:"lastFailedAt"`
+	Error        string     `json:"error"`
+}
+
+type options struct {
+	queue     string
+	id        string
+	processAt time.Time
+	maxRetry  int
+	timeout   time.Duration
+}
+
+type Option func(o *options)
+
+// Queue 指定队列
+func Queue(name string) Option {
+	return func(o *options) { o.queue = name }
+}
+
+// TaskID 指定任务ID, 相同ID的任务没有完成之前再次入队返回 ErrTaskExists, 可以用来去重
+func TaskID(id string) Option {
+	return func(o *options) { o.id = id }
+}
+
+// Delay 延迟执行
+func Delay(d time.Duration) Option {
+	return func(o *options) { o.processAt = time.Now().Add(d) }
+}
+
+// ProcessAt 在指定时间执行
+func ProcessAt(t time.Time) Option {
+	return func(o *options) { o.processAt = t }
+}
+
+// MaxRetry 失败后最多重试的次数, 默认 5 次, 0 表示不重试
+func MaxRetry(n int) Option {
+	return func(o *options) { o.maxRetry = n }
+}
+
+// Timeout 单次执行的超时时间, 默认使用 worker 的配置
+func Timeout(d time.Duration) Option {
+	return func(o *options) { o.timeout = d }
+}
+
+// Client 投递任务
+type Client struct {
+	rdb redis.UniversalClient
+}
+
+func NewClient(rdb redis.UniversalClient) *Client {
+	return &Client{rdb: rdb}
+}
+
+// Enqueue 投递任务, payload 使用 JSON 编码, 处理函数中通过 Task.Bind 或者 Typed 解析
+func (c *Client) Enqueue(ctx context.Context, taskType string, payload any, opts ...Option) (*TaskInfo, error) {
+	o := options{queue: DefaultQueue, maxRetry: 5}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.id == "" {
+		o.id = uuidx.UID()
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if o.processAt.IsZero() || o.processAt.Before(now) {
+		o.processAt = now
+	}
+	k := newKeys(o.queue)
+	res, err := enqueueScript.Run(ctx, c.rdb, []string{k.task(o.id), k.pending, k.scheduled, k.dead},
+		o.id, taskType, data, o.maxRetry, int64(o.timeout/time.Second), now.UnixMilli(), o.processAt.UnixMilli(), now.UnixMilli(), o.queue,
+	).Int()
+	if err != nil {
+		return nil, err
+	}
+	if res == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrTaskExists, o.id)
+	}
+	// 队列名称单独保存, 和任务不在同一个 slot, 不放在脚本里
+	c.rdb.SAdd(ctx, queuesKey, o.queue)
+
+	state := StatePending
+	if o.processAt.After(now) {
+		state = StateScheduled
+	}
+	return &TaskInfo{
+		ID:        o.id,
+		Type:      taskType,
+		Queue:     o.queue,
+		State:     state,
+		Payload:   data,
+		MaxRetry:  o.maxRetry,
+		Timeout:   int64(o.timeout / time.Second),
+		CreatedAt: now,
+		ProcessAt: o.processAt,
+	}, nil
+}
+
+// queuesKey 全部队列名称
+const queuesKey = "queue:queues"
+
+// keys 同一个队列的 key 都带有 {队列名称} hash tag, 集群模式下落在同一个 slot, 可以在脚本中一起操作
+//
+// dequeueScript 和 forwardScript 处理的任务 id 要在脚本里从列表和有序集合中取出, 无法事先放进 KEYS,
+// 只能用 ARGV 传入 prefix 再拼接任务 key. 这依赖任务 key 与 KEYS 中的 key 带有同一个 hash tag,
+// 集群会把它们路由到同一个节点. 修改 prefix 时必须保留 {队列名称}, 否则集群模式下脚本会报 CROSSSLOT
+type keys struct {
+	prefix    string
+	pending   string
+	active    string
+	scheduled string
+	dead      string
+}
+
+func newKeys(queue string) keys {
+	prefix := "queue:{" + queue + "}:"
+	return keys{
+		prefix:    prefix + "t:",
+		pending:   prefix + "pending",
+		active:    prefix + "active",
+		scheduled: prefix + "scheduled",
+		dead:      prefix + "dead",
+	}
+}
+
+func (k keys) task(id string) string {
+	return k.prefix + id
+}
+
+// parseTask 解析 HGETALL 的结果
+func parseTask(m map[string]string) *TaskInfo {
+	info := &TaskInfo{
+		ID:      m["id"],
+		Type:    m["type"],
+		Queue:   m["queue"],
+		State:   m["state"],
+		Payload: json.RawMessage(m["payload"]),
+		Error:   m["error"],
+	}
+	info.Retried, _ = strconv.Atoi(m["retried"])
+	info.MaxRetry, _ = strconv.Atoi(m["max_retry"])
+	info.Timeout, _ = strconv.ParseInt(m["timeout"], 10, 64)
+	info.CreatedAt = parseMilli(m["created_at"])
+	info.ProcessAt = parseMilli(m["process_at"])
+	if t := parseMilli(m["last_failed_at"]); !t.IsZero() {
+		info.LastFailedAt = &t
+	}
+	return info
+}
+
+func parseMilli(s string) time.Time {
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// pairs 把 HGETALL 在脚本中返回的数组转成 map
+func pairs(v any) map[string]string {
+	list, _ := v.([]any)
+	m := make(map[string]string, len(list)/2)
+	for i := 0; i+1 < len(list); i += 2 {
+		k, _ := list[i].(string)
+		val, _ := list[i+1].(string)
+		m[k] = val
+	}
+	return m
+}
@@ -0,0 +1,286 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queuex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestRedis(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+	m := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return rdb, m
+}
+
+// waitState 等待任务进入指定状态, state 为空表示任务已经删除
+func waitState(t *testing.T, in *Inspector, queue, id, state string) *TaskInfo {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		info, err := in.GetTask(context.Background(), queue, id)
+		if state == "" && errors.Is(err, ErrTaskNotFound) {
+			return nil
+		}
+		if err == nil && info.State == state {
+			return info
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("task %s state = %+v, %v, want %q", id, info, err, state)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func startServer(t *testing.T, rdb redis.UniversalClient, h HandlerFunc) {
+	t.Helper()
+	srv := NewServer(rdb, Options{
+		PollInterval: 10 * time.Millisecond,
+		Lease:        time.Second,
+		Backoff:      func(int) time.Duration { return 0 },
+	})
+	srv.Handle("test", h)
+	srv.Start(context.Background())
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	})
+}
+
+func TestEnqueueDuplicate(t *testing.T) {
+	rdb, m := newTestRedis(t)
+	ctx := context.Background()
+	c := NewClient(rdb)
+
+	info, err := c.Enqueue(ctx, "test", map[string]int{"n": 1}, TaskID("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.State != StatePending || info.MaxRetry != 5 {
+		t.Errorf("info = %+v", info)
+	}
+	if _, err = c.Enqueue(ctx, "test", nil, TaskID("a")); !errors.Is(err, ErrTaskExists) {
+		t.Errorf("duplicate Enqueue = %v, want ErrTaskExists", err)
+	}
+	if info, _ = c.Enqueue(ctx, "test", nil, Delay(time.Hour)); info.State != StateScheduled {
+		t.Errorf("delayed task state = %s", info.State)
+	}
+	if ok, _ := m.SIsMember(queuesKey, DefaultQueue); !ok {
+		t.Error("queue name not recorded")
+	}
+}
+
+func TestRetryThenSucceed(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ctx := context.Background()
+	var calls atomic.Int32
+	var retried atomic.Int32
+	startServer(t, rdb, func(ctx context.Context, task *Task) error {
+		retried.Store(int32(task.Retried))
+		if calls.Add(1) == 1 {
+			return errors.New("first attempt fails")
+		}
+		return nil
+	})
+
+	info, err := NewClient(rdb).Enqueue(ctx, "test", nil, MaxRetry(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, NewInspector(rdb), DefaultQueue, info.ID, "")
+	if calls.Load() != 2 || retried.Load() != 1 {
+		t.Errorf("calls = %d, retried = %d, want 2 and 1", calls.Load(), retried.Load())
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ctx := context.Background()
+	startServer(t, rdb, func(ctx context.Context, task *Task) error {
+		if string(task.Payload) == `"skip"` {
+			return fmt.Errorf("bad payload: %w", SkipRetry)
+		}
+		return errors.New("always fails")
+	})
+	c := NewClient(rdb)
+	in := NewInspector(rdb)
+
+	// 重试次数用完
+	exhausted, err := c.Enqueue(ctx, "test", "fail", MaxRetry(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := waitState(t, in, DefaultQueue, exhausted.ID, StateDead)
+	if info.Retried != 2 || info.Error != "always fails" || info.LastFailedAt == nil {
+		t.Errorf("dead task = %+v", info)
+	}
+
+	// SkipRetry 不再重试
+	skipped, err := c.Enqueue(ctx, "test", "skip", MaxRetry(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info = waitState(t, in, DefaultQueue, skipped.ID, StateDead); info.Retried != 1 {
+		t.Errorf("skipped task retried = %d, want 1", info.Retried)
+	}
+
+	// 死信可以被相同ID的新任务覆盖
+	if _, err = c.Enqueue(ctx, "test", "skip", TaskID(skipped.ID)); err != nil {
+		t.Errorf("Enqueue over a dead task = %v", err)
+	}
+	waitState(t, in, DefaultQueue, skipped.ID, StateDead)
+	list, total, err := in.ListTasks(ctx, DefaultQueue, StateDead, 1, 10)
+	if err != nil || total != 2 || len(list) != 2 {
+		t.Errorf("dead list = %d/%d, %v, want 2", len(list), total, err)
+	}
+
+	// 手动重新执行死信, 失败次数清零
+	if err = in.RunTask(ctx, DefaultQueue, exhausted.ID); err != nil {
+		t.Fatal(err)
+	}
+	if info = waitState(t, in, DefaultQueue, exhausted.ID, StateDead); info.Retried != 2 {
+		t.Errorf("rerun dead task retried = %d, want 2", info.Retried)
+	}
+}
+
+// hashTag 按集群规则取出 key 中参与 slot 计算的部分
+func hashTag(key string) string {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			return key[s+1 : s+1+e]
+		}
+	}
+	return key
+}
+
+// dequeueScript 和 forwardScript 用 prefix 拼接任务 key, 必须与 KEYS 落在同一个 slot
+func TestKeysHashTag(t *testing.T) {
+	for _, queue := range []string{DefaultQueue, "sms", "a:b"} {
+		k := newKeys(queue)
+		want := hashTag(k.pending)
+		if want != queue {
+			t.Errorf("queue %s: hash tag = %q", queue, want)
+		}
+		for _, key := range []string{k.active, k.scheduled, k.dead, k.task("id"), k.prefix + "id"} {
+			if got := hashTag(key); got != want {
+				t.Errorf("queue %s: key %s hash tag = %q, want %q", queue, key, got, want)
+			}
+		}
+	}
+}
+
+func TestLeaseExpiry(t *testing.T) {
+	rdb, m := newTestRedis(t)
+	ctx := context.Background()
+	c := NewClient(rdb)
+	k := newKeys(DefaultQueue)
+	now := time.Now()
+
+	// 领取后 worker 退出, 租约已经过期
+	dequeue := func() string {
+		t.Helper()
+		res, err := dequeueScript.Run(ctx, rdb, []string{k.pending, k.active}, now.Add(-time.Second).UnixMilli(), k.prefix).Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pairs(res)["id"]
+	}
+	forward := func(deadBefore time.Time) {
+		t.Helper()
+		err := forwardScript.Run(ctx, rdb, []string{k.scheduled, k.pending, k.active, k.dead},
+			now.UnixMilli(), k.prefix, 100, deadBefore.UnixMilli()).Err()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := c.Enqueue(ctx, "test", nil, TaskID("lease"), MaxRetry(1)); err != nil {
+		t.Fatal(err)
+	}
+	if id := dequeue(); id != "lease" {
+		t.Fatalf("dequeued %q", id)
+	}
+	forward(time.Time{})
+	if state := m.HGet(k.task("lease"), "state"); state != StatePending {
+		t.Fatalf("state after lease expiry = %s, want pending", state)
+	}
+	if retried := m.HGet(k.task("lease"), "retried"); retried != "1" {
+		t.Errorf("retried = %s, want 1", retried)
+	}
+
+	// 过期的 worker 之后再回报结果不会改变任务状态
+	res, err := retryScript.Run(ctx, rdb, []string{k.active, k.scheduled, k.task("lease")},
+		"lease", now.UnixMilli(), "late", now.UnixMilli()).Int()
+	if err != nil || res != 0 {
+		t.Errorf("retry after lease expiry = %d, %v, want 0", res, err)
+	}
+
+	// 超过最大重试次数后进入死信
+	dequeue()
+	forward(time.Time{})
+	if state := m.HGet(k.task("lease"), "state"); state != StateDead {
+		t.Fatalf("state = %s, want dead", state)
+	}
+	if _, err = m.ZScore(k.dead, "lease"); err != nil {
+		t.Error("task not in the dead set")
+	}
+
+	// 超过保留时间的死信被删除
+	forward(now.Add(time.Second))
+	if m.Exists(k.task("lease")) {
+		t.Error("expired dead task not deleted")
+	}
+	if members, _ := m.ZMembers(k.dead); len(members) != 0 {
+		t.Errorf("dead set = %v, want empty", members)
+	}
+}
+
+func TestForwardScheduled(t *testing.T) {
+	rdb, m := newTestRedis(t)
+	ctx := context.Background()
+	k := newKeys(DefaultQueue)
+
+	if _, err := NewClient(rdb).Enqueue(ctx, "test", nil, TaskID("later"), Delay(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	run := func(now time.Time) {
+		err := forwardScript.Run(ctx, rdb, []string{k.scheduled, k.pending, k.active, k.dead},
+			now.UnixMilli(), k.prefix, 100, 0).Err()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	run(time.Now())
+	if state := m.HGet(k.task("later"), "state"); state != StateScheduled {
+		t.Errorf("state before due = %s", state)
+	}
+	run(time.Now().Add(2 * time.Minute))
+	if state := m.HGet(k.task("later"), "state"); state != StatePending {
+		t.Errorf("state after due = %s", state)
+	}
+	if list, _ := m.List(k.pending); len(list) != 1 || list[0] != "later" {
+		t.Errorf("pending = %v", list)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queuex
+
+import "github.com/redis/go-redis/v9"
+
+// 任务保存在 hash 中, 各个状态的集合只保存任务ID:
+// pending 列表 LPUSH 入队 RPOP 出队, active 有序集合的分数为租约到期时间,
+// scheduled 有序集合保存延迟任务以及等待重试的任务, 分数为执行时间, dead 有序集合的分数为进入时间
+
+// enqueueScript 已存在且不是死信时返回 0, 死信会被新任务覆盖
+// KEYS: task pending scheduled dead
+// ARGV: id type payload max_retry timeout created_at process_at now queue
+var enqueueScript = redis.NewScript(`
+local state = redis.call("HGET", KEYS[1], "state")
+if state and state ~= "dead" then
+	return 0
+end
+if state == "dead" then
+	redis.call("ZREM", KEYS[4], ARGV[1])
+	redis.call("DEL", KEYS[1])
+end
+redis.call("HSET", KEYS[1], "id", ARGV[1], "type", ARGV[2], "payload", ARGV[3], "queue", ARGV[9],
+	"retried", 0, "max_retry", ARGV[4], "timeout", ARGV[5], "created_at", ARGV[6], "process_at", ARGV[7])
+if tonumber(ARGV[7]) > tonumber(ARGV[8]) then
+	redis.call("HSET", KEYS[1], "state", "scheduled")
+	redis.call("ZADD", KEYS[3], ARGV[7], ARGV[1])
+else
+	redis.call("HSET", KEYS[1], "state", "pending")
+	redis.call("LPUSH", KEYS[2], ARGV[1])
+end
+return 1
+`)
+
+// dequeueScript 取出一个任务放入 active, 队列为空时返回 nil
+// KEYS: pending active
+// ARGV: lease_deadline task_prefix
+// 任务 key 由 task_prefix 拼接, 没有声明在 KEYS 中, 依赖 hash tag 与 KEYS 同 slot, 见 newKeys
+var dequeueScript = redis.NewScript(`
+while true do
+	local id = redis.call("RPOP", KEYS[1])
+	if not id then
+		return nil
+	end
+	local key = ARGV[2] .. id
+	if redis.call("EXISTS", key) == 1 then
+		redis.call("ZADD", KEYS[2], ARGV[1], id)
+		redis.call("HSET", key, "state", "active")
+		return redis.call("HGETALL", key)
+	end
+end
+`)
+
+// doneScript 执行成功后删除任务, 租约过期后被重新放回队列的也一并删除
+// KEYS: active pending scheduled task
+// ARGV: id
+var doneScript = redis.NewScript(`
+if redis.call("ZREM", KEYS[1], ARGV[1]) == 0 then
+	redis.call("LREM", KEYS[2], 0, ARGV[1])
+	redis.call("ZREM", KEYS[3], ARGV[1])
+end
+redis.call("DEL", KEYS[4])
+return 1
+`)
+
+// retryScript 执行失败等待重试, 租约已经失效时返回 0
+// KEYS: active scheduled task
+// ARGV: id retry_at error now
+var retryScript = redis.NewScript(`
+if redis.call("ZREM", KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call("HINCRBY", KEYS[3], "retried", 1)
+redis.call("HSET", KEYS[3], "state", "retry", "error", ARGV[3], "last_failed_at", ARGV[4], "process_at", ARGV[2])
+redis.call("ZADD", KEYS[2], ARGV[2], ARGV[1])
+return 1
+`)
+
+// killScript 重试次数用完或者不可重试的错误, 放入死信队列
+// KEYS: active dead task
+// ARGV: id now error
+var killScript = redis.NewScript(`
+if redis.call("ZREM", KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call("HINCRBY", KEYS[3], "retried", 1)
+redis.call("HSET", KEYS[3], "state", "dead", "error", ARGV[3], "last_failed_at", ARGV[2], "process_at", ARGV[2])
+redis.call("ZADD", KEYS[2], ARGV[2], ARGV[1])
+return 1
+`)
+
+// requeueScript 程序退出时没有执行完的任务原样放回队列头部, 不计入失败次数
+// KEYS: active pending task
+// ARGV: id
+var requeueScript = redis.NewScript(`
+if redis.call("ZREM", KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call("HSET", KEYS[3], "state", "pending")
+redis.call("RPUSH", KEYS[2], ARGV[1])
+return 1
+`)
+
+// extendScript 续租
+// KEYS: active
+// ARGV: lease_deadline id
+var extendScript = redis.NewScript(`
+return redis.call("ZADD", KEYS[1], "XX", ARGV[1], ARGV[2])
+`)
+
+// forwardScript 把到期的延迟任务以及重试任务放回队列, 租约过期的任务视为 worker 异常退出,
+// 计一次失败后放回队列, 同时清理超过保留时间的死信
+// KEYS: scheduled pending active dead
+// ARGV: now task_prefix limit dead_before
+// 任务 key 由 task_prefix 拼接, 没有声明在 KEYS 中, 依赖 hash tag 与 KEYS 同 slot, 见 newKeys
+var forwardScript = redis.NewScript(`
+local ids = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[3])
+for _, id in ipairs(ids) do
+	redis.call("ZREM", KEYS[1], id)
+	redis.call("HSET", ARGV[2] .. id, "state", "pending")
+	redis.call("LPUSH", KEYS[2], id)
+end
+local expired = redis.call("ZRANGEBYSCORE", KEYS[3], "-inf", ARGV[1], "LIMIT", 0, ARGV[3])
+for _, id in ipairs(expired) do
+	redis.call("ZREM", KEYS[3], id)
+	local key = ARGV[2] .. id
+	if redis.call("EXISTS", key) == 1 then
+		local retried = redis.call("HINCRBY", key, "retried", 1)
+		local max = tonumber(redis.call("HGET", key, "max_retry")) or 0
+		redis.call("HSET", key, "error", "租约过期, worker 可能已经退出", "last_failed_at", ARGV[1])
+		if retried > max then
+			redis.call("HSET", key, "state", "dead", "process_at", ARGV[1])
+			redis.call("ZADD", KEYS[4], ARGV[1], id)
+		else
+			redis.call("HSET", key, "state", "pending")
+			redis.call("LPUSH", KEYS[2], id)
+		end
+	end
+end
+local old = redis.call("ZRANGEBYSCORE", KEYS[4], "-inf", ARGV[4], "LIMIT", 0, ARGV[3])
+for _, id in ipairs(old) do
+	redis.call("ZREM", KEYS[4], id)
+	redis.call("DEL", ARGV[2] .. id)
+end
+return #ids + #expired
+`)
+
+// runScript 立即执行延迟 重试中以及死信任务, 死信的失败次数清零.
+// 返回 1 成功, 0 已经在队列中, -1 不存在, -2 正在执行
+// KEYS: scheduled dead pending task
+// ARGV: id
+var runScript = redis.NewScript(`
+local state = redis.call("HGET", KEYS[4], "state")
+if not state then
+	return -1
+end
+if state == "active" then
+	return -2
+end
+if state == "pending" then
+	return 0
+end
+redis.call("ZREM", KEYS[1], ARGV[1])
+redis.call("ZREM", KEYS[2], ARGV[1])
+if state == "dead" then
+	redis.call("HSET", KEYS[4], "retried", 0)
+end
+redis.call("HSET", KEYS[4], "state", "pending")
+redis.call("LPUSH", KEYS[3], ARGV[1])
+return 1
+`)
+
+// deleteScript 删除没有在执行的任务, 返回 1 成功, -1 不存在, -2 正在执行
+// KEYS: pending scheduled dead task
+// ARGV: id
+var deleteScript = redis.NewScript(`
+local state = redis.call("HGET", KEYS[4], "state")
+if not state then
+	return -1
+end
+if state == "active" then
+	return -2
+end
+redis.call("LREM", KEYS[1], 0, ARGV[1])
+redis.call("ZREM", KEYS[2], ARGV[1])
+redis.call("ZREM", KEYS[3], ARGV[1])
+redis.call("DEL", KEYS[4])
+return 1
+`)
@@ -0,0 +1,353 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queuex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 执行结果, 传给 Options.OnResult
+const (
+	ResultSuccess = "success"
+	ResultRetry   = "retry"
+	ResultDead    = "dead"
+)
+
+// HandlerFunc 任务处理函数, 返回错误时按退避时间重试, ctx 在超时或者程序退出时取消
+type HandlerFunc func(ctx context.Context, task *Task) error
+
+// Typed 把参数类型为 T 的处理函数转成 HandlerFunc, 参数解析失败时不再重试
+func Typed[T any](fn func(ctx context.Context, payload T) error) HandlerFunc {
+	return func(ctx context.Context, task *Task) error {
+		var payload T
+		if err := task.Bind(&payload); err != nil {
+			return fmt.Errorf("解析任务参数失败: %v: %w", err, SkipRetry)
+		}
+		return fn(ctx, payload)
+	}
+}
+
+type retryIn struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *retryIn) Error() string { return e.err.Error() }
+func (e *retryIn) Unwrap() error { return e.err }
+
+// RetryIn 指定本次失败后的重试间隔, 覆盖 Options.Backoff
+func RetryIn(err error, delay time.Duration) error {
+	return &retryIn{err: err, delay: delay}
+}
+
+type Options struct {
+	// 每个队列的并发数, 默认只处理 default 队列, 并发 10
+	Queues map[string]int
+	// 队列为空时的轮询间隔, 默认 1 秒
+	PollInterval time.Duration
+	// 租约时长, 执行期间定时续租, worker 异常退出后超过该时间任务重新入队, 默认 30 秒
+	Lease time.Duration
+	// 没有设置超时时间的任务的默认超时, 默认 30 分钟
+	Timeout time.Duration
+	// 死信保留时间, 默认 7 天
+	DeadRetention time.Duration
+	// 第 retried 次失败后的重试间隔, 默认从 10 秒开始指数退避, 最长 1 小时
+	Backoff func(retried int) time.Duration
+	// 每个任务执行结束后调用, 用于记录日志以及指标
+	OnResult func(task *Task, result string, err error)
+	// Redis 异常等不属于具体任务的错误
+	OnError func(err error)
+}
+
+type Server struct {
+	rdb      redis.UniversalClient
+	opts     Options
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+
+	// fetch 取消后不再领取新任务, run 取消后正在执行的任务收到取消信号
+	fetchCtx    context.Context
+	stopFetch   context.CancelFunc
+	runCtx      context.Context
+	cancelRun   context.CancelFunc
+	fetchers    sync.WaitGroup
+	processings sync.WaitGroup
+}
+
+func NewServer(rdb redis.UniversalClient, opts Options) *Server {
+	if len(opts.Queues) == 0 {
+		opts.Queues = map[string]int{DefaultQueue: 10}
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = 30 * time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Minute
+	}
+	if opts.DeadRetention <= 0 {
+		opts.DeadRetention = 7 * 24 * time.Hour
+	}
+	if opts.Backoff == nil {
+		opts.Backoff = DefaultBackoff
+	}
+	s := &Server{
+		rdb:      rdb,
+		opts:     opts,
+		handlers: map[string]HandlerFunc{},
+	}
+	s.fetchCtx, s.stopFetch = context.WithCancel(context.Background())
+	s.runCtx, s.cancelRun = context.WithCancel(context.Background())
+	return s
+}
+
+// DefaultBackoff 10s 20s 40s ... 最长 1 小时, 加上最多 10% 的随机抖动
+func DefaultBackoff(retried int) time.Duration {
+	if retried < 1 {
+		retried = 1
+	}
+	d := time.Hour
+	if retried <= 9 {
+		d = 10 * time.Second << (retried - 1)
+	}
+	if d > time.Hour {
+		d = time.Hour
+	}
+	return d + time.Duration(rand.Int63n(int64(d/10)+1))
+}
+
+// Handle 注册任务类型的处理函数
+func (s *Server) Handle(taskType string, h HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[taskType] = h
+}
+
+// Queues 处理的队列, 按名称排序
+func (s *Server) Queues() []string {
+	names := make([]string, 0, len(s.opts.Queues))
+	for name := range s.opts.Queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Start 为每个队列启动领取任务的协程, 以及把到期任务放回队列的协程
+func (s *Server) Start(ctx context.Context) {
+	for name, concurrency := range s.opts.Queues {
+		if concurrency <= 0 {
+			concurrency = 1
+		}
+		// 让新部署的实例也能在管理接口中看到空队列
+		s.rdb.SAdd(ctx, queuesKey, name)
+		s.fetchers.Add(1)
+		go s.fetch(name, concurrency)
+	}
+	s.fetchers.Add(1)
+	go s.forward()
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.stopFetch()
+		case <-s.fetchCtx.Done():
+		}
+	}()
+}
+
+// Shutdown 停止领取新任务, 等待正在执行的任务结束, ctx 超时后取消它们并放回队列
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stopFetch()
+	s.fetchers.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		s.processings.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.cancelRun()
+		// 处理函数响应取消后会把任务放回队列, 不响应的等租约过期后由其他实例接手
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+		}
+		return ctx.Err()
+	}
+}
+
+func (s *Server) fetch(queue string, concurrency int) {
+	defer s.fetchers.Done()
+	k := newKeys(queue)
+	sem := make(chan struct{}, concurrency)
+	for {
+		select {
+		case <-s.fetchCtx.Done():
+			return
+		case sem <- struct{}{}:
+		}
+		res, err := dequeueScript.Run(s.fetchCtx, s.rdb, []string{k.pending, k.active},
+			time.Now().Add(s.opts.Lease).UnixMilli(), k.prefix,
+		).Result()
+		if err != nil {
+			<-sem
+			if !errors.Is(err, redis.Nil) && s.fetchCtx.Err() == nil {
+				s.error(fmt.Errorf("领取任务 %s: %w", queue, err))
+			}
+			select {
+			case <-s.fetchCtx.Done():
+				return
+			case <-time.After(s.opts.PollInterval):
+			}
+			continue
+		}
+
+		info := parseTask(pairs(res))
+		task := &Task{
+			ID:       info.ID,
+			Type:     info.Type,
+			Queue:    queue,
+			Payload:  info.Payload,
+			Retried:  info.Retried,
+			MaxRetry: info.MaxRetry,
+			Timeout:  time.Duration(info.Timeout) * time.Second,
+		}
+		s.processings.Add(1)
+		go func() {
+			defer func() { <-sem }()
+			defer s.processings.Done()
+			s.process(k, task)
+		}()
+	}
+}
+
+func (s *Server) process(k keys, task *Task) {
+	timeout := task.Timeout
+	if timeout <= 0 {
+		timeout = s.opts.Timeout
+	}
+	ctx, cancel := context.WithTimeout(s.runCtx, timeout)
+	defer cancel()
+	go s.heartbeat(ctx, k, task.ID)
+
+	err := s.call(ctx, task)
+	// Redis 操作不使用任务的 ctx, 超时或者退出时也要能更新任务状态
+	bg := context.Background()
+	now := time.Now()
+	switch {
+	case err == nil:
+		err = doneScript.Run(bg, s.rdb, []string{k.active, k.pending, k.scheduled, k.task(task.ID)}, task.ID).Err()
+		s.result(task, ResultSuccess, nil)
+	case s.runCtx.Err() != nil:
+		err = requeueScript.Run(bg, s.rdb, []string{k.active, k.pending, k.task(task.ID)}, task.ID).Err()
+	case errors.Is(err, SkipRetry) || task.Retried >= task.MaxRetry:
+		s.result(task, ResultDead, err)
+		err = killScript.Run(bg, s.rdb, []string{k.active, k.dead, k.task(task.ID)}, task.ID, now.UnixMilli(), err.Error()).Err()
+	default:
+		delay := s.opts.Backoff(task.Retried + 1)
+		var r *retryIn
+		if errors.As(err, &r) {
+			delay = r.delay
+		}
+		s.result(task, ResultRetry, err)
+		err = retryScript.Run(bg, s.rdb, []string{k.active, k.scheduled, k.task(task.ID)},
+			task.ID, now.Add(delay).UnixMilli(), err.Error(), now.UnixMilli(),
+		).Err()
+	}
+	if err != nil {
+		s.error(fmt.Errorf("更新任务 %s 状态: %w", task.ID, err))
+	}
+}
+
+// call 执行处理函数, 没有注册处理函数以及 panic 都按失败处理
+func (s *Server) call(ctx context.Context, task *Task) (err error) {
+	s.mu.RLock()
+	h, ok := s.handlers[task.Type]
+	s.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("任务类型 %s 没有注册处理函数: %w", task.Type, SkipRetry)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h(ctx, task)
+}
+
+// heartbeat 执行期间每隔 1/3 租约时长续租一次
+func (s *Server) heartbeat(ctx context.Context, k keys, id string) {
+	ticker := time.NewTicker(s.opts.Lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := extendScript.Run(context.Background(), s.rdb, []string{k.active}, time.Now().Add(s.opts.Lease).UnixMilli(), id).Err()
+		if err != nil {
+			s.error(fmt.Errorf("任务 %s 续租: %w", id, err))
+		}
+	}
+}
+
+// forward 每个轮询间隔把到期的延迟任务 重试任务以及租约过期的任务放回队列
+func (s *Server) forward() {
+	defer s.fetchers.Done()
+	ticker := time.NewTicker(s.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.fetchCtx.Done():
+			return
+		case <-ticker.C:
+		}
+		now := time.Now()
+		for _, queue := range s.Queues() {
+			k := newKeys(queue)
+			err := forwardScript.Run(s.fetchCtx, s.rdb, []string{k.scheduled, k.pending, k.active, k.dead},
+				now.UnixMilli(), k.prefix, 100, now.Add(-s.opts.DeadRetention).UnixMilli(),
+			).Err()
+			if err != nil && s.fetchCtx.Err() == nil {
+				s.error(fmt.Errorf("转移到期任务 %s: %w", queue, err))
+			}
+		}
+	}
+}
+
+func (s *Server) result(task *Task, result string, err error) {
+	if s.opts.OnResult != nil {
+		s.opts.OnResult(task, result, err)
+	}
+}
+
+func (s *Server) error(err error) {
+	if s.opts.OnError != nil {
+		s.opts.OnError(err)
+	}
+}
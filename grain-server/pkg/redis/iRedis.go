@@ -1,39 +1,58 @@
 package redisx
 
 import (
+	"context"
 	"github.com/redis/go-redis/v9"
 	"time"
 )
 
+// Nil key 不存在时 Get 以及 GetObject 返回的错误
+const Nil = redis.Nil
+
+// IRedis 业务代码使用的 Redis 操作, 第一个参数都是 ctx, 请求结束或者超时后命令随之取消,
+// 过期时间为 0 表示不过期
 type IRedis interface {
-	Subscribe(channel string) *redis.PubSub
-	Publish(data []byte, channel string) error
-	Set(key string, value interface{}, ex time.Duration)
-	Get(key string) string
-	Del(key string) int64
-	GetInt64(key string) (int64, error)
-	GetInt(key string) (int, error)
-	SetInt(key string, value int64, expiration time.Duration) error
-	IncrInt(key string, value int64) (int64, error)
-	DecrInt(key string, value int64) (int64, error)
-	GetFloat(key string) (float64, error)
-	IncrFloat(key string, value float64) (float64, error)
-	SetFloat(key string, value float64, expiration time.Duration) error
-	GetObject(key string, v interface{}) error
-	SetObject(key string, value interface{}, expiration time.Duration) error
-	Incr(key string, value interface{}) (interface{}, error)
-	SetEx(key string, t time.Duration)
-	Exists(key string) (bool, error)
-	UserSign(userID string) error
-	ZRange(key string) []string
-	ZAdd(key string, data interface{}) error
-	SetNX(key string, value interface{}, expiration time.Duration) error
-	Scan(key string, count int64) []string
-	GetTTL(key string) float64
-	Enqueue(key string, item interface{}) error
-	Dequeue(key string, item interface{}) error
-	Peek(key string, item interface{}) error
-	Length(key string) (int64, error)
-	Clear(key string) error
-	EnqueueWithTTL(key string, item interface{}, ttl time.Duration) error
+	Subscribe(ctx context.Context, channels ...string) *redis.PubSub
+	Publish(ctx context.Context, channel string, message interface{}) error
+
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+	// SetNX key 不存在时写入, 已存在返回 false
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error)
+	// Del 集群模式下多个 key 需要使用相同的 hash tag, 如 a:{id} a:{id}:b
+	Del(ctx context.Context, keys ...string) (int64, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Expire(ctx context.Context, key string, expiration time.Duration) (bool, error)
+	// TTL key 不存在时返回 -2ns, 没有过期时间返回 -1ns
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	// Scan 返回匹配 match 的全部 key, count 为每一批扫描的数量, 集群模式下会扫描所有主节点
+	Scan(ctx context.Context, match string, count int64) ([]string, error)
+
+	// GetInt GetInt64 GetFloat key 不存在时返回 0
+	GetInt(ctx context.Context, key string) (int, error)
+	GetInt64(ctx context.Context, key string) (int64, error)
+	GetFloat(ctx context.Context, key string) (float64, error)
+	IncrBy(ctx context.Context, key string, value int64) (int64, error)
+	DecrBy(ctx context.Context, key string, value int64) (int64, error)
+	IncrByFloat(ctx context.Context, key string, value float64) (float64, error)
+
+	// GetObject SetObject 使用 JSON 编码
+	GetObject(ctx context.Context, key string, v interface{}) error
+	SetObject(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+
+	ZAdd(ctx context.Context, key string, members ...redis.Z) error
+	ZRange(ctx context.Context, key string, start, stop int64) ([]string, error)
+	SAdd(ctx context.Context, key string, members ...interface{}) error
+	SMembers(ctx context.Context, key string) ([]string, error)
+
+	// Pipelined 批量发送命令, 减少往返次数, 不保证原子性
+	Pipelined(ctx context.Context, fn func(pipe redis.Pipeliner) error) ([]redis.Cmder, error)
+	// TxPipelined 使用 MULTI/EXEC 原子执行, 集群模式下事务中的 key 需要在同一个槽位
+	TxPipelined(ctx context.Context, fn func(pipe redis.Pipeliner) error) ([]redis.Cmder, error)
+	// Watch 乐观锁事务, keys 在 fn 执行期间被其他客户端修改时返回 redis.TxFailedErr
+	Watch(ctx context.Context, fn func(tx *redis.Tx) error, keys ...string) error
+	// RunScript 执行 RegisterScript 注册的 Lua 脚本, 优先使用 EVALSHA
+	RunScript(ctx context.Context, script *Script, keys []string, args ...interface{}) (interface{}, error)
+	// LoadScripts 预先加载全部注册的脚本
+	LoadScripts(ctx context.Context) error
 }
@@ -0,0 +1,186 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisx
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// LimitResult 一次限流判断的结果
+type LimitResult struct {
+	// 是否放行
+	Allowed bool
+	// 窗口内允许的请求数 令牌桶为桶容量
+	Limit int64
+	// 剩余可用次数
+	Remaining int64
+	// 额度完全恢复还需要的时间
+	ResetAfter time.Duration
+	// 被拒绝时 距离下一次可以请求的时间
+	RetryAfter time.Duration
+}
+
+// Limiter 基于 Redis 的分布式限流器, 多个实例共享同一份计数
+type Limiter interface {
+	Allow(ctx context.Context, key string) (*LimitResult, error)
+}
+
+// tokenBucketScript 令牌桶, 使用 Redis 服务器时间避免多实例时钟不一致,
+// 读取 TIME 之后还要写入, 低版本 Redis 需要先开启 replicate_commands
+// KEYS[1] 桶 ARGV[1] 容量 ARGV[2] 每秒生成的令牌数 ARGV[3] 本次消耗的令牌数
+var tokenBucketScript = RegisterScript("token_bucket", `
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local requested = tonumber(ARGV[3])
+redis.replicate_commands()
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate / 1000)
+
+local allowed = 0
+local retry = 0
+if tokens >= requested then
+	tokens = tokens - requested
+	allowed = 1
+else
+	retry = math.ceil((requested - tokens) * 1000 / rate)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tokens, 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity * 1000 / rate) + 1000)
+return {allowed, math.floor(tokens), retry, math.ceil((capacity - tokens) * 1000 / rate)}
+`)
+
+// slidingWindowScript 滑动窗口日志, 有序集合中保存窗口内每次请求的时间
+// KEYS[1] 窗口 ARGV[1] 窗口内最大请求数 ARGV[2] 窗口长度 毫秒 ARGV[3] 本次请求的唯一标识
+var slidingWindowScript = RegisterScript("sliding_window", `
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+redis.replicate_commands()
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], 0, now - window)
+local count = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[3])
+	count = count + 1
+	allowed = 1
+end
+redis.call('PEXPIRE', KEYS[1], window)
+
+local reset = window
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, limit - count, reset}
+`)
+
+type tokenBucket struct {
+	rdb      IRedis
+	capacity int64
+	rate     float64
+}
+
+// NewTokenBucket 令牌桶限流, 桶容量为 capacity, 每 period 匀速补满
+func NewTokenBucket(rdb IRedis, capacity int64, period time.Duration) Limiter {
+	rate := float64(capacity) / period.Seconds()
+	return &tokenBucket{rdb: rdb, capacity: capacity, rate: rate}
+}
+
+func (l *tokenBucket) Allow(ctx context.Context, key string) (*LimitResult, error) {
+	if l.capacity <= 0 || l.rate <= 0 {
+		return nil, errors.New("令牌桶参数不正确")
+	}
+	res, err := l.rdb.RunScript(ctx, tokenBucketScript, []string{key}, l.capacity, l.rate, 1)
+	if err != nil {
+		return nil, err
+	}
+	v, err := scriptInts(res, 4)
+	if err != nil {
+		return nil, err
+	}
+	return &LimitResult{
+		Allowed:    v[0] == 1,
+		Limit:      l.capacity,
+		Remaining:  v[1],
+		RetryAfter: time.Duration(v[2]) * time.Millisecond,
+		ResetAfter: time.Duration(v[3]) * time.Millisecond,
+	}, nil
+}
+
+type slidingWindow struct {
+	rdb    IRedis
+	limit  int64
+	window time.Duration
+}
+
+// NewSlidingWindow 滑动窗口限流, 任意 window 时间内最多 limit 次请求
+func NewSlidingWindow(rdb IRedis, limit int64, window time.Duration) Limiter {
+	return &slidingWindow{rdb: rdb, limit: limit, window: window}
+}
+
+func (l *slidingWindow) Allow(ctx context.Context, key string) (*LimitResult, error) {
+	if l.limit <= 0 || l.window < time.Millisecond {
+		return nil, errors.New("滑动窗口参数不正确")
+	}
+	member := strconv.FormatInt(time.Now().UnixNano(), 36) + strconv.FormatInt(rand.Int63(), 36)
+	res, err := l.rdb.RunScript(ctx, slidingWindowScript, []string{key}, l.limit, l.window.Milliseconds(), member)
+	if err != nil {
+		return nil, err
+	}
+	v, err := scriptInts(res, 3)
+	if err != nil {
+		return nil, err
+	}
+	r := &LimitResult{
+		Allowed:    v[0] == 1,
+		Limit:      l.limit,
+		Remaining:  v[1],
+		ResetAfter: time.Duration(v[2]) * time.Millisecond,
+	}
+	if !r.Allowed {
+		r.RetryAfter = r.ResetAfter
+	}
+	return r, nil
+}
+
+func scriptInts(res interface{}, n int) ([]int64, error) {
+	list, ok := res.([]interface{})
+	if !ok || len(list) < n {
+		return nil, errors.New("限流脚本返回值格式不正确")
+	}
+	v := make([]int64, n)
+	for i := 0; i < n; i++ {
+		if v[i], ok = list[i].(int64); !ok {
+			return nil, errors.New("限流脚本返回值格式不正确")
+		}
+	}
+	return v, nil
+}
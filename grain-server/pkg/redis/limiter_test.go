@@ -0,0 +1,108 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisx
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	rdb, m := newTestRedis(t)
+	now := time.Now()
+	m.SetTime(now)
+	ctx := context.Background()
+	limiter := NewTokenBucket(rdb, 3, 3*time.Second)
+
+	for i := 0; i < 3; i++ {
+		res, err := limiter.Allow(ctx, "bucket")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Allowed || res.Remaining != int64(2-i) || res.Limit != 3 {
+			t.Fatalf("request %d = %+v", i, res)
+		}
+	}
+	res, err := limiter.Allow(ctx, "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed || res.RetryAfter != time.Second || res.ResetAfter != 3*time.Second {
+		t.Fatalf("over limit = %+v, want denied and retry after 1s", res)
+	}
+	// 其他 key 不受影响
+	if res, _ = limiter.Allow(ctx, "other"); !res.Allowed {
+		t.Error("other key denied")
+	}
+
+	// 每秒补充一个令牌
+	m.SetTime(now.Add(time.Second))
+	if res, _ = limiter.Allow(ctx, "bucket"); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("after refill = %+v", res)
+	}
+	if res, _ = limiter.Allow(ctx, "bucket"); res.Allowed {
+		t.Errorf("second request after refill = %+v, want denied", res)
+	}
+	if ttl := m.TTL("bucket"); ttl <= 0 || ttl > 4*time.Second {
+		t.Errorf("bucket ttl = %v", ttl)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	rdb, m := newTestRedis(t)
+	now := time.Now()
+	m.SetTime(now)
+	ctx := context.Background()
+	limiter := NewSlidingWindow(rdb, 2, time.Second)
+
+	for i := 0; i < 2; i++ {
+		res, err := limiter.Allow(ctx, "window")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Allowed || res.Remaining != int64(1-i) {
+			t.Fatalf("request %d = %+v", i, res)
+		}
+		m.SetTime(now.Add(400 * time.Millisecond))
+	}
+	res, err := limiter.Allow(ctx, "window")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 最早的请求在 600ms 后滑出窗口
+	if res.Allowed || res.Remaining != 0 || res.RetryAfter != 600*time.Millisecond {
+		t.Fatalf("over limit = %+v, want denied and retry after 600ms", res)
+	}
+
+	m.SetTime(now.Add(1001 * time.Millisecond))
+	if res, _ = limiter.Allow(ctx, "window"); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("after the first request left the window = %+v", res)
+	}
+	if n, _ := m.ZMembers("window"); len(n) != 2 {
+		t.Errorf("window members = %v, want 2", n)
+	}
+}
+
+func TestLimiterInvalidOptions(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ctx := context.Background()
+	if _, err := NewTokenBucket(rdb, 0, time.Second).Allow(ctx, "k"); err == nil {
+		t.Error("token bucket with zero capacity allowed")
+	}
+	if _, err := NewSlidingWindow(rdb, 1, time.Microsecond).Allow(ctx, "k"); err == nil {
+		t.Error("sliding window shorter than 1ms allowed")
+	}
+}
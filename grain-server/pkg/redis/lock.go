@@ -0,0 +1,169 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotObtained 锁已经被其他客户端持有
+	ErrNotObtained = errors.New("redisx: 锁已被占用")
+	// ErrLockLost 续租失败或者锁已过期, 锁可能已经被其他客户端持有
+	ErrLockLost = errors.New("redisx: 锁已丢失")
+)
+
+// lockRefreshScript 仍然持有锁时续租
+var lockRefreshScript = RegisterScript("lock_refresh", `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// lockReleaseScript 仍然持有锁时删除, 不会误删其他客户端的锁
+var lockReleaseScript = RegisterScript("lock_release", `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// Lock 分布式锁, 持有期间每隔 ttl/3 自动续租, 进程异常退出后锁在 ttl 后自动释放
+type Lock struct {
+	rdb   IRedis
+	key   string
+	token string
+	ttl   time.Duration
+
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
+	lost chan struct{}
+}
+
+// Obtain 获取锁, 已被其他客户端持有时返回 ErrNotObtained, 用完需要调用 Release
+func Obtain(ctx context.Context, rdb IRedis, key string, ttl time.Duration) (*Lock, error) {
+	if ttl < 30*time.Millisecond {
+		return nil, errors.New("redisx: 锁的有效期太短")
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	token := hex.EncodeToString(b)
+	ok, err := rdb.SetNX(ctx, key, token, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotObtained
+	}
+	l := &Lock{
+		rdb:   rdb,
+		key:   key,
+		token: token,
+		ttl:   ttl,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+		lost:  make(chan struct{}),
+	}
+	go l.renew()
+	return l, nil
+}
+
+// lockRetryInterval ObtainWait 重试获取锁的间隔
+const lockRetryInterval = 50 * time.Millisecond
+
+// ObtainWait 获取锁, 已被其他客户端持有时每隔一段时间重试, 等待超过 wait 后返回 ErrNotObtained
+func ObtainWait(ctx context.Context, rdb IRedis, key string, ttl, wait time.Duration) (*Lock, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		l, err := Obtain(ctx, rdb, key, ttl)
+		if !errors.Is(err, ErrNotObtained) || time.Now().After(deadline) {
+			return l, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Lost 锁丢失后关闭, 持有锁执行较长的操作时可以监听它提前中止
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Release 停止续租并释放锁, 锁已经丢失时返回 ErrLockLost
+func (l *Lock) Release(ctx context.Context) error {
+	l.once.Do(func() { close(l.stop) })
+	<-l.done
+	select {
+	case <-l.lost:
+		return ErrLockLost
+	default:
+	}
+	res, err := l.rdb.RunScript(ctx, lockReleaseScript, []string{l.key}, l.token)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.(int64); n == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// renew 续租失败时在锁到期之前一直重试, 确认锁不再属于自己或者已经到期后关闭 lost
+func (l *Lock) renew() {
+	defer close(l.done)
+	interval := l.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	expiresAt := time.Now().Add(l.ttl)
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		res, err := l.rdb.RunScript(ctx, lockRefreshScript, []string{l.key}, l.token, l.ttl.Milliseconds())
+		cancel()
+		if err == nil {
+			if n, _ := res.(int64); n == 0 {
+				close(l.lost)
+				return
+			}
+			expiresAt = start.Add(l.ttl)
+			continue
+		}
+		if time.Now().After(expiresAt) {
+			close(l.lost)
+			return
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestObtainRelease(t *testing.T) {
+	rdb, m := newTestRedis(t)
+	ctx := context.Background()
+
+	lock, err := Obtain(ctx, rdb, "lock", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Obtain(ctx, rdb, "lock", time.Second); !errors.Is(err, ErrNotObtained) {
+		t.Errorf("second Obtain = %v, want ErrNotObtained", err)
+	}
+	if err = lock.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if m.Exists("lock") {
+		t.Error("lock key left after Release")
+	}
+	// 重复释放不会删除别人的锁
+	other, err := Obtain(ctx, rdb, "lock", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Release(ctx)
+	if err = lock.Release(ctx); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Release twice = %v, want ErrLockLost", err)
+	}
+	if !m.Exists("lock") {
+		t.Error("released another client's lock")
+	}
+
+	if _, err = Obtain(ctx, rdb, "short", 10*time.Millisecond); err == nil {
+		t.Error("Obtain with a 10ms ttl succeeded")
+	}
+}
+
+func TestLockRenew(t *testing.T) {
+	rdb, m := newTestRedis(t)
+	ctx := context.Background()
+	ttl := 150 * time.Millisecond
+
+	lock, err := Obtain(ctx, rdb, "lock", ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Release(ctx)
+	// miniredis 只在 FastForward 时过期, 续租之后剩余时间恢复为 ttl
+	m.FastForward(100 * time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	for m.TTL("lock") <= 100*time.Millisecond {
+		if time.Now().After(deadline) {
+			t.Fatalf("lock not renewed, ttl = %v", m.TTL("lock"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-lock.Lost():
+		t.Fatal("lock lost after renewal")
+	default:
+	}
+}
+
+func TestLockLostWhenTaken(t *testing.T) {
+	rdb, m := newTestRedis(t)
+	ctx := context.Background()
+
+	lock, err := Obtain(ctx, rdb, "lock", 90*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 锁过期后被其他客户端拿到
+	if err = m.Set("lock", "other"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("Lost not closed after the key changed owner")
+	}
+	if err = lock.Release(ctx); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Release = %v, want ErrLockLost", err)
+	}
+	if v, _ := m.Get("lock"); v != "other" {
+		t.Errorf("lock value = %q, want the other client's", v)
+	}
+}
+
+func TestLockLostWhenUnreachable(t *testing.T) {
+	rdb, m := newTestRedis(t)
+	ctx := context.Background()
+
+	lock, err := Obtain(ctx, rdb, "lock", 90*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 续租一直失败, 超过 ttl 之后认为锁已经丢失
+	m.Close()
+	start := time.Now()
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("Lost not closed while Redis is unreachable")
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("lock lost after %v, before the ttl ran out", elapsed)
+	}
+	if err = lock.Release(ctx); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Release = %v, want ErrLockLost", err)
+	}
+}
+
+func TestObtainWait(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ctx := context.Background()
+
+	held, err := Obtain(ctx, rdb, "lock", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(100*time.Millisecond, func() { _ = held.Release(context.Background()) })
+	lock, err := ObtainWait(ctx, rdb, "lock", time.Second, time.Second)
+	if err != nil {
+		t.Fatalf("ObtainWait after release = %v", err)
+	}
+
+	start := time.Now()
+	if _, err = ObtainWait(ctx, rdb, "lock", time.Second, 100*time.Millisecond); !errors.Is(err, ErrNotObtained) {
+		t.Errorf("ObtainWait while held = %v, want ErrNotObtained", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("ObtainWait gave up after %v", elapsed)
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, 60*time.Millisecond)
+	defer cancel()
+	if _, err = ObtainWait(cctx, rdb, "lock", time.Second, time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ObtainWait with a cancelled context = %v", err)
+	}
+	_ = lock.Release(ctx)
+}
@@ -0,0 +1,57 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisx
+
+import (
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"sort"
+	"sync"
+)
+
+var (
+	scriptsMu sync.Mutex
+	scripts   = map[string]*Script{}
+)
+
+// Script 注册过的 Lua 脚本, 启动时通过 IRedis.LoadScripts 统一加载
+type Script struct {
+	*redis.Script
+	Name string
+}
+
+// RegisterScript 注册 Lua 脚本, 一般在包级变量中调用, 名称重复时 panic
+func RegisterScript(name, src string) *Script {
+	scriptsMu.Lock()
+	defer scriptsMu.Unlock()
+	if _, ok := scripts[name]; ok {
+		panic(fmt.Sprintf("redisx: 脚本 %s 重复注册", name))
+	}
+	s := &Script{Script: redis.NewScript(src), Name: name}
+	scripts[name] = s
+	return s
+}
+
+// Scripts 全部注册的脚本, 按名称排序
+func Scripts() []*Script {
+	scriptsMu.Lock()
+	defer scriptsMu.Unlock()
+	list := make([]*Script, 0, len(scripts))
+	for _, s := range scripts {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
@@ -4,8 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/go-grain/grain/log"
 	"github.com/go-grain/grain/pkg/encrypt"
-	"github.com/go-pay/gopay/pkg/xlog"
+	tracex "github.com/go-grain/grain/pkg/trace"
 	"time"
 )
 
@@ -13,6 +14,9 @@ var (
 	ReqOk ErrCode = 2000
 )
 
+// CodeKey 响应的业务 code 同时放进 gin.Context, 操作日志从这里读取
+const CodeKey = "resCode"
+
 type ErrCode int
 
 type IResponse interface {
@@ -43,6 +47,10 @@ type Response struct {
 	Total         int64       `json:"total,omitempty"`
 	Page          int         `json:"page,omitempty"`
 	PageSize      int         `json:"page_size,omitempty"`
+	// 请求ID, 与响应头 X-Request-ID 一致, 方便排查问题时关联日志
+	RequestID string `json:"request_id,omitempty"`
+	// 链路追踪ID, 与 traceparent 响应头中的 trace-id 一致
+	TraceID string `json:"trace_id,omitempty"`
 }
 
 func New() IResponse {
@@ -126,8 +134,10 @@ func (r *Response) Success(ctx *gin.Context) {
 		PageSize:  r.PageSize,
 		Page:      r.Page,
 		Time:      time.Now().UnixMilli(),
+		RequestID: tracex.RequestID(ctx),
+		TraceID:   tracex.TraceID(ctx),
 	}
-	ctx.JSON(200, s)
+	writeJSON(ctx, s)
 }
 
 func (r *Response) Fail(ctx *gin.Context) {
@@ -147,8 +157,10 @@ func (r *Response) Fail(ctx *gin.Context) {
 					Code:      r.Code,
 					Message:   "数据加密传输失败",
 					Time:      time.Now().UnixMilli(),
+					RequestID: tracex.RequestID(ctx),
+					TraceID:   tracex.TraceID(ctx),
 				}
-				ctx.JSON(200, s)
+				writeJSON(ctx, s)
 				return
 			}
 		}
@@ -164,8 +176,10 @@ func (r *Response) Fail(ctx *gin.Context) {
 		IV:        r.IV,
 		Encrypted: r.Encrypted,
 		Time:      time.Now().UnixMilli(),
+		RequestID: tracex.RequestID(ctx),
+		TraceID:   tracex.TraceID(ctx),
 	}
-	ctx.JSON(200, s)
+	writeJSON(ctx, s)
 }
 
 // 加密返回数据
@@ -180,7 +194,7 @@ func (r *Response) aesEncrypt(encryptKey string) error {
 	iv := []byte(ivStr)
 	aesEncrypt, err := encrypt.AesEncrypt(marshal, key, iv)
 	if err != nil {
-		xlog.Info("加密失败", err)
+		log.Error("加密失败: ", err)
 		r.WithData(nil)
 		return err
 	}
@@ -190,3 +204,8 @@ func (r *Response) aesEncrypt(encryptKey string) error {
 	r.WithData(aesEncrypt)
 	return nil
 }
+
+func writeJSON(ctx *gin.Context, s *Response) {
+	ctx.Set(CodeKey, int(s.Code))
+	ctx.JSON(200, s)
+}
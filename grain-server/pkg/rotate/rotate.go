@@ -0,0 +1,357 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rotatex
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat 归档文件名中的时间格式, 不使用冒号以兼容 Windows
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+const compressSuffix = ".gz"
+
+const megabyte = 1024 * 1024
+
+var _ io.WriteCloser = (*Writer)(nil)
+
+// Options 滚动日志配置
+type Options struct {
+	// Filename 当前写入的日志文件, 归档文件与它放在同一目录下
+	Filename string
+	// MaxSize 单个文件的最大体积, 单位 MB, 0 表示不按大小切割
+	MaxSize int
+	// Interval 按时间切割的周期, 例如 24h 表示每天零点切割, 0 表示不按时间切割
+	Interval time.Duration
+	// MaxBackups 最多保留的归档文件数量, 0 表示不限制
+	MaxBackups int
+	// MaxAge 归档文件最多保留的天数, 0 表示不限制
+	MaxAge int
+	// Compress 是否使用 gzip 压缩归档文件
+	Compress bool
+}
+
+// Writer 按大小和时间滚动的日志文件, 可以被多个 goroutine 并发写入
+//
+// 切割出来的文件命名为 name-2006-01-02T15-04-05.000.ext, 压缩、清理过期归档在后台 goroutine 中完成
+type Writer struct {
+	opts Options
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	next time.Time
+
+	millCh    chan struct{}
+	startMill sync.Once
+}
+
+// New 创建滚动日志文件, 文件在第一次写入时才会打开
+func New(opts Options) *Writer {
+	return &Writer{opts: opts}
+}
+
+// Write 写入日志, 单次写入超过 MaxSize 时返回错误
+func (w *Writer) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	size := int64(len(p))
+	if limit := w.maxSize(); limit > 0 && size > limit {
+		return 0, errors.New("rotate: write length exceeds maximum file size")
+	}
+
+	if w.file == nil {
+		if err = w.openExisting(size); err != nil {
+			return 0, err
+		}
+	}
+
+	if w.shouldRotate(size) {
+		if err = w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err = w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate 立即切割当前文件
+func (w *Writer) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rotate()
+}
+
+// Close 关闭当前文件
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.close()
+}
+
+func (w *Writer) close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *Writer) maxSize() int64 {
+	return int64(w.opts.MaxSize) * megabyte
+}
+
+func (w *Writer) shouldRotate(size int64) bool {
+	if limit := w.maxSize(); limit > 0 && w.size+size > limit {
+		return true
+	}
+	return w.opts.Interval > 0 && !time.Now().Before(w.next)
+}
+
+// openExisting 打开已有的日志文件继续追加, 文件不存在时新建
+// 周期起点按文件的最后修改时间计算, 这样服务重启后也能在正确的时间切割
+func (w *Writer) openExisting(size int64) error {
+	info, err := os.Stat(w.opts.Filename)
+	if os.IsNotExist(err) {
+		return w.openNew()
+	}
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(w.opts.Filename, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return w.openNew()
+	}
+	w.file = file
+	w.size = info.Size()
+	w.next = w.nextRotate(info.ModTime())
+	return nil
+}
+
+func (w *Writer) openNew() error {
+	if err := os.MkdirAll(filepath.Dir(w.opts.Filename), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(w.opts.Filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	w.file = file
+	w.size = 0
+	w.next = w.nextRotate(time.Now())
+	return nil
+}
+
+// rotate 把当前文件改名归档, 然后重新创建一个空文件
+func (w *Writer) rotate() error {
+	if err := w.close(); err != nil {
+		return err
+	}
+	if _, err := os.Stat(w.opts.Filename); err == nil {
+		if err = os.Rename(w.opts.Filename, w.backupName(time.Now())); err != nil {
+			return err
+		}
+	}
+	if err := w.openNew(); err != nil {
+		return err
+	}
+	w.mill()
+	return nil
+}
+
+// nextRotate 计算 t 所在周期的结束时间, 周期按本地时区对齐, 例如 24h 对齐到零点
+func (w *Writer) nextRotate(t time.Time) time.Time {
+	if w.opts.Interval <= 0 {
+		return time.Time{}
+	}
+	_, offset := t.Zone()
+	shift := time.Duration(offset) * time.Second
+	return t.Add(shift).Truncate(w.opts.Interval).Add(w.opts.Interval - shift)
+}
+
+func (w *Writer) backupName(t time.Time) string {
+	dir := filepath.Dir(w.opts.Filename)
+	prefix, ext := w.prefixAndExt()
+	return filepath.Join(dir, prefix+t.Format(backupTimeFormat)+ext)
+}
+
+func (w *Writer) prefixAndExt() (prefix, ext string) {
+	name := filepath.Base(w.opts.Filename)
+	ext = filepath.Ext(name)
+	prefix = strings.TrimSuffix(name, ext) + "-"
+	return
+}
+
+// mill 通知后台 goroutine 压缩并清理归档文件
+func (w *Writer) mill() {
+	w.startMill.Do(func() {
+		w.millCh = make(chan struct{}, 1)
+		go w.millRun()
+	})
+	select {
+	case w.millCh <- struct{}{}:
+	default:
+	}
+}
+
+func (w *Writer) millRun() {
+	for range w.millCh {
+		_ = w.millRunOnce()
+	}
+}
+
+type backupFile struct {
+	name      string
+	timestamp time.Time
+}
+
+func (w *Writer) millRunOnce() error {
+	if w.opts.MaxBackups == 0 && w.opts.MaxAge == 0 && !w.opts.Compress {
+		return nil
+	}
+
+	files, err := w.backupFiles()
+	if err != nil {
+		return err
+	}
+
+	var remove, compress []backupFile
+	if w.opts.MaxBackups > 0 && len(files) > w.opts.MaxBackups {
+		// 同一份归档可能同时存在压缩前后两个文件, 按去掉 .gz 后的名字计数
+		preserved := make(map[string]struct{})
+		var remaining []backupFile
+		for _, f := range files {
+			preserved[strings.TrimSuffix(f.name, compressSuffix)] = struct{}{}
+			if len(preserved) > w.opts.MaxBackups {
+				remove = append(remove, f)
+			} else {
+				remaining = append(remaining, f)
+			}
+		}
+		files = remaining
+	}
+	if w.opts.MaxAge > 0 {
+		cutoff := time.Now().Add(-time.Duration(w.opts.MaxAge) * 24 * time.Hour)
+		var remaining []backupFile
+		for _, f := range files {
+			if f.timestamp.Before(cutoff) {
+				remove = append(remove, f)
+			} else {
+				remaining = append(remaining, f)
+			}
+		}
+		files = remaining
+	}
+	if w.opts.Compress {
+		for _, f := range files {
+			if !strings.HasSuffix(f.name, compressSuffix) {
+				compress = append(compress, f)
+			}
+		}
+	}
+
+	dir := filepath.Dir(w.opts.Filename)
+	var errs []error
+	for _, f := range remove {
+		if err = os.Remove(filepath.Join(dir, f.name)); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	for _, f := range compress {
+		name := filepath.Join(dir, f.name)
+		if err = compressFile(name, name+compressSuffix); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// backupFiles 列出所有归档文件, 按时间从新到旧排序
+func (w *Writer) backupFiles() ([]backupFile, error) {
+	entries, err := os.ReadDir(filepath.Dir(w.opts.Filename))
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, ext := w.prefixAndExt()
+	var files []backupFile
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := e.Name()
+		ts := strings.TrimSuffix(name, compressSuffix)
+		if !strings.HasPrefix(ts, prefix) || !strings.HasSuffix(ts, ext) {
+			continue
+		}
+		ts = strings.TrimSuffix(strings.TrimPrefix(ts, prefix), ext)
+		t, err := time.ParseInLocation(backupTimeFormat, ts, time.Local)
+		if err != nil {
+			continue
+		}
+		files = append(files, backupFile{name: name, timestamp: t})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].timestamp.After(files[j].timestamp)
+	})
+	return files, nil
+}
+
+// compressFile 压缩归档文件, 成功后删除原文件
+func compressFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(dst)
+		}
+	}()
+
+	gz := gzip.NewWriter(out)
+	if _, err = io.Copy(gz, in); err != nil {
+		return err
+	}
+	if err = gz.Close(); err != nil {
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
@@ -0,0 +1,193 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rotatex
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeBackup 按归档文件名格式创建一个归档
+func writeBackup(t *testing.T, w *Writer, ts time.Time, content string) string {
+	t.Helper()
+	name := w.backupName(ts)
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Base(name)
+}
+
+func TestRotateOnSize(t *testing.T) {
+	dir := t.TempDir()
+	w := New(Options{Filename: filepath.Join(dir, "app.log"), MaxSize: 1})
+	defer w.Close()
+
+	chunk := bytes.Repeat([]byte("a"), 600*1024)
+	for i := 0; i < 2; i++ {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names := listDir(t, dir)
+	if len(names) != 2 {
+		t.Fatalf("files = %v, want current file and one backup", names)
+	}
+	info, err := os.Stat(filepath.Join(dir, "app.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len(chunk)) {
+		t.Errorf("current size = %d, want %d", info.Size(), len(chunk))
+	}
+
+	if _, err = w.Write(bytes.Repeat([]byte("a"), 2*megabyte)); err == nil {
+		t.Error("write larger than MaxSize succeeded")
+	}
+}
+
+func TestRotateKeepsExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(name, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w := New(Options{Filename: name, MaxSize: 1})
+	if _, err := w.Write([]byte("new\n")); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+	data, _ := os.ReadFile(name)
+	if string(data) != "old\nnew\n" {
+		t.Errorf("content = %q, want appended", data)
+	}
+}
+
+func TestNextRotate(t *testing.T) {
+	w := New(Options{Interval: 24 * time.Hour})
+	now := time.Date(2023, 5, 6, 15, 4, 5, 0, time.Local)
+	want := time.Date(2023, 5, 7, 0, 0, 0, 0, time.Local)
+	if got := w.nextRotate(now); !got.Equal(want) {
+		t.Errorf("nextRotate = %v, want %v", got, want)
+	}
+	if got := New(Options{}).nextRotate(now); !got.IsZero() {
+		t.Errorf("nextRotate without interval = %v, want zero", got)
+	}
+}
+
+func TestMillMaxBackups(t *testing.T) {
+	dir := t.TempDir()
+	w := New(Options{Filename: filepath.Join(dir, "app.log"), MaxBackups: 2})
+	now := time.Now()
+	var names []string
+	for i := 0; i < 4; i++ {
+		names = append(names, writeBackup(t, w, now.Add(-time.Duration(i)*time.Hour), "x"))
+	}
+	// 不是归档的文件不受影响
+	if err := os.WriteFile(filepath.Join(dir, "other.log"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.millRunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{names[1], names[0], "other.log"}
+	sort.Strings(want)
+	if got := listDir(t, dir); !equal(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+}
+
+func TestMillMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	w := New(Options{Filename: filepath.Join(dir, "app.log"), MaxAge: 7})
+	now := time.Now()
+	fresh := writeBackup(t, w, now.Add(-24*time.Hour), "x")
+	writeBackup(t, w, now.Add(-10*24*time.Hour), "x")
+
+	if err := w.millRunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if got := listDir(t, dir); !equal(got, []string{fresh}) {
+		t.Errorf("files = %v, want %v", got, []string{fresh})
+	}
+}
+
+func TestMillCompress(t *testing.T) {
+	dir := t.TempDir()
+	w := New(Options{Filename: filepath.Join(dir, "app.log"), Compress: true, MaxBackups: 1})
+	now := time.Now()
+	name := writeBackup(t, w, now, "hello grain\n")
+	// 旧归档已经压缩过, 按去掉 .gz 后的名字计数, 超出 MaxBackups 被删除
+	old := writeBackup(t, w, now.Add(-time.Hour), "old")
+	if err := os.Rename(filepath.Join(dir, old), filepath.Join(dir, old+compressSuffix)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.millRunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if got := listDir(t, dir); !equal(got, []string{name + compressSuffix}) {
+		t.Fatalf("files = %v, want %v", got, []string{name + compressSuffix})
+	}
+
+	f, err := os.Open(filepath.Join(dir, name+compressSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello grain\n" {
+		t.Errorf("content = %q", data)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smsx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	jsonx "github.com/go-grain/grain/pkg/encoding/json"
+)
+
+// HttpReply HTTP 渠道约定的响应格式, Code 为 0 表示受理成功
+type HttpReply struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Result
+}
+
+// HttpSender 通过 HTTP 接口投递短信, 请求体为 Message 的 JSON,
+// 可以对接自建的短信网关, 测试时对接 StubServer
+type HttpSender struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func NewHttpSender(url, token string, timeout time.Duration) *HttpSender {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &HttpSender{url: url, token: token, client: &http.Client{Timeout: timeout}}
+}
+
+func (s *HttpSender) Name() string {
+	return "http"
+}
+
+func (s *HttpSender) Send(ctx context.Context, msg *Message) (*Result, error) {
+	body := jsonx.Marshal(msg)
+	if body == nil {
+		return nil, errors.New("短信内容序列化失败")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("短信网关响应异常: %d %s", resp.StatusCode, data)
+	}
+	reply := HttpReply{}
+	if err = jsonx.Unmarshal(data, &reply); err != nil {
+		return nil, err
+	}
+	if reply.Code != 0 {
+		return nil, fmt.Errorf("短信网关拒绝发送: %s", reply.Message)
+	}
+	if reply.Status == "" {
+		reply.Status = StatusSent
+	}
+	return &reply.Result, nil
+}
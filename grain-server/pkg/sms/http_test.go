@@ -0,0 +1,60 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smsx
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHttpSenderWithStub(t *testing.T) {
+	stub := NewStubServer("secret")
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	ctx := context.Background()
+	msg := &Message{Mobile: "13800000000", SignName: "Grain", Template: "SMS_001", Params: map[string]string{"code": "123456"}, Content: "您的验证码是123456"}
+
+	res, err := NewHttpSender(srv.URL, "secret", time.Second).Send(ctx, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.MessageID != "stub-1" || res.Status != StatusSent {
+		t.Errorf("Send() = %+v", res)
+	}
+	got := stub.Messages()
+	if len(got) != 1 || got[0].Mobile != msg.Mobile || got[0].Params["code"] != "123456" {
+		t.Fatalf("stub received %+v", got)
+	}
+
+	// token 不正确
+	if _, err = NewHttpSender(srv.URL, "wrong", time.Second).Send(ctx, msg); err == nil {
+		t.Error("Send() with wrong token should fail")
+	}
+
+	// 网关拒绝发送
+	stub.SetFail(true)
+	if _, err = NewHttpSender(srv.URL, "secret", time.Second).Send(ctx, msg); err == nil {
+		t.Error("Send() should fail when the gateway rejects the message")
+	}
+	stub.SetFail(false)
+
+	stub.Reset()
+	if len(stub.Messages()) != 0 {
+		t.Error("Reset() should clear received messages")
+	}
+}
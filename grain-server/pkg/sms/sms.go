@@ -0,0 +1,126 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smsx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"text/template"
+)
+
+const (
+	StatusSent   = "sent"
+	StatusFailed = "failed"
+)
+
+var ErrTemplateNotFound = errors.New("短信模板不存在")
+
+// SmsSender 短信发送渠道, 不同服务商实现该接口即可接入
+type SmsSender interface {
+	// Name 渠道名称, 会记录到投递记录中
+	Name() string
+	Send(ctx context.Context, msg *Message) (*Result, error)
+}
+
+// Message 待发送的短信
+type Message struct {
+	Mobile   string `json:"mobile"`
+	SignName string `json:"signName"`
+	// Template 服务商侧的模板编号
+	Template string            `json:"template"`
+	Params   map[string]string `json:"params"`
+	// Content 本地渲染后的短信正文, 方便开发环境查看以及留档
+	Content string `json:"content"`
+}
+
+// Result 服务商返回的投递结果
+type Result struct {
+	MessageID string `json:"messageId"`
+	Status    string `json:"status"`
+}
+
+// Template 短信模板, Content 使用 text/template 语法, 例如 "您的验证码是{{.code}}"
+type Template struct {
+	Name    string
+	Code    string
+	Content string
+	tpl     *template.Template
+}
+
+// Registry 短信模板注册表
+type Registry struct {
+	mu        sync.RWMutex
+	templates map[string]*Template
+}
+
+func NewRegistry() *Registry {
+	return &Registry{templates: make(map[string]*Template)}
+}
+
+// Register 注册模板, 同名模板会被覆盖
+func (r *Registry) Register(name, code, content string) error {
+	tpl, err := template.New(name).Option("missingkey=zero").Parse(content)
+	if err != nil {
+		return fmt.Errorf("解析短信模板 %s 失败: %w", name, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.templates[name] = &Template{Name: name, Code: code, Content: content, tpl: tpl}
+	return nil
+}
+
+func (r *Registry) Exists(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.templates[name]
+	return ok
+}
+
+// MaskParams 返回一份参数值全部替换为 * 的副本, 用于留档, 避免验证码等内容落库
+func MaskParams(params map[string]string) map[string]string {
+	masked := make(map[string]string, len(params))
+	for k := range params {
+		masked[k] = "******"
+	}
+	return masked
+}
+
+// Build 根据模板名称和参数生成待发送的短信
+func (r *Registry) Build(name, mobile string, params map[string]string) (*Message, error) {
+	r.mu.RLock()
+	t, ok := r.templates[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, ErrTemplateNotFound
+	}
+
+	var buf bytes.Buffer
+	if err := t.tpl.Execute(&buf, params); err != nil {
+		return nil, err
+	}
+	code := t.Code
+	if code == "" {
+		code = t.Name
+	}
+	return &Message{
+		Mobile:   mobile,
+		Template: code,
+		Params:   params,
+		Content:  buf.String(),
+	}, nil
+}
@@ -0,0 +1,98 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smsx
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRegistryBuild(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register("captcha", "SMS_001", "您的验证码是{{.code}}"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("notice", "", "{{.name}} 您好"); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := r.Build("captcha", "13800000000", map[string]string{"code": "123456"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Template != "SMS_001" || msg.Content != "您的验证码是123456" || msg.Mobile != "13800000000" {
+		t.Errorf("Build() = %+v", msg)
+	}
+	// 没有服务商模板编号时使用模板名称
+	msg, err = r.Build("notice", "13800000000", map[string]string{"name": "grain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Template != "notice" || msg.Content != "grain 您好" {
+		t.Errorf("Build() = %+v", msg)
+	}
+
+	if _, err = r.Build("missing", "13800000000", nil); err != ErrTemplateNotFound {
+		t.Errorf("Build() err = %v, want %v", err, ErrTemplateNotFound)
+	}
+	if err = r.Register("bad", "", "{{.code"); err == nil {
+		t.Error("Register() should fail on invalid template")
+	}
+}
+
+func TestMaskParams(t *testing.T) {
+	params := map[string]string{"code": "123456"}
+	masked := MaskParams(params)
+	if params["code"] != "123456" {
+		t.Error("MaskParams() must not modify params")
+	}
+	r := NewRegistry()
+	_ = r.Register("captcha", "", "您的验证码是{{.code}}")
+	msg, err := r.Build("captcha", "13800000000", masked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(msg.Content, "123456") || !strings.Contains(msg.Content, "******") {
+		t.Errorf("masked content = %q", msg.Content)
+	}
+}
+
+func TestFileSender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sms", "sms.log")
+	s, err := NewFileSender(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Send(context.Background(), &Message{Mobile: "13800000000", Content: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "mobile=13800000000") || !strings.Contains(string(data), "content=hello") {
+		t.Errorf("file content = %q", data)
+	}
+	// 控制台输出不会被关闭
+	if err = NewConsoleSender().Close(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smsx
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	jsonx "github.com/go-grain/grain/pkg/encoding/json"
+)
+
+// StubServer 本地短信网关桩, 实现了 HttpSender 约定的协议,
+// 测试时配合 httptest.NewServer 使用, 可以断言收到的短信以及模拟发送失败
+type StubServer struct {
+	mu       sync.Mutex
+	token    string
+	messages []*Message
+	seq      int64
+	fail     atomic.Bool
+}
+
+func NewStubServer(token string) *StubServer {
+	return &StubServer{token: token}
+}
+
+// SetFail 设置为 true 后所有请求都会返回失败
+func (s *StubServer) SetFail(fail bool) {
+	s.fail.Store(fail)
+}
+
+// Messages 返回已收到的短信
+func (s *StubServer) Messages() []*Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Message(nil), s.messages...)
+}
+
+// Reset 清空已收到的短信
+func (s *StubServer) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = nil
+}
+
+func (s *StubServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if s.token != "" && r.Header.Get("Authorization") != "Bearer "+s.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	reply := HttpReply{}
+	msg := Message{}
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = jsonx.Unmarshal(body, &msg)
+	}
+	if err != nil {
+		reply.Code, reply.Message = 1, err.Error()
+	} else if s.fail.Load() {
+		reply.Code, reply.Message = 1, "stub: 模拟发送失败"
+	} else {
+		s.mu.Lock()
+		s.seq++
+		reply.MessageID = "stub-" + strconv.FormatInt(s.seq, 10)
+		s.messages = append(s.messages, &msg)
+		s.mu.Unlock()
+		reply.Status = StatusSent
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(jsonx.Marshal(reply))
+}
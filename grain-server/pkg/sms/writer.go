@@ -0,0 +1,76 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smsx
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	uuidx "github.com/go-grain/grain/pkg/uuid"
+)
+
+// WriterSender 把短信内容写到控制台或者文件, 仅用于开发环境
+type WriterSender struct {
+	name string
+	mu   sync.Mutex
+	w    io.Writer
+}
+
+// NewConsoleSender 短信内容输出到标准输出
+func NewConsoleSender() *WriterSender {
+	return &WriterSender{name: "console", w: os.Stdout}
+}
+
+// NewFileSender 短信内容追加写入到指定文件
+func NewFileSender(path string) (*WriterSender, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterSender{name: "file", w: f}, nil
+}
+
+// Close 关闭输出文件, 控制台输出不会被关闭
+func (s *WriterSender) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.w.(*os.File); ok && f != os.Stdout && f != os.Stderr {
+		return f.Close()
+	}
+	return nil
+}
+
+func (s *WriterSender) Name() string {
+	return s.name
+}
+
+func (s *WriterSender) Send(_ context.Context, msg *Message) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := fmt.Fprintf(s.w, "%s [SMS] mobile=%s sign=%s template=%s content=%s\n",
+		time.Now().Format("2006-01-02 15:04:05"), msg.Mobile, msg.SignName, msg.Template, msg.Content)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{MessageID: uuidx.UID(), Status: StatusSent}, nil
+}
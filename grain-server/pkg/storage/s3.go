@@ -0,0 +1,257 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storagex
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Options S3 兼容存储的连接参数
+type S3Options struct {
+	// 服务地址 例如 https://s3.amazonaws.com http://127.0.0.1:9000
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// MinIO 等自建服务一般使用路径风格 endpoint/bucket/key
+	PathStyle bool
+	// 公开访问地址 例如 CDN 域名, 为空时使用 Endpoint
+	BaseURL string
+	Timeout time.Duration
+}
+
+// S3 S3 兼容的对象存储, 阿里云 OSS 腾讯云 COS MinIO 等都可以使用
+type S3 struct {
+	opt      S3Options
+	endpoint *url.URL
+	signer   signer
+	client   *http.Client
+}
+
+func NewS3(opt S3Options) (*S3, error) {
+	if opt.Bucket == "" {
+		return nil, errors.New("storage: s3 bucket 不能为空")
+	}
+	endpoint, err := url.Parse(strings.TrimRight(opt.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("storage: s3 endpoint %q 不正确", opt.Endpoint)
+	}
+	if opt.Region == "" {
+		opt.Region = "us-east-1"
+	}
+	if opt.Timeout <= 0 {
+		opt.Timeout = 30 * time.Second
+	}
+	return &S3{
+		opt:      opt,
+		endpoint: endpoint,
+		signer:   signer{accessKey: opt.AccessKey, secretKey: opt.SecretKey, region: opt.Region},
+		client:   &http.Client{Timeout: opt.Timeout},
+	}, nil
+}
+
+func (s *S3) Name() string {
+	return "s3"
+}
+
+// objectURL 对象在 Endpoint 上的地址
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	if s.opt.PathStyle {
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + s.opt.Bucket + "/" + key
+	} else {
+		u.Host = s.opt.Bucket + "." + u.Host
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + key
+	}
+	u.RawPath = uriEscape(u.Path, true)
+	return &u
+}
+
+func (s *S3) do(ctx context.Context, method, key string, body io.Reader, size int64, contentType string, header http.Header) (*http.Response, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	u := s.objectURL(key)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	// 额外的请求头不参与签名
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	payloadHash := emptyPayloadHash
+	if body != nil {
+		// 流式上传不计算内容摘要, 完整性由 TLS 以及 Content-Length 保证
+		payloadHash = unsignedPayload
+		req.ContentLength = size
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+	}
+
+	amzDate := time.Now().UTC().Format(amzDateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	sig := s.signer.signature(method, u.Host, u.Path, u.Query(), req.Header, signed, payloadHash, amzDate)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s, SignedHeaders=%s, Signature=%s",
+		sigAlgorithm, s.signer.credential(amzDate[:8]), strings.Join(signed, ";"), sig))
+
+	return s.client.Do(req)
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if size < 0 {
+		// S3 的 PutObject 必须带 Content-Length
+		buf, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		r, size = bytes.NewReader(buf), int64(len(buf))
+	}
+	res, err := s.do(ctx, http.MethodPut, key, r, size, contentType, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return s.check(res, http.MethodPut)
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, *Object, error) {
+	res, err := s.do(ctx, http.MethodGet, key, nil, 0, "", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = s.check(res, http.MethodGet); err != nil {
+		res.Body.Close()
+		return nil, nil, err
+	}
+	return res.Body, s.object(key, res), nil
+}
+
+func (s *S3) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	res, err := s.do(ctx, http.MethodGet, key, nil, 0, "", header)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.check(res, http.MethodGet); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	// 不支持 Range 的兼容服务会返回整个对象
+	if res.StatusCode == http.StatusOK {
+		if _, err = io.CopyN(io.Discard, res.Body, offset); err != nil {
+			res.Body.Close()
+			return nil, err
+		}
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(res.Body, length), res.Body}, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	res, err := s.do(ctx, http.MethodDelete, key, nil, 0, "", nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if err = s.check(res, http.MethodDelete); err != nil && !errors.Is(err, ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (*Object, error) {
+	res, err := s.do(ctx, http.MethodHead, key, nil, 0, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if err = s.check(res, http.MethodHead); err != nil {
+		return nil, err
+	}
+	return s.object(key, res), nil
+}
+
+func (s *S3) URL(key string) string {
+	key = strings.TrimLeft(key, "/")
+	if s.opt.BaseURL != "" {
+		return strings.TrimRight(s.opt.BaseURL, "/") + "/" + escapeKey(key)
+	}
+	return s.objectURL(key).String()
+}
+
+// PresignedURL 生成查询参数签名的 GET 地址, 签名和 Endpoint 的域名绑定, 不能替换成 BaseURL
+func (s *S3) PresignedURL(ctx context.Context, key string, expire time.Duration) (string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	seconds := int64(expire / time.Second)
+	if seconds < 1 || seconds > 7*24*3600 {
+		return "", errors.New("storage: 签名有效期需要在 1 秒到 7 天之间")
+	}
+
+	u := s.objectURL(key)
+	amzDate := time.Now().UTC().Format(amzDateFormat)
+	q := url.Values{}
+	q.Set("X-Amz-Algorithm", sigAlgorithm)
+	q.Set("X-Amz-Credential", s.signer.credential(amzDate[:8]))
+	q.Set("X-Amz-Date", amzDate)
+	q.Set("X-Amz-Expires", strconv.FormatInt(seconds, 10))
+	q.Set("X-Amz-SignedHeaders", "host")
+	sig := s.signer.signature(http.MethodGet, u.Host, u.Path, q, http.Header{}, []string{"host"}, unsignedPayload, amzDate)
+	u.RawQuery = canonicalQuery(q) + "&X-Amz-Signature=" + sig
+	return u.String(), nil
+}
+
+func (s *S3) check(res *http.Response, method string) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return ErrNotExist
+	}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("storage: s3 %s %s: %s", method, res.Status, strings.TrimSpace(string(body)))
+}
+
+func (s *S3) object(key string, res *http.Response) *Object {
+	obj := &Object{
+		Key:         key,
+		Size:        res.ContentLength,
+		ContentType: res.Header.Get("Content-Type"),
+		ETag:        strings.Trim(res.Header.Get("ETag"), `"`),
+	}
+	obj.LastModified, _ = http.ParseTime(res.Header.Get("Last-Modified"))
+	return obj
+}
@@ -0,0 +1,156 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storagex
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newStubS3(t *testing.T, secretKey string) (*S3, *StubServer) {
+	t.Helper()
+	stub := NewStubServer("grain", "grain-secret", "")
+	srv := httptest.NewServer(stub)
+	t.Cleanup(srv.Close)
+	s3, err := NewS3(S3Options{
+		Endpoint:  srv.URL,
+		Bucket:    "grain",
+		AccessKey: "grain",
+		SecretKey: secretKey,
+		PathStyle: true,
+		Timeout:   5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s3, stub
+}
+
+func TestS3WithStub(t *testing.T) {
+	s3, stub := newStubS3(t, "grain-secret")
+	ctx := context.Background()
+	key := "avatar/2023/hello world.txt"
+
+	if err := s3.Put(ctx, key, strings.NewReader("hello"), -1, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if keys := stub.Keys(); len(keys) != 1 || keys[0] != "grain/"+key {
+		t.Fatalf("stub keys = %v", keys)
+	}
+
+	obj, err := s3.Stat(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Size != 5 || obj.ContentType != "text/plain" || obj.ETag == "" {
+		t.Errorf("Stat() = %+v", obj)
+	}
+
+	rc, _, err := s3.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "hello" {
+		t.Errorf("Get() = %q", data)
+	}
+
+	if err = s3.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s3.Stat(ctx, key); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat() after delete err = %v, want %v", err, ErrNotExist)
+	}
+	// 删除不存在的对象不返回错误
+	if err = s3.Delete(ctx, key); err != nil {
+		t.Error(err)
+	}
+	if _, err = s3.Stat(ctx, "../etc/passwd"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Stat() err = %v, want %v", err, ErrInvalidKey)
+	}
+}
+
+func TestS3WrongSecret(t *testing.T) {
+	s3, stub := newStubS3(t, "wrong-secret")
+	err := s3.Put(context.Background(), "a.txt", bytes.NewReader([]byte("a")), 1, "")
+	if err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("Put() err = %v, want SignatureDoesNotMatch", err)
+	}
+	if len(stub.Keys()) != 0 {
+		t.Error("stub should not store objects with a bad signature")
+	}
+}
+
+func TestS3PresignedURL(t *testing.T) {
+	s3, _ := newStubS3(t, "grain-secret")
+	ctx := context.Background()
+	if err := s3.Put(ctx, "doc/a.txt", strings.NewReader("presigned"), 9, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := s3.PresignedURL(ctx, "doc/a.txt", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || string(data) != "presigned" {
+		t.Errorf("GET presigned = %d %q", res.StatusCode, data)
+	}
+
+	// 签名和对象键绑定, 换一个键签名失效
+	res, err = http.Get(strings.Replace(u, "/doc/a.txt", "/doc/b.txt", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("GET tampered presigned = %d, want %d", res.StatusCode, http.StatusForbidden)
+	}
+
+	if _, err = s3.PresignedURL(ctx, "doc/a.txt", 8*24*time.Hour); err == nil {
+		t.Error("PresignedURL() should reject expiry longer than 7 days")
+	}
+}
+
+func TestReadRange(t *testing.T) {
+	s3, _ := newStubS3(t, "grain-secret")
+	local := NewLocal(t.TempDir(), "/uploads", "secret")
+	ctx := context.Background()
+	for _, store := range []Storage{s3, local} {
+		if err := store.Put(ctx, "blobs/ab/abc", strings.NewReader("0123456789"), 10, ""); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ReadRange(ctx, store, "blobs/ab/abc", 3, 4)
+		if err != nil || string(data) != "3456" {
+			t.Errorf("%s ReadRange() = %q, %v", store.Name(), data, err)
+		}
+		if _, err = ReadRange(ctx, store, "blobs/ab/abc", 8, 4); err == nil {
+			t.Errorf("%s ReadRange() past the end should fail", store.Name())
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storagex
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNotExist 对象不存在
+var ErrNotExist = errors.New("storage: object does not exist")
+
+// ErrInvalidKey 对象键不合法, 例如包含 .. 或者为空
+var ErrInvalidKey = errors.New("storage: invalid object key")
+
+// Object 对象的元信息
+type Object struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// Storage 文件存储驱动, 对象键统一使用 / 分隔, 例如 avatar/2023/5-1/abcde.png
+type Storage interface {
+	// Name 驱动名称, 会记录在 Upload.Storage 中
+	Name() string
+	// Put 写入对象, size 未知时传 -1
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get 读取对象, 调用方负责关闭返回的 ReadCloser
+	Get(ctx context.Context, key string) (io.ReadCloser, *Object, error)
+	// Delete 删除对象, 对象不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+	// Stat 获取对象元信息, 对象不存在时返回 ErrNotExist
+	Stat(ctx context.Context, key string) (*Object, error)
+	// URL 对象的公开访问地址
+	URL(key string) string
+	// PresignedURL 生成带签名和过期时间的临时访问地址
+	PresignedURL(ctx context.Context, key string, expire time.Duration) (string, error)
+}
+
+// RangeReader 支持读取对象一部分内容的存储驱动
+type RangeReader interface {
+	// GetRange 读取从 offset 开始的 length 个字节, 调用方负责关闭返回的 ReadCloser
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+}
+
+// Mover 支持在存储内部移动对象的存储驱动
+type Mover interface {
+	// Move 把 src 移动到 dst, dst 已经存在时覆盖
+	Move(ctx context.Context, src, dst string) error
+}
+
+// Move 把对象从 src 移动到 dst, 驱动不支持 Mover 时读取 src 写入 dst 后删除 src
+func Move(ctx context.Context, store Storage, src, dst string, contentType string) error {
+	if m, ok := store.(Mover); ok {
+		return m.Move(ctx, src, dst)
+	}
+	rc, obj, err := store.Get(ctx, src)
+	if err != nil {
+		return err
+	}
+	err = store.Put(ctx, dst, rc, obj.Size, contentType)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	return store.Delete(ctx, src)
+}
+
+// ReadRange 读取对象从 offset 开始的 length 个字节, 驱动不支持 RangeReader 时读取整个对象后跳过前面的内容
+func ReadRange(ctx context.Context, store Storage, key string, offset, length int64) ([]byte, error) {
+	var rc io.ReadCloser
+	var err error
+	if rr, ok := store.(RangeReader); ok {
+		rc, err = rr.GetRange(ctx, key, offset, length)
+	} else {
+		rc, _, err = store.Get(ctx, key)
+		if err == nil {
+			if _, err = io.CopyN(io.Discard, rc, offset); err != nil {
+				rc.Close()
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	buf := make([]byte, length)
+	if _, err = io.ReadFull(rc, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// CleanKey 规范化对象键, 拒绝空键以及跳出根目录的键
+func CleanKey(key string) (string, error) {
+	key = strings.Trim(strings.ReplaceAll(key, "\\", "/"), "/")
+	if key == "" {
+		return "", ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", ErrInvalidKey
+		}
+	}
+	return key, nil
+}
+
+// escapeKey 按 RFC 3986 编码对象键, 保留 / 分隔符
+func escapeKey(key string) string {
+	return uriEscape(key, true)
+}
+
+func uriEscape(s string, keepSlash bool) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (keepSlash && c == '/') {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&15])
+	}
+	return b.String()
+}
@@ -0,0 +1,223 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracex
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-grain/grain/log"
+	"strings"
+)
+
+const (
+	// HeaderRequestID 请求ID请求头, 客户端或网关传入时沿用, 否则由服务端生成
+	HeaderRequestID = "X-Request-ID"
+	// HeaderTraceparent W3C Trace Context 请求头 https://www.w3.org/TR/trace-context/
+	HeaderTraceparent = "traceparent"
+)
+
+// 以下 key 同时用于 gin.Context, 与 JwtAuth 中间件的 uid、role 保持一致
+const (
+	RequestIDKey = "requestId"
+	TraceIDKey   = "traceId"
+	SpanIDKey    = "spanId"
+	UIDKey       = "uid"
+	RoleKey      = "role"
+)
+
+// maxRequestIDLen 客户端传入的请求ID超过该长度时重新生成, 避免日志被刷爆
+const maxRequestIDLen = 128
+
+// Trace 一次请求的追踪信息
+type Trace struct {
+	RequestID string
+	TraceID   string
+	SpanID    string
+	// ParentID 上游的 span ID, 没有上游时为空
+	ParentID string
+	Sampled  bool
+}
+
+// Traceparent 生成传给下游的 traceparent 请求头
+func (t Trace) Traceparent() string {
+	flags := "00"
+	if t.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", t.TraceID, t.SpanID, flags)
+}
+
+// New 根据上游传入的请求ID和 traceparent 创建本次请求的追踪信息, 参数不合法时重新生成
+func New(requestID, traceparent string) Trace {
+	t := Trace{SpanID: NewSpanID(), Sampled: true}
+	if traceID, parentID, sampled, ok := ParseTraceparent(traceparent); ok {
+		t.TraceID, t.ParentID, t.Sampled = traceID, parentID, sampled
+	} else {
+		t.TraceID = NewTraceID()
+	}
+	if validRequestID(requestID) {
+		t.RequestID = requestID
+	} else {
+		t.RequestID = t.TraceID
+	}
+	return t
+}
+
+// ParseTraceparent 解析 version-traceid-parentid-flags 格式的 traceparent
+func ParseTraceparent(s string) (traceID, parentID string, sampled bool, ok bool) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return
+	}
+	// 版本 00 必须正好四段, 更高版本允许在末尾追加字段
+	if parts[0] == "00" && len(parts) != 4 {
+		return
+	}
+	if !isHex(parts[0]) || !isHex(parts[1]) || !isHex(parts[2]) || !isHex(parts[3]) {
+		return
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return
+	}
+	if isZero(parts[1]) || isZero(parts[2]) {
+		return
+	}
+	flags, _ := hex.DecodeString(parts[3])
+	return parts[1], parts[2], flags[0]&1 == 1, true
+}
+
+// NewTraceID 生成 16 字节的 trace ID
+func NewTraceID() string {
+	return randomHex(16)
+}
+
+// NewSpanID 生成 8 字节的 span ID
+func NewSpanID() string {
+	return randomHex(8)
+}
+
+type traceKey struct{}
+
+// NewContext 把追踪信息放进 context.Context, 供脱离 gin.Context 的下游使用
+func NewContext(ctx context.Context, t Trace) context.Context {
+	return context.WithValue(ctx, traceKey{}, t)
+}
+
+// FromContext 取出追踪信息, 同时兼容 NewContext 和保存在 gin.Context 中的值
+func FromContext(ctx context.Context) (Trace, bool) {
+	if ctx == nil {
+		return Trace{}, false
+	}
+	if t, ok := ctx.Value(traceKey{}).(Trace); ok {
+		return t, true
+	}
+	t := Trace{
+		RequestID: stringValue(ctx, RequestIDKey),
+		TraceID:   stringValue(ctx, TraceIDKey),
+		SpanID:    stringValue(ctx, SpanIDKey),
+	}
+	return t, t.RequestID != "" || t.TraceID != ""
+}
+
+// RequestID 从 context 中取出请求ID
+func RequestID(ctx context.Context) string {
+	t, _ := FromContext(ctx)
+	return t.RequestID
+}
+
+// TraceID 从 context 中取出 trace ID
+func TraceID(ctx context.Context) string {
+	t, _ := FromContext(ctx)
+	return t.TraceID
+}
+
+// RequestIDValuer 日志中输出请求ID
+func RequestIDValuer() log.Valuer {
+	return func(ctx context.Context) interface{} {
+		return RequestID(ctx)
+	}
+}
+
+// TraceIDValuer 日志中输出 trace ID
+func TraceIDValuer() log.Valuer {
+	return func(ctx context.Context) interface{} {
+		return TraceID(ctx)
+	}
+}
+
+// SpanIDValuer 日志中输出 span ID
+func SpanIDValuer() log.Valuer {
+	return func(ctx context.Context) interface{} {
+		t, _ := FromContext(ctx)
+		return t.SpanID
+	}
+}
+
+// UIDValuer 日志中输出当前登录用户的 UID
+func UIDValuer() log.Valuer {
+	return func(ctx context.Context) interface{} {
+		return stringValue(ctx, UIDKey)
+	}
+}
+
+// RoleValuer 日志中输出当前登录用户的角色
+func RoleValuer() log.Valuer {
+	return func(ctx context.Context) interface{} {
+		return stringValue(ctx, RoleKey)
+	}
+}
+
+// stringValue gin.Context 的 Value 方法对字符串 key 会去 Keys 中查找
+func stringValue(ctx context.Context, key string) string {
+	if ctx == nil {
+		return ""
+	}
+	v, _ := ctx.Value(key).(string)
+	return v
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,114 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracex
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID  = "00f067aa0ba902b7"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		ok      bool
+		sampled bool
+	}{
+		{"采样", "00-" + testTraceID + "-" + testSpanID + "-01", true, true},
+		{"未采样", "00-" + testTraceID + "-" + testSpanID + "-00", true, false},
+		// 只看最低位
+		{"其它标志位", "00-" + testTraceID + "-" + testSpanID + "-02", true, false},
+		{"前后空白", "  00-" + testTraceID + "-" + testSpanID + "-01 ", true, true},
+		{"版本 00 多一段", "00-" + testTraceID + "-" + testSpanID + "-01-extra", false, false},
+		{"版本 00 少一段", "00-" + testTraceID + "-" + testSpanID, false, false},
+		{"未来版本追加字段", "cc-" + testTraceID + "-" + testSpanID + "-01-what-the-future-holds", true, true},
+		{"未来版本四段", "01-" + testTraceID + "-" + testSpanID + "-01", true, true},
+		{"版本 ff", "ff-" + testTraceID + "-" + testSpanID + "-01", false, false},
+		{"版本长度错误", "000-" + testTraceID + "-" + testSpanID + "-01", false, false},
+		{"trace ID 全 0", "00-" + strings.Repeat("0", 32) + "-" + testSpanID + "-01", false, false},
+		{"span ID 全 0", "00-" + testTraceID + "-" + strings.Repeat("0", 16) + "-01", false, false},
+		{"trace ID 长度错误", "00-" + testTraceID[:30] + "-" + testSpanID + "-01", false, false},
+		{"span ID 长度错误", "00-" + testTraceID + "-" + testSpanID + "00-01", false, false},
+		{"大写十六进制", "00-" + strings.ToUpper(testTraceID) + "-" + testSpanID + "-01", false, false},
+		{"非十六进制", "00-" + testTraceID[:31] + "g-" + testSpanID + "-01", false, false},
+		{"标志位非十六进制", "00-" + testTraceID + "-" + testSpanID + "-0x", false, false},
+		{"空", "", false, false},
+	}
+	for _, tt := range tests {
+		traceID, parentID, sampled, ok := ParseTraceparent(tt.header)
+		if ok != tt.ok || sampled != tt.sampled {
+			t.Errorf("%s: ok = %v sampled = %v, 期望 %v %v", tt.name, ok, sampled, tt.ok, tt.sampled)
+			continue
+		}
+		if ok && (traceID != testTraceID || parentID != testSpanID) {
+			t.Errorf("%s: traceID = %s parentID = %s", tt.name, traceID, parentID)
+		}
+		if !ok && (traceID != "" || parentID != "") {
+			t.Errorf("%s: 解析失败时不应该返回 ID", tt.name)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	header := "00-" + testTraceID + "-" + testSpanID + "-00"
+	tr := New("req-1", header)
+	if tr.TraceID != testTraceID || tr.ParentID != testSpanID || tr.Sampled || tr.RequestID != "req-1" {
+		t.Errorf("沿用上游 = %+v", tr)
+	}
+	if len(tr.SpanID) != 16 || tr.SpanID == testSpanID {
+		t.Errorf("本次请求应该生成新的 span ID, SpanID = %s", tr.SpanID)
+	}
+	if got := tr.Traceparent(); got != "00-"+testTraceID+"-"+tr.SpanID+"-00" {
+		t.Errorf("Traceparent = %s", got)
+	}
+
+	// traceparent 不合法时重新生成, 默认采样
+	tr = New("", "00-"+strings.Repeat("0", 32)+"-"+testSpanID+"-01")
+	if len(tr.TraceID) != 32 || tr.TraceID == strings.Repeat("0", 32) || tr.ParentID != "" || !tr.Sampled {
+		t.Errorf("重新生成 = %+v", tr)
+	}
+
+	// 请求ID不合法时使用 trace ID
+	tests := []struct {
+		name string
+		id   string
+		ok   bool
+	}{
+		{"普通", "abc-123_XYZ", true},
+		{"最长", strings.Repeat("a", maxRequestIDLen), true},
+		{"超长", strings.Repeat("a", maxRequestIDLen+1), false},
+		{"空", "", false},
+		{"空格", "abc 123", false},
+		{"换行", "abc\n123", false},
+		{"控制字符", "abc\x00", false},
+		{"DEL", "abc\x7f", false},
+		{"非 ASCII", "请求", false},
+	}
+	for _, tt := range tests {
+		tr = New(tt.id, header)
+		want := testTraceID
+		if tt.ok {
+			want = tt.id
+		}
+		if tr.RequestID != want {
+			t.Errorf("%s: RequestID = %q, 期望 %q", tt.name, tr.RequestID, want)
+		}
+	}
+}
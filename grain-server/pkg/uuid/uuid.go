@@ -2,7 +2,7 @@ package uuidx
 
 import (
 	"crypto/rand"
-	"github.com/go-pay/gopay/pkg/xlog"
+	"github.com/go-grain/grain/log"
 	"github.com/gofrs/uuid"
 	"github.com/oklog/ulid"
 	"strings"
@@ -17,7 +17,7 @@ func ULID() string {
 	// 生成ULID
 	id, err := ulid.New(ulid.Now(), ulid.Monotonic(rand.Reader, 0))
 	if err != nil {
-		xlog.Info("Error generating ULID:", err)
+		log.Error("Error generating ULID: ", err)
 		return ""
 	}
 	return id.String()
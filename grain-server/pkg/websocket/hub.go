@@ -0,0 +1,426 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wsx
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-grain/grain/log"
+	redisx "github.com/go-grain/grain/pkg/redis"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Protocol 浏览器无法为 WebSocket 设置请求头, 令牌通过子协议传递时写在 Protocol 之后,
+// 例如 new WebSocket(url, ["grain", token]), 服务端只回应 Protocol
+const Protocol = "grain"
+
+type Options struct {
+	// 跨实例广播使用的 Redis 频道
+	Channel string
+	// 每个连接待发送消息的缓冲数, 写满说明客户端消费过慢, 直接断开让其重连
+	SendBuffer int
+	// 客户端单条消息的最大字节数
+	MaxMessageSize int64
+	// 服务端发送 ping 的间隔, 需要小于 PongWait
+	PingInterval time.Duration
+	// 等待客户端 pong 或者任意消息的超时时间
+	PongWait time.Duration
+	// 单次写超时
+	WriteWait time.Duration
+	// 校验握手来源, 为空时只允许与 Host 相同的来源
+	CheckOrigin func(r *http.Request) bool
+}
+
+// envelope 跨实例广播的数据, UID 为单个用户, UIDs 为多个用户, All 为所有在线用户
+type envelope struct {
+	UID  string          `json:"uid,omitempty"`
+	UIDs []string        `json:"uids,omitempty"`
+	All  bool            `json:"all,omitempty"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Hub 维护当前实例上按 UID 分组的连接, 通过 Redis 发布订阅把消息投递到所有实例
+type Hub struct {
+	rdb      redisx.IRedis
+	opts     Options
+	upgrader websocket.Upgrader
+
+	mu      sync.RWMutex
+	clients map[string]map[*Client]struct{}
+
+	// Close 之后结束, 停止订阅并作为处理连接消息的 context
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewHub(rdb redisx.IRedis, opts Options) *Hub {
+	if opts.Channel == "" {
+		opts.Channel = "grain:websocket"
+	}
+	if opts.SendBuffer <= 0 {
+		opts.SendBuffer = 256
+	}
+	if opts.MaxMessageSize <= 0 {
+		opts.MaxMessageSize = 64 << 10
+	}
+	if opts.PongWait <= 0 {
+		opts.PongWait = 60 * time.Second
+	}
+	if opts.PingInterval <= 0 || opts.PingInterval >= opts.PongWait {
+		opts.PingInterval = opts.PongWait * 9 / 10
+	}
+	if opts.WriteWait <= 0 {
+		opts.WriteWait = 10 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Hub{
+		rdb:  rdb,
+		opts: opts,
+		upgrader: websocket.Upgrader{
+			Subprotocols: []string{Protocol},
+			// gorilla 在 CheckOrigin 为 nil 时校验 Origin 与 Host 相同
+			CheckOrigin: opts.CheckOrigin,
+		},
+		clients: make(map[string]map[*Client]struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Run 订阅跨实例频道, 把其他实例(包括自己)发布的消息投递给本实例上的连接, 直到 ctx 结束或者调用 Close
+func (h *Hub) Run(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-h.ctx.Done():
+		}
+		cancel()
+	}()
+	go func() {
+		for {
+			h.subscribe(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+				// Redis 断开后稍等重新订阅
+			}
+		}
+	}()
+}
+
+func (h *Hub) subscribe(ctx context.Context) {
+	pubsub := h.rdb.Subscribe(ctx, h.opts.Channel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			var env envelope
+			if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil {
+				log.Errorw("errMsg", "解析 WebSocket 广播消息", "err", err.Error())
+				continue
+			}
+			switch {
+			case env.All:
+				h.sendLocal(nil, env.Data)
+			case len(env.UIDs) > 0:
+				uids := make(map[string]struct{}, len(env.UIDs))
+				for _, uid := range env.UIDs {
+					uids[uid] = struct{}{}
+				}
+				h.sendLocal(uids, env.Data)
+			default:
+				h.SendLocal(env.UID, env.Data)
+			}
+		}
+	}
+}
+
+// Send 向用户的所有连接投递消息, 用户连接在哪个实例上都能收到, data 需要是合法的 JSON
+func (h *Hub) Send(uid string, data []byte) error {
+	payload, err := json.Marshal(envelope{UID: uid, Data: data})
+	if err != nil {
+		return err
+	}
+	return h.rdb.Publish(context.Background(), h.opts.Channel, payload)
+}
+
+// SendJSON 序列化后投递
+func (h *Hub) SendJSON(uid string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return h.Send(uid, data)
+}
+
+// Multicast 向多个用户投递同一条消息, 所有用户共用一次发布
+func (h *Hub) Multicast(uids []string, v interface{}) error {
+	if len(uids) == 0 {
+		return nil
+	}
+	return h.publish(envelope{UIDs: uids}, v)
+}
+
+// Broadcast 向所有实例上的所有连接投递同一条消息
+func (h *Hub) Broadcast(v interface{}) error {
+	return h.publish(envelope{All: true}, v)
+}
+
+func (h *Hub) publish(env envelope, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	env.Data = data
+	payload, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	return h.rdb.Publish(context.Background(), h.opts.Channel, payload)
+}
+
+// SendLocal 只投递给本实例上的连接, 返回成功写入发送缓冲的连接数
+func (h *Hub) SendLocal(uid string, data []byte) int {
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.clients[uid]))
+	for c := range h.clients[uid] {
+		clients = append(clients, c)
+	}
+	h.mu.RUnlock()
+
+	sent := 0
+	for _, c := range clients {
+		if c.Send(data) {
+			sent++
+		}
+	}
+	return sent
+}
+
+// sendLocal 投递给本实例上属于 uids 的连接, uids 为 nil 时投递给所有连接
+func (h *Hub) sendLocal(uids map[string]struct{}, data []byte) {
+	h.mu.RLock()
+	var clients []*Client
+	for uid, set := range h.clients {
+		if uids != nil {
+			if _, ok := uids[uid]; !ok {
+				continue
+			}
+		}
+		for c := range set {
+			clients = append(clients, c)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, c := range clients {
+		c.Send(data)
+	}
+}
+
+// Close 停止订阅并断开本实例上的所有连接, 退出时在 HTTP 服务停止之后调用
+func (h *Hub) Close() {
+	h.cancel()
+	h.mu.RLock()
+	var clients []*Client
+	for _, set := range h.clients {
+		for c := range set {
+			clients = append(clients, c)
+		}
+	}
+	h.mu.RUnlock()
+	for _, c := range clients {
+		c.Close()
+	}
+}
+
+// Online 用户在本实例上是否有连接
+func (h *Hub) Online(uid string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients[uid]) > 0
+}
+
+// Count 本实例上的连接数
+func (h *Hub) Count() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	n := 0
+	for _, clients := range h.clients {
+		n += len(clients)
+	}
+	return n
+}
+
+// Serve 升级连接并阻塞直到连接关闭, onConnect 在连接注册后调用, onMessage 处理客户端发来的每条消息
+func (h *Hub) Serve(w http.ResponseWriter, r *http.Request, uid string, onConnect func(c *Client), onMessage func(c *Client, data []byte)) error {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return err
+	}
+	c := &Client{
+		uid:  uid,
+		hub:  h,
+		conn: conn,
+		send: make(chan []byte, h.opts.SendBuffer),
+		done: make(chan struct{}),
+	}
+	h.register(c)
+	defer h.unregister(c)
+
+	go c.writePump()
+	if onConnect != nil {
+		onConnect(c)
+	}
+	c.readPump(onMessage)
+	return nil
+}
+
+func (h *Hub) register(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients[c.uid] == nil {
+		h.clients[c.uid] = make(map[*Client]struct{})
+	}
+	h.clients[c.uid][c] = struct{}{}
+}
+
+func (h *Hub) unregister(c *Client) {
+	h.mu.Lock()
+	if clients, ok := h.clients[c.uid]; ok {
+		delete(clients, c)
+		if len(clients) == 0 {
+			delete(h.clients, c.uid)
+		}
+	}
+	h.mu.Unlock()
+	c.Close()
+}
+
+// Client 一个 WebSocket 连接, 同一个用户可以有多个连接
+type Client struct {
+	uid  string
+	hub  *Hub
+	conn *websocket.Conn
+	send chan []byte
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func (c *Client) UID() string {
+	return c.uid
+}
+
+// Context 连接中心关闭后结束, 处理连接消息时使用
+func (c *Client) Context() context.Context {
+	return c.hub.ctx
+}
+
+// Send 写入发送缓冲, 缓冲已满时断开连接并返回 false
+func (c *Client) Send(data []byte) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	select {
+	case c.send <- data:
+		return true
+	default:
+		log.Warnw("errMsg", "WebSocket 发送缓冲已满, 断开慢速连接", "uid", c.uid)
+		c.Close()
+		return false
+	}
+}
+
+// SendJSON 序列化后写入发送缓冲
+func (c *Client) SendJSON(v interface{}) bool {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return false
+	}
+	return c.Send(data)
+}
+
+// Close 通知写协程发送关闭帧并断开连接, 可重复调用
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+func (c *Client) readPump(onMessage func(c *Client, data []byte)) {
+	opts := c.hub.opts
+	c.conn.SetReadLimit(opts.MaxMessageSize)
+	_ = c.conn.SetReadDeadline(time.Now().Add(opts.PongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(opts.PongWait))
+	})
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure, websocket.CloseNoStatusReceived) {
+				log.Warnw("errMsg", "WebSocket 连接异常断开", "uid", c.uid, "err", err.Error())
+			}
+			return
+		}
+		// 收到任意消息都说明连接存活
+		_ = c.conn.SetReadDeadline(time.Now().Add(opts.PongWait))
+		if onMessage != nil {
+			onMessage(c, data)
+		}
+	}
+}
+
+func (c *Client) writePump() {
+	opts := c.hub.opts
+	ticker := time.NewTicker(opts.PingInterval)
+	defer func() {
+		ticker.Stop()
+		c.Close()
+		// 关闭底层连接后读协程随之退出
+		_ = c.conn.Close()
+	}()
+	for {
+		select {
+		case <-c.done:
+			_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(opts.WriteWait))
+			return
+		case data := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(opts.WriteWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(opts.WriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wsx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redisx "github.com/go-grain/grain/pkg/redis"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+)
+
+// testRedis 只实现发布订阅, 其余方法调用时 panic
+type testRedis struct {
+	redisx.IRedis
+	client *redis.Client
+}
+
+func (r *testRedis) Subscribe(ctx context.Context, channels ...string) *redis.PubSub {
+	return r.client.Subscribe(ctx, channels...)
+}
+
+func (r *testRedis) Publish(ctx context.Context, channel string, message interface{}) error {
+	return r.client.Publish(ctx, channel, message).Err()
+}
+
+// newTestHub 启动连接中心和 WebSocket 服务, 连接的 UID 取自 uid 查询参数
+func newTestHub(t *testing.T, opts Options) (*Hub, *httptest.Server, *miniredis.Miniredis) {
+	t.Helper()
+	m := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: m.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+
+	hub := NewHub(&testRedis{client: client}, opts)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = hub.Serve(w, r, r.URL.Query().Get("uid"), nil, nil)
+	}))
+	t.Cleanup(func() {
+		hub.Close()
+		srv.Close()
+	})
+	return hub, srv, m
+}
+
+func dial(t *testing.T, srv *httptest.Server, uid string, header http.Header) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	conn, res, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"?uid="+uid, header)
+	if err == nil {
+		t.Cleanup(func() { _ = conn.Close() })
+	}
+	return conn, res, err
+}
+
+// connect 建立连接并等待注册到连接中心
+func connect(t *testing.T, hub *Hub, srv *httptest.Server, uid string) *websocket.Conn {
+	t.Helper()
+	n := hub.Count()
+	conn, _, err := dial(t, srv, uid, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return hub.Count() == n+1 })
+	return conn
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("等待超时")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) string {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCheckOrigin(t *testing.T) {
+	_, srv, _ := newTestHub(t, Options{})
+
+	// CheckOrigin 为空时拒绝其它来源
+	_, res, err := dial(t, srv, "u1", http.Header{"Origin": {"http://evil.example"}})
+	if err == nil || res == nil || res.StatusCode != http.StatusForbidden {
+		t.Fatalf("跨域握手 err = %v res = %v", err, res)
+	}
+	// 与 Host 相同的来源可以连接
+	if _, _, err = dial(t, srv, "u1", http.Header{"Origin": {srv.URL}}); err != nil {
+		t.Fatalf("同源握手 err = %v", err)
+	}
+
+	// 配置了 CheckOrigin 时按配置校验
+	_, allowed, _ := newTestHub(t, Options{CheckOrigin: func(r *http.Request) bool {
+		return r.Header.Get("Origin") == "https://app.example"
+	}})
+	if _, _, err = dial(t, allowed, "u1", http.Header{"Origin": {"https://app.example"}}); err != nil {
+		t.Fatalf("允许的来源 err = %v", err)
+	}
+	if _, _, err = dial(t, allowed, "u1", http.Header{"Origin": {allowed.URL}}); err == nil {
+		t.Fatal("CheckOrigin 不允许的来源也连接成功了")
+	}
+}
+
+func TestSlowConsumer(t *testing.T) {
+	hub := NewHub(nil, Options{SendBuffer: 2})
+	// 写协程没有运行, 相当于客户端一直不读取
+	c := &Client{uid: "u1", hub: hub, send: make(chan []byte, hub.opts.SendBuffer), done: make(chan struct{})}
+	if !c.Send([]byte("1")) || !c.Send([]byte("2")) {
+		t.Fatal("缓冲未满时应该写入成功")
+	}
+	if c.Send([]byte("3")) {
+		t.Fatal("缓冲已满时应该返回 false")
+	}
+	select {
+	case <-c.done:
+	default:
+		t.Fatal("缓冲已满时应该断开连接")
+	}
+	if c.Send([]byte("4")) {
+		t.Error("断开后不应该再写入")
+	}
+}
+
+func TestFanOut(t *testing.T) {
+	hub, srv, m := newTestHub(t, Options{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hub.Run(ctx)
+	waitFor(t, func() bool { return m.PubSubNumSub(hub.opts.Channel)[hub.opts.Channel] == 1 })
+
+	u1 := connect(t, hub, srv, "u1")
+	u1b := connect(t, hub, srv, "u1")
+	u2 := connect(t, hub, srv, "u2")
+	u3 := connect(t, hub, srv, "u3")
+	if !hub.Online("u1") || hub.Online("u4") {
+		t.Fatal("Online 结果错误")
+	}
+
+	// 同一个用户的所有连接都能收到
+	if err := hub.Multicast([]string{"u1", "u2"}, map[string]int{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+	for _, conn := range []*websocket.Conn{u1, u1b, u2} {
+		if got := readMessage(t, conn); got != `{"n":1}` {
+			t.Errorf("Multicast 收到 %s", got)
+		}
+	}
+
+	if err := hub.SendJSON("u2", map[string]int{"n": 2}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readMessage(t, u2); got != `{"n":2}` {
+		t.Errorf("Send 收到 %s", got)
+	}
+
+	if err := hub.Broadcast(map[string]int{"n": 3}); err != nil {
+		t.Fatal(err)
+	}
+	// u3 不在 Multicast 和 Send 的范围内, 第一条消息就是广播
+	for _, conn := range []*websocket.Conn{u3, u1, u1b, u2} {
+		if got := readMessage(t, conn); got != `{"n":3}` {
+			t.Errorf("Broadcast 收到 %s", got)
+		}
+	}
+
+	// 空列表不发布
+	if err := hub.Multicast(nil, map[string]int{"n": 4}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	hub, srv, m := newTestHub(t, Options{})
+	hub.Run(context.Background())
+	waitFor(t, func() bool { return m.PubSubNumSub(hub.opts.Channel)[hub.opts.Channel] == 1 })
+	conns := []*websocket.Conn{connect(t, hub, srv, "u1"), connect(t, hub, srv, "u2")}
+
+	hub.Close()
+	// 客户端收到正常关闭帧
+	for _, conn := range conns {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, _, err := conn.ReadMessage()
+		if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+			t.Errorf("关闭后 err = %v, 期望正常关闭", err)
+		}
+	}
+	waitFor(t, func() bool { return hub.Count() == 0 })
+	// 停止订阅
+	waitFor(t, func() bool { return m.PubSubNumSub(hub.opts.Channel)[hub.opts.Channel] == 0 })
+}
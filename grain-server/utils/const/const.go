@@ -17,6 +17,7 @@ package consts
 const (
 	FormatOrTypeError = 4000
 	ReqFail           = 5000
+	TooManyRequests   = 4290
 	//系统用户
 	CreateUserFail             = 1001
 	InvalidParameter           = 1002
@@ -33,12 +34,15 @@ const (
 	DeleteSysUserByIdFail      = 1013
 	DeleteSysUserByIdsFail     = 1014
 	UploadAvatarFail           = 1015
+	SwitchRoleFail             = 1016
 
 	//验证码
 	SendMobileCaptchaFail     = 1101
 	SendEmailCaptchaFail      = 1102
 	SendUserEmailCaptchaFail  = 1103
 	SendUserMobileCaptchaFail = 1104
+	GetVisualCaptchaFail      = 1105
+	VerifyCaptchaFail         = 1106
 
 	// casbin
 	GetAuthApiListFail = 1200
@@ -52,6 +56,11 @@ const (
 	DeleteRoleListFail = 1304
 
 	NotRoleList = 1340
+
+	// 附件
+	UploadFileFail      = 1400
+	UploadFileRejected  = 1401
+	UploadQuotaExceeded = 1402
 )
 
 var (
@@ -76,12 +85,18 @@ func init() {
 		SetDefaultRoleFail:         "设置默认角色失败",
 		DeleteSysUserByIdFail:      "删除系统用户失败",
 		UploadAvatarFail:           "上传头像失败",
+		SwitchRoleFail:             "切换角色失败",
 
 		//验证码
 		SendMobileCaptchaFail:     "发送手机验证码失败",
 		SendEmailCaptchaFail:      "发送电子邮件验证码失败",
 		SendUserEmailCaptchaFail:  "发送用户电子邮件验证码失败",
 		SendUserMobileCaptchaFail: "发送用户手机验证码失败",
+		GetVisualCaptchaFail:      "获取图形验证码失败",
+		VerifyCaptchaFail:         "验证码校验失败",
+
+		//限流
+		TooManyRequests: "请求过于频繁, 请稍后再试",
 
 		// casbin
 		GetAuthApiListFail: "获取已分配权限的Api列表失败",
@@ -91,6 +106,11 @@ func init() {
 		CreateRoleFail:  "创建用户角色失败",
 		GetRoleListFail: "获取用户角色分页数据失败",
 		NotRoleList:     "暂无角色数据",
+
+		// 附件
+		UploadFileFail:      "上传文件失败",
+		UploadFileRejected:  "文件不符合上传要求",
+		UploadQuotaExceeded: "存储空间不足",
 	}
 
 	Maps[1] = map[int]string{
@@ -106,16 +126,27 @@ func init() {
 		SetDefaultRoleFail:         "Setting the default role failed",
 		DeleteSysUserByIdFail:      "Failed to delete system user",
 		UploadAvatarFail:           "Failed to upload avatar",
+		SwitchRoleFail:             "Switching role failed",
 
 		//验证码
 		SendMobileCaptchaFail:     "Failed to send phone verification code",
 		SendEmailCaptchaFail:      "Failed to send email verification code",
 		SendUserEmailCaptchaFail:  "Failed to send user email verification code",
 		SendUserMobileCaptchaFail: "Failed to send user's mobile phone verification code",
+		GetVisualCaptchaFail:      "Failed to get captcha",
+		VerifyCaptchaFail:         "Captcha verification failed",
+
+		//限流
+		TooManyRequests: "Too many requests, please try again later",
 
 		// casbin
 		GetAuthApiListFail: "Failed to get the list of APIs with assigned permissions",
 		UpdateCasbinFail:   "Failed to update permissions",
+
+		// 附件
+		UploadFileFail:      "Failed to upload file",
+		UploadFileRejected:  "The file does not meet the upload requirements",
+		UploadQuotaExceeded: "Storage quota exceeded",
 	}
 }
 
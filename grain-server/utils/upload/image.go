@@ -0,0 +1,392 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/go-grain/grain/config"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+)
+
+// maxPixels 重新编码前允许的最大像素数, 防止小体积的超大尺寸图片耗尽内存
+const maxPixels = 40 << 20
+
+// Reencode 解码后重新编码图片, 丢弃 EXIF 等元数据, JPEG 会先按 EXIF 方向旋转,
+// 不支持的格式原样返回 ok=false
+func Reencode(data []byte, mimeType string) (out []byte, ok bool, err error) {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		return data, false, nil
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, false, &PolicyError{Msg: "图片解析失败"}
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, false, &PolicyError{Msg: "图片尺寸过大"}
+	}
+
+	buf := &bytes.Buffer{}
+	switch mimeType {
+	case "image/jpeg":
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, false, &PolicyError{Msg: "图片解析失败"}
+		}
+		img = orient(img, jpegOrientation(data))
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: 90})
+		if err != nil {
+			return nil, false, err
+		}
+	case "image/png":
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, false, &PolicyError{Msg: "图片解析失败"}
+		}
+		if err = png.Encode(buf, img); err != nil {
+			return nil, false, err
+		}
+	case "image/gif":
+		// 动图逐帧保留, 只丢弃扩展块里的元数据
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, false, &PolicyError{Msg: "图片解析失败"}
+		}
+		if err = gif.EncodeAll(buf, g); err != nil {
+			return nil, false, err
+		}
+	}
+	return buf.Bytes(), true, nil
+}
+
+// jpegOrientation 从 APP1 段的 EXIF 中读取方向标记, 没有或者解析失败时返回 1
+func jpegOrientation(data []byte) int {
+	r := bytes.NewReader(data)
+	var marker [2]byte
+	if _, err := io.ReadFull(r, marker[:]); err != nil || marker != [2]byte{0xFF, 0xD8} {
+		return 1
+	}
+	for {
+		if _, err := io.ReadFull(r, marker[:]); err != nil || marker[0] != 0xFF {
+			return 1
+		}
+		// SOS 之后是图像数据, 不会再有 EXIF
+		if marker[1] == 0xDA {
+			return 1
+		}
+		var length uint16
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil || length < 2 {
+			return 1
+		}
+		seg := make([]byte, length-2)
+		if _, err := io.ReadFull(r, seg); err != nil {
+			return 1
+		}
+		if marker[1] == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return tiffOrientation(seg[6:])
+		}
+	}
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		// 0x0112 Orientation, SHORT 类型, 值在条目的前两个字节
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			o := int(order.Uint16(tiff[entry+8:]))
+			if o < 1 || o > 8 {
+				return 1
+			}
+			return o
+		}
+	}
+	return 1
+}
+
+// orient 按 EXIF 方向把图片转正
+func orient(src image.Image, orientation int) image.Image {
+	if orientation <= 1 {
+		return src
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	// 5-8 需要交换宽高
+	swap := orientation >= 5
+	dw, dh := w, h
+	if swap {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, src.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// Image 按规格生成的图片
+type Image struct {
+	Data     []byte
+	MimeType string
+	Ext      string
+	Width    int
+	Height   int
+}
+
+// DecodeImage 解码图片, 先读取尺寸拦截超大图片, JPEG 按 EXIF 方向转正, 返回图片以及格式名称
+func DecodeImage(data []byte) (image.Image, string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", &PolicyError{Msg: "图片解析失败"}
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, "", &PolicyError{Msg: "图片尺寸过大"}
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", &PolicyError{Msg: "图片解析失败"}
+	}
+	if format == "jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+	return img, format, nil
+}
+
+// Resize 按规格缩放并转换格式, 只缩小不放大
+func Resize(data []byte, preset config.ImagePreset) (*Image, error) {
+	src, format, err := DecodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	w, h := preset.Width, preset.Height
+	if preset.Fit == "cover" && w > 0 && h > 0 {
+		// 先从中间裁出目标宽高比的区域
+		cw, ch := sw, sh
+		if sw*h > sh*w {
+			cw = sh * w / h
+		} else {
+			ch = sw * h / w
+		}
+		x0, y0 := b.Min.X+(sw-cw)/2, b.Min.Y+(sh-ch)/2
+		src = subImage(src, image.Rect(x0, y0, x0+cw, y0+ch))
+		sw, sh = cw, ch
+		if cw < w {
+			w, h = cw, ch
+		}
+	} else {
+		scale := 1.0
+		if w > 0 && float64(w)/float64(sw) < scale {
+			scale = float64(w) / float64(sw)
+		}
+		if h > 0 && float64(h)/float64(sh) < scale {
+			scale = float64(h) / float64(sh)
+		}
+		w, h = int(math.Round(float64(sw)*scale)), int(math.Round(float64(sh)*scale))
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	dst := toRGBA(src)
+	if w != sw || h != sh {
+		dst = resample(dst, w, h)
+	}
+
+	if preset.Format != "" {
+		format = preset.Format
+	}
+	res := &Image{Width: w, Height: h}
+	buf := &bytes.Buffer{}
+	switch format {
+	case "jpeg", "jpg":
+		quality := preset.Quality
+		if quality <= 0 || quality > 100 {
+			quality = 85
+		}
+		// JPEG 没有透明通道, 透明部分填充白色
+		bg := image.NewRGBA(dst.Bounds())
+		draw.Draw(bg, bg.Bounds(), image.White, image.Point{}, draw.Src)
+		draw.Draw(bg, bg.Bounds(), dst, image.Point{}, draw.Over)
+		err = jpeg.Encode(buf, bg, &jpeg.Options{Quality: quality})
+		res.MimeType, res.Ext = "image/jpeg", "jpg"
+	default:
+		err = png.Encode(buf, dst)
+		res.MimeType, res.Ext = "image/png", "png"
+	}
+	if err != nil {
+		return nil, err
+	}
+	res.Data = buf.Bytes()
+	return res, nil
+}
+
+func subImage(src image.Image, r image.Rectangle) image.Image {
+	if s, ok := src.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		return s.SubImage(r)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, r.Min, draw.Src)
+	return dst
+}
+
+// toRGBA 转成左上角为原点的 RGBA, 方便直接按下标读取像素
+func toRGBA(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	return dst
+}
+
+type tap struct {
+	idx    int
+	weight float32
+}
+
+// taps 计算一个方向上每个目标像素对应的源像素以及权重, 三角滤波,
+// 缩小时滤波半径随缩放比例增大, 相当于对覆盖到的源像素做加权平均
+func taps(dst, src int) [][]tap {
+	ratio := float64(src) / float64(dst)
+	support := math.Max(1, ratio)
+	res := make([][]tap, dst)
+	for i := range res {
+		center := (float64(i)+0.5)*ratio - 0.5
+		var sum float64
+		var ts []tap
+		for j := int(math.Floor(center-support)) + 1; j <= int(math.Floor(center+support)); j++ {
+			w := 1 - math.Abs(float64(j)-center)/support
+			if w <= 0 {
+				continue
+			}
+			k := j
+			if k < 0 {
+				k = 0
+			} else if k >= src {
+				k = src - 1
+			}
+			ts = append(ts, tap{idx: k, weight: float32(w)})
+			sum += w
+		}
+		for t := range ts {
+			ts[t].weight /= float32(sum)
+		}
+		res[i] = ts
+	}
+	return res
+}
+
+// resample 先横向再纵向缩放, 在预乘透明度的 RGBA 上计算, 透明边缘不会出现黑边
+func resample(src *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	xt, yt := taps(w, sw), taps(h, sh)
+
+	tmp := make([]float32, w*sh*4)
+	for y := 0; y < sh; y++ {
+		row := src.Pix[y*src.Stride:]
+		for x, ts := range xt {
+			o := (y*w + x) * 4
+			for _, t := range ts {
+				p := row[t.idx*4 : t.idx*4+4]
+				tmp[o] += float32(p[0]) * t.weight
+				tmp[o+1] += float32(p[1]) * t.weight
+				tmp[o+2] += float32(p[2]) * t.weight
+				tmp[o+3] += float32(p[3]) * t.weight
+			}
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y, ts := range yt {
+		for x := 0; x < w; x++ {
+			var c [4]float32
+			for _, t := range ts {
+				o := (t.idx*w + x) * 4
+				c[0] += tmp[o] * t.weight
+				c[1] += tmp[o+1] * t.weight
+				c[2] += tmp[o+2] * t.weight
+				c[3] += tmp[o+3] * t.weight
+			}
+			p := dst.Pix[y*dst.Stride+x*4 : y*dst.Stride+x*4+4]
+			for i := range c {
+				p[i] = clamp8(c[i])
+			}
+		}
+	}
+	return dst
+}
+
+func clamp8(v float32) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	}
+	return uint8(v + 0.5)
+}
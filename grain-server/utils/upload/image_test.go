@@ -0,0 +1,205 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/go-grain/grain/config"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// halves 左半边红色 右半边蓝色
+func halves(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= w/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, halves(w, h)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// exifJPEG 32x16 的 JPEG, SOI 之后插入只有方向标记的 APP1 段
+func exifJPEG(t *testing.T, orientation uint16) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, halves(32, 16), &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	tiff := &bytes.Buffer{}
+	tiff.WriteString("MM")
+	// 第一个 IFD 紧跟在 8 字节的头部之后, 只有一个 Orientation 条目, SHORT 类型, 个数为 1
+	for _, v := range []interface{}{uint16(42), uint32(8), uint16(1), uint16(0x0112), uint16(3), uint32(1), orientation, uint16(0), uint32(0)} {
+		_ = binary.Write(tiff, binary.BigEndian, v)
+	}
+	seg := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+
+	out := &bytes.Buffer{}
+	out.Write(data[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	_ = binary.Write(out, binary.BigEndian, uint16(len(seg)+2))
+	out.Write(seg)
+	out.Write(data[2:])
+	return out.Bytes()
+}
+
+func isRed(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r>>8 > 200 && g>>8 < 60 && b>>8 < 60
+}
+
+func isBlue(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return b>>8 > 200 && r>>8 < 60 && g>>8 < 60
+}
+
+func TestJpegOrientation(t *testing.T) {
+	for o := uint16(1); o <= 8; o++ {
+		if got := jpegOrientation(exifJPEG(t, o)); got != int(o) {
+			t.Errorf("jpegOrientation = %d, want %d", got, o)
+		}
+	}
+	if got := jpegOrientation(exifJPEG(t, 9)); got != 1 {
+		t.Errorf("invalid orientation = %d, want 1", got)
+	}
+	if got := jpegOrientation(encodePNG(t, 2, 2)); got != 1 {
+		t.Errorf("png orientation = %d, want 1", got)
+	}
+}
+
+func TestDecodeImageOrientation(t *testing.T) {
+	cases := []struct {
+		orientation uint16
+		w, h        int
+		// 转正之后红色所在的角
+		red image.Point
+	}{
+		{1, 32, 16, image.Pt(2, 2)},
+		{2, 32, 16, image.Pt(29, 2)},
+		{3, 32, 16, image.Pt(29, 13)},
+		{6, 16, 32, image.Pt(2, 2)},
+		{8, 16, 32, image.Pt(2, 29)},
+	}
+	for _, c := range cases {
+		img, format, err := DecodeImage(exifJPEG(t, c.orientation))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := img.Bounds()
+		if format != "jpeg" || b.Dx() != c.w || b.Dy() != c.h {
+			t.Errorf("orientation %d: %s %dx%d, want jpeg %dx%d", c.orientation, format, b.Dx(), b.Dy(), c.w, c.h)
+			continue
+		}
+		opposite := image.Pt(c.w-1-c.red.X, c.h-1-c.red.Y)
+		if !isRed(img.At(c.red.X, c.red.Y)) || !isBlue(img.At(opposite.X, opposite.Y)) {
+			t.Errorf("orientation %d: red not at %v", c.orientation, c.red)
+		}
+	}
+}
+
+func TestReencode(t *testing.T) {
+	out, ok, err := Reencode(exifJPEG(t, 6), "image/jpeg")
+	if err != nil || !ok {
+		t.Fatalf("Reencode = %v, %v", ok, err)
+	}
+	if bytes.Contains(out, []byte("Exif")) {
+		t.Error("EXIF kept after re-encoding")
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(out))
+	if err != nil || cfg.Width != 16 || cfg.Height != 32 {
+		t.Errorf("re-encoded %dx%d, %v, want rotated 16x32", cfg.Width, cfg.Height, err)
+	}
+
+	text := []byte("plain")
+	if out, ok, err = Reencode(text, "text/plain"); ok || err != nil || !bytes.Equal(out, text) {
+		t.Errorf("unsupported type = %q, %v, %v, want unchanged", out, ok, err)
+	}
+	if _, _, err = Reencode([]byte("\x89PNG broken"), "image/png"); err == nil {
+		t.Error("broken png re-encoded")
+	}
+}
+
+// hugePNG 只有 IHDR 的 PNG, 声明的尺寸超过 maxPixels
+func hugePNG() []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], 10000)
+	binary.BigEndian.PutUint32(ihdr[4:], 10000)
+	ihdr[8], ihdr[9] = 8, 2
+	_ = binary.Write(buf, binary.BigEndian, uint32(len(ihdr)))
+	chunk := append([]byte("IHDR"), ihdr...)
+	buf.Write(chunk)
+	_ = binary.Write(buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	return buf.Bytes()
+}
+
+func TestMaxPixels(t *testing.T) {
+	if _, _, err := Reencode(hugePNG(), "image/png"); err == nil || err.Error() != "图片尺寸过大" {
+		t.Errorf("Reencode = %v, want size error", err)
+	}
+	if _, _, err := DecodeImage(hugePNG()); err == nil || err.Error() != "图片尺寸过大" {
+		t.Errorf("DecodeImage = %v, want size error", err)
+	}
+}
+
+func TestResize(t *testing.T) {
+	src := encodePNG(t, 400, 200)
+	cases := []struct {
+		preset config.ImagePreset
+		w, h   int
+		mime   string
+	}{
+		{config.ImagePreset{Width: 100}, 100, 50, "image/png"},
+		{config.ImagePreset{Width: 100, Height: 100, Fit: "cover", Format: "jpeg"}, 100, 100, "image/jpeg"},
+		{config.ImagePreset{Width: 100, Height: 100}, 100, 50, "image/png"},
+		// 只缩小不放大
+		{config.ImagePreset{Width: 800}, 400, 200, "image/png"},
+	}
+	for _, c := range cases {
+		img, err := Resize(src, c.preset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Width != c.w || img.Height != c.h || img.MimeType != c.mime {
+			t.Errorf("Resize(%+v) = %dx%d %s, want %dx%d %s", c.preset, img.Width, img.Height, img.MimeType, c.w, c.h, c.mime)
+		}
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(img.Data))
+		if err != nil || cfg.Width != c.w || cfg.Height != c.h {
+			t.Errorf("Resize(%+v) data is %dx%d, %v", c.preset, cfg.Width, cfg.Height, err)
+		}
+	}
+}
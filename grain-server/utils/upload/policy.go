@@ -0,0 +1,108 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"fmt"
+	"github.com/go-grain/grain/config"
+	stringsx "github.com/go-grain/grain/pkg/strings"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// PolicyError 文件不符合上传策略
+type PolicyError struct {
+	Msg string
+}
+
+func (e *PolicyError) Error() string {
+	return e.Msg
+}
+
+// Policy 按 classify 获取上传策略, 没有单独配置时使用 default, 都没有配置时不做限制
+func Policy(classify string) config.UploadPolicy {
+	return PolicyOf(config.GetConfig().Upload, classify)
+}
+
+// PolicyOf 从指定的上传配置中取 classify 对应的上传策略
+func PolicyOf(conf config.Upload, classify string) config.UploadPolicy {
+	// viper 读取配置时 map 的键会转成小写
+	if p, ok := conf.Policies[strings.ToLower(classify)]; ok {
+		return p
+	}
+	return conf.Policies["default"]
+}
+
+// CheckFile 校验文件大小以及扩展名, 在读取文件内容之前调用
+func CheckFile(policy config.UploadPolicy, filename string, size int64) error {
+	if policy.MaxSize > 0 && size > policy.MaxSize {
+		return &PolicyError{Msg: fmt.Sprintf("文件大小不能超过 %s", formatSize(policy.MaxSize))}
+	}
+	ext := strings.ToLower(stringsx.Ext(filename))
+	for _, e := range policy.ForbiddenExts {
+		if strings.EqualFold(strings.TrimPrefix(e, "."), ext) {
+			return &PolicyError{Msg: fmt.Sprintf("不允许上传 .%s 文件", ext)}
+		}
+	}
+	return nil
+}
+
+// CheckContent 根据文件开头的内容识别 MIME 类型并校验是否允许上传, 返回识别出的 MIME 类型
+func CheckContent(policy config.UploadPolicy, head []byte) (string, error) {
+	mimeType := DetectMime(head)
+	if len(policy.AllowedMimes) == 0 {
+		return mimeType, nil
+	}
+	for _, allowed := range policy.AllowedMimes {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed == mimeType || strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mimeType, strings.TrimSuffix(allowed, "*")) {
+			return mimeType, nil
+		}
+	}
+	return mimeType, &PolicyError{Msg: fmt.Sprintf("不允许上传 %s 类型的文件", mimeType)}
+}
+
+// DetectMime 按文件内容识别 MIME 类型, 不带 charset 等参数
+func DetectMime(head []byte) string {
+	mimeType, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return mimeType
+}
+
+// InlineMime 浏览器可以直接安全展示的类型, 其它类型下载时一律作为附件
+func InlineMime(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp", "image/bmp",
+		"video/mp4", "video/webm", "audio/mpeg", "audio/wave", "application/ogg",
+		"application/pdf", "text/plain":
+		return true
+	}
+	return false
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<30 && size%(1<<30) == 0:
+		return fmt.Sprintf("%dGB", size>>30)
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", size)
+}
@@ -0,0 +1,151 @@
+// Copyright © 2023 Grain. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/go-grain/grain/config"
+	"io"
+	"testing"
+)
+
+func TestCheckFile(t *testing.T) {
+	policy := config.UploadPolicy{MaxSize: 1 << 20, ForbiddenExts: []string{".exe", "PHP"}}
+	cases := []struct {
+		name string
+		size int64
+		ok   bool
+	}{
+		{"a.png", 1 << 20, true},
+		{"a.png", 1<<20 + 1, false},
+		{"a.exe", 10, false},
+		{"a.php", 10, false},
+		{"a.tar.PHP", 10, false},
+		{"php", 10, true},
+	}
+	for _, c := range cases {
+		err := CheckFile(policy, c.name, c.size)
+		if (err == nil) != c.ok {
+			t.Errorf("CheckFile(%q, %d) = %v, want ok=%v", c.name, c.size, err, c.ok)
+		}
+		var pe *PolicyError
+		if err != nil && !errors.As(err, &pe) {
+			t.Errorf("CheckFile(%q) error %T is not *PolicyError", c.name, err)
+		}
+	}
+}
+
+func TestCheckContent(t *testing.T) {
+	png := encodePNG(t, 2, 2)
+	cases := []struct {
+		allowed []string
+		head    []byte
+		mime    string
+		ok      bool
+	}{
+		{nil, []byte("hello"), "text/plain", true},
+		{[]string{"image/*"}, png, "image/png", true},
+		{[]string{" Image/PNG "}, png, "image/png", true},
+		{[]string{"image/*"}, []byte("<html><body>"), "text/html", false},
+		{[]string{"image/jpeg"}, png, "image/png", false},
+	}
+	for _, c := range cases {
+		mimeType, err := CheckContent(config.UploadPolicy{AllowedMimes: c.allowed}, c.head)
+		if mimeType != c.mime || (err == nil) != c.ok {
+			t.Errorf("CheckContent(%v, %q) = %s, %v, want %s ok=%v", c.allowed, c.head[:5], mimeType, err, c.mime, c.ok)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	cases := map[int64]string{
+		512:       "512B",
+		1536:      "1.5KB",
+		5 << 20:   "5.0MB",
+		2 << 30:   "2GB",
+		3<<30 + 1: "3072.0MB",
+	}
+	for size, want := range cases {
+		if got := formatSize(size); got != want {
+			t.Errorf("formatSize(%d) = %s, want %s", size, got, want)
+		}
+	}
+}
+
+// memFile 满足 multipart.File 的内存文件
+type memFile struct {
+	*bytes.Reader
+	closed bool
+}
+
+func (f *memFile) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestOpenFile(t *testing.T) {
+	data := exifJPEG(t, 6)
+	f := &memFile{Reader: bytes.NewReader(data)}
+	file, err := openFile(f, "photo.JPG", int64(len(data)), config.UploadPolicy{AllowedMimes: []string{"image/*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	if file.Upload.Hash != hex.EncodeToString(sum[:]) || file.Upload.FileSize != int64(len(data)) {
+		t.Errorf("upload = %+v, want original hash and size", file.Upload)
+	}
+	if file.MimeType != "image/jpeg" {
+		t.Errorf("mime = %s", file.MimeType)
+	}
+	if err = file.Close(); err != nil || !f.closed {
+		t.Errorf("Close did not close the source")
+	}
+}
+
+func TestOpenFileReencode(t *testing.T) {
+	data := exifJPEG(t, 6)
+	f := &memFile{Reader: bytes.NewReader(data)}
+	file, err := openFile(f, "photo.jpg", int64(len(data)), config.UploadPolicy{Reencode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = file.src.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	if _, err = out.ReadFrom(file.src); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(out.Bytes(), []byte("Exif")) {
+		t.Error("re-encoded file still contains EXIF")
+	}
+	sum := sha256.Sum256(out.Bytes())
+	if file.Upload.Hash != hex.EncodeToString(sum[:]) || file.Upload.FileSize != int64(out.Len()) {
+		t.Errorf("hash and size do not describe the re-encoded content")
+	}
+}
+
+func TestOpenFileVariantsRequireImage(t *testing.T) {
+	data := []byte("not an image")
+	f := &memFile{Reader: bytes.NewReader(data)}
+	_, err := openFile(f, "a.png", int64(len(data)), config.UploadPolicy{Variants: []string{"thumb"}})
+	var pe *PolicyError
+	if !errors.As(err, &pe) {
+		t.Errorf("openFile = %v, want PolicyError", err)
+	}
+}
@@ -15,95 +15,194 @@
 package upload
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/go-grain/grain/config"
 	model "github.com/go-grain/grain/model/system"
-	filex "github.com/go-grain/grain/pkg/path"
-	randx "github.com/go-grain/grain/pkg/rand"
+	storagex "github.com/go-grain/grain/pkg/storage"
 	stringsx "github.com/go-grain/grain/pkg/strings"
+	"image"
 	"io"
-	"os"
-	"time"
+	"mime/multipart"
+	"strings"
 )
 
-func UploadFile(ctx *gin.Context, classify string) (*model.Upload, error) {
+// File 通过上传策略校验并且已经计算出 SHA-256, 等待写入存储的文件
+type File struct {
+	// Upload 的 Storage FileKey FileUrl 在 Save 之后才有值
+	Upload   *model.Upload
+	MimeType string
+	src      io.ReadSeeker
+	closer   io.Closer
+}
+
+// OpenFile 读取 multipart 中的 file 字段, 按 classify 对应的上传策略校验文件并计算 SHA-256,
+// 用完需要调用 Close
+func OpenFile(ctx *gin.Context, classify string) (*File, error) {
 	file, err := ctx.FormFile("file")
 	if err != nil {
 		return nil, err
 	}
-	src, err := file.Open()
+	policy := Policy(classify)
+	if err = CheckFile(policy, file.Filename, file.Size); err != nil {
+		return nil, err
+	}
+	f, err := file.Open()
 	if err != nil {
 		return nil, err
 	}
-	defer src.Close()
-
-	now := time.Now()
-	y := now.Year()
-	m := int(now.Month())
-	d := now.Day()
-	path := fmt.Sprintf("uploads/%s/%d/%d-%d/", classify, y, m, d)
-	filename := ""
-
-	e := stringsx.Ext(file.Filename)
-	if e == "" {
-		filename = path + randx.RandomCharset(5)
+	res, err := openFile(f, file.Filename, file.Size, policy)
+	if err != nil {
+		f.Close()
+		return nil, err
 	}
-	filename = path + randx.RandomCharset(5) + "." + e
+	return res, nil
+}
 
-	exist := filex.PathIsNotExist(path)
-	if exist {
-		err = os.MkdirAll(path, os.ModePerm)
-		if err != nil {
+func openFile(f multipart.File, filename string, size int64, policy config.UploadPolicy) (*File, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	mimeType, err := CheckContent(policy, head[:n])
+	if err != nil {
+		return nil, err
+	}
+	// 需要生成图片规格的文件必须是可以解码的图片
+	if len(policy.Variants) > 0 {
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
 			return nil, err
 		}
+		if _, _, err = image.DecodeConfig(f); err != nil {
+			return nil, &PolicyError{Msg: "图片解析失败"}
+		}
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
 	}
 
-	// 检测重名
-	if !filex.FileIsNotExist(filename) {
-		for { //慢慢找一个和本地文件名不重复的随机字符串做文件名
-			filename = path + randx.RandomCharset(5) + "." + e
-			if !filex.FileIsNotExist(filename) {
-				continue
-			} else {
-				break
-			}
+	var src io.ReadSeeker = f
+	if policy.Reencode {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return nil, err
 		}
+		data, _, err = Reencode(data, mimeType)
+		if err != nil {
+			return nil, err
+		}
+		src, size = bytes.NewReader(data), int64(len(data))
 	}
 
-	dst, err := os.Create(filename)
-	if err != nil {
+	hash := sha256.New()
+	if _, err = io.Copy(hash, src); err != nil {
 		return nil, err
 	}
-	defer dst.Close()
 
-	_, err = io.Copy(dst, src)
+	return &File{
+		Upload: &model.Upload{
+			FileName: filename,
+			FileType: FileType(filename, mimeType),
+			Hash:     hex.EncodeToString(hash.Sum(nil)),
+			FileSize: size,
+		},
+		MimeType: mimeType,
+		src:      src,
+		closer:   f,
+	}, nil
+}
+
+// Save 把文件写入存储驱动, 对象键由文件内容的 SHA-256 决定, 相同内容的文件只会保存一份
+func (f *File) Save(ctx context.Context, store storagex.Storage) error {
+	key := BlobKey(f.Upload.Hash)
+	_, err := store.Stat(ctx, key)
+	if errors.Is(err, storagex.ErrNotExist) {
+		if _, err = f.src.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		err = store.Put(ctx, key, f.src, f.Upload.FileSize, f.MimeType)
+	}
 	if err != nil {
-		return nil, err
+		return err
 	}
+	f.Upload.FileUrl = store.URL(key)
+	f.Upload.Storage = store.Name()
+	f.Upload.FileKey = key
+	return nil
+}
+
+func (f *File) Close() error {
+	return f.closer.Close()
+}
+
+// ChunkPrefix 分片上传的分片所在的目录, 分片是上传过程中的中间文件, 不能通过 uploads 路径访问
+const ChunkPrefix = "chunks/"
+
+// ChunkKey 分片的对象键 chunks/上传会话ID/分片序号
+func ChunkKey(uploadId string, index int) string {
+	return fmt.Sprintf("%s%s/%d", ChunkPrefix, uploadId, index)
+}
 
-	ext := stringsx.Ext(file.Filename)
-	fileType := ""
-	switch ext {
-	case ".jpg", ".jpeg", ".png":
-		fileType = "图片 "
-	case ".zip", ".gz", "7z":
-		fileType = "压缩包"
-	case ".mp4", ".mov", ".mkv", "flv", "mp3":
-		fileType = "音视频"
-	case ".go":
-		fileType = "Go文件"
-	case ".c":
-		fileType = "C文件"
-	case ".py":
-		fileType = "python文件"
-	default:
-		fileType = "NA"
+// MergedKey 合并分片时先写入的临时对象键 chunks/上传会话ID/merged, 校验通过后才移动到 BlobKey,
+// 和分片放在同一个目录, 客户端不能写入, 清理分片时一起删除
+func MergedKey(uploadId string) string {
+	return fmt.Sprintf("%s%s/merged", ChunkPrefix, uploadId)
+}
+
+// 按内容寻址的文件以及图片规格所在的目录
+const (
+	BlobPrefix    = "blobs/"
+	VariantPrefix = "variants/"
+)
+
+// BlobKey 按内容寻址的对象键 blobs/前两位/SHA-256, 不带扩展名,
+// 同样内容但扩展名不同的文件也只保存一份
+func BlobKey(hash string) string {
+	return fmt.Sprintf("%s%s/%s", BlobPrefix, hash[:2], hash)
+}
+
+// VariantKey 图片规格的对象键 variants/前两位/原图SHA-256/规格名称.扩展名
+func VariantKey(hash, preset, ext string) string {
+	return fmt.Sprintf("%s%s/%s/%s.%s", VariantPrefix, hash[:2], hash, preset, ext)
+}
+
+// Managed 对象键是否在上传服务管理的目录中, 这些文件必须有对应的记录才能访问
+func Managed(key string) bool {
+	return strings.HasPrefix(key, BlobPrefix) || strings.HasPrefix(key, VariantPrefix) || strings.HasPrefix(key, ChunkPrefix)
+}
+
+// FileType 根据识别出的 MIME 类型划分文件类型, 无法识别时再按扩展名划分
+func FileType(filename, mimeType string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return "图片"
+	case strings.HasPrefix(mimeType, "video/"), strings.HasPrefix(mimeType, "audio/"):
+		return "音视频"
+	}
+	switch mimeType {
+	case "application/zip", "application/x-gzip", "application/x-rar-compressed":
+		return "压缩包"
 	}
 
-	upload := &model.Upload{
-		FileName: file.Filename,
-		FileUrl:  filename,
-		FileType: fileType,
+	switch strings.ToLower(stringsx.Ext(filename)) {
+	case "jpg", "jpeg", "png", "gif", "webp":
+		return "图片"
+	case "zip", "gz", "7z", "rar":
+		return "压缩包"
+	case "mp4", "mov", "mkv", "flv", "mp3":
+		return "音视频"
+	case "go":
+		return "Go文件"
+	case "c":
+		return "C文件"
+	case "py":
+		return "python文件"
 	}
-	return upload, nil
+	return "NA"
 }